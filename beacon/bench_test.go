@@ -0,0 +1,63 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// benchDump generates a synthetic dump with 1M links.
+var benchDump = sync.OnceValue(func() string {
+	var b strings.Builder
+	for i := 0; i < 1_000_000; i++ {
+		fmt.Fprintf(&b, "%06x|http://example.com/%d\n", i, i)
+	}
+	return b.String()
+})
+
+func BenchmarkRead(b *testing.B) {
+	dump := benchDump()
+	b.SetBytes(int64(len(dump)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := NewURLTeamReader(strings.NewReader(dump), 6)
+		for {
+			_, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkReadInto(b *testing.B) {
+	dump := benchDump()
+	b.SetBytes(int64(len(dump)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := NewURLTeamReader(strings.NewReader(dump), 6)
+		var l Link
+		for {
+			err := r.ReadInto(&l)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/andrewarchi/archive"
+	"github.com/klauspost/compress/zstd"
+)
+
+// NewCompressedReader constructs a reader that reads RFC-format BEACON
+// link dumps, which are optionally compressed with gzip, bzip2, xz, or
+// zstd. Close must be called to release the decompressor.
+func NewCompressedReader(r io.Reader) (*Reader, error) {
+	return NewCompressedReaderOptions(r, nil)
+}
+
+// NewCompressedURLTeamReader constructs a reader that reads
+// URLTeam-format BEACON link dumps, which are optionally compressed with
+// gzip, bzip2, xz, or zstd. Close must be called to release the
+// decompressor.
+func NewCompressedURLTeamReader(r io.Reader, shortcodeLen int) (*Reader, error) {
+	return NewCompressedReaderOptions(r, &ReaderOptions{Format: URLTeam, ShortcodeLen: shortcodeLen})
+}
+
+// NewCompressedReaderOptions constructs a reader with the given options
+// that detects the compression of the link dump from its magic number.
+// Close must be called to release the decompressor.
+func NewCompressedReaderOptions(r io.Reader, opts *ReaderOptions) (*Reader, error) {
+	// Count compressed bytes for progress.
+	var counter *countingReader
+	if opts != nil && opts.Progress != nil {
+		counter = &countingReader{r: r}
+		r = counter
+	}
+	rc, err := Decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	br := newReader(rc, counter, opts)
+	br.closer = rc
+	return br, nil
+}
+
+// Decompress detects the compression of a stream from its magic number
+// and returns a reader that decompresses it. Streams with gzip, bzip2,
+// xz, or zstd compression are supported and other streams are returned
+// as is, unless they have the magic number of an unsupported format.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(6)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return io.NopCloser(bzip2.NewReader(br)), nil
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return archive.NewXZReader(br)
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	for _, f := range unsupportedFormats {
+		if bytes.HasPrefix(magic, f.magic) {
+			return nil, fmt.Errorf("beacon: unsupported compression format: %s", f.name)
+		}
+	}
+	return io.NopCloser(br), nil
+}
+
+var unsupportedFormats = []struct {
+	name  string
+	magic []byte
+}{
+	{"7z", []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}},
+	{"zip", []byte{'P', 'K', 0x03, 0x04}},
+	{"rar", []byte{'R', 'a', 'r', '!', 0x1a, 0x07}},
+	{"lz4", []byte{0x04, 0x22, 0x4d, 0x18}},
+}
+
+// GzipOptions contains options for writing gzip-compressed link dumps.
+type GzipOptions struct {
+	Format  Format    // RFC or URLTeam
+	Level   int       // compression level; 0 is gzip.NoCompression, not gzip.DefaultCompression
+	Name    string    // file name in the gzip header, if any
+	ModTime time.Time // modification time in the gzip header, if any
+}
+
+// NewGzipWriter constructs a writer that writes RFC-format BEACON link
+// dumps compressed with gzip at the given level. Close must be called
+// to finalize the gzip stream.
+func NewGzipWriter(w io.Writer, level int) (*Writer, error) {
+	return NewGzipWriterOptions(w, &GzipOptions{Level: level})
+}
+
+// NewGzipWriterOptions constructs a writer that writes link dumps
+// compressed with gzip, with the given options. Close must be called to
+// finalize the gzip stream.
+func NewGzipWriterOptions(w io.Writer, opts *GzipOptions) (*Writer, error) {
+	gz, err := gzip.NewWriterLevel(w, opts.Level)
+	if err != nil {
+		return nil, fmt.Errorf("beacon: %w", err)
+	}
+	gz.Name = opts.Name
+	gz.ModTime = opts.ModTime
+	return &Writer{w: bufio.NewWriter(gz), format: opts.Format, gz: gz}, nil
+}
+
+// Close releases the decompressor of a reader constructed with
+// NewCompressedReader. It does not close the underlying reader.
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNewCompressedReader(t *testing.T) {
+	const dump = "abc|http://example.com/\n"
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(dump))
+	gw.Close()
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zst := zw.EncodeAll([]byte(dump), nil)
+	bz2 := []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x78, 0x61,
+		0xec, 0x54, 0x00, 0x00, 0x03, 0x59, 0x80, 0x00, 0x10, 0x00, 0x01, 0x80,
+		0x10, 0x3a, 0x46, 0xc4, 0x44, 0x20, 0x00, 0x22, 0x81, 0xa7, 0x94, 0x61,
+		0xa8, 0x53, 0x00, 0x04, 0xd3, 0x23, 0xcd, 0xa8, 0x6a, 0x27, 0xb0, 0x11,
+		0xa1, 0x2a, 0x70, 0x96, 0xfe, 0x2e, 0xe4, 0x8a, 0x70, 0xa1, 0x20, 0xf0,
+		0xc3, 0xd8, 0xa8,
+	}
+	xz := []byte{
+		0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00, 0x00, 0x04, 0xe6, 0xd6, 0xb4, 0x46,
+		0x02, 0x00, 0x21, 0x01, 0x16, 0x00, 0x00, 0x00, 0x74, 0x2f, 0xe5, 0xa3,
+		0x01, 0x00, 0x17, 0x61, 0x62, 0x63, 0x7c, 0x68, 0x74, 0x74, 0x70, 0x3a,
+		0x2f, 0x2f, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f,
+		0x6d, 0x2f, 0x0a, 0x00, 0x96, 0xc7, 0x4b, 0x3b, 0x44, 0x63, 0x8c, 0xe6,
+		0x00, 0x01, 0x30, 0x18, 0x8e, 0x1b, 0xac, 0xec, 0x1f, 0xb6, 0xf3, 0x7d,
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x04, 0x59, 0x5a,
+	}
+	want := []Link{{"abc", "http://example.com/", ""}}
+	for _, b := range [][]byte{[]byte(dump), gz.Bytes(), bz2, xz, zst} {
+		r, err := NewCompressedURLTeamReader(iotest.OneByteReader(bytes.NewReader(b)), 3)
+		if err != nil {
+			t.Errorf("%x: %v", b[:2], err)
+			continue
+		}
+		links, err := r.ReadAll()
+		if err != nil {
+			t.Errorf("%x: %v", b[:2], err)
+		} else if !reflect.DeepEqual(links, want) {
+			t.Errorf("%x: got %q, want %q", b[:2], links, want)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%x: close: %v", b[:2], err)
+		}
+	}
+
+	sevenZip := []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c, 0x00, 0x04}
+	if _, err := NewCompressedReader(bytes.NewReader(sevenZip)); err == nil || !strings.Contains(err.Error(), "7z") {
+		t.Errorf("got error %v, want unsupported 7z", err)
+	}
+}
+
+func TestGzipWriter(t *testing.T) {
+	modTime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	var buf bytes.Buffer
+	w, err := NewGzipWriterOptions(&buf, &GzipOptions{Format: URLTeam, Level: gzip.BestCompression, Name: "dump.txt", ModTime: modTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Link{{"abc", "http://example.com/", ""}, {"xyz", "http://example.org/", ""}}
+	for _, link := range want {
+		if err := w.WriteLink(&link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if err := w.WriteLink(&want[0]); err != ErrWriterClosed {
+		t.Errorf("got error %v, want %v", err, ErrWriterClosed)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zr.Name != "dump.txt" || !zr.ModTime.Equal(modTime) {
+		t.Errorf("got header name %q, mod time %v", zr.Name, zr.ModTime)
+	}
+	r, err := NewCompressedURLTeamReader(&buf, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	links, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+
+	if _, err := NewGzipWriter(&buf, 42); err == nil {
+		t.Error("expected error for invalid level")
+	}
+}
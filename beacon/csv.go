@@ -0,0 +1,90 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// CSVWriter writes links as CSV records of source, target, and,
+// optionally, annotation. Output is buffered, so Flush must be called
+// after the last link is written.
+type CSVWriter struct {
+	// Comma is the field delimiter. It is ',' by default and can be set
+	// to '\t' for TSV output before the first link is written.
+	Comma rune
+
+	w          *csv.Writer
+	annotation bool
+}
+
+// NewCSVWriter constructs a writer that writes links as CSV. When
+// includeAnnotation is not set, annotations are omitted.
+func NewCSVWriter(w io.Writer, includeAnnotation bool) *CSVWriter {
+	return &CSVWriter{Comma: ',', w: csv.NewWriter(w), annotation: includeAnnotation}
+}
+
+// WriteLink writes a link as a CSV record.
+func (w *CSVWriter) WriteLink(l *Link) error {
+	w.w.Comma = w.Comma
+	record := []string{l.Source, l.Target}
+	if w.annotation {
+		record = append(record, l.Annotation)
+	}
+	if err := w.w.Write(record); err != nil {
+		return fmt.Errorf("beacon: %w", err)
+	}
+	return nil
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (w *CSVWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// CSVReader reads links from CSV records written by CSVWriter.
+type CSVReader struct {
+	// Comma is the field delimiter. It is ',' by default and can be set
+	// to '\t' for TSV input before the first link is read.
+	Comma rune
+
+	r          *csv.Reader
+	annotation bool
+}
+
+// NewCSVReader constructs a reader that reads links from CSV. Records
+// must have 3 fields when includeAnnotation is set and 2 otherwise.
+func NewCSVReader(r io.Reader, includeAnnotation bool) *CSVReader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	if includeAnnotation {
+		cr.FieldsPerRecord = 3
+	}
+	cr.ReuseRecord = true
+	return &CSVReader{Comma: ',', r: cr, annotation: includeAnnotation}
+}
+
+// Read reads the next link. Errors include the line number of the
+// record.
+func (r *CSVReader) Read() (*Link, error) {
+	r.r.Comma = r.Comma
+	record, err := r.r.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("beacon: %w", err)
+	}
+	link := &Link{Source: record[0], Target: record[1]}
+	if r.annotation {
+		link.Annotation = record[2]
+	}
+	return link, nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	links := []Link{
+		{"abc", "http://example.com/", ""},
+		{"abd", "http://example.com/?a=1,2", "3"},
+		{"abe", `http://example.com/"quoted"`, "a\tb"},
+		{"abf", "http://example.com/a\nb", ""},
+	}
+	tests := []struct {
+		annotation bool
+		comma      rune
+		want       string
+	}{
+		{false, ',', "abc,http://example.com/\nabd,\"http://example.com/?a=1,2\"\nabe,\"http://example.com/\"\"quoted\"\"\"\nabf,\"http://example.com/a\nb\"\n"},
+		{true, ',', "abc,http://example.com/,\nabd,\"http://example.com/?a=1,2\",3\nabe,\"http://example.com/\"\"quoted\"\"\",a\tb\nabf,\"http://example.com/a\nb\",\n"},
+		{true, '\t', "abc\thttp://example.com/\t\nabd\thttp://example.com/?a=1,2\t3\nabe\t\"http://example.com/\"\"quoted\"\"\"\t\"a\tb\"\nabf\t\"http://example.com/a\nb\"\t\n"},
+	}
+	for i, tt := range tests {
+		var b strings.Builder
+		w := NewCSVWriter(&b, tt.annotation)
+		w.Comma = tt.comma
+		for _, l := range links {
+			if err := w.WriteLink(&l); err != nil {
+				t.Fatalf("#%d: %v", i, err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("#%d: got %q, want %q", i, got, tt.want)
+		}
+
+		r := NewCSVReader(strings.NewReader(b.String()), tt.annotation)
+		r.Comma = tt.comma
+		var got []Link
+		for {
+			link, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("#%d: %v", i, err)
+			}
+			got = append(got, *link)
+		}
+		want := links
+		if !tt.annotation {
+			want = make([]Link, len(links))
+			for j, l := range links {
+				want[j] = Link{l.Source, l.Target, ""}
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("#%d: round trip got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestCSVReaderFieldCount(t *testing.T) {
+	r := NewCSVReader(strings.NewReader("abc,http://example.com/\nabd,http://example.com/,x\n"), false)
+	if _, err := r.Read(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := r.Read()
+	var perr *csv.ParseError
+	if !errors.As(err, &perr) || perr.Line != 2 || !errors.Is(err, csv.ErrFieldCount) {
+		t.Errorf("got error %v, want field count error on line 2", err)
+	}
+}
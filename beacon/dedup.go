@@ -0,0 +1,80 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+// LinkReader is the interface implemented by readers of link streams,
+// such as Reader, MultiReader, and DedupReader.
+type LinkReader interface {
+	// Read reads the next link or returns io.EOF at the end.
+	Read() (*Link, error)
+}
+
+// Seen is a set of keys used by DedupReader. It can be implemented with
+// a bloom filter or an on-disk set for streams too large for a map.
+type Seen interface {
+	// Add adds key to the set and reports whether it was not already
+	// present.
+	Add(key string) bool
+}
+
+// DedupReader reads links from another reader and skips links with a
+// source and target that have already been read.
+type DedupReader struct {
+	inner   LinkReader
+	seen    Seen
+	total   int64
+	dropped int64
+}
+
+// NewDedupReader constructs a reader that drops duplicate links from
+// inner, tracked with a map.
+func NewDedupReader(inner LinkReader) *DedupReader {
+	return NewDedupReaderSeen(inner, make(mapSeen))
+}
+
+// NewDedupReaderSeen constructs a reader that drops duplicate links from
+// inner, tracked with the given set.
+func NewDedupReaderSeen(inner LinkReader, seen Seen) *DedupReader {
+	return &DedupReader{inner: inner, seen: seen}
+}
+
+// Read reads the next link that has not been read before.
+func (d *DedupReader) Read() (*Link, error) {
+	for {
+		link, err := d.inner.Read()
+		if err != nil {
+			return nil, err
+		}
+		d.total++
+		// Sources cannot contain a bar, so the key is unambiguous.
+		if d.seen.Add(link.Source + "|" + link.Target) {
+			return link, nil
+		}
+		d.dropped++
+	}
+}
+
+// Total returns the number of links read from the inner reader,
+// including duplicates.
+func (d *DedupReader) Total() int64 {
+	return d.total
+}
+
+// Dropped returns the number of duplicate links skipped.
+func (d *DedupReader) Dropped() int64 {
+	return d.dropped
+}
+
+type mapSeen map[string]struct{}
+
+func (m mapSeen) Add(key string) bool {
+	if _, ok := m[key]; ok {
+		return false
+	}
+	m[key] = struct{}{}
+	return true
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDedupReader(t *testing.T) {
+	const dump = "abc|http://example.com/\nabd|http://example.com/\nabc|http://example.com/\nabc|http://example.org/\nabd|http://example.com/\n"
+	want := []Link{
+		{"abc", "http://example.com/", ""},
+		{"abd", "http://example.com/", ""},
+		{"abc", "http://example.org/", ""},
+	}
+	d := NewDedupReader(NewURLTeamReader(strings.NewReader(dump), 3))
+	var links []Link
+	for {
+		link, err := d.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		links = append(links, *link)
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+	if d.Total() != 5 || d.Dropped() != 2 {
+		t.Errorf("got %d total and %d dropped, want 5 and 2", d.Total(), d.Dropped())
+	}
+}
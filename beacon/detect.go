@@ -0,0 +1,88 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"golang.org/x/text/transform"
+)
+
+// detectSampleLen is the number of bytes sampled by DetectFormat.
+const detectSampleLen = 4096
+
+// DetectFormat guesses the format of a link dump from its first few
+// kilobytes without consuming any input. A dump starting with a meta
+// line, such as #FORMAT or #PREFIX, is RFC format. A headerless dump
+// with bars is URLTeam format and, when the bar is at the same column
+// on every sampled line, the shortcode length is that column;
+// otherwise, it is 0 for variable length. A dump without any bars is
+// RFC format.
+func DetectFormat(r *bufio.Reader) (Format, int, error) {
+	sample, err := r.Peek(min(detectSampleLen, r.Size()))
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return RFC, 0, err
+	}
+	atEOF := err == io.EOF
+	if len(sample) >= 2 {
+		if e, ok := utf16Encoding(sample); ok {
+			// An odd trailing byte is decoded as U+FFFD.
+			sample, _, _ = transform.Bytes(e.NewDecoder(), sample)
+		}
+	}
+	sample = bytes.TrimPrefix(sample, []byte("\uFEFF"))
+	if len(sample) == 0 || sample[0] == '#' {
+		return RFC, 0, nil
+	}
+	if !atEOF {
+		// Drop the last line, which may be truncated.
+		if i := bytes.LastIndexByte(sample, '\n'); i != -1 {
+			sample = sample[:i+1]
+		}
+	}
+	col, lines := -1, 0
+	for len(sample) != 0 {
+		line := sample
+		if i := bytes.IndexByte(sample, '\n'); i != -1 {
+			line, sample = sample[:i], sample[i+1:]
+		} else {
+			sample = nil
+		}
+		i := bytes.IndexByte(line, '|')
+		if i == -1 {
+			// Blank lines or continuations of multi-line targets
+			continue
+		}
+		if lines == 0 {
+			col = i
+		} else if i != col {
+			col = 0
+		}
+		lines++
+	}
+	switch {
+	case lines == 0:
+		return RFC, 0, nil
+	case lines == 1:
+		// A single line is not enough to tell a fixed length.
+		return URLTeam, 0, nil
+	}
+	return URLTeam, col, nil
+}
+
+// NewAutoReader constructs a reader with the format and shortcode
+// length detected by DetectFormat.
+func NewAutoReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	format, shortcodeLen, err := DetectFormat(br)
+	if err != nil {
+		return nil, err
+	}
+	return NewReaderOptions(br, &ReaderOptions{Format: format, ShortcodeLen: shortcodeLen}), nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		dump         string
+		format       Format
+		shortcodeLen int
+	}{
+		{"", RFC, 0},
+		{"#FORMAT: BEACON\n\nfoo|bar\n", RFC, 0},
+		{"\uFEFF#PREFIX: http://example.org/\n\nfoo\n", RFC, 0},
+		{"foo\nbar\n", RFC, 0},
+		{"abc|http://example.com/\nxyz|http://example.org/a|b\n", URLTeam, 3},
+		{"\uFEFFabc|http://example.com/\nxyz|http://example.org/\n", URLTeam, 3},
+		{"abc|http://example.com/a\nb\n\nxyz|http://example.org/\n", URLTeam, 3},
+		{"abc|http://example.com/\nabcd|http://example.org/\n", URLTeam, 0},
+		{"abc|http://example.com/\n", URLTeam, 0},
+		// The truncated last line of the sample is ignored.
+		{"abc|http://example.com/\nxyz|http://example.org/\n" + strings.Repeat("x", 4096), URLTeam, 3},
+	}
+	for i, tt := range tests {
+		format, shortcodeLen, err := DetectFormat(bufio.NewReader(strings.NewReader(tt.dump)))
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if format != tt.format || shortcodeLen != tt.shortcodeLen {
+			t.Errorf("#%d: got format %d with shortcode length %d, want %d with %d",
+				i, format, shortcodeLen, tt.format, tt.shortcodeLen)
+		}
+	}
+}
+
+func TestNewAutoReader(t *testing.T) {
+	tests := []struct {
+		dump  string
+		links []Link
+	}{
+		{"\uFEFF#FORMAT: BEACON\n\nfoo|http://example.com/\n", []Link{{"foo", "http://example.com/", ""}}},
+		{"\uFEFFabc|http://example.com/a\nb\nxyz|http://example.org/\n", []Link{
+			{"abc", "http://example.com/a\nb", ""},
+			{"xyz", "http://example.org/", ""},
+		}},
+	}
+	for i, tt := range tests {
+		r, err := NewAutoReader(strings.NewReader(tt.dump))
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		links, err := r.ReadAll()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+		} else if !reflect.DeepEqual(links, tt.links) {
+			t.Errorf("#%d: got %q, want %q", i, links, tt.links)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// DiffResult contains the changes between two link dumps, ordered by
+// source.
+type DiffResult struct {
+	Added      []Link     // links only in the new dump
+	Removed    []Link     // links only in the old dump
+	Retargeted []Retarget // sources with a different target
+}
+
+// Retarget is a source that has a different target in the new dump.
+type Retarget struct {
+	Old, New Link
+}
+
+// Diff compares two link dumps. When a source has exactly one link that
+// was removed and one that was added, it is reported as retargeted,
+// rather than as a removal and an addition. Links are otherwise compared
+// by source and target and duplicates are counted.
+//
+// When sorted is set, both dumps must be sorted by source and are
+// compared in a single streaming pass. Otherwise, both dumps are read
+// into memory.
+func Diff(old, new *Reader, sorted bool) (*DiffResult, error) {
+	var res DiffResult
+	if !sorted {
+		oldLinks, err := groupBySource(old)
+		if err != nil {
+			return nil, err
+		}
+		newLinks, err := groupBySource(new)
+		if err != nil {
+			return nil, err
+		}
+		sources := make([]string, 0, len(oldLinks)+len(newLinks))
+		for source := range oldLinks {
+			sources = append(sources, source)
+		}
+		for source := range newLinks {
+			if _, ok := oldLinks[source]; !ok {
+				sources = append(sources, source)
+			}
+		}
+		slices.Sort(sources)
+		for _, source := range sources {
+			res.diffSource(oldLinks[source], newLinks[source])
+		}
+		return &res, nil
+	}
+
+	o, n := &diffInput{r: old, name: "old"}, &diffInput{r: new, name: "new"}
+	if err := o.advance(); err != nil {
+		return nil, err
+	}
+	if err := n.advance(); err != nil {
+		return nil, err
+	}
+	for o.next != nil || n.next != nil {
+		var oldLinks, newLinks []Link
+		var err error
+		switch {
+		case n.next == nil || o.next != nil && o.next.Source < n.next.Source:
+			oldLinks, err = o.group()
+		case o.next == nil || n.next.Source < o.next.Source:
+			newLinks, err = n.group()
+		default:
+			if oldLinks, err = o.group(); err == nil {
+				newLinks, err = n.group()
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.diffSource(oldLinks, newLinks)
+	}
+	return &res, nil
+}
+
+// diffSource compares the links for a single source.
+func (res *DiffResult) diffSource(oldLinks, newLinks []Link) {
+	counts := make(map[string]int, len(oldLinks))
+	for _, l := range oldLinks {
+		counts[l.Target]++
+	}
+	var added []Link
+	for _, l := range newLinks {
+		if counts[l.Target] > 0 {
+			counts[l.Target]--
+		} else {
+			added = append(added, l)
+		}
+	}
+	var removed []Link
+	for _, l := range oldLinks {
+		if counts[l.Target] > 0 {
+			counts[l.Target]--
+			removed = append(removed, l)
+		}
+	}
+	if len(removed) == 1 && len(added) == 1 {
+		res.Retargeted = append(res.Retargeted, Retarget{removed[0], added[0]})
+		return
+	}
+	res.Removed = append(res.Removed, removed...)
+	res.Added = append(res.Added, added...)
+}
+
+func groupBySource(r *Reader) (map[string][]Link, error) {
+	links := make(map[string][]Link)
+	for {
+		link, err := r.Read()
+		if err == io.EOF {
+			return links, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		links[link.Source] = append(links[link.Source], *link)
+	}
+}
+
+// diffInput reads runs of links with the same source from a sorted
+// dump.
+type diffInput struct {
+	r    *Reader
+	name string
+	next *Link
+}
+
+// advance reads the next link and checks that the dump is sorted.
+func (in *diffInput) advance() error {
+	prev := in.next
+	link, err := in.r.Read()
+	if err == io.EOF {
+		in.next = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if prev != nil && link.Source < prev.Source {
+		return fmt.Errorf("beacon: %s dump not sorted: %q after %q", in.name, link.Source, prev.Source)
+	}
+	in.next = link
+	return nil
+}
+
+// group returns the links with the same source as the next link.
+func (in *diffInput) group() ([]Link, error) {
+	source := in.next.Source
+	var links []Link
+	for in.next != nil && in.next.Source == source {
+		links = append(links, *in.next)
+		if err := in.advance(); err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	const old = "aaa|http://example.com/a\n" +
+		"bbb|http://example.com/b\n" +
+		"ccc|http://example.com/c\n" +
+		"ddd|http://example.com/d1\n" +
+		"ddd|http://example.com/d2\n" +
+		"fff|http://example.com/f\n"
+	const new = "aaa|http://example.com/a\n" +
+		"ccc|http://example.com/c2\n" +
+		"ddd|http://example.com/d2\n" +
+		"ddd|http://example.com/d3\n" +
+		"eee|http://example.com/e\n" +
+		"fff|http://example.com/f\n" +
+		"fff|http://example.com/f\n"
+	want := &DiffResult{
+		Added: []Link{
+			{"eee", "http://example.com/e", ""},
+			{"fff", "http://example.com/f", ""},
+		},
+		Removed: []Link{
+			{"bbb", "http://example.com/b", ""},
+		},
+		Retargeted: []Retarget{
+			{Link{"ccc", "http://example.com/c", ""}, Link{"ccc", "http://example.com/c2", ""}},
+			{Link{"ddd", "http://example.com/d1", ""}, Link{"ddd", "http://example.com/d3", ""}},
+		},
+	}
+	for _, sorted := range []bool{true, false} {
+		got, err := Diff(NewURLTeamReader(strings.NewReader(old), 3), NewURLTeamReader(strings.NewReader(new), 3), sorted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("sorted %t: got %+v, want %+v", sorted, got, want)
+		}
+	}
+}
+
+func TestDiffUnsorted(t *testing.T) {
+	old := NewURLTeamReader(strings.NewReader("bbb|http://example.com/b\naaa|http://example.com/a\n"), 3)
+	new := NewURLTeamReader(strings.NewReader("aaa|http://example.com/a\n"), 3)
+	if _, err := Diff(old, new, true); err == nil || !strings.Contains(err.Error(), "not sorted") {
+		t.Errorf("got error %v, want not sorted", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SyntaxError reports a line in a link dump that fails to parse. Errors
+// returned by Reader wrap it, so it can be retrieved with errors.As.
+type SyntaxError struct {
+	Line   int        // line number
+	Column int        // byte column, starting at 1, or 0 when unknown
+	Kind   SyntaxKind // kind of error
+	Text   string     // raw line, truncated to 100 bytes
+	Err    error      // underlying error, if any
+	msg    string
+}
+
+func (e *SyntaxError) Error() string { return e.msg }
+
+func (e *SyntaxError) Unwrap() error { return e.Err }
+
+// SyntaxKind classifies a SyntaxError.
+type SyntaxKind uint8
+
+const (
+	InvalidMetaChar    SyntaxKind = iota + 1 // invalid character in meta field name
+	MissingMetaValue                         // meta line without a value
+	UnknownMetaField                         // unknown meta field in strict mode
+	DuplicateMetaField                       // duplicate meta field in strict mode
+	InvalidFormat                            // FORMAT other than BEACON in strict mode or missing with RequireFormat
+	EmptySource                              // link with empty source in strict mode
+	InvalidURL                               // invalid URL after template expansion in strict mode or with ValidateURLs
+	MissingBar                               // URLTeam link line without a bar
+	WrongShortcodeLen                        // URLTeam shortcode not of the fixed length
+	DisallowedScheme                         // URL scheme not allowed by ValidateURLs
+	ControlChar                              // control character in a URL with ValidateURLs
+	InvalidSource                            // source not matching SourcePattern
+)
+
+var syntaxKindNames = [...]string{
+	InvalidMetaChar:    "invalid meta character",
+	MissingMetaValue:   "missing meta value",
+	UnknownMetaField:   "unknown meta field",
+	DuplicateMetaField: "duplicate meta field",
+	InvalidFormat:      "invalid format",
+	EmptySource:        "empty source",
+	InvalidURL:         "invalid URL",
+	MissingBar:         "missing bar",
+	WrongShortcodeLen:  "wrong shortcode length",
+	DisallowedScheme:   "disallowed scheme",
+	ControlChar:        "control character",
+	InvalidSource:      "invalid source",
+}
+
+func (k SyntaxKind) String() string {
+	if int(k) < len(syntaxKindNames) && syntaxKindNames[k] != "" {
+		return syntaxKindNames[k]
+	}
+	return fmt.Sprintf("SyntaxKind(%d)", k)
+}
+
+// isURLError reports whether err is from validating the URLs of a link.
+func isURLError(err error) bool {
+	var serr *SyntaxError
+	if !errors.As(err, &serr) {
+		return false
+	}
+	switch serr.Kind {
+	case InvalidURL, DisallowedScheme, ControlChar:
+		return true
+	}
+	return false
+}
+
+// maxErrorText is the maximum length of raw line text retained in
+// errors.
+const maxErrorText = 100
+
+// syntaxError constructs a *SyntaxError. The line and text are filled
+// in by the reader.
+func syntaxError(kind SyntaxKind, column int, format string, args ...any) *SyntaxError {
+	return &SyntaxError{Kind: kind, Column: column, msg: fmt.Sprintf(format, args...)}
+}
+
+// setPosition fills in the line and text of a *SyntaxError in err, when
+// not already set.
+func setPosition(err error, line int, text string) {
+	var serr *SyntaxError
+	if errors.As(err, &serr) && serr.Line == 0 {
+		serr.Line = line
+		serr.Text = text[:min(len(text), maxErrorText)]
+	}
+}
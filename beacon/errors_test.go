@@ -0,0 +1,51 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		dump   string
+		opts   ReaderOptions
+		line   int
+		column int
+		kind   SyntaxKind
+		text   string
+		prefix string
+	}{
+		{"#FORMAT: BEACON\n#Foo: bar\n", ReaderOptions{}, 2, 3, InvalidMetaChar, "#Foo: bar\n", "beacon: line 2, offset 16: "},
+		{"#FORMAT\n", ReaderOptions{}, 1, 0, MissingMetaValue, "#FORMAT\n", "beacon: line 1, offset 0: "},
+		{"#FOO: bar\n", ReaderOptions{Strict: true}, 1, 2, UnknownMetaField, "#FOO: bar\n", "beacon: line 1, offset 0: "},
+		{"#NAME: a\n#NAME: b\n", ReaderOptions{Strict: true}, 2, 2, DuplicateMetaField, "#NAME: b\n", "beacon: line 2, offset 9: "},
+		{"#FORMAT: foo\n", ReaderOptions{Strict: true}, 1, 0, InvalidFormat, "#FORMAT: foo\n", "beacon: line 1, offset 0: "},
+		{"|foo\n", ReaderOptions{Strict: true}, 1, 1, EmptySource, "|foo\n", "beacon: line 1, offset 0: "},
+		{"abcd\nabc|x\n", ReaderOptions{Format: URLTeam, ShortcodeLen: 3}, 1, 0, MissingBar, "abcd\n", "beacon: line 1, offset 0: "},
+		{"abcd|x\n", ReaderOptions{Format: URLTeam, ShortcodeLen: 3}, 1, 5, WrongShortcodeLen, "abcd|x\n", "beacon: line 1, offset 0: "},
+		{"a" + strings.Repeat("b", 200) + "\n", ReaderOptions{Format: URLTeam}, 1, 0, MissingBar, "a" + strings.Repeat("b", 99), "beacon: line 1, offset 0: "},
+	}
+	for i, tt := range tests {
+		r := NewReaderOptions(strings.NewReader(tt.dump), &tt.opts)
+		_, err := r.ReadAll()
+		var serr *SyntaxError
+		if !errors.As(err, &serr) {
+			t.Errorf("#%d: got error %v, want *SyntaxError", i, err)
+			continue
+		}
+		if serr.Line != tt.line || serr.Column != tt.column || serr.Kind != tt.kind || serr.Text != tt.text {
+			t.Errorf("#%d: got %d:%d %v %q, want %d:%d %v %q", i,
+				serr.Line, serr.Column, serr.Kind, serr.Text, tt.line, tt.column, tt.kind, tt.text)
+		}
+		if !strings.HasPrefix(err.Error(), tt.prefix) {
+			t.Errorf("#%d: got error %q, want prefix %q", i, err, tt.prefix)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+func ExampleReader_Links() {
+	dump := `#FORMAT: BEACON
+#PREFIX: http://example.org/
+
+foo|http://example.com/foo
+bar|http://example.com/bar
+baz|http://example.com/baz
+`
+	r := beacon.NewReader(strings.NewReader(dump))
+	for link, err := range r.Links() {
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(link.Source, link.Target)
+		if link.Source == "bar" {
+			break
+		}
+	}
+	// Reading resumes after the last link yielded.
+	link, err := r.Read()
+	fmt.Println(link, err)
+	// Output:
+	// foo http://example.com/foo
+	// bar http://example.com/bar
+	// baz|http://example.com/baz <nil>
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// FilterReader reads the links from another reader that match a
+// predicate.
+type FilterReader struct {
+	inner LinkReader
+	keep  func(*Link) bool
+}
+
+// NewFilterReader constructs a reader that reads the links from inner
+// for which keep returns true.
+func NewFilterReader(inner LinkReader, keep func(*Link) bool) *FilterReader {
+	return &FilterReader{inner: inner, keep: keep}
+}
+
+// Read reads the next matching link. Errors from the inner reader,
+// including io.EOF, are returned unchanged.
+func (f *FilterReader) Read() (*Link, error) {
+	for {
+		link, err := f.inner.Read()
+		if err != nil {
+			return link, err
+		}
+		if f.keep(link) {
+			return link, nil
+		}
+	}
+}
+
+// FilterByTargetHost returns a predicate matching links with a target
+// URL on any of the hosts or their subdomains. Hosts are compared
+// case-insensitively.
+func FilterByTargetHost(hosts ...string) func(*Link) bool {
+	lower := make([]string, len(hosts))
+	for i, h := range hosts {
+		lower[i] = strings.TrimSuffix(strings.ToLower(h), ".")
+	}
+	return func(l *Link) bool {
+		u, err := url.Parse(l.Target)
+		if err != nil {
+			return false
+		}
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+		for _, h := range lower {
+			if host == h || strings.HasSuffix(host, "."+h) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterBySourcePattern returns a predicate matching links with a
+// source matched by re.
+func FilterBySourcePattern(re *regexp.Regexp) func(*Link) bool {
+	return func(l *Link) bool {
+		return re.MatchString(l.Source)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFilterReader(t *testing.T) {
+	const dump = "abcde|https://www.YouTube.com/watch?v=1\n" +
+		"abcd|https://youtube.com/watch?v=2\n" +
+		"abcdf|https://notyoutube.com/\n" +
+		"ABCDE|https://youtu.be/3\n" +
+		"abcdg|http://[::1\n" +
+		"abcdh|https://YOUTUBE.COM./\n"
+	tests := []struct {
+		keep    func(*Link) bool
+		sources []string
+	}{
+		{FilterByTargetHost("youtube.com", "youtu.be"), []string{"abcde", "abcd", "ABCDE", "abcdh"}},
+		{FilterBySourcePattern(regexp.MustCompile(`^[a-z]{5}$`)), []string{"abcde", "abcdf", "abcdg", "abcdh"}},
+	}
+	for i, tt := range tests {
+		f := NewFilterReader(NewURLTeamReader(strings.NewReader(dump), 0), tt.keep)
+		var sources []string
+		for {
+			link, err := f.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("#%d: %v", i, err)
+			}
+			sources = append(sources, link.Source)
+		}
+		if !reflect.DeepEqual(sources, tt.sources) {
+			t.Errorf("#%d: got %q, want %q", i, sources, tt.sources)
+		}
+	}
+
+	f := NewFilterReader(NewReaderOptions(strings.NewReader("|x\n"), &ReaderOptions{Strict: true}), func(*Link) bool { return true })
+	if _, err := f.Read(); err == nil || err == io.EOF {
+		t.Errorf("got error %v, want parse error", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Header contains the meta fields of a link dump, as defined in section
+// 4. Unset fields are zero.
+type Header struct {
+	Format      string    // FORMAT, "BEACON" for the current version
+	Prefix      string    // PREFIX URI pattern
+	Target      string    // TARGET URI pattern
+	Message     string    // MESSAGE template for link labels
+	Relation    *url.URL  // RELATION link type
+	Annotation  *url.URL  // ANNOTATION meaning
+	Description string    // DESCRIPTION
+	Creator     string    // CREATOR name or URI
+	Contact     string    // CONTACT email address
+	Homepage    *url.URL  // HOMEPAGE
+	Feed        *url.URL  // FEED of the link dump
+	Timestamp   time.Time // TIMESTAMP of the last modification
+	Update      string    // UPDATE frequency, e.g. "daily"
+	SourceSet   *url.URL  // SOURCESET
+	TargetSet   *url.URL  // TARGETSET
+	Name        string    // NAME of the target dataset
+	Institution string    // INSTITUTION of the target dataset
+	Extra       []MetaField
+}
+
+// Header parses the meta fields in the header into a Header.
+func (r *Reader) Header() (*Header, error) {
+	meta, err := r.Meta()
+	if err != nil {
+		return nil, err
+	}
+	return ParseHeader(meta, r.opts.Strict)
+}
+
+// ParseHeader parses meta fields into a Header. Unknown fields are
+// collected in Extra. When strict is set, a field occurring more than
+// once or a FORMAT other than "BEACON" is an error; otherwise, the last
+// occurrence is used and the FORMAT value is recorded as is, for
+// versions that may be defined later.
+func ParseHeader(meta []MetaField, strict bool) (*Header, error) {
+	var h Header
+	seen := make(map[string]struct{}, len(meta))
+	for _, m := range meta {
+		var err error
+		switch m.Name {
+		case "FORMAT":
+			h.Format = m.Value
+			if strict && m.Value != "BEACON" {
+				err = fmt.Errorf("unsupported format %q", m.Value)
+			}
+		case "PREFIX":
+			h.Prefix = m.Value
+		case "TARGET":
+			h.Target = m.Value
+		case "MESSAGE":
+			h.Message = m.Value
+		case "RELATION":
+			h.Relation, err = url.Parse(m.Value)
+		case "ANNOTATION":
+			h.Annotation, err = url.Parse(m.Value)
+		case "DESCRIPTION":
+			h.Description = m.Value
+		case "CREATOR":
+			h.Creator = m.Value
+		case "CONTACT":
+			h.Contact = m.Value
+		case "HOMEPAGE":
+			h.Homepage, err = url.Parse(m.Value)
+		case "FEED":
+			h.Feed, err = url.Parse(m.Value)
+		case "TIMESTAMP":
+			h.Timestamp, err = parseTimestamp(m.Value)
+		case "UPDATE":
+			switch m.Value {
+			case "always", "hourly", "daily", "weekly", "monthly", "yearly", "never":
+				h.Update = m.Value
+			default:
+				err = fmt.Errorf("invalid update frequency %q", m.Value)
+			}
+		case "SOURCESET":
+			h.SourceSet, err = url.Parse(m.Value)
+		case "TARGETSET":
+			h.TargetSet, err = url.Parse(m.Value)
+		case "NAME":
+			h.Name = m.Value
+		case "INSTITUTION":
+			h.Institution = m.Value
+		default:
+			h.Extra = append(h.Extra, m)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("beacon: meta field %s: %w", m.Name, err)
+		}
+		if _, ok := seen[m.Name]; ok && strict {
+			return nil, fmt.Errorf("beacon: duplicate meta field %s", m.Name)
+		}
+		seen[m.Name] = struct{}{}
+	}
+	return &h, nil
+}
+
+// isKnownMeta reports whether name is a meta field defined in section
+// 4.
+func isKnownMeta(name string) bool {
+	switch name {
+	case "FORMAT", "PREFIX", "TARGET", "MESSAGE", "RELATION", "ANNOTATION",
+		"DESCRIPTION", "CREATOR", "CONTACT", "HOMEPAGE", "FEED", "TIMESTAMP",
+		"UPDATE", "SOURCESET", "TARGETSET", "NAME", "INSTITUTION":
+		return true
+	}
+	return false
+}
+
+// parseTimestamp parses a timestamp in RFC 3339 format, with or without
+// the time.
+func parseTimestamp(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeader(t *testing.T) {
+	dump := `#FORMAT: BEACON
+#PREFIX: http://example.org/
+#TARGET: http://example.com/{ID}
+#HOMEPAGE: http://example.net/
+#TIMESTAMP: 2021-04-09T21:12:00Z
+#UPDATE: daily
+#NAME: Example
+#NAME: Example 2
+#CUSTOM: foo
+
+`
+	h, err := NewReader(strings.NewReader(dump)).Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Format != "BEACON" || h.Prefix != "http://example.org/" || h.Target != "http://example.com/{ID}" {
+		t.Errorf("got format %q, prefix %q, target %q", h.Format, h.Prefix, h.Target)
+	}
+	if h.Homepage == nil || h.Homepage.Host != "example.net" {
+		t.Errorf("got homepage %v", h.Homepage)
+	}
+	if want := time.Date(2021, 4, 9, 21, 12, 0, 0, time.UTC); !h.Timestamp.Equal(want) {
+		t.Errorf("got timestamp %v, want %v", h.Timestamp, want)
+	}
+	if h.Update != "daily" || h.Name != "Example 2" {
+		t.Errorf("got update %q, name %q", h.Update, h.Name)
+	}
+	if len(h.Extra) != 1 || h.Extra[0] != (MetaField{"CUSTOM", "foo"}) {
+		t.Errorf("got extra %v", h.Extra)
+	}
+}
+
+func TestParseHeaderErrors(t *testing.T) {
+	tests := []struct {
+		meta   []MetaField
+		strict bool
+	}{
+		{[]MetaField{{"UPDATE", "sometimes"}}, false},
+		{[]MetaField{{"TIMESTAMP", "yesterday"}}, false},
+		{[]MetaField{{"HOMEPAGE", "http://[::1"}}, false},
+		{[]MetaField{{"NAME", "a"}, {"NAME", "b"}}, true},
+		{[]MetaField{{"FORMAT", "BEACON 2"}}, true},
+	}
+	for i, tt := range tests {
+		if _, err := ParseHeader(tt.meta, tt.strict); err == nil {
+			t.Errorf("#%d: ParseHeader(%v) got no error", i, tt.meta)
+		}
+	}
+}
+
+func TestHeaderFormat(t *testing.T) {
+	h, err := ParseHeader([]MetaField{{"FORMAT", "BEACON 2"}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Format != "BEACON 2" {
+		t.Errorf("got format %q, want %q", h.Format, "BEACON 2")
+	}
+
+	tests := []struct {
+		dump string
+		err  bool
+	}{
+		{"#FORMAT: BEACON\n\nfoo\n", false},
+		{"#NAME: x\n#FORMAT: BEACON\n\nfoo\n", false},
+		{"#NAME: x\n\nfoo\n", true},
+		{"foo\n", true},
+		{"", true},
+	}
+	for i, tt := range tests {
+		r := NewReaderOptions(strings.NewReader(tt.dump), &ReaderOptions{RequireFormat: true})
+		_, err := r.Meta()
+		var serr *SyntaxError
+		if tt.err && (!errors.As(err, &serr) || serr.Kind != InvalidFormat) {
+			t.Errorf("#%d: got error %v, want %v", i, err, InvalidFormat)
+		} else if !tt.err && err != nil {
+			t.Errorf("#%d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Index records the byte offset and source of every Nth link in a link
+// dump, for random access with NewReaderAt. For a dump sorted by
+// source, Seek finds the region that contains a source, so that a
+// lookup only parses a few links.
+type Index struct {
+	Every int // number of links between checkpoints
+
+	offsets []int64
+	sources []string
+}
+
+// indexMagic identifies a serialized Index and its version.
+const indexMagic = "BEACONIDX1"
+
+// BuildIndex scans the link dump in r and records a checkpoint at every
+// Nth link, starting with the first. The format and shortcode length
+// are detected by DetectFormat.
+func BuildIndex(r io.ReaderAt, every int) (*Index, error) {
+	if every <= 0 {
+		return nil, fmt.Errorf("beacon: invalid index interval %d", every)
+	}
+	opts, err := detectFormatAt(r, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	head, _, err := readHeaderAt(r, math.MaxInt64, opts)
+	if err != nil {
+		return nil, err
+	}
+	idx := &Index{Every: every}
+	var l Link
+	for i := 0; ; i++ {
+		if err := head.ReadInto(&l); err != nil {
+			if err == io.EOF {
+				return idx, nil
+			}
+			return nil, err
+		}
+		if i%every == 0 {
+			_, offset := head.Position()
+			idx.offsets = append(idx.offsets, offset)
+			idx.sources = append(idx.sources, l.Source)
+		}
+	}
+}
+
+// Len returns the number of checkpoints.
+func (idx *Index) Len() int {
+	return len(idx.offsets)
+}
+
+// Seek returns the offset of the last checkpoint with a source less
+// than source, or of the first checkpoint when there is none. The dump
+// must be sorted by source. Reading from the offset with NewReaderAt
+// and calling SkipToSource finds the first link with the source, if it
+// exists, within Every links.
+func (idx *Index) Seek(source string) int64 {
+	if len(idx.offsets) == 0 {
+		return 0
+	}
+	i := sort.SearchStrings(idx.sources, source)
+	return idx.offsets[max(i-1, 0)]
+}
+
+// WriteTo serializes the index in a compact binary form. Offsets are
+// delta encoded and sources share a prefix with the previous source.
+func (idx *Index) WriteTo(w io.Writer) (int64, error) {
+	buf := []byte(indexMagic)
+	buf = binary.AppendUvarint(buf, uint64(idx.Every))
+	buf = binary.AppendUvarint(buf, uint64(len(idx.offsets)))
+	var prevOffset int64
+	var prevSource string
+	for i, offset := range idx.offsets {
+		source := idx.sources[i]
+		shared := 0
+		for shared < min(len(source), len(prevSource)) && source[shared] == prevSource[shared] {
+			shared++
+		}
+		buf = binary.AppendUvarint(buf, uint64(offset-prevOffset))
+		buf = binary.AppendUvarint(buf, uint64(shared))
+		buf = binary.AppendUvarint(buf, uint64(len(source)-shared))
+		buf = append(buf, source[shared:]...)
+		prevOffset, prevSource = offset, source
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// ReadIndex reads an index serialized by WriteTo.
+func ReadIndex(r io.Reader) (*Index, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(indexMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != indexMagic {
+		return nil, errors.New("beacon: not a link dump index")
+	}
+	every, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, indexErr(err)
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, indexErr(err)
+	}
+	idx := &Index{Every: int(every)}
+	var offset int64
+	var source []byte
+	for i := uint64(0); i < n; i++ {
+		delta, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, indexErr(err)
+		}
+		shared, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, indexErr(err)
+		}
+		suffix, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, indexErr(err)
+		}
+		if shared > uint64(len(source)) || suffix > math.MaxInt32 {
+			return nil, errors.New("beacon: corrupt index")
+		}
+		source = source[:shared]
+		for j := uint64(0); j < suffix; j++ {
+			b, err := br.ReadByte()
+			if err != nil {
+				return nil, indexErr(err)
+			}
+			source = append(source, b)
+		}
+		offset += int64(delta)
+		idx.offsets = append(idx.offsets, offset)
+		idx.sources = append(idx.sources, string(source))
+	}
+	return idx, nil
+}
+
+func indexErr(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("beacon: corrupt index: %w", err)
+}
+
+// NewReaderAt constructs a reader that reads links from r, starting at
+// the link at offset, such as one returned by Index.Seek. The header is
+// read from the start of r and the format and shortcode length are
+// detected by DetectFormat. Offsets are absolute, but line numbers are
+// unknown, unless reading from the first link.
+func NewReaderAt(r io.ReaderAt, offset int64) (*Reader, error) {
+	opts, err := detectFormatAt(r, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	head, start, err := readHeaderAt(r, math.MaxInt64, opts)
+	if err != nil {
+		return nil, err
+	}
+	if offset > start {
+		return head.sectionReader(r, offset, math.MaxInt64), nil
+	}
+	lr := head.sectionReader(r, start, math.MaxInt64)
+	lr.noLineNums = false
+	lr.line = head.line
+	if head.peeked {
+		lr.line = head.peekNum - 1
+	}
+	return lr, nil
+}
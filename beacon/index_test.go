@@ -0,0 +1,135 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	var b strings.Builder
+	var want []Link
+	for i := 0; i < 500; i += 2 {
+		code := fmt.Sprintf("%04d", i)
+		target := fmt.Sprintf("http://example.com/%d", i)
+		if i%6 == 0 {
+			// Multi-line target
+			target += "\ncontinued"
+		}
+		fmt.Fprintf(&b, "%s|%s\n", code, target)
+		want = append(want, Link{code, target, ""})
+	}
+	dump := strings.NewReader(b.String())
+
+	idx, err := BuildIndex(dump, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := (len(want) + 15) / 16; idx.Len() != n {
+		t.Errorf("got %d checkpoints, want %d", idx.Len(), n)
+	}
+
+	var buf bytes.Buffer
+	if _, err := idx.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	idx2, err := ReadIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(idx2, idx) {
+		t.Errorf("round trip: got %+v, want %+v", idx2, idx)
+	}
+
+	for i, link := range want {
+		r, err := NewReaderAt(dump, idx.Seek(link.Source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.SkipToSource(link.Source); err != nil {
+			t.Errorf("#%d: SkipToSource: %v", i, err)
+			continue
+		}
+		got, err := r.Read()
+		if err != nil {
+			t.Errorf("#%d: Read: %v", i, err)
+			continue
+		}
+		if *got != link {
+			t.Errorf("#%d: got %v, want %v", i, *got, link)
+		}
+	}
+
+	// Odd codes are missing.
+	r, err := NewReaderAt(dump, idx.Seek("0101"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SkipToSource("0101"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.Read(); err != nil || got.Source != "0102" {
+		t.Errorf("got %v, %v, want 0102", got, err)
+	}
+	r, err = NewReaderAt(dump, idx.Seek("9999"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SkipToSource("9999"); err != io.EOF {
+		t.Errorf("got %v, want %v", err, io.EOF)
+	}
+}
+
+func TestNewReaderAtHeader(t *testing.T) {
+	const dump = "#FORMAT: BEACON\n#TARGET: http://example.com/{ID}\n\na\nb|c|d\n"
+	want, err := NewReader(strings.NewReader(dump)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReaderAt(strings.NewReader(dump), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, link := range want {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != link {
+			t.Errorf("#%d: got %v, want %v", i, *got, link)
+		}
+		// Line numbers are known when reading from the first link.
+		if line, _ := r.Position(); line != i+4 {
+			t.Errorf("#%d: got line %d, want %d", i, line, i+4)
+		}
+	}
+
+	r, err = NewReaderAt(strings.NewReader(dump), int64(strings.Index(dump, "b|")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(links, want[1:]) {
+		t.Errorf("got %v, want %v", links, want[1:])
+	}
+}
+
+func TestReadIndexCorrupt(t *testing.T) {
+	for i, data := range []string{"", "BEACONIDX", "BEACONIDX1", "BEACONIDX1\x10\x02\x00\x00\x05ab"} {
+		if _, err := ReadIndex(strings.NewReader(data)); err == nil {
+			t.Errorf("#%d: expected error", i)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// EncodeJSONL writes the remaining links from r to w as JSON Lines, one
+// object with "source", "target", and, when not empty, "annotation"
+// per line.
+func EncodeJSONL(w io.Writer, r LinkReader) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	for {
+		link, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(link); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// JSONLReader reads links from JSON Lines written by EncodeJSONL.
+type JSONLReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// DecodeJSONL constructs a reader that reads links from JSON Lines.
+// Blank lines are skipped.
+func DecodeJSONL(r io.Reader) *JSONLReader {
+	return &JSONLReader{r: bufio.NewReader(r)}
+}
+
+// Read reads the next link. Malformed lines are reported with their
+// line number.
+func (r *JSONLReader) Read() (*Link, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return nil, err
+		}
+		r.line++
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("beacon: line %d: %w", r.line, err)
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var link Link
+		if err := json.Unmarshal(line, &link); err != nil {
+			return nil, fmt.Errorf("beacon: line %d: %w", r.line, err)
+		}
+		return &link, nil
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONL(t *testing.T) {
+	const dump = "#FORMAT: BEACON\n\nabc|http://example.com/?a=1&b=2\nabd|3|http://example.com/\n"
+	const want = `{"source":"abc","target":"http://example.com/?a=1&b=2"}` + "\n" +
+		`{"source":"abd","target":"http://example.com/","annotation":"3"}` + "\n"
+	var b strings.Builder
+	if err := EncodeJSONL(&b, NewReader(strings.NewReader(dump))); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	r := DecodeJSONL(strings.NewReader(want + "\n"))
+	var links []Link
+	for {
+		link, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		links = append(links, *link)
+	}
+	wantLinks := []Link{{"abc", "http://example.com/?a=1&b=2", ""}, {"abd", "http://example.com/", "3"}}
+	if !reflect.DeepEqual(links, wantLinks) {
+		t.Errorf("got %q, want %q", links, wantLinks)
+	}
+
+	r = DecodeJSONL(strings.NewReader(`{"source":"abc"}` + "\n\n" + `{"source":` + "\n"))
+	if _, err := r.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(); err == nil || !strings.HasPrefix(err.Error(), "beacon: line 3: ") {
+		t.Errorf("got error %v, want error at line 3", err)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+)
+
+// MergeReader merges links from readers that are each sorted, so that
+// links are read in sorted order across all readers.
+type MergeReader struct {
+	// Unique collapses links equal to the previous link.
+	Unique bool
+
+	readers []*Reader
+	h       mergeHeap
+	started bool
+	popped  bool // whether the top of the heap has been read
+	last    *Link
+}
+
+// Merge constructs a reader that merges links from readers, which must
+// each be sorted by less. Links that compare equal are read in the
+// order of their readers.
+func Merge(less func(a, b *Link) bool, readers ...*Reader) *MergeReader {
+	return &MergeReader{readers: readers, h: mergeHeap{less: less}}
+}
+
+// Read reads the least link across all readers. Errors are annotated
+// with the index of the failing reader.
+func (m *MergeReader) Read() (*Link, error) {
+	if !m.started {
+		for i := len(m.h.items); i < len(m.readers); i++ {
+			link, err := m.readers[i].Read()
+			if err != nil && err != io.EOF {
+				return nil, fmt.Errorf("beacon: merge input %d: %w", i, err)
+			}
+			// Keep exhausted readers on the heap until initialized, so
+			// that the number of items is the next reader to read.
+			m.h.items = append(m.h.items, mergeItem{link, i})
+		}
+		items := m.h.items[:0]
+		for _, item := range m.h.items {
+			if item.link != nil {
+				items = append(items, item)
+			}
+		}
+		m.h.items = items
+		heap.Init(&m.h)
+		m.started = true
+	}
+	for {
+		if m.popped {
+			// Replace the top with the next link from the same reader,
+			// rather than popping and pushing.
+			top := &m.h.items[0]
+			link, err := m.readers[top.i].Read()
+			if err != nil && err != io.EOF {
+				return nil, fmt.Errorf("beacon: merge input %d: %w", top.i, err)
+			}
+			if err == io.EOF {
+				heap.Pop(&m.h)
+			} else {
+				top.link = link
+				heap.Fix(&m.h, 0)
+			}
+			m.popped = false
+		}
+		if len(m.h.items) == 0 {
+			return nil, io.EOF
+		}
+		link := m.h.items[0].link
+		m.popped = true
+		if m.Unique && m.last != nil && *link == *m.last {
+			continue
+		}
+		m.last = link
+		return link, nil
+	}
+}
+
+type mergeItem struct {
+	link *Link
+	i    int
+}
+
+type mergeHeap struct {
+	items []mergeItem
+	less  func(a, b *Link) bool
+}
+
+func (h *mergeHeap) Len() int { return len(h.items) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.less(a.link, b.link) {
+		return true
+	}
+	if h.less(b.link, a.link) {
+		return false
+	}
+	return a.i < b.i
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *mergeHeap) Push(x any) { h.items = append(h.items, x.(mergeItem)) }
+
+func (h *mergeHeap) Pop() any {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items = h.items[:n-1]
+	return item
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func lessSource(a, b *Link) bool {
+	return a.Source < b.Source
+}
+
+func TestMerge(t *testing.T) {
+	dumps := []string{
+		"aaa|http://example.com/1\nccc|http://example.com/3\neee|http://example.com/5\n",
+		"",
+		"bbb|http://example.com/2\nccc|http://example.com/3\n",
+		"ddd|http://example.com/4\n",
+	}
+	newReaders := func() []*Reader {
+		readers := make([]*Reader, len(dumps))
+		for i, dump := range dumps {
+			readers[i] = NewURLTeamReader(strings.NewReader(dump), 3)
+		}
+		return readers
+	}
+	want := []Link{
+		{"aaa", "http://example.com/1", ""},
+		{"bbb", "http://example.com/2", ""},
+		{"ccc", "http://example.com/3", ""},
+		{"ccc", "http://example.com/3", ""},
+		{"ddd", "http://example.com/4", ""},
+		{"eee", "http://example.com/5", ""},
+	}
+	for _, unique := range []bool{false, true} {
+		m := Merge(lessSource, newReaders()...)
+		m.Unique = unique
+		var links []Link
+		for {
+			link, err := m.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			links = append(links, *link)
+		}
+		w := want
+		if unique {
+			w = append(want[:3:3], want[4:]...)
+		}
+		if !reflect.DeepEqual(links, w) {
+			t.Errorf("unique=%t: got %q, want %q", unique, links, w)
+		}
+	}
+
+	readers := newReaders()
+	readers[2] = NewReaderOptions(strings.NewReader("bbb\n|x\n"), &ReaderOptions{Strict: true})
+	m := Merge(lessSource, readers...)
+	var err error
+	for err == nil {
+		_, err = m.Read()
+	}
+	if err == io.EOF || !strings.HasPrefix(err.Error(), "beacon: merge input 2: ") {
+		t.Errorf("got error %v, want error for input 2", err)
+	}
+}
+
+// linesReader generates a sorted URLTeam dump with n links, with
+// shortcodes starting at start and incrementing by step.
+type linesReader struct {
+	i, n, start, step int
+	buf               []byte
+}
+
+func (r *linesReader) Read(p []byte) (int, error) {
+	for len(r.buf) < len(p) && r.i < r.n {
+		r.buf = fmt.Appendf(r.buf, "%08d|http://example.com/%d\n", r.start+r.i*r.step, r.i)
+		r.i++
+	}
+	if len(r.buf) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// BenchmarkMerge merges 100 readers of 100k links each.
+func BenchmarkMerge(b *testing.B) {
+	const readers, links = 100, 100_000
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rs := make([]*Reader, readers)
+		for j := range rs {
+			rs[j] = NewURLTeamReader(&linesReader{n: links, start: j, step: readers}, 8)
+		}
+		m := Merge(lessSource, rs...)
+		n := 0
+		for {
+			_, err := m.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+			n++
+		}
+		if n != readers*links {
+			b.Fatalf("merged %d links, want %d", n, readers*links)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"fmt"
+	"io"
+)
+
+// MultiReader reads links from a sequence of link dumps, as if they
+// were a single dump.
+type MultiReader struct {
+	n        int
+	open     func(i int) (*Reader, string, error)
+	r        *Reader
+	i        int
+	name     string
+	closer   io.Closer
+	readers  []*Reader
+	meta     []MetaField
+	metaRead bool
+}
+
+// NewMultiReader constructs a reader that reads links from each reader
+// in order. Dumps are named by their index, as in "dump 1", and errors
+// are prefixed with the name.
+func NewMultiReader(readers ...*Reader) *MultiReader {
+	mr := &MultiReader{n: len(readers), readers: readers}
+	mr.open = func(i int) (*Reader, string, error) {
+		return readers[i], fmt.Sprintf("dump %d", i), nil
+	}
+	return mr
+}
+
+// Meta returns the merged meta fields of the headers of the readers
+// passed to NewMultiReader, in order of first appearance. When readers
+// have different PREFIX or TARGET meta fields, links cannot be resolved
+// consistently, so it is an error when any reader is in strict mode;
+// otherwise, the first value is used. For other meta fields, the first
+// value is used. For a MultiReader from OpenZip, Meta returns nil.
+func (mr *MultiReader) Meta() ([]MetaField, error) {
+	if mr.metaRead {
+		return mr.meta, nil
+	}
+	anyStrict := false
+	for _, r := range mr.readers {
+		anyStrict = anyStrict || r.opts.Strict
+	}
+	var merged []MetaField
+	for i, r := range mr.readers {
+		meta, err := r.Meta()
+		if err != nil {
+			return nil, fmt.Errorf("dump %d: %w", i, err)
+		}
+		for _, m := range meta {
+			prev, ok := metaValue(merged, m.Name)
+			if !ok {
+				merged = append(merged, m)
+				continue
+			}
+			if (m.Name == "PREFIX" || m.Name == "TARGET") && m.Value != prev && anyStrict {
+				return nil, fmt.Errorf("dump %d: beacon: conflicting %s meta field %q, previously %q", i, m.Name, m.Value, prev)
+			}
+		}
+	}
+	mr.meta, mr.metaRead = merged, true
+	return merged, nil
+}
+
+// Read reads the next link, continuing with the next dump at the end
+// of each dump. Errors are prefixed with the name of the dump.
+func (mr *MultiReader) Read() (*Link, error) {
+	if !mr.metaRead {
+		if _, err := mr.Meta(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		if mr.r == nil {
+			if mr.i >= mr.n {
+				return nil, io.EOF
+			}
+			r, name, err := mr.open(mr.i)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			mr.r, mr.name = r, name
+		}
+		link, err := mr.r.Read()
+		if err == io.EOF {
+			if err := mr.r.Close(); err != nil {
+				return nil, fmt.Errorf("%s: %w", mr.name, err)
+			}
+			mr.r = nil
+			mr.i++
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mr.name, err)
+		}
+		return link, nil
+	}
+}
+
+// Name returns the name of the current dump.
+func (mr *MultiReader) Name() string {
+	return mr.name
+}
+
+// Index returns the index of the current dump.
+func (mr *MultiReader) Index() int {
+	return mr.i
+}
+
+// Close closes the current dump and any underlying archive.
+func (mr *MultiReader) Close() error {
+	var err error
+	if mr.r != nil {
+		err = mr.r.Close()
+		mr.r = nil
+	}
+	if mr.closer != nil {
+		if err1 := mr.closer.Close(); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
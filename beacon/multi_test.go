@@ -0,0 +1,77 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewMultiReader(t *testing.T) {
+	newReaders := func(strict bool, dumps ...string) []*Reader {
+		readers := make([]*Reader, len(dumps))
+		for i, dump := range dumps {
+			readers[i] = NewReaderOptions(strings.NewReader(dump), &ReaderOptions{Strict: strict})
+		}
+		return readers
+	}
+	dumps := []string{
+		"#FORMAT: BEACON\n#PREFIX: http://example.com/\n\na\nb\n",
+		"#FORMAT: BEACON\n\n",
+		"#FORMAT: BEACON\n#PREFIX: http://example.com/\n#NAME: c\n\nc\n",
+	}
+	mr := NewMultiReader(newReaders(true, dumps...)...)
+	var links []Link
+	for {
+		link, err := mr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		links = append(links, *link)
+	}
+	if want := []Link{{"a", "", ""}, {"b", "", ""}, {"c", "", ""}}; !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+	meta, err := mr.Meta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMeta := []MetaField{{"FORMAT", "BEACON"}, {"PREFIX", "http://example.com/"}, {"NAME", "c"}}
+	if !reflect.DeepEqual(meta, wantMeta) {
+		t.Errorf("got meta %q, want %q", meta, wantMeta)
+	}
+
+	conflict := []string{dumps[0], "#PREFIX: http://example.org/\n\nc\n"}
+	if _, err := NewMultiReader(newReaders(true, conflict...)...).Read(); err == nil || !strings.Contains(err.Error(), "dump 1:") {
+		t.Errorf("got error %v, want conflict in dump 1", err)
+	}
+	// A lenient reader conflicting with a strict one is still an error.
+	mixed := append(newReaders(true, conflict[0]), newReaders(false, conflict[1])...)
+	if _, err := NewMultiReader(mixed...).Meta(); err == nil || !strings.Contains(err.Error(), "dump 1:") {
+		t.Errorf("got error %v, want conflict in dump 1 with strict first reader", err)
+	}
+	mr = NewMultiReader(newReaders(false, conflict...)...)
+	if meta, err := mr.Meta(); err != nil || meta[1].Value != "http://example.com/" {
+		t.Errorf("got meta %q, error %v, want first PREFIX", meta, err)
+	}
+
+	mr = NewMultiReader(newReaders(true, dumps[0], "c\n|x\n")...)
+	for err == nil {
+		_, err = mr.Read()
+	}
+	if want := "dump 1: beacon: line 2,"; err == io.EOF || !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("got error %v, want prefix %q", err, want)
+	}
+	if mr.Index() != 1 {
+		t.Errorf("got index %d, want 1", mr.Index())
+	}
+}
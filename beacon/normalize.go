@@ -0,0 +1,117 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"net/url"
+	"strings"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// NormalizeURL normalizes an absolute URL, so that equivalent URLs
+// compare equal. The scheme and host are lowercased, default ports are
+// removed, the fragment is removed, dot segments in the path are
+// collapsed as in RFC 3986, section 5.2.4, an empty path becomes "/",
+// and percent-encodings in the path and query are uppercased. Other
+// escaping is preserved, so %2F remains distinct from /. Relative or
+// unparsable URLs are returned unchanged.
+func NormalizeURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Fragment, u.RawFragment = "", ""
+	if u.Opaque != "" {
+		return u.String()
+	}
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); port == "" || port == defaultPorts[u.Scheme] {
+		u.Host = strings.TrimSuffix(strings.TrimSuffix(u.Host, port), ":")
+	}
+	p := upperPercent(removeDotSegments(u.EscapedPath()))
+	if p == "" && u.Host != "" {
+		p = "/"
+	}
+	if u.Path, err = url.PathUnescape(p); err != nil {
+		return rawURL
+	}
+	u.RawPath = p
+	u.RawQuery = upperPercent(u.RawQuery)
+	return u.String()
+}
+
+// removeDotSegments removes "." and ".." segments from a path, as
+// described by RFC 3986, section 5.2.4.
+func removeDotSegments(p string) string {
+	if !strings.Contains(p, ".") {
+		return p
+	}
+	var out []string
+	in := p
+	for in != "" {
+		switch {
+		case strings.HasPrefix(in, "../"):
+			in = in[3:]
+		case strings.HasPrefix(in, "./"):
+			in = in[2:]
+		case strings.HasPrefix(in, "/./"):
+			in = in[2:]
+		case in == "/.":
+			in = "/"
+		case strings.HasPrefix(in, "/../"):
+			in = in[3:]
+			if len(out) != 0 {
+				out = out[:len(out)-1]
+			}
+		case in == "/..":
+			in = "/"
+			if len(out) != 0 {
+				out = out[:len(out)-1]
+			}
+		case in == "." || in == "..":
+			in = ""
+		default:
+			i := strings.IndexByte(in[1:], '/')
+			if i == -1 {
+				out = append(out, in)
+				in = ""
+			} else {
+				out = append(out, in[:i+1])
+				in = in[i+1:]
+			}
+		}
+	}
+	return strings.Join(out, "")
+}
+
+// upperPercent uppercases the hex digits of percent-encodings.
+func upperPercent(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	b := []byte(s)
+	for i := 0; i+2 < len(b); i++ {
+		if b[i] == '%' && isHex(b[i+1]) && isHex(b[i+2]) {
+			b[i+1], b[i+2] = upperHex(b[i+1]), upperHex(b[i+2])
+			i += 2
+		}
+	}
+	return string(b)
+}
+
+func upperHex(ch byte) byte {
+	if 'a' <= ch && ch <= 'f' {
+		return ch - 'a' + 'A'
+	}
+	return ch
+}
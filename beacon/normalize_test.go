@@ -0,0 +1,49 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"HTTP://Example.com:80/./a%2fb", "http://example.com/a%2Fb"},
+		{"https://example.com:443/a/b/../c#frag", "https://example.com/a/c"},
+		{"https://example.com:8443/a/./b/../../c/", "https://example.com:8443/c/"},
+		{"http://Example.COM", "http://example.com/"},
+		{"http://example.com:/a?q=%e2%9c%93&x=1#", "http://example.com/a?q=%E2%9C%93&x=1"},
+		{"http://[::1]:80/a/..", "http://[::1]/"},
+		{"http://example.com/a//b/", "http://example.com/a//b/"},
+		{"http://example.com/%7Euser/..%2F", "http://example.com/%7Euser/..%2F"},
+		{"MAILTO:user@example.com", "mailto:user@example.com"},
+		{"/relative/../path", "/relative/../path"},
+		{"http://%zz/", "http://%zz/"},
+	}
+	for i, tt := range tests {
+		if got := NormalizeURL(tt.url); got != tt.want {
+			t.Errorf("#%d: NormalizeURL(%q) = %q, want %q", i, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeTarget(t *testing.T) {
+	dump := "abc|HTTP://Example.com:80/./a\nxyz|https://example.org/b#c\n"
+	r := NewReaderOptions(strings.NewReader(dump), &ReaderOptions{Format: URLTeam, ShortcodeLen: 3, NormalizeTarget: NormalizeURL})
+	links, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Link{{"abc", "http://example.com/a", ""}, {"xyz", "https://example.org/b", ""}}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+}
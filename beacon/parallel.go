@@ -0,0 +1,188 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// minChunkLen is the minimum length of a chunk parsed by ParseParallel,
+// so that small dumps are not split more than is useful.
+var minChunkLen int64 = 1 << 20
+
+// ParseParallel parses the link dump of the given size in r with up to
+// workers goroutines and calls fn for each link. The format and
+// shortcode length are detected by DetectFormat.
+//
+// fn is called concurrently from multiple goroutines and links are
+// delivered in no particular order, though links within a chunk are
+// delivered in order. When fn or parsing returns an error, the
+// remaining chunks are abandoned and the first error is returned.
+// Errors from parsing have absolute byte offsets, but no line numbers.
+func ParseParallel(r io.ReaderAt, size int64, workers int, fn func(*Link) error) error {
+	opts, err := detectFormatAt(r, size)
+	if err != nil {
+		return err
+	}
+	return ParseParallelOptions(r, size, workers, opts, fn)
+}
+
+// ParseParallelOptions parses a link dump in parallel, like
+// ParseParallel, but with the given options, rather than detecting the
+// format. UTF-16 dumps are not supported and the Progress option is
+// ignored.
+func ParseParallelOptions(r io.ReaderAt, size int64, workers int, opts *ReaderOptions, fn func(*Link) error) error {
+	if opts != nil && opts.Progress != nil {
+		o := *opts
+		o.Progress = nil
+		opts = &o
+	}
+	head, start, err := readHeaderAt(r, size, opts)
+	if err != nil {
+		return err
+	}
+	bounds, err := chunkBounds(r, start, size, workers, &head.opts)
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		stop     atomic.Bool
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() { firstErr = err })
+		stop.Store(true)
+	}
+	for i := 0; i+1 < len(bounds); i++ {
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+			cr := head.sectionReader(r, start, end)
+			for !stop.Load() {
+				var l Link
+				if err := cr.ReadInto(&l); err != nil {
+					if err != io.EOF {
+						fail(err)
+					}
+					return
+				}
+				if err := fn(&l); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}(bounds[i], bounds[i+1])
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// detectFormatAt detects the format of the link dump in r, like
+// DetectFormat.
+func detectFormatAt(r io.ReaderAt, size int64) (*ReaderOptions, error) {
+	br := bufio.NewReader(io.NewSectionReader(r, 0, size))
+	format, shortcodeLen, err := DetectFormat(br)
+	if err != nil {
+		return nil, err
+	}
+	return &ReaderOptions{Format: format, ShortcodeLen: shortcodeLen}, nil
+}
+
+// readHeaderAt reads the header of the link dump in r and returns the
+// reader and the offset of the first link. UTF-16 dumps are rejected,
+// because offsets in them do not correspond to offsets in r.
+func readHeaderAt(r io.ReaderAt, size int64, opts *ReaderOptions) (*Reader, int64, error) {
+	head := NewReaderOptions(io.NewSectionReader(r, 0, size), opts)
+	if b, err := head.r.Peek(2); err == nil {
+		if _, ok := utf16Encoding(b); ok {
+			return nil, 0, errors.New("beacon: random access into UTF-16 dumps is not supported")
+		}
+	}
+	if _, err := head.Meta(); err != nil {
+		return nil, 0, err
+	}
+	start := head.offset
+	if head.peeked {
+		start = head.peekOffset
+	}
+	return head, start, nil
+}
+
+// sectionReader constructs a reader for the links from start to end in
+// r, using the header already read by head. Offsets are absolute, but
+// line numbers are unknown.
+func (head *Reader) sectionReader(r io.ReaderAt, start, end int64) *Reader {
+	sr := NewReaderOptions(io.NewSectionReader(r, start, end-start), &head.opts)
+	sr.meta, sr.metaRead, sr.hasTarget = head.meta, true, head.hasTarget
+	sr.offset = start
+	sr.noLineNums = true
+	return sr
+}
+
+// chunkBounds splits the range from start to size into up to workers
+// chunks and returns their boundaries. Each boundary is moved forward
+// to the start of a link, so that the continuation lines of a URLTeam
+// multi-line target stay in the same chunk as their first line.
+func chunkBounds(r io.ReaderAt, start, size int64, workers int, opts *ReaderOptions) ([]int64, error) {
+	n := int64(max(workers, 1))
+	if chunks := (size - start) / minChunkLen; chunks < n {
+		n = max(chunks, 1)
+	}
+	bounds := []int64{start}
+	for i := int64(1); i < n; i++ {
+		p := start + (size-start)*i/n
+		if p <= bounds[len(bounds)-1] {
+			continue
+		}
+		b, err := alignChunk(r, p, size, opts)
+		if err != nil {
+			return nil, err
+		}
+		if b > bounds[len(bounds)-1] && b < size {
+			bounds = append(bounds, b)
+		}
+	}
+	return append(bounds, size), nil
+}
+
+// alignChunk returns the offset of the first link that starts after the
+// line containing p, or size when there is none.
+func alignChunk(r io.ReaderAt, p, size int64, opts *ReaderOptions) (int64, error) {
+	br := NewReaderOptions(io.NewSectionReader(r, p, size-p), opts)
+	// Discard the rest of the line containing p.
+	if _, err := br.readLineBytes(); err != nil {
+		if _, ok := err.(*LineTooLongError); !ok {
+			if err == io.EOF {
+				return size, nil
+			}
+			return 0, err
+		}
+	}
+	for {
+		line, err := br.readLineBytes()
+		if err == io.EOF {
+			return size, nil
+		}
+		if _, ok := err.(*LineTooLongError); ok {
+			// The reader treats an overlong line as the start of a link.
+			return p + br.lineOffset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if br.format != URLTeam || !br.isContinuation(line) {
+			return p + br.lineOffset, nil
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseParallel(t *testing.T) {
+	defer func(n int64) { minChunkLen = n }(minChunkLen)
+	minChunkLen = 64
+
+	var fixed, variable, rfc strings.Builder
+	rfc.WriteString("#FORMAT: BEACON\n#TARGET: http://example.com/{ID}\n\n")
+	for i := range 300 {
+		fmt.Fprintf(&fixed, "%04d|http://example.com/%d\n", i, i)
+		if i%3 == 0 {
+			// Multi-line target
+			fmt.Fprintf(&fixed, "continued/%d\n", i)
+		}
+		fmt.Fprintf(&variable, "%x|http://example.com/%d\n", i, i)
+		if i%5 == 0 {
+			fmt.Fprintf(&variable, "more/%d\n\n", i)
+		}
+		fmt.Fprintf(&rfc, "%d|note %d\n", i, i)
+	}
+	tests := []struct {
+		dump string
+		opts *ReaderOptions // nil to detect
+	}{
+		{fixed.String(), nil},
+		{fixed.String(), &ReaderOptions{Format: URLTeam, ShortcodeLen: 4}},
+		{variable.String(), &ReaderOptions{Format: URLTeam}},
+		{rfc.String(), nil},
+		{"", nil},
+	}
+	for i, tt := range tests {
+		opts := tt.opts
+		if opts == nil {
+			r, err := NewAutoReader(strings.NewReader(tt.dump))
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts = &r.opts
+		}
+		want, err := NewReaderOptions(strings.NewReader(tt.dump), opts).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.SortFunc(want, compareLinks)
+		for _, workers := range []int{1, 2, 3, 8, 100} {
+			var (
+				mu    sync.Mutex
+				links []Link
+			)
+			fn := func(l *Link) error {
+				mu.Lock()
+				defer mu.Unlock()
+				links = append(links, *l)
+				return nil
+			}
+			r := strings.NewReader(tt.dump)
+			if tt.opts == nil {
+				err = ParseParallel(r, r.Size(), workers, fn)
+			} else {
+				err = ParseParallelOptions(r, r.Size(), workers, tt.opts, fn)
+			}
+			if err != nil {
+				t.Errorf("#%d: workers %d: %v", i, workers, err)
+				continue
+			}
+			// Links are delivered unordered.
+			slices.SortFunc(links, compareLinks)
+			if !reflect.DeepEqual(links, want) {
+				t.Errorf("#%d: workers %d: got %d links, want %d", i, workers, len(links), len(want))
+			}
+		}
+	}
+}
+
+func TestParseParallelError(t *testing.T) {
+	defer func(n int64) { minChunkLen = n }(minChunkLen)
+	minChunkLen = 64
+
+	var b strings.Builder
+	b.WriteString("#FORMAT: BEACON\n")
+	for i := range 100 {
+		b.WriteString(fmt.Sprintf("%d|http://example.com/%d\n", i, i))
+	}
+	clean := b.String()
+	offset := b.Len()
+	b.WriteString("|x\n")
+	for i := range 100 {
+		b.WriteString(fmt.Sprintf("%d|http://example.com/%d\n", i, i))
+	}
+	r := strings.NewReader(b.String())
+	err := ParseParallelOptions(r, r.Size(), 4, &ReaderOptions{Strict: true}, func(*Link) error { return nil })
+	var serr *SyntaxError
+	if !errors.As(err, &serr) || serr.Kind != EmptySource {
+		t.Fatalf("got error %v, want %v", err, EmptySource)
+	}
+	if want := fmt.Sprintf("offset %d:", offset); !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not contain %q", err, want)
+	}
+
+	errStop := errors.New("stop")
+	r = strings.NewReader(clean)
+	err = ParseParallel(r, r.Size(), 4, func(*Link) error { return errStop })
+	if err != errStop {
+		t.Errorf("got error %v, want %v", err, errStop)
+	}
+}
+
+func compareLinks(a, b Link) int {
+	if c := strings.Compare(a.Source, b.Source); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Target, b.Target)
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import "io"
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// progressState tracks the progress last reported by a Reader.
+type progressState struct {
+	counter   *countingReader
+	links     int64 // links read
+	lastLinks int64 // links at the last report
+	lastBytes int64 // bytes at the last report
+	reported  bool  // whether progress was reported
+	done      bool  // whether EOF was reported
+}
+
+// reportProgress calls the Progress option when an interval has
+// elapsed since the last report, or once at EOF, unless unchanged.
+func (r *Reader) reportProgress(eof bool) {
+	p := &r.progress
+	if eof {
+		if p.done {
+			return
+		}
+		p.done = true
+	} else {
+		p.links++
+	}
+	var bytes int64
+	if p.counter != nil {
+		bytes = p.counter.n
+	}
+	if eof && !(p.reported && p.links == p.lastLinks && bytes == p.lastBytes) ||
+		r.opts.ProgressLinks > 0 && p.links-p.lastLinks >= r.opts.ProgressLinks ||
+		r.opts.ProgressBytes > 0 && bytes-p.lastBytes >= r.opts.ProgressBytes {
+		p.lastLinks, p.lastBytes, p.reported = p.links, bytes, true
+		r.opts.Progress(p.links, bytes)
+	}
+}
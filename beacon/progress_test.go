@@ -0,0 +1,96 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestProgress(t *testing.T) {
+	var b strings.Builder
+	for i := range 10 {
+		fmt.Fprintf(&b, "%03d|http://example.com/\n", i) // 24 bytes
+	}
+	dump := b.String()
+
+	type report struct{ links, bytes int64 }
+	tests := []struct {
+		links, bytes int64
+		want         []report
+	}{
+		{4, 0, []report{{4, 240}, {8, 240}, {10, 240}}},
+		{0, 0, []report{{10, 240}}},
+		{5, 0, []report{{5, 240}, {10, 240}}},
+	}
+	for i, tt := range tests {
+		var got []report
+		r := NewReaderOptions(strings.NewReader(dump), &ReaderOptions{
+			Format:        URLTeam,
+			ShortcodeLen:  3,
+			Progress:      func(links, bytes int64) { got = append(got, report{links, bytes}) },
+			ProgressLinks: tt.links,
+			ProgressBytes: tt.bytes,
+		})
+		if _, err := r.ReadAll(); err != nil {
+			t.Fatal(err)
+		}
+		// Reading again at EOF does not report again.
+		if _, err := r.Read(); err != io.EOF {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: got %v, want %v", i, got, tt.want)
+		}
+	}
+
+	// Bytes are counted as the bufio buffer is filled, including the
+	// line after each link, which is read to check for continuations.
+	var got []report
+	r := NewReaderOptions(iotest.OneByteReader(strings.NewReader(dump)), &ReaderOptions{
+		Format:        URLTeam,
+		ShortcodeLen:  3,
+		Progress:      func(links, bytes int64) { got = append(got, report{links, bytes}) },
+		ProgressBytes: 100,
+	})
+	if _, err := r.ReadAll(); err != nil {
+		t.Fatal(err)
+	}
+	want := []report{{4, 120}, {9, 240}, {10, 240}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestProgressCompressed(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(strings.Repeat("abc|http://example.com/\n", 100)))
+	gw.Close()
+	var links, n int64
+	r, err := NewCompressedReaderOptions(bytes.NewReader(gz.Bytes()), &ReaderOptions{
+		Format:       URLTeam,
+		ShortcodeLen: 3,
+		Progress:     func(l, b int64) { links, n = l, b },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.ReadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if links != 100 || n != int64(gz.Len()) {
+		t.Errorf("got %d links, %d bytes, want 100, %d", links, n, gz.Len())
+	}
+}
@@ -10,27 +10,158 @@ package beacon
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
 )
 
 type Reader struct {
-	r         *bufio.Reader
-	meta      []MetaField
-	metaRead  bool
-	peekLine  string
-	line      int
-	format    Format
-	sourceLen int
+	r          *bufio.Reader
+	meta       []MetaField
+	metaLines  []int // line number of each meta field
+	metaRead   bool
+	peekLine   string
+	peekNum    int
+	peekOffset int64
+	peekErr    error
+	peeked     bool
+	line       int   // number of lines read from r
+	offset     int64 // number of bytes read from r
+	lineNum    int   // line number of the line being parsed
+	lineOffset int64 // byte offset of the line being parsed
+	format     Format
+	sourceLen  int
+	hasTarget  bool // whether the TARGET meta field is a template
+	opts       ReaderOptions
+	resolver   *Resolver
+	readErr    error // non-EOF error from r
+	closer     io.Closer
+	lineText   string
+	errs       []LineError
+	skipped    int
+	invalidURL int
+	pendingCR  bool // whether the last fragment ended with \r
+	noLineNums bool // whether line numbers are unknown, as in a chunk
+	progress   progressState
 }
 
+// ReaderOptions contains options for reading link dumps.
+type ReaderOptions struct {
+	Format       Format // RFC or URLTeam
+	ShortcodeLen int    // fixed shortcode length for URLTeam dumps; <=0 for variable
+
+	// Strict rejects unknown or duplicate meta fields, FORMAT values
+	// other than "BEACON", links with empty sources, and sources and
+	// targets that are not valid URLs after template expansion.
+	Strict bool
+
+	// SkipInvalid skips links that fail to parse, rather than returning
+	// an error. Skipped lines are recorded by Errors, up to MaxErrors or
+	// DefaultMaxErrors when unset.
+	SkipInvalid bool
+	MaxErrors   int
+
+	// MaxLineLen is the maximum length of a line in bytes, including the
+	// line break. Longer lines produce a *LineTooLongError. When unset,
+	// DefaultMaxLineLen is used.
+	MaxLineLen int
+
+	// MaxShortcodeLen is the maximum shortcode length in URLTeam dumps
+	// with variable shortcode length. Lines without a bar within this
+	// many characters continue the target of the previous link. When
+	// unset, DefaultMaxShortcodeLen is used.
+	MaxShortcodeLen int
+
+	// IsContinuation, when set, overrides MaxShortcodeLen to decide
+	// whether a line continues the target of the previous link.
+	IsContinuation func(line string) bool
+
+	// CRLineBreaks treats a bare \r as a line break, in addition to \n
+	// and \r\n, for dumps with classic Mac OS or mixed line endings. It
+	// is off by default, since URLTeam targets may contain \r.
+	CRLineBreaks bool
+
+	// ValidateURLs rejects links with targets or absolute sources that,
+	// after template expansion, are not valid URLs, have a scheme not in
+	// AllowedSchemes, or contain control characters. In SkipInvalid
+	// mode, these links are counted by InvalidURLs.
+	ValidateURLs   bool
+	AllowedSchemes []string // when unset, DefaultAllowedSchemes is used
+
+	// SourcePattern, when set, rejects links with sources that do not
+	// match it, such as shortcodes outside the alphabet of a shortener.
+	// It is matched against the whole source after splitting and should
+	// be anchored, like ^[0-9A-Za-z]{6}$.
+	SourcePattern *regexp.Regexp
+
+	// NormalizeTarget, when set, is applied to the target of each link
+	// before it is returned, such as NormalizeURL.
+	NormalizeTarget func(target string) string
+
+	// Progress, when set, is called from Read with the number of links
+	// read and the number of bytes consumed from the underlying reader,
+	// every ProgressLinks links or ProgressBytes bytes, whichever comes
+	// first, and once at EOF. Bytes include any read ahead into the
+	// buffer and, for a compressed reader, are compressed bytes. When
+	// both intervals are unset, it is only called at EOF.
+	Progress      func(links, bytes int64)
+	ProgressLinks int64
+	ProgressBytes int64
+
+	// RequireFormat rejects RFC dumps without a FORMAT meta field, such
+	// as headerless files.
+	RequireFormat bool
+
+	// SkipEmptyTargets skips links with empty targets in URLTeam dumps,
+	// which record deleted shortcodes. See Link.Deleted.
+	SkipEmptyTargets bool
+}
+
+// DefaultAllowedSchemes is the default set of URL schemes permitted by
+// ValidateURLs.
+var DefaultAllowedSchemes = []string{"http", "https", "ftp", "mailto"}
+
+// DefaultMaxShortcodeLen is the default maximum shortcode length in
+// URLTeam dumps with variable shortcode length.
+const DefaultMaxShortcodeLen = 32
+
+// DefaultMaxLineLen is the default maximum line length.
+const DefaultMaxLineLen = 4 << 20
+
+// ErrLineTooLong is matched by errors.Is for a *LineTooLongError.
+var ErrLineTooLong = errors.New("beacon: line too long")
+
+// LineTooLongError reports a line exceeding MaxLineLen. The line is
+// discarded, so reading can continue with the next line.
+type LineTooLongError struct {
+	Offset int64  // byte offset of the start of the line
+	Prefix string // first bytes of the line
+}
+
+func (e *LineTooLongError) Error() string {
+	return fmt.Sprintf("line too long at offset %d: %q...", e.Offset, e.Prefix)
+}
+
+func (e *LineTooLongError) Unwrap() error { return ErrLineTooLong }
+
 type MetaField struct {
 	Name, Value string
 }
 
 type Link struct {
-	Source, Target, Annotation string
+	Source     string `json:"source"`
+	Target     string `json:"target"`
+	Annotation string `json:"annotation,omitempty"`
 }
 
 // Format defines the format of the BEACON link dump.
@@ -49,13 +180,68 @@ const (
 // NewReader constructs a reader that reads RFC-format BEACON link
 // dumps.
 func NewReader(r io.Reader) *Reader {
-	return &Reader{r: bufio.NewReader(r)}
+	return NewReaderOptions(r, nil)
 }
 
 // NewURLTeamReader constructs a reader that reads URLTeam-format BEACON
 // link dumps. Links always omit the annotation field.
 func NewURLTeamReader(r io.Reader, shortcodeLen int) *Reader {
-	return &Reader{r: bufio.NewReader(r), format: URLTeam, sourceLen: shortcodeLen}
+	return NewReaderOptions(r, &ReaderOptions{Format: URLTeam, ShortcodeLen: shortcodeLen})
+}
+
+// NewReaderOptions constructs a reader with the given options. A nil
+// options reads RFC-format link dumps.
+func NewReaderOptions(r io.Reader, opts *ReaderOptions) *Reader {
+	var counter *countingReader
+	if opts != nil && opts.Progress != nil {
+		counter = &countingReader{r: r}
+		r = counter
+	}
+	return newReader(r, counter, opts)
+}
+
+// newReader constructs a reader with a counter of the bytes consumed
+// from r, if reporting progress.
+func newReader(r io.Reader, counter *countingReader, opts *ReaderOptions) *Reader {
+	br := &Reader{r: bufio.NewReader(r)}
+	br.progress.counter = counter
+	if opts != nil {
+		br.opts = *opts
+		br.format = opts.Format
+		br.sourceLen = opts.ShortcodeLen
+	}
+	return br
+}
+
+// Reset discards all state and switches the reader to read from rd with
+// the same options, reusing the buffer, like bufio.Reader.Reset. Any
+// decompressor from NewCompressedReader is kept, so it is still
+// released by Close.
+func (r *Reader) Reset(rd io.Reader) {
+	var counter *countingReader
+	if r.opts.Progress != nil {
+		counter = &countingReader{r: rd}
+		rd = counter
+	}
+	r.r.Reset(rd)
+	*r = Reader{
+		progress:  progressState{counter: counter},
+		r:         r.r,
+		format:    r.format,
+		sourceLen: r.sourceLen,
+		opts:      r.opts,
+		closer:    r.closer,
+	}
+}
+
+// ResetURLTeam resets the reader, like Reset, to read a URLTeam-format
+// link dump with the given shortcode length.
+func (r *Reader) ResetURLTeam(rd io.Reader, shortcodeLen int) {
+	r.Reset(rd)
+	r.format = URLTeam
+	r.sourceLen = shortcodeLen
+	r.opts.Format = URLTeam
+	r.opts.ShortcodeLen = shortcodeLen
 }
 
 // Meta returns the meta fields in the header.
@@ -66,11 +252,75 @@ func (r *Reader) Meta() ([]MetaField, error) {
 	r.metaRead = true
 	meta, err := r.readMeta()
 	if err == nil || err == io.EOF {
+		if _, ok := metaValue(meta, "FORMAT"); !ok && r.opts.RequireFormat && r.format != URLTeam {
+			r.lineNum, r.lineOffset, r.lineText = 1, 0, ""
+			return nil, r.err(syntaxError(InvalidFormat, 0, "missing FORMAT meta field"))
+		}
+		r.hasTarget = hasTargetTemplate(meta)
 		return meta, nil
 	}
 	return nil, r.err(err)
 }
 
+// HasTargetTemplate reports whether the header has a TARGET meta field
+// other than the default "{+ID}". When it does, link lines with two
+// tokens are interpreted as SOURCE|ANNOTATION, rather than
+// SOURCE|TARGET. It is valid after Meta or Read has been called.
+func (r *Reader) HasTargetTemplate() bool {
+	return r.hasTarget
+}
+
+func hasTargetTemplate(meta []MetaField) bool {
+	target, ok := metaValue(meta, "TARGET")
+	return ok && target != "" && target != "{+ID}"
+}
+
+// MetaValue returns the value of the meta field with the given name.
+// When the field occurs more than once, the last value is returned. It
+// is valid after Meta or Read has been called.
+func (r *Reader) MetaValue(name string) (string, bool) {
+	return metaValue(r.meta, name)
+}
+
+// MetaValues returns all values of the meta field with the given name,
+// in order. It is valid after Meta or Read has been called.
+func (r *Reader) MetaValues(name string) []string {
+	var values []string
+	for _, m := range r.meta {
+		if m.Name == name {
+			values = append(values, m.Value)
+		}
+	}
+	return values
+}
+
+// DuplicateMeta returns the names of meta fields that occur more than
+// once, which are rejected in strict mode. It is valid after Meta or
+// Read has been called.
+func (r *Reader) DuplicateMeta() []string {
+	var dups []string
+	for i, m := range r.meta {
+		for _, p := range r.meta[:i] {
+			if p.Name == m.Name {
+				if !slices.Contains(dups, m.Name) {
+					dups = append(dups, m.Name)
+				}
+				break
+			}
+		}
+	}
+	return dups
+}
+
+func metaValue(meta []MetaField, name string) (string, bool) {
+	for i := len(meta) - 1; i >= 0; i-- {
+		if meta[i].Name == name {
+			return meta[i].Value, true
+		}
+	}
+	return "", false
+}
+
 func (r *Reader) readMeta() ([]MetaField, error) {
 	if err := r.consumeBOM(); err != nil {
 		return nil, err
@@ -90,14 +340,20 @@ func (r *Reader) readMeta() ([]MetaField, error) {
 			break
 		}
 		if line[0] != '#' {
-			r.peekLine = line
+			r.unreadLine(line)
 			return r.meta, nil
 		}
 		meta, err := splitMeta(line[1:])
 		if err != nil {
 			return nil, err
 		}
+		if r.opts.Strict {
+			if err := checkMetaStrict(meta, r.meta); err != nil {
+				return nil, err
+			}
+		}
 		r.meta = append(r.meta, meta)
+		r.metaLines = append(r.metaLines, r.lineNum)
 	}
 
 	// Consume empty lines
@@ -107,24 +363,59 @@ func (r *Reader) readMeta() ([]MetaField, error) {
 			return r.meta, err
 		}
 		if trimLeftSpace(line) != "" {
-			r.peekLine = line
+			r.unreadLine(line)
 			return r.meta, nil
 		}
 	}
 }
 
 // consumeBOM skips a UTF-8 byte order mark as permitted by section 3.1.
+// When the dump starts with a UTF-16 byte order mark, the rest of the
+// dump is transcoded to UTF-8 and offsets are of the transcoded dump.
 func (r *Reader) consumeBOM() error {
+	if b, err := r.r.Peek(2); err == nil {
+		if e, ok := utf16Encoding(b); ok {
+			dec := e.NewDecoder()
+			r.r = bufio.NewReaderSize(transform.NewReader(r.r, dec), r.r.Size())
+			return nil
+		}
+	}
 	ch, _, err := r.r.ReadRune()
 	if err != nil {
 		return err
 	}
 	if ch == '\uFEFF' {
+		r.offset += int64(len(string(ch)))
 		return nil
 	}
 	return r.r.UnreadRune()
 }
 
+// utf16Encoding returns the UTF-16 encoding for a byte order mark.
+func utf16Encoding(bom []byte) (encoding.Encoding, bool) {
+	switch {
+	case bom[0] == 0xff && bom[1] == 0xfe:
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), true
+	case bom[0] == 0xfe && bom[1] == 0xff:
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), true
+	}
+	return nil, false
+}
+
+// ParseMetaLine parses a meta line of the form "#NAME: value", with an
+// optional line break.
+func ParseMetaLine(line string) (MetaField, error) {
+	line = dropLineBreak(line)
+	if !strings.HasPrefix(line, "#") {
+		return MetaField{}, fmt.Errorf("beacon: %w", syntaxError(InvalidMetaChar, 1, "meta line missing #: %q", line))
+	}
+	m, err := splitMeta(line[1:])
+	if err != nil {
+		return MetaField{}, fmt.Errorf("beacon: %w", err)
+	}
+	return m, nil
+}
+
 func splitMeta(meta string) (MetaField, error) {
 	for i, ch := range meta {
 		switch {
@@ -132,87 +423,325 @@ func splitMeta(meta string) (MetaField, error) {
 		case ch == ':' || ch == ' ' || ch == '\t':
 			return MetaField{meta[:i], trimLeftSpace(meta[i+1:])}, nil
 		default:
-			return MetaField{}, fmt.Errorf("invalid character %q in meta field: %q", ch, meta)
+			return MetaField{}, syntaxError(InvalidMetaChar, i+2, "invalid character %q in meta field: %q", ch, meta)
 		}
 	}
-	return MetaField{}, fmt.Errorf("meta line missing value: %q", meta)
+	return MetaField{}, syntaxError(MissingMetaValue, 0, "meta line missing value: %q", meta)
+}
+
+// checkMetaStrict checks that a meta field is known, is not a
+// duplicate, and, for FORMAT, has the value "BEACON".
+func checkMetaStrict(m MetaField, prev []MetaField) error {
+	if !isKnownMeta(m.Name) {
+		return syntaxError(UnknownMetaField, 2, "unknown meta field: %s", m.Name)
+	}
+	for _, p := range prev {
+		if p.Name == m.Name {
+			return syntaxError(DuplicateMetaField, 2, "duplicate meta field: %s", m.Name)
+		}
+	}
+	if m.Name == "FORMAT" && m.Value != "BEACON" {
+		return syntaxError(InvalidFormat, 0, "FORMAT not BEACON: %q", m.Value)
+	}
+	return nil
+}
+
+func (r *Reader) Read() (*Link, error) {
+	var link Link
+	if err := r.ReadInto(&link); err != nil {
+		return nil, err
+	}
+	return &link, nil
 }
 
-func (r *Reader) Read() (link *Link, err error) {
+// ReadInto reads the next link into l, like Read, but reuses l to avoid
+// allocating. The fields of each link share a single copy of its line.
+func (r *Reader) ReadInto(l *Link) error {
 	if !r.metaRead {
 		if _, err := r.Meta(); err != nil {
-			return nil, err
+			return err
+		}
+	}
+	for {
+		err := r.readLink(l)
+		if r.opts.Progress != nil && (err == nil || err == io.EOF) {
+			r.reportProgress(err == io.EOF)
+		}
+		if err == nil || err == io.EOF || r.readErr != nil || !r.opts.SkipInvalid {
+			return r.err(err)
+		}
+		if isURLError(err) {
+			r.invalidURL++
+		} else {
+			r.skipped++
+		}
+		setPosition(err, r.lineNum, r.lineText)
+		if len(r.errs) < r.maxErrors() {
+			r.errs = append(r.errs, LineError{r.lineNum, r.lineOffset, r.lineText, err})
+		}
+	}
+}
+
+// ReadAll reads the remaining links. Unlike Read, io.EOF is not
+// returned. On error, the links read before the error are returned.
+func (r *Reader) ReadAll() ([]Link, error) {
+	var links []Link
+	for {
+		link, err := r.Read()
+		if err == io.EOF {
+			return links, nil
+		}
+		if err != nil {
+			return links, err
 		}
+		links = append(links, *link)
 	}
+}
+
+// Links returns an iterator over the remaining links. Iteration stops
+// at io.EOF, which is not yielded, or after yielding any other error.
+// When iteration is stopped early, Read can be used to continue with
+// the next link.
+func (r *Reader) Links() iter.Seq2[*Link, error] {
+	return func(yield func(*Link, error) bool) {
+		for {
+			link, err := r.Read()
+			if err == io.EOF {
+				return
+			}
+			if !yield(link, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (r *Reader) readLink(l *Link) error {
+	var err error
 	if r.format == URLTeam {
-		link, err = r.readLinkURLTeam()
+		err = r.readLinkURLTeam(l)
+		for err == nil && r.opts.SkipEmptyTargets && l.Deleted() {
+			err = r.readLinkURLTeam(l)
+		}
 	} else {
-		link, err = r.readLinkRFC()
+		err = r.readLinkRFC(l)
+	}
+	if err == nil && r.opts.Strict {
+		err = r.checkLinkStrict(l)
+	}
+	if err == nil && r.opts.SourcePattern != nil && !r.opts.SourcePattern.MatchString(l.Source) {
+		err = syntaxError(InvalidSource, 1, "source %q does not match pattern %s", l.Source, r.opts.SourcePattern)
+	}
+	if err == nil && r.opts.ValidateURLs {
+		err = r.checkLinkURLs(l)
 	}
-	return link, r.err(err)
+	if err == nil && r.opts.NormalizeTarget != nil && l.Target != "" {
+		l.Target = r.opts.NormalizeTarget(l.Target)
+	}
+	return err
+}
+
+// LineError records an invalid line skipped by a reader in SkipInvalid
+// mode.
+type LineError struct {
+	Line   int    // line number
+	Offset int64  // byte offset of the start of the line
+	Text   string // raw line, including any line break
+	Err    error
+}
+
+// DefaultMaxErrors is the default number of skipped lines recorded by a
+// reader in SkipInvalid mode.
+const DefaultMaxErrors = 1000
+
+// Errors returns the lines skipped in SkipInvalid mode, up to
+// MaxErrors.
+func (r *Reader) Errors() []LineError {
+	return r.errs
+}
+
+// Skipped returns the number of lines skipped in SkipInvalid mode,
+// including those not recorded by Errors, but excluding links with
+// invalid URLs.
+func (r *Reader) Skipped() int {
+	return r.skipped
+}
+
+// InvalidURLs returns the number of links skipped in SkipInvalid mode
+// for having invalid URLs.
+func (r *Reader) InvalidURLs() int {
+	return r.invalidURL
 }
 
-func (r *Reader) readLinkRFC() (*Link, error) {
+func (r *Reader) maxErrors() int {
+	if r.opts.MaxErrors > 0 {
+		return r.opts.MaxErrors
+	}
+	return DefaultMaxErrors
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("beacon: line %d, offset %d: %v", e.Line, e.Offset, e.Err)
+}
+
+func (e *LineError) Unwrap() error { return e.Err }
+
+// checkLinkStrict checks that a link has a source and that its source
+// and target are valid URLs after template expansion.
+func (r *Reader) checkLinkStrict(l *Link) error {
+	if l.Source == "" {
+		return syntaxError(EmptySource, 1, "link has empty source: %q", l)
+	}
+	if r.resolver == nil {
+		r.resolver = NewResolver(r.meta)
+	}
+	if _, _, err := r.resolver.resolve(l); err != nil {
+		serr := syntaxError(InvalidURL, 0, "%v", err)
+		serr.Err = err
+		return serr
+	}
+	return nil
+}
+
+func (r *Reader) readLinkRFC(l *Link) error {
 	line, err := r.readLine()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var link Link
-	tokens := strings.SplitN(line, "|", 4)
-	switch len(tokens) {
-	case 1:
-		link.Source = tokens[0]
-	case 2:
-		link.Source, link.Target = tokens[0], tokens[1]
-		// TODO:
-		// link.Source, link.Annotation = tokens[0], tokens[1]
-	case 3:
-		link.Source, link.Annotation, link.Target = tokens[0], tokens[1], tokens[2]
-	case 4:
-		return nil, fmt.Errorf("link line has too many bar separators: %q", line)
+	*l = Link{}
+	i := strings.IndexByte(line, '|')
+	if i == -1 {
+		l.Source = line
+		return nil
 	}
-	return &link, nil
+	j := strings.IndexByte(line[i+1:], '|')
+	if j == -1 {
+		if r.hasTarget {
+			l.Source, l.Annotation = line[:i], line[i+1:]
+		} else {
+			l.Source, l.Target = line[:i], line[i+1:]
+		}
+		return nil
+	}
+	// The target absorbs the rest of the line, since only the source
+	// and annotation cannot contain bars.
+	j += i + 1
+	l.Source, l.Annotation, l.Target = line[:i], line[i+1:j], line[j+1:]
+	return nil
 }
 
-func (r *Reader) readLinkURLTeam() (*Link, error) {
+func (r *Reader) readLinkURLTeam(l *Link) error {
 	line, err := r.readLineRaw()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Variable shortcode length
+	var shortcode, target string
 	if r.sourceLen <= 0 {
+		// Variable shortcode length
 		i := strings.IndexByte(line, '|')
 		if i == -1 {
-			return nil, fmt.Errorf("link line missing bar separator: %q", line)
+			return syntaxError(MissingBar, 0, "link line missing bar separator: %q", line)
+		}
+		shortcode, target = line[:i], line[i+1:]
+	} else {
+		// Fixed shortcode length
+		if len(line) <= r.sourceLen || line[r.sourceLen] != '|' {
+			if i := strings.IndexByte(line, '|'); i != -1 {
+				return syntaxError(WrongShortcodeLen, i+1, "shortcode not %d characters: %q", r.sourceLen, line)
+			}
+			return syntaxError(MissingBar, 0, "link line missing bar separator: %q", line)
 		}
-		return &Link{line[:i], dropLineBreak(line[i:]), ""}, nil
+		shortcode, target = line[:r.sourceLen], line[r.sourceLen+1:]
 	}
-
-	// Fixed shortcode length
-	if len(line) < r.sourceLen || line[r.sourceLen] != '|' {
-		if i := strings.IndexByte(line, '|'); i != -1 {
-			return nil, fmt.Errorf("shortcode not %d characters: %q", r.sourceLen, line)
+	lineNum, lineOffset, lineText := r.lineNum, r.lineOffset, r.lineText
+	if dropLineBreak(target) == "" {
+		// An empty target records a deleted shortcode, so following
+		// blank lines are discarded, rather than joined, and any other
+		// line is parsed as the next link.
+		if err := r.skipBlankLines(); err != nil {
+			return err
 		}
-		return nil, fmt.Errorf("link line missing bar separator: %q", line)
+		r.lineNum, r.lineOffset, r.lineText = lineNum, lineOffset, lineText
+		*l = Link{shortcode, "", ""}
+		return nil
 	}
-	shortcode, target := line[:r.sourceLen], line[r.sourceLen+1:]
-	// Append successive lines in multi-line link
+	// Append successive lines in multi-line link. Lines are read from the
+	// bufio buffer and only copied when joined.
+	var b strings.Builder
 	for {
-		line, err := r.readLineRaw()
+		line, err := r.readLineBytes()
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return nil, err
+			// Defer the error to the next link, since the line may not be
+			// a continuation.
+			if _, ok := err.(*LineTooLongError); ok {
+				r.unreadErr(err)
+				break
+			}
+			return err
 		}
-		if len(line) > r.sourceLen && line[r.sourceLen] == '|' {
-			r.peekLine = line
+		if !r.isContinuation(line) {
+			r.unreadLine(string(line))
 			break
 		}
-		target += line
+		if b.Len() == 0 {
+			b.WriteString(target)
+		}
+		b.Write(line)
+	}
+	if b.Len() != 0 {
+		target = b.String()
+	}
+	r.lineNum, r.lineOffset, r.lineText = lineNum, lineOffset, lineText
+	*l = Link{shortcode, dropLineBreak(target), ""}
+	return nil
+}
+
+// skipBlankLines discards lines consisting of only a line break and
+// pushes back the first other line.
+func (r *Reader) skipBlankLines() error {
+	for {
+		line, err := r.readLineBytes()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if _, ok := err.(*LineTooLongError); ok {
+				r.unreadErr(err)
+				return nil
+			}
+			return err
+		}
+		if !isBlankLine(line) {
+			r.unreadLine(string(line))
+			return nil
+		}
+	}
+}
+
+func isBlankLine(line []byte) bool {
+	return len(bytes.TrimRight(line, "\r\n")) == 0
+}
+
+// isContinuation reports whether a line in a URLTeam dump continues
+// the target of the previous link. With a fixed shortcode length, a line
+// is a new link when it has a bar after the shortcode. Otherwise, it is
+// a new link when it has a bar within MaxShortcodeLen characters.
+func (r *Reader) isContinuation(line []byte) bool {
+	if r.sourceLen > 0 {
+		return len(line) <= r.sourceLen || line[r.sourceLen] != '|'
+	}
+	if r.opts.IsContinuation != nil {
+		return r.opts.IsContinuation(string(line))
+	}
+	max := r.opts.MaxShortcodeLen
+	if max <= 0 {
+		max = DefaultMaxShortcodeLen
 	}
-	return &Link{shortcode, dropLineBreak(target), ""}, nil
+	return bytes.IndexByte(line[:min(len(line), max+1)], '|') == -1
 }
 
 func (r *Reader) readLine() (string, error) {
@@ -224,32 +753,173 @@ func (r *Reader) readLine() (string, error) {
 }
 
 func (r *Reader) readLineRaw() (string, error) {
-	if l := r.peekLine; l != "" {
-		r.peekLine = ""
-		return l, nil
+	if r.peeked {
+		r.peeked = false
+		r.lineNum, r.lineOffset, r.lineText = r.peekNum, r.peekOffset, r.peekLine
+		if err := r.peekErr; err != nil {
+			r.peekErr = nil
+			return "", err
+		}
+		return r.peekLine, nil
 	}
-	r.line++
-	line, err := r.r.ReadString('\n')
-	if err != nil && !(err == io.EOF && line != "") {
+	line, err := r.readLineBytes()
+	if err != nil {
 		return "", err
 	}
+	r.lineText = string(line)
+	return r.lineText, nil
+}
+
+// readLineBytes reads the next line, like readLineRaw, but ignores any
+// pushed back line. The returned slice is only valid until the next
+// read.
+func (r *Reader) readLineBytes() ([]byte, error) {
+	r.lineNum, r.lineOffset = r.line+1, r.offset
+	r.lineText = ""
+	line, n, err := r.readSlice()
+	r.offset += int64(n)
+	if n != 0 {
+		r.line++
+	}
+	if tooLong, ok := err.(*LineTooLongError); ok {
+		tooLong.Offset = r.lineOffset
+		r.lineText = tooLong.Prefix
+		return nil, err
+	}
+	if err != nil && err != io.EOF {
+		r.readErr = err
+	}
+	if err != nil && !(err == io.EOF && len(line) != 0) {
+		return nil, err
+	}
 	return line, nil
 }
 
+// readSlice reads until the first newline, like bufio.Reader's
+// ReadSlice, but buffers lines longer than the bufio buffer up to
+// MaxLineLen. Overlong lines are discarded through the next newline. The
+// number of bytes consumed is returned.
+func (r *Reader) readSlice() ([]byte, int, error) {
+	max := r.opts.MaxLineLen
+	if max <= 0 {
+		max = DefaultMaxLineLen
+	}
+	var buf []byte
+	for {
+		frag, err := r.readFrag()
+		if len(buf)+len(frag) > max {
+			prefix := append(buf, frag[:min(len(frag), maxErrorText)]...)
+			if len(prefix) > maxErrorText {
+				prefix = prefix[:maxErrorText]
+			}
+			tooLong := &LineTooLongError{Prefix: string(prefix)}
+			n := len(buf) + len(frag)
+			for err == bufio.ErrBufferFull {
+				frag, err = r.readFrag()
+				n += len(frag)
+			}
+			if err != nil && err != io.EOF {
+				return nil, n, err
+			}
+			return nil, n, tooLong
+		}
+		if err != bufio.ErrBufferFull {
+			if buf == nil {
+				return frag, len(frag), err
+			}
+			buf = append(buf, frag...)
+			return buf, len(buf), err
+		}
+		buf = append(buf, frag...)
+	}
+}
+
+// readFrag reads until the first line break, like bufio.Reader's
+// ReadSlice. When CRLineBreaks is set, a bare \r also ends the line.
+func (r *Reader) readFrag() ([]byte, error) {
+	if !r.opts.CRLineBreaks {
+		return r.r.ReadSlice('\n')
+	}
+	if r.pendingCR {
+		// The previous fragment ended with \r at the end of the buffer,
+		// so check whether it is followed by \n.
+		r.pendingCR = false
+		b, err := r.r.Peek(1)
+		if err == nil && b[0] == '\n' {
+			r.r.Discard(1)
+			return b, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return nil, nil
+	}
+	if _, err := r.r.Peek(1); err != nil {
+		return nil, err
+	}
+	buf, _ := r.r.Peek(r.r.Buffered())
+	i := bytes.IndexAny(buf, "\r\n")
+	switch {
+	case i == -1:
+		r.r.Discard(len(buf))
+		return buf, bufio.ErrBufferFull
+	case buf[i] == '\n':
+		i++
+	case i+1 == len(buf):
+		r.pendingCR = true
+		r.r.Discard(len(buf))
+		return buf, bufio.ErrBufferFull
+	case buf[i+1] == '\n':
+		i += 2
+	default:
+		i++
+	}
+	r.r.Discard(i)
+	return buf[:i], nil
+}
+
+// unreadLine pushes back a line to be returned by the next call to
+// readLineRaw. Empty lines are preserved.
+func (r *Reader) unreadLine(line string) {
+	r.peekLine, r.peeked = line, true
+	r.peekNum, r.peekOffset = r.lineNum, r.lineOffset
+}
+
+// unreadErr pushes back an error for a line to be returned by the next
+// call to readLineRaw.
+func (r *Reader) unreadErr(err error) {
+	r.unreadLine(r.lineText)
+	r.peekErr = err
+}
+
+// Position returns the line number and byte offset of the start of the
+// line most recently parsed. For multi-line links, this is the first
+// line of the link.
+func (r *Reader) Position() (line int, offset int64) {
+	return r.lineNum, r.lineOffset
+}
+
 func (r *Reader) err(err error) error {
 	if err == io.EOF || err == nil {
 		return err
 	}
-	return fmt.Errorf("beacon: line %d: %w", r.line, err)
+	if r.noLineNums {
+		setPosition(err, 0, r.lineText)
+		return fmt.Errorf("beacon: offset %d: %w", r.lineOffset, err)
+	}
+	setPosition(err, r.lineNum, r.lineText)
+	if strings.Count(r.lineText, "\x00") > len(r.lineText)/4 {
+		return fmt.Errorf("beacon: line %d, offset %d: %w (line has NUL bytes; the dump may be UTF-16 without a byte order mark)", r.lineNum, r.lineOffset, err)
+	}
+	return fmt.Errorf("beacon: line %d, offset %d: %w", r.lineNum, r.lineOffset, err)
 }
 
 func dropLineBreak(line string) string {
 	if len(line) > 0 && line[len(line)-1] == '\n' {
-		drop := 1
-		if len(line) > 1 && line[len(line)-2] == '\r' {
-			drop = 2
-		}
-		line = line[:len(line)-drop]
+		line = line[:len(line)-1]
+	}
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
 	}
 	return line
 }
@@ -271,3 +941,33 @@ func (l Link) String() string {
 	}
 	return fmt.Sprintf("%s|%s", l.Source, l.Target)
 }
+
+// Deleted reports whether the link has an empty target. In URLTeam
+// dumps, a line like "code|" records a shortcode that resolved to
+// nothing or was deleted. Blank lines following it are not joined as a
+// multi-line target. In RFC dumps, an empty target is instead derived
+// from the TARGET meta field.
+func (l *Link) Deleted() bool {
+	return l.Target == ""
+}
+
+// Count parses the annotation as a non-negative integer, such as a hit
+// count. It reports false when the annotation is not a count. The
+// meaning of annotations may be declared by the ANNOTATION meta field,
+// exposed by Header.Annotation.
+func (l *Link) Count() (int, bool) {
+	a := l.Annotation
+	if a == "" {
+		return 0, false
+	}
+	for i := 0; i < len(a); i++ {
+		if a[i] < '0' || a[i] > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(a)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -6,7 +6,18 @@
 
 package beacon
 
-import "testing"
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"golang.org/x/text/encoding/unicode"
+)
 
 func TestSplitMeta(t *testing.T) {
 	tests := []struct {
@@ -35,3 +46,592 @@ func TestSplitMeta(t *testing.T) {
 		}
 	}
 }
+
+func TestReadBlankLines(t *testing.T) {
+	tests := []struct {
+		dump         string
+		format       Format
+		shortcodeLen int
+		links        []Link
+	}{
+		{"#FORMAT: BEACON\n\n\nfoo|http://example.com/\n", RFC, 0,
+			[]Link{{"foo", "http://example.com/", ""}}},
+		{"#FORMAT: BEACON\nfoo|http://example.com/\n", RFC, 0,
+			[]Link{{"foo", "http://example.com/", ""}}},
+		{"abc|http://example.com/\n\nfoo\nxyz|http://example.org/\n", URLTeam, 3,
+			[]Link{{"abc", "http://example.com/\n\nfoo", ""}, {"xyz", "http://example.org/", ""}}},
+		{"abc|http://example.com/\n\n\nxyz|\n\n", URLTeam, 3,
+			[]Link{{"abc", "http://example.com/\n\n", ""}, {"xyz", "", ""}}},
+	}
+	for i, tt := range tests {
+		var r *Reader
+		if tt.format == URLTeam {
+			r = NewURLTeamReader(strings.NewReader(tt.dump), tt.shortcodeLen)
+		} else {
+			r = NewReader(strings.NewReader(tt.dump))
+		}
+		links, err := r.ReadAll()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(links, tt.links) {
+			t.Errorf("#%d: got %q, want %q", i, links, tt.links)
+		}
+	}
+}
+
+func TestReadBarInTarget(t *testing.T) {
+	dump := "#FORMAT: BEACON\n\na|b|http://example.com/?x=1|2\nc||http://example.com/||\nd|http://example.com/\n"
+	links, err := NewReader(strings.NewReader(dump)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Link{
+		{"a", "http://example.com/?x=1|2", "b"},
+		{"c", "http://example.com/||", ""},
+		{"d", "http://example.com/", ""},
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	dump := "\uFEFF#FORMAT: BEACON\n\nfoo|http://example.com/\n|1|http://example.com/\n"
+	r := NewReaderOptions(strings.NewReader(dump), &ReaderOptions{Strict: true})
+	if _, err := r.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if line, offset := r.Position(); line != 3 || offset != 20 {
+		t.Errorf("got line %d, offset %d, want line 3, offset 20", line, offset)
+	}
+	_, err := r.Read()
+	if err == nil || !strings.HasPrefix(err.Error(), "beacon: line 4, offset 44: ") {
+		t.Errorf("got error %v, want error at line 4, offset 44", err)
+	}
+
+	dump = "abc|http://example.com/\nfoo\nxyz|http://example.org/\n"
+	r = NewURLTeamReader(strings.NewReader(dump), 3)
+	for _, want := range []struct {
+		line   int
+		offset int64
+	}{{1, 0}, {3, 28}} {
+		if _, err := r.Read(); err != nil {
+			t.Fatal(err)
+		}
+		if line, offset := r.Position(); line != want.line || offset != want.offset {
+			t.Errorf("got line %d, offset %d, want line %d, offset %d", line, offset, want.line, want.offset)
+		}
+	}
+}
+
+func TestReadRFCTokens(t *testing.T) {
+	tests := []struct {
+		dump      string
+		hasTarget bool
+		links     []Link
+	}{
+		{"foo\nfoo|bar\nfoo|1|bar\n", false,
+			[]Link{{"foo", "", ""}, {"foo", "bar", ""}, {"foo", "bar", "1"}}},
+		{"#TARGET: {+ID}\n\nfoo|bar\n", false,
+			[]Link{{"foo", "bar", ""}}},
+		{"#TARGET: http://example.com/{ID}\n\nfoo\nfoo|bar\nfoo|1|bar\n", true,
+			[]Link{{"foo", "", ""}, {"foo", "", "bar"}, {"foo", "bar", "1"}}},
+		{"#TARGET: http://example.com/\n\nfoo|bar\n", true,
+			[]Link{{"foo", "", "bar"}}},
+	}
+	for i, tt := range tests {
+		r := NewReader(strings.NewReader(tt.dump))
+		links, err := r.ReadAll()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if r.HasTargetTemplate() != tt.hasTarget {
+			t.Errorf("#%d: HasTargetTemplate() = %t, want %t", i, !tt.hasTarget, tt.hasTarget)
+		}
+		if !reflect.DeepEqual(links, tt.links) {
+			t.Errorf("#%d: got %q, want %q", i, links, tt.links)
+		}
+	}
+}
+
+func TestSkipInvalid(t *testing.T) {
+	// Lines without a bar at the shortcode length are continuations, so
+	// only invalid lines before the first link are skipped.
+	dump := "ab|http://example.com/ab\n\x00\x9f\xff\x00garbage\nabc|http://example.com/\nxyz|http://example.org/\n"
+	r := NewReaderOptions(strings.NewReader(dump), &ReaderOptions{Format: URLTeam, ShortcodeLen: 3, SkipInvalid: true, MaxErrors: 1})
+	links, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Link{{"abc", "http://example.com/", ""}, {"xyz", "http://example.org/", ""}}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+	errs := r.Errors()
+	if len(errs) != 1 || errs[0].Line != 1 || errs[0].Text != "ab|http://example.com/ab\n" {
+		t.Errorf("got errors %v", errs)
+	}
+	if r.Skipped() != 2 {
+		t.Errorf("got %d skipped, want 2", r.Skipped())
+	}
+
+	dump = "no bar\nabc|http://example.com/\nabcd|http://example.org/\n"
+	r = NewReaderOptions(strings.NewReader(dump), &ReaderOptions{Format: URLTeam, SkipInvalid: true})
+	links, err = r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []Link{{"abc", "http://example.com/", ""}, {"abcd", "http://example.org/", ""}}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+	if errs := r.Errors(); len(errs) != 1 || errs[0].Line != 1 {
+		t.Errorf("got errors %v", errs)
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	dump := "#FORMAT: BEACON\n\nfoo\nbar\nbaz\n"
+	r := NewReader(strings.NewReader(dump))
+	if _, err := r.Read(); err != nil {
+		t.Fatal(err)
+	}
+	links, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Link{{"bar", "", ""}, {"baz", "", ""}}; !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+
+	dump = "foo\n|x\nbaz\n"
+	links, err = NewReaderOptions(strings.NewReader(dump), &ReaderOptions{Strict: true}).ReadAll()
+	if err == nil || !strings.HasPrefix(err.Error(), "beacon: line 2,") {
+		t.Errorf("got error %v, want error at line 2", err)
+	}
+	if want := []Link{{"foo", "", ""}}; !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	dump := "foo\nbar\n|x\nqux\n"
+	r := NewReaderOptions(strings.NewReader(dump), &ReaderOptions{Strict: true})
+	var links []Link
+	for link, err := range r.Links() {
+		if err != nil {
+			if !strings.HasPrefix(err.Error(), "beacon: line 3,") {
+				t.Errorf("got error %v, want error at line 3", err)
+			}
+			continue
+		}
+		links = append(links, *link)
+	}
+	if want := []Link{{"foo", "", ""}, {"bar", "", ""}}; !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+	// Resume after the error
+	links, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Link{{"qux", "", ""}}; !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+}
+
+func TestMaxLineLen(t *testing.T) {
+	long := "abc|http://example.com/" + strings.Repeat("a", 10000) + "\n"
+	dump := "foo|http://example.com/\n" + long + "bar|http://example.org/\n"
+	r := NewReaderOptions(strings.NewReader(dump), &ReaderOptions{Format: URLTeam, MaxLineLen: 5000})
+	if _, err := r.Read(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := r.Read()
+	var tooLong *LineTooLongError
+	if !errors.As(err, &tooLong) || !errors.Is(err, ErrLineTooLong) {
+		t.Fatalf("got error %v, want LineTooLongError", err)
+	}
+	if tooLong.Offset != 24 || tooLong.Prefix != long[:100] {
+		t.Errorf("got offset %d, prefix %q", tooLong.Offset, tooLong.Prefix)
+	}
+	link, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Link{"bar", "http://example.org/", ""}); *link != want {
+		t.Errorf("got %q, want %q", link, want)
+	}
+	if line, offset := r.Position(); line != 3 || offset != int64(24+len(long)) {
+		t.Errorf("got line %d, offset %d", line, offset)
+	}
+
+	r = NewReaderOptions(strings.NewReader(dump), &ReaderOptions{Format: URLTeam, MaxLineLen: 5000, SkipInvalid: true})
+	links, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 || len(r.Errors()) != 1 {
+		t.Errorf("got %d links and errors %v", len(links), r.Errors())
+	}
+}
+
+func TestReadURLTeamVariableMultiLine(t *testing.T) {
+	dump := "4e1|http://example.com/?q=a\nb\n" +
+		"4e2|http://example.com/a\r\nb\r\n" +
+		"4e3|http://example.com/\n\nhttp://example.org/a\n" +
+		"vanity|http://example.com/c\n"
+	want := []Link{
+		{"4e1", "http://example.com/?q=a\nb", ""},
+		{"4e2", "http://example.com/a\r\nb", ""},
+		{"4e3", "http://example.com/\n\nhttp://example.org/a", ""},
+		{"vanity", "http://example.com/c", ""},
+	}
+	r := NewURLTeamReader(strings.NewReader(dump), 0)
+	links, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+
+	// Only lines with a bar after exactly 3 characters are new links.
+	isContinuation := func(line string) bool {
+		return len(line) <= 3 || line[3] != '|'
+	}
+	want = append(want[:2], Link{"4e3", "http://example.com/\n\nhttp://example.org/a\nvanity|http://example.com/c", ""})
+	r = NewReaderOptions(strings.NewReader(dump), &ReaderOptions{Format: URLTeam, IsContinuation: isContinuation})
+	links, err = r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+}
+
+// BenchmarkReadMultiLine reads a dump with targets split across many
+// lines.
+func BenchmarkReadMultiLine(b *testing.B) {
+	var dump strings.Builder
+	for i := 0; i < 10; i++ {
+		dump.WriteString("abc|http://example.com/")
+		for j := 0; j < 1000; j++ {
+			dump.WriteString("\nline")
+		}
+		dump.WriteString("\n")
+	}
+	s := dump.String()
+	b.SetBytes(int64(len(s)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := NewURLTeamReader(strings.NewReader(s), 3)
+		if _, err := r.ReadAll(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	dumps := []string{
+		"#FORMAT: BEACON\n#TARGET: http://example.com/{ID}\n\nfoo|bar\nbaz\n",
+		"\uFEFF#NAME: test\n\nfoo|http://example.com/\n",
+		"foo|bar|baz\n",
+	}
+	r := NewReader(strings.NewReader(""))
+	for i, dump := range dumps {
+		fresh := NewReader(strings.NewReader(dump))
+		r.Reset(strings.NewReader(dump))
+		for _, r := range []*Reader{fresh, r} {
+			if _, err := r.Meta(); err != nil {
+				t.Fatalf("#%d: %v", i, err)
+			}
+		}
+		wantLinks, err := fresh.ReadAll()
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		links, err := r.ReadAll()
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(r.meta, fresh.meta) || r.HasTargetTemplate() != fresh.HasTargetTemplate() {
+			t.Errorf("#%d: got meta %v, want %v", i, r.meta, fresh.meta)
+		}
+		if !reflect.DeepEqual(links, wantLinks) {
+			t.Errorf("#%d: got %q, want %q", i, links, wantLinks)
+		}
+		if line, offset := r.Position(); line != fresh.lineNum || offset != fresh.lineOffset {
+			t.Errorf("#%d: got position %d:%d, want %d:%d", i, line, offset, fresh.lineNum, fresh.lineOffset)
+		}
+	}
+
+	r.ResetURLTeam(strings.NewReader("abc|http://example.com/\nb\n"), 3)
+	links, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Link{{"abc", "http://example.com/\nb", ""}}; !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+
+	// The decompressor is still released by Close after Reset.
+	c := &countingCloser{}
+	r.closer = c
+	r.Reset(strings.NewReader(dumps[0]))
+	if err := r.Close(); err != nil || c.n != 1 {
+		t.Errorf("got %d closes, error %v, want 1 close after Reset", c.n, err)
+	}
+}
+
+type countingCloser struct{ n int }
+
+func (c *countingCloser) Close() error {
+	c.n++
+	return nil
+}
+
+func TestCRLineBreaks(t *testing.T) {
+	tests := []struct {
+		dump  string
+		opts  ReaderOptions
+		links []Link
+	}{
+		{"#FORMAT: BEACON\r\rfoo|http://example.com/\rbar\r", ReaderOptions{},
+			[]Link{{"foo", "http://example.com/", ""}, {"bar", "", ""}}},
+		{"#FORMAT: BEACON\r\n\r\nfoo|http://example.com/\r\nbar\r\n", ReaderOptions{},
+			[]Link{{"foo", "http://example.com/", ""}, {"bar", "", ""}}},
+		{"#FORMAT: BEACON\r\n\rfoo|http://example.com/\nbar\rbaz\r\nqux", ReaderOptions{},
+			[]Link{{"foo", "http://example.com/", ""}, {"bar", "", ""}, {"baz", "", ""}, {"qux", "", ""}}},
+		{"abc|http://example.com/\rabd|http://example.com/a\rb\r\n", ReaderOptions{Format: URLTeam, ShortcodeLen: 3},
+			[]Link{{"abc", "http://example.com/", ""}, {"abd", "http://example.com/a\rb", ""}}},
+	}
+	for i, tt := range tests {
+		tt.opts.CRLineBreaks = true
+		for _, oneByte := range []bool{false, true} {
+			var rd io.Reader = strings.NewReader(tt.dump)
+			if oneByte {
+				rd = iotest.OneByteReader(rd)
+			}
+			r := NewReaderOptions(rd, &tt.opts)
+			links, err := r.ReadAll()
+			if err != nil {
+				t.Errorf("#%d: %v", i, err)
+				continue
+			}
+			if !reflect.DeepEqual(links, tt.links) {
+				t.Errorf("#%d: got %q, want %q", i, links, tt.links)
+			}
+		}
+	}
+
+	// Without CRLineBreaks, a CR-only file is a single line.
+	r := NewReader(strings.NewReader("foo\rbar\r"))
+	links, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Link{{"foo\rbar", "", ""}}; !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+}
+
+func TestUTF16(t *testing.T) {
+	const dump = "#FORMAT: BEACON\n\nfoo|http://example.com/é\n"
+	want := []Link{{"foo", "http://example.com/é", ""}}
+	for _, order := range []unicode.Endianness{unicode.LittleEndian, unicode.BigEndian} {
+		enc := unicode.UTF16(order, unicode.UseBOM).NewEncoder()
+		b, err := enc.Bytes([]byte(dump))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewAutoReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		links, err := r.ReadAll()
+		if err != nil {
+			t.Errorf("%v: %v", order, err)
+		} else if !reflect.DeepEqual(links, want) {
+			t.Errorf("%v: got %q, want %q", order, links, want)
+		}
+		if meta := r.meta; len(meta) != 1 || meta[0] != (MetaField{"FORMAT", "BEACON"}) {
+			t.Errorf("%v: got meta %v", order, meta)
+		}
+	}
+
+	// Without a byte order mark, the error hints at the encoding.
+	b, err := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().Bytes([]byte(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewReader(bytes.NewReader(b)).ReadAll()
+	if err == nil || !strings.Contains(err.Error(), "UTF-16") {
+		t.Errorf("got error %v, want UTF-16 hint", err)
+	}
+}
+
+func TestLinkCount(t *testing.T) {
+	tests := []struct {
+		annotation string
+		count      int
+		ok         bool
+	}{
+		{"0", 0, true},
+		{"42", 42, true},
+		{"007", 7, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"+1", 0, false},
+		{"1.5", 0, false},
+		{"label", 0, false},
+		{"99999999999999999999", 0, false},
+	}
+	for _, tt := range tests {
+		l := Link{Source: "foo", Annotation: tt.annotation}
+		if count, ok := l.Count(); count != tt.count || ok != tt.ok {
+			t.Errorf("Count(%q) = %d, %t, want %d, %t", tt.annotation, count, ok, tt.count, tt.ok)
+		}
+	}
+}
+
+func TestMetaValue(t *testing.T) {
+	r := NewReader(strings.NewReader("#FORMAT: BEACON\n#NAME: a\n#TARGET: {+ID}\n#NAME: b\n#TARGET: http://example.com/{ID}\n\nfoo|bar\n"))
+	if _, err := r.Meta(); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := r.MetaValue("NAME"); v != "b" || !ok {
+		t.Errorf("MetaValue(NAME) = %q, %t, want b, true", v, ok)
+	}
+	if v, ok := r.MetaValue("name"); v != "" || ok {
+		t.Errorf("MetaValue(name) = %q, %t, want false", v, ok)
+	}
+	if v := r.MetaValues("NAME"); !reflect.DeepEqual(v, []string{"a", "b"}) {
+		t.Errorf("MetaValues(NAME) = %q", v)
+	}
+	if v := r.MetaValues("PREFIX"); v != nil {
+		t.Errorf("MetaValues(PREFIX) = %q", v)
+	}
+	if d := r.DuplicateMeta(); !reflect.DeepEqual(d, []string{"NAME", "TARGET"}) {
+		t.Errorf("DuplicateMeta() = %q", d)
+	}
+	// The last TARGET is used, as in the resolver.
+	if !r.HasTargetTemplate() {
+		t.Error("HasTargetTemplate() = false")
+	}
+}
+
+func TestParseMetaLine(t *testing.T) {
+	m, err := ParseMetaLine("#PREFIX: http://example.org/\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MetaField{"PREFIX", "http://example.org/"}); m != want {
+		t.Errorf("got %v, want %v", m, want)
+	}
+	for _, line := range []string{"PREFIX: x", "#Prefix: x", "#PREFIX"} {
+		var serr *SyntaxError
+		if _, err := ParseMetaLine(line); !errors.As(err, &serr) {
+			t.Errorf("ParseMetaLine(%q) got error %v, want *SyntaxError", line, err)
+		}
+	}
+}
+
+func TestSourcePattern(t *testing.T) {
+	// The second link has a multi-line target, so the pattern is checked
+	// against the sliced shortcode.
+	dump := "abc|http://example.com/1\nab1|http://example.com/\n2\nAB_|http://example.com/3\nxyz|http://example.com/4\n"
+	opts := &ReaderOptions{Format: URLTeam, ShortcodeLen: 3, SourcePattern: regexp.MustCompile(`^[a-z0-9]{3}$`)}
+	r := NewReaderOptions(strings.NewReader(dump), opts)
+	links, err := r.ReadAll()
+	var serr *SyntaxError
+	if !errors.As(err, &serr) || serr.Kind != InvalidSource || serr.Line != 4 {
+		t.Fatalf("got error %v, want %v at line 4", err, InvalidSource)
+	}
+	if !strings.Contains(err.Error(), `"AB_"`) {
+		t.Errorf("error %q does not name the shortcode", err)
+	}
+	want := []Link{{"abc", "http://example.com/1", ""}, {"ab1", "http://example.com/\n2", ""}}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+
+	opts.SkipInvalid = true
+	r = NewReaderOptions(strings.NewReader(dump), opts)
+	links, err = r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, Link{"xyz", "http://example.com/4", ""})
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+	if errs := r.Errors(); r.Skipped() != 1 || len(errs) != 1 || errs[0].Line != 4 {
+		t.Errorf("got %d skipped, errors %v", r.Skipped(), errs)
+	}
+}
+
+func TestDeleted(t *testing.T) {
+	// Blank lines after an empty target are discarded and other lines
+	// that look like continuations are not joined, so "foo" is invalid.
+	const dump = "abc|\n\nxyz|http://example.com/\nabd|\nfoo\nabe|http://example.org/\n"
+	opts := &ReaderOptions{Format: URLTeam, ShortcodeLen: 3, SkipInvalid: true}
+	r := NewReaderOptions(strings.NewReader(dump), opts)
+	links, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Link{{"abc", "", ""}, {"xyz", "http://example.com/", ""}, {"abd", "", ""}, {"abe", "http://example.org/", ""}}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+	for i, link := range links {
+		if deleted := link.Target == ""; link.Deleted() != deleted {
+			t.Errorf("#%d: Deleted() = %t", i, !deleted)
+		}
+	}
+	if errs := r.Errors(); r.Skipped() != 1 || len(errs) != 1 || errs[0].Line != 5 {
+		t.Errorf("got %d skipped, errors %v", r.Skipped(), errs)
+	}
+
+	opts.SkipEmptyTargets = true
+	links, err = NewReaderOptions(strings.NewReader(dump), opts).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Link{want[1], want[3]}; !reflect.DeepEqual(links, want) {
+		t.Errorf("SkipEmptyTargets: got %q, want %q", links, want)
+	}
+
+	r = NewURLTeamReader(strings.NewReader(dump), 3)
+	if err := r.Skip(2); err != nil {
+		t.Fatal(err)
+	}
+	if link, err := r.Read(); err != nil || *link != want[2] {
+		t.Errorf("after Skip: got %v, %v, want %v", link, err, want[2])
+	}
+
+	// Deleted links are written as "code|".
+	var b strings.Builder
+	w := NewURLTeamWriter(&b)
+	for _, link := range want {
+		if err := w.WriteLink(&link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	links, err = NewURLTeamReader(strings.NewReader(b.String()), 3).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("round trip: got %q, want %q", links, want)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Resolver expands link tokens into absolute URLs using the PREFIX and
+// TARGET URI patterns from the header, as defined in section 3.3.
+type Resolver struct {
+	Prefix string // PREFIX meta field, e.g. "http://example.org/{ID}"
+	Target string // TARGET meta field, e.g. "http://example.com/{ID}"
+}
+
+// NewResolver constructs a resolver from the meta fields in a header.
+// Omitted fields default to "{+ID}".
+func NewResolver(meta []MetaField) *Resolver {
+	r := &Resolver{Prefix: "{+ID}", Target: "{+ID}"}
+	for _, m := range meta {
+		switch m.Name {
+		case "PREFIX":
+			r.Prefix = m.Value
+		case "TARGET":
+			r.Target = m.Value
+		}
+	}
+	return r
+}
+
+// ResolveLink expands the source and target of a link into absolute
+// URLs using the meta fields of the header.
+func (r *Reader) ResolveLink(l *Link) (sourceURL, targetURL *url.URL, err error) {
+	meta, err := r.Meta()
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewResolver(meta).Resolve(l)
+}
+
+// Resolve expands the source and target of a link into absolute URLs.
+// When the link has no target token and TARGET is a template, the
+// source is expanded with TARGET instead. The target URL is nil when
+// the link has no target.
+func (r *Resolver) Resolve(l *Link) (sourceURL, targetURL *url.URL, err error) {
+	sourceURL, targetURL, err = r.resolve(l)
+	if err != nil {
+		return nil, nil, fmt.Errorf("beacon: %w", err)
+	}
+	return sourceURL, targetURL, nil
+}
+
+func (r *Resolver) resolve(l *Link) (sourceURL, targetURL *url.URL, err error) {
+	sourceURL, err = url.Parse(expandTemplate(r.Prefix, l.Source))
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolve source: %w", err)
+	}
+	id := l.Target
+	if id == "" {
+		if r.Target == "" || r.Target == "{+ID}" {
+			return sourceURL, nil, nil
+		}
+		id = l.Source
+	}
+	targetURL, err = url.Parse(expandTemplate(r.Target, id))
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolve target: %w", err)
+	}
+	return sourceURL, targetURL, nil
+}
+
+// expandTemplate substitutes id into a URI pattern. {ID} is replaced
+// with the percent-encoded id and {+ID} is replaced with the id with
+// reserved characters unencoded. A pattern without either has {ID}
+// appended.
+func expandTemplate(template, id string) string {
+	if template == "" {
+		template = "{+ID}"
+	}
+	if !strings.Contains(template, "{ID}") && !strings.Contains(template, "{+ID}") {
+		return template + escapeID(id, false)
+	}
+	template = strings.ReplaceAll(template, "{ID}", escapeID(id, false))
+	return strings.ReplaceAll(template, "{+ID}", escapeID(id, true))
+}
+
+// escapeID percent-encodes characters not permitted in simple string
+// expansion or, when reserved is set, in reserved expansion, as defined
+// in RFC 6570.
+func escapeID(id string, reserved bool) string {
+	var b strings.Builder
+	for i := 0; i < len(id); i++ {
+		ch := id[i]
+		switch {
+		case isUnreserved(ch),
+			reserved && strings.IndexByte(":/?#[]@!$&'()*+,;=", ch) != -1,
+			reserved && ch == '%' && i+2 < len(id) && isHex(id[i+1]) && isHex(id[i+2]):
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func isUnreserved(ch byte) bool {
+	return 'A' <= ch && ch <= 'Z' || 'a' <= ch && ch <= 'z' || '0' <= ch && ch <= '9' ||
+		ch == '-' || ch == '.' || ch == '_' || ch == '~'
+}
+
+func isHex(ch byte) bool {
+	return '0' <= ch && ch <= '9' || 'A' <= ch && ch <= 'F' || 'a' <= ch && ch <= 'f'
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		prefix, target string
+		link           Link
+		source, dest   string
+	}{
+		{"{+ID}", "{+ID}", Link{"http://example.org/a", "http://example.com/b", ""}, "http://example.org/a", "http://example.com/b"},
+		{"http://example.org/", "", Link{"a b", "", ""}, "http://example.org/a%20b", ""},
+		{"http://example.org/{ID}.html", "http://example.com/{ID}", Link{"a/b", "", "1"}, "http://example.org/a%2Fb.html", "http://example.com/a%2Fb"},
+		{"http://example.org/{+ID}", "http://example.com/?q={ID}", Link{"a/b", "x&y", ""}, "http://example.org/a/b", "http://example.com/?q=x%26y"},
+		{"http://example.org/{+ID}", "{+ID}", Link{"100%25", "http://example.com/a|b", ""}, "http://example.org/100%25", "http://example.com/a%7Cb"},
+	}
+	for i, tt := range tests {
+		r := &Resolver{tt.prefix, tt.target}
+		source, target, err := r.Resolve(&tt.link)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if source.String() != tt.source {
+			t.Errorf("#%d: source got %q, want %q", i, source, tt.source)
+		}
+		if (target == nil && tt.dest != "") || (target != nil && target.String() != tt.dest) {
+			t.Errorf("#%d: target got %v, want %q", i, target, tt.dest)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import "io"
+
+// Scanner reads links from a Reader with an interface like
+// bufio.Scanner. Successive calls to Scan step through the links,
+// stopping at EOF or the first error. Options, such as the format and
+// SkipInvalid, are those of the Reader.
+type Scanner struct {
+	r    *Reader
+	link Link
+	err  error
+	done bool
+}
+
+// NewScanner constructs a scanner that reads links from r.
+func NewScanner(r *Reader) *Scanner {
+	return &Scanner{r: r}
+}
+
+// Scan advances to the next link, which is then available through
+// Link. It returns false when there are no more links, either at EOF or
+// on an error. After Scan returns false, Err returns any error that
+// occurred, except that it is nil at EOF.
+func (s *Scanner) Scan() bool {
+	if s.done {
+		return false
+	}
+	if err := s.r.ReadInto(&s.link); err != nil {
+		if err != io.EOF {
+			s.err = err
+		}
+		s.link = Link{}
+		s.done = true
+		return false
+	}
+	return true
+}
+
+// Link returns the most recent link read by Scan. It is overwritten by
+// the next call to Scan, so it must be copied to be retained.
+func (s *Scanner) Link() *Link {
+	return &s.link
+}
+
+// Err returns the first non-EOF error encountered by Scan.
+func (s *Scanner) Err() error {
+	return s.err
+}
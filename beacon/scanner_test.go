@@ -0,0 +1,44 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanner(t *testing.T) {
+	tests := []struct {
+		dump string
+		opts *ReaderOptions
+		want []Link
+		err  bool
+	}{
+		{"abc|http://example.com/\nxyz|http://example.org/\n", &ReaderOptions{Format: URLTeam, ShortcodeLen: 3},
+			[]Link{{"abc", "http://example.com/", ""}, {"xyz", "http://example.org/", ""}}, false},
+		{"foo\n|x\nbaz\n", &ReaderOptions{Strict: true}, []Link{{"foo", "", ""}}, true},
+		{"foo\n|x\nbaz\n", &ReaderOptions{Strict: true, SkipInvalid: true}, []Link{{"foo", "", ""}, {"baz", "", ""}}, false},
+		{"", nil, nil, false},
+	}
+	for i, tt := range tests {
+		s := NewScanner(NewReaderOptions(strings.NewReader(tt.dump), tt.opts))
+		var links []Link
+		for s.Scan() {
+			links = append(links, *s.Link())
+		}
+		if !reflect.DeepEqual(links, tt.want) {
+			t.Errorf("#%d: got %q, want %q", i, links, tt.want)
+		}
+		if (s.Err() != nil) != tt.err {
+			t.Errorf("#%d: got error %v", i, s.Err())
+		}
+		if s.Scan() {
+			t.Errorf("#%d: Scan returned true after stopping", i)
+		}
+	}
+}
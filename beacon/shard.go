@@ -0,0 +1,214 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxOpenShards is the default maximum number of shard files
+// kept open by a Sharder.
+const DefaultMaxOpenShards = 64
+
+// UnderflowShard is the name of the shard for sources shorter than the
+// prefix length.
+const UnderflowShard = "_underflow"
+
+// Sharder partitions links into files by source prefix. Each shard is
+// written to dir/<prefix>.beacon, which is created when its first link
+// is written. Characters other than lowercase ASCII letters, digits,
+// and '-' are escaped in file names as %XX, so that prefixes that
+// differ only in case have distinct files on case-insensitive file
+// systems.
+type Sharder struct {
+	// MaxOpen is the maximum number of shard files kept open. The least
+	// recently used file is closed when the limit is reached and is
+	// reopened for appending when needed again. It is
+	// DefaultMaxOpenShards when <=0.
+	MaxOpen int
+
+	dir       string
+	prefixLen int
+	format    Format
+	meta      []MetaField
+	shards    map[string]*shard
+	open      list.List // open shards, most recently used first
+}
+
+type shard struct {
+	name  string
+	count int64
+	f     *os.File
+	w     *Writer
+	elem  *list.Element
+}
+
+// NewSharder constructs a sharder that writes links with the first
+// prefixLen bytes of the source as the prefix. Shards are written with
+// the URLTeam or RFC writer according to format and, for RFC, start
+// with the given meta fields.
+func NewSharder(dir string, prefixLen int, format Format, meta []MetaField) *Sharder {
+	return &Sharder{
+		dir:       dir,
+		prefixLen: prefixLen,
+		format:    format,
+		meta:      meta,
+		shards:    make(map[string]*shard),
+	}
+}
+
+// WriteLink writes a link to the shard for its source prefix.
+func (s *Sharder) WriteLink(l *Link) error {
+	name := UnderflowShard
+	if len(l.Source) >= s.prefixLen {
+		name = shardName(l.Source[:s.prefixLen])
+	}
+	sh, ok := s.shards[name]
+	if !ok {
+		sh = &shard{name: name}
+		s.shards[name] = sh
+	}
+	if err := s.openShard(sh); err != nil {
+		return err
+	}
+	if err := sh.w.WriteLink(l); err != nil {
+		return err
+	}
+	sh.count++
+	return nil
+}
+
+// openShard opens the file for a shard, if not already open, and marks
+// it as most recently used.
+func (s *Sharder) openShard(sh *shard) error {
+	if sh.f != nil {
+		s.open.MoveToFront(sh.elem)
+		return nil
+	}
+	maxOpen := s.MaxOpen
+	if maxOpen <= 0 {
+		maxOpen = DefaultMaxOpenShards
+	}
+	for s.open.Len() >= maxOpen {
+		if err := s.closeShard(s.open.Back().Value.(*shard)); err != nil {
+			return err
+		}
+	}
+	reopen := sh.count != 0
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if reopen {
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, sh.name+".beacon"), flag, 0o666)
+	if err != nil {
+		return err
+	}
+	if s.format == URLTeam {
+		sh.w = NewURLTeamWriter(f)
+	} else {
+		sh.w = NewWriter(f)
+		if reopen {
+			sh.w.linkWritten = true
+			sh.w.hasTarget = hasTargetTemplate(s.meta)
+		} else if len(s.meta) != 0 {
+			if err := sh.w.WriteMeta(s.meta); err != nil {
+				f.Close()
+				return err
+			}
+		}
+	}
+	sh.f = f
+	sh.elem = s.open.PushFront(sh)
+	return nil
+}
+
+func (s *Sharder) closeShard(sh *shard) error {
+	s.open.Remove(sh.elem)
+	err := sh.w.Flush()
+	if err1 := sh.f.Close(); err == nil {
+		err = err1
+	}
+	sh.f, sh.w, sh.elem = nil, nil, nil
+	return err
+}
+
+// Close flushes and closes all open shard files.
+func (s *Sharder) Close() error {
+	var errs []error
+	for s.open.Len() != 0 {
+		errs = append(errs, s.closeShard(s.open.Front().Value.(*shard)))
+	}
+	return errors.Join(errs...)
+}
+
+// Counts returns the number of links written to each shard, keyed by
+// shard name.
+func (s *Sharder) Counts() map[string]int64 {
+	counts := make(map[string]int64, len(s.shards))
+	for name, sh := range s.shards {
+		counts[name] = sh.count
+	}
+	return counts
+}
+
+// shardName escapes a prefix for use as a file name. Uppercase letters
+// are escaped, since shortcodes are case-sensitive, but file names may
+// not be.
+func shardName(prefix string) string {
+	var b strings.Builder
+	for i := 0; i < len(prefix); i++ {
+		switch ch := prefix[i]; {
+		case 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9', ch == '-':
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// Shard reads the remaining links from r and partitions them into
+// files in dir by the first prefixLen bytes of the source, as described
+// by Sharder. RFC shards start with the header of r. It returns the
+// number of links written to each shard.
+func Shard(r *Reader, dir string, prefixLen int, format Format) (map[string]int64, error) {
+	if prefixLen <= 0 {
+		return nil, fmt.Errorf("beacon: invalid shard prefix length %d", prefixLen)
+	}
+	var meta []MetaField
+	if format != URLTeam {
+		var err error
+		if meta, err = r.Meta(); err != nil {
+			return nil, err
+		}
+	}
+	s := NewSharder(dir, prefixLen, format, meta)
+	var l Link
+	for {
+		err := r.ReadInto(&l)
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = s.WriteLink(&l)
+		}
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if err := s.Close(); err != nil {
+		return nil, err
+	}
+	return s.Counts(), nil
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShard(t *testing.T) {
+	const dump = "#FORMAT: BEACON\n#TARGET: http://example.com/{ID}\n\n" +
+		"aa1\n" +
+		"ab2|note\n" +
+		"b\n" +
+		"aa3|note|http://other.example/\n" +
+		"a/4\n"
+	dir := t.TempDir()
+	counts, err := Shard(NewReader(strings.NewReader(dump)), dir, 2, RFC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCounts := map[string]int64{"aa": 2, "ab": 1, "a%2F": 1, UnderflowShard: 1}
+	if !reflect.DeepEqual(counts, wantCounts) {
+		t.Errorf("got counts %v, want %v", counts, wantCounts)
+	}
+	want := map[string]string{
+		"aa":           "#FORMAT: BEACON\n#TARGET: http://example.com/{ID}\n\naa1\naa3|note|http://other.example/\n",
+		"ab":           "#FORMAT: BEACON\n#TARGET: http://example.com/{ID}\n\nab2|note\n",
+		"a%2F":         "#FORMAT: BEACON\n#TARGET: http://example.com/{ID}\n\na/4\n",
+		UnderflowShard: "#FORMAT: BEACON\n#TARGET: http://example.com/{ID}\n\nb\n",
+	}
+	checkShards(t, dir, want)
+}
+
+func TestSharderReopen(t *testing.T) {
+	dir := t.TempDir()
+	s := NewSharder(dir, 1, URLTeam, nil)
+	s.MaxOpen = 2
+	for _, code := range []string{"a1", "b1", "c1", "a2", "b2", "c2", "a3"} {
+		if err := s.WriteLink(&Link{Source: code, Target: "http://example.com/" + code}); err != nil {
+			t.Fatal(err)
+		}
+		if s.open.Len() > 2 {
+			t.Fatalf("%d files open", s.open.Len())
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkShards(t, dir, map[string]string{
+		"a": "a1|http://example.com/a1\na2|http://example.com/a2\na3|http://example.com/a3\n",
+		"b": "b1|http://example.com/b1\nb2|http://example.com/b2\n",
+		"c": "c1|http://example.com/c1\nc2|http://example.com/c2\n",
+	})
+}
+
+func TestShardCase(t *testing.T) {
+	const dump = "Ab1|http://example.com/1\nab2|http://example.com/2\nAb3|http://example.com/3\n"
+	dir := t.TempDir()
+	counts, err := Shard(NewURLTeamReader(strings.NewReader(dump), 3), dir, 2, URLTeam)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCounts := map[string]int64{"%41b": 2, "ab": 1}
+	if !reflect.DeepEqual(counts, wantCounts) {
+		t.Errorf("got counts %v, want %v", counts, wantCounts)
+	}
+	checkShards(t, dir, map[string]string{
+		"%41b": "Ab1|http://example.com/1\nAb3|http://example.com/3\n",
+		"ab":   "ab2|http://example.com/2\n",
+	})
+}
+
+func checkShards(t *testing.T, dir string, want map[string]string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want) {
+		t.Errorf("got %d shards, want %d", len(entries), len(want))
+	}
+	for name, w := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name+".beacon"))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(got) != w {
+			t.Errorf("shard %s: got %q, want %q", name, got, w)
+		}
+	}
+}
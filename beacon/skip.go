@@ -0,0 +1,125 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"bytes"
+	"io"
+)
+
+// Skip discards the next n links without parsing their targets, for
+// resuming a partially processed dump. The same links are discarded as
+// by n calls to Read, so links filtered by the options are not counted.
+// It returns io.EOF when the dump has fewer than n links. Line numbers
+// and offsets remain accurate for subsequent reads.
+func (r *Reader) Skip(n int) error {
+	if r.opts.SkipInvalid || r.opts.Strict || r.opts.ValidateURLs {
+		// Invalid links are only known once their targets are parsed.
+		var l Link
+		for ; n > 0; n-- {
+			if err := r.ReadInto(&l); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := r.skip(func([]byte) bool {
+		if n <= 0 {
+			return true
+		}
+		n--
+		return false
+	})
+	if err == io.EOF && n == 0 {
+		return nil
+	}
+	return err
+}
+
+// SkipToSource discards links until the first link with a source
+// greater than or equal to code, which is read next. The dump must be
+// sorted by source. It returns io.EOF when no such link exists.
+func (r *Reader) SkipToSource(code string) error {
+	return r.skip(func(source []byte) bool {
+		return string(source) >= code
+	})
+}
+
+// skip discards links until stop reports true for the source of a link,
+// which is pushed back to be read next. Links with empty targets are
+// discarded without calling stop when SkipEmptyTargets is set and links
+// with sources not matching SourcePattern are reported as errors, as
+// when read. Lines are read from the bufio buffer and only copied for
+// the pushed back link.
+func (r *Reader) skip(stop func(source []byte) bool) error {
+	if !r.metaRead {
+		if _, err := r.Meta(); err != nil {
+			return err
+		}
+	}
+	line, err := r.nextLineBytes()
+	for {
+		if err != nil {
+			return r.err(err)
+		}
+		source := line
+		if r.format == URLTeam {
+			i := -1
+			if r.sourceLen <= 0 {
+				i = bytes.IndexByte(line, '|')
+			} else if len(line) > r.sourceLen && line[r.sourceLen] == '|' {
+				i = r.sourceLen
+			}
+			if i == -1 {
+				// Parse the line to report the error.
+				r.unreadLine(string(line))
+				return r.err(r.readLink(&Link{}))
+			}
+			source = line[:i]
+		} else {
+			if i := bytes.IndexByte(line, '|'); i != -1 {
+				source = line[:i]
+			}
+			source = bytes.TrimRight(source, "\r\n")
+		}
+		deleted := r.format == URLTeam && isBlankLine(line[len(source)+1:])
+		if !deleted || !r.opts.SkipEmptyTargets {
+			if stop(source) {
+				r.unreadLine(string(line))
+				return nil
+			}
+			if r.opts.SourcePattern != nil && !r.opts.SourcePattern.Match(source) {
+				// Parse the line to report the error.
+				r.unreadLine(string(line))
+				return r.err(r.readLink(&Link{}))
+			}
+		}
+		if r.format != URLTeam {
+			line, err = r.readLineBytes()
+			continue
+		}
+		// Discard continuation lines of a multi-line target. The first
+		// line that is not a continuation starts the next link. After
+		// an empty target, only blank lines are discarded.
+		for {
+			line, err = r.readLineBytes()
+			if err != nil || !r.isContinuation(line) || deleted && !isBlankLine(line) {
+				break
+			}
+		}
+	}
+}
+
+// nextLineBytes reads the next line, like readLineBytes, but returns any
+// pushed back line first.
+func (r *Reader) nextLineBytes() ([]byte, error) {
+	if r.peeked {
+		line, err := r.readLineRaw()
+		return []byte(line), err
+	}
+	return r.readLineBytes()
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSkip(t *testing.T) {
+	const rfc = "#FORMAT: BEACON\n\naaa|1\nbbb|2\nccc|3\nddd|4\n|x\n"
+	const urlteam = "aaa|http://example.com/1\nbbb|http://example.com/2\n\nx\nccc|http://example.com/3\r\nddd|http://example.com/4\nbad\n"
+	tests := []struct {
+		dump   string
+		opts   ReaderOptions
+		skip   func(r *Reader) error
+		link   Link
+		line   int
+		offset int64
+		errPos string
+	}{
+		{rfc, ReaderOptions{Strict: true}, func(r *Reader) error { return r.Skip(2) },
+			Link{"ccc", "3", ""}, 5, 29, "beacon: line 7, offset 41: "},
+		{rfc, ReaderOptions{Strict: true}, func(r *Reader) error { return r.SkipToSource("bcd") },
+			Link{"ccc", "3", ""}, 5, 29, "beacon: line 7, offset 41: "},
+		{urlteam, ReaderOptions{Format: URLTeam, ShortcodeLen: 3}, func(r *Reader) error { return r.Skip(2) },
+			Link{"ccc", "http://example.com/3", ""}, 5, 53, ""},
+		{urlteam, ReaderOptions{Format: URLTeam}, func(r *Reader) error { return r.SkipToSource("ccc") },
+			Link{"ccc", "http://example.com/3", ""}, 5, 53, ""},
+	}
+	for i, tt := range tests {
+		r := NewReaderOptions(strings.NewReader(tt.dump), &tt.opts)
+		if err := tt.skip(r); err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		link, err := r.Read()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(*link, tt.link) {
+			t.Errorf("#%d: got %q, want %q", i, link, &tt.link)
+		}
+		if line, offset := r.Position(); line != tt.line || offset != tt.offset {
+			t.Errorf("#%d: got position %d:%d, want %d:%d", i, line, offset, tt.line, tt.offset)
+		}
+		if err := r.Skip(1); err != nil {
+			t.Errorf("#%d: %v", i, err)
+		}
+		_, err = r.Read()
+		if tt.errPos == "" && err != io.EOF {
+			t.Errorf("#%d: got error %v, want io.EOF", i, err)
+		} else if tt.errPos != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.errPos)) {
+			t.Errorf("#%d: got error %v, want prefix %q", i, err, tt.errPos)
+		}
+	}
+
+	r := NewURLTeamReader(strings.NewReader("bad\n"+urlteam), 3)
+	if err := r.SkipToSource("zzz"); err == nil || !strings.HasPrefix(err.Error(), "beacon: line 1, offset 0: ") {
+		t.Errorf("got error %v, want error for invalid line", err)
+	}
+	r = NewReader(strings.NewReader(rfc))
+	if err := r.Skip(10); err != io.EOF {
+		t.Errorf("got error %v, want io.EOF", err)
+	}
+}
+
+func TestSkipFilters(t *testing.T) {
+	const dump = "aaa|http://example.com/1\nbbb|\nc-c|http://example.com/3\nddd|\n\neee|http://example.com/5\nfff|http://example.com/6\n"
+	pattern := regexp.MustCompile("^[a-z]+$")
+	const invalid = "#FORMAT: BEACON\n\naaa|http://example.com/1\n|http://example.com/2\nccc|mailto:c\nddd|http://example.com/4\n"
+	for _, tt := range []struct {
+		dump string
+		opts ReaderOptions
+	}{
+		{dump, ReaderOptions{Format: URLTeam, SkipEmptyTargets: true}},
+		{dump, ReaderOptions{Format: URLTeam, SkipEmptyTargets: true, SourcePattern: pattern, SkipInvalid: true}},
+		{dump, ReaderOptions{Format: URLTeam, SourcePattern: pattern, SkipInvalid: true}},
+		{dump, ReaderOptions{Format: URLTeam, SkipEmptyTargets: true, SourcePattern: pattern}},
+		{invalid, ReaderOptions{Strict: true}},
+		{invalid, ReaderOptions{ValidateURLs: true}},
+		{invalid, ReaderOptions{Strict: true, ValidateURLs: true, SkipInvalid: true}},
+	} {
+		dump, opts := tt.dump, tt.opts
+		for n := 0; n <= 5; n++ {
+			want := NewReaderOptions(strings.NewReader(dump), &opts)
+			var wantErr error
+			for i := 0; i < n && wantErr == nil; i++ {
+				_, wantErr = want.Read()
+			}
+			wantLinks, wantReadErr := want.ReadAll()
+
+			r := NewReaderOptions(strings.NewReader(dump), &opts)
+			err := r.Skip(n)
+			if (err == nil) != (wantErr == nil) || err != nil && err.Error() != wantErr.Error() {
+				t.Errorf("%+v: Skip(%d): got error %v, want %v", opts, n, err, wantErr)
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			links, readErr := r.ReadAll()
+			if !reflect.DeepEqual(links, wantLinks) || (readErr == nil) != (wantReadErr == nil) {
+				t.Errorf("%+v: Skip(%d): got %q, %v, want %q, %v", opts, n, links, readErr, wantLinks, wantReadErr)
+			}
+		}
+	}
+}
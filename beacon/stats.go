@@ -0,0 +1,149 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+// Stats accumulates statistics of a link stream in constant memory.
+// Unique counts are estimated with HyperLogLog, which has a standard
+// error of about 1%. The zero value is ready to use.
+type Stats struct {
+	Links        int64 // number of links
+	MinSourceLen int   // length of the shortest source
+	MaxSourceLen int   // length of the longest source
+	TargetBytes  int64 // total length of targets
+
+	sources hyperLogLog
+	hosts   hyperLogLog
+}
+
+// CollectStats reads the remaining links from r and returns their
+// statistics.
+func CollectStats(r LinkReader) (*Stats, error) {
+	var s Stats
+	for {
+		link, err := r.Read()
+		if err == io.EOF {
+			return &s, nil
+		}
+		if err != nil {
+			return &s, err
+		}
+		s.Add(link)
+	}
+}
+
+// Add adds a link to the statistics.
+func (s *Stats) Add(l *Link) {
+	if s.Links == 0 || len(l.Source) < s.MinSourceLen {
+		s.MinSourceLen = len(l.Source)
+	}
+	if len(l.Source) > s.MaxSourceLen {
+		s.MaxSourceLen = len(l.Source)
+	}
+	s.Links++
+	s.TargetBytes += int64(len(l.Target))
+	s.sources.add(l.Source)
+	if host := targetHost(l.Target); host != "" {
+		s.hosts.add(strings.ToLower(host))
+	}
+}
+
+// UniqueSources returns the estimated number of distinct sources.
+func (s *Stats) UniqueSources() int64 {
+	return s.sources.estimate()
+}
+
+// UniqueHosts returns the estimated number of distinct target hosts.
+func (s *Stats) UniqueHosts() int64 {
+	return s.hosts.estimate()
+}
+
+// String formats the statistics on one line for logging.
+func (s *Stats) String() string {
+	return fmt.Sprintf("%d links, ~%d unique sources, ~%d unique target hosts, source length %d-%d, %d target bytes",
+		s.Links, s.UniqueSources(), s.UniqueHosts(), s.MinSourceLen, s.MaxSourceLen, s.TargetBytes)
+}
+
+// targetHost returns the host of an absolute URL, without parsing the
+// rest of the URL.
+func targetHost(target string) string {
+	i := strings.Index(target, "://")
+	if i == -1 {
+		return ""
+	}
+	host := target[i+3:]
+	if j := strings.IndexAny(host, "/?#"); j != -1 {
+		host = host[:j]
+	}
+	if j := strings.LastIndexByte(host, '@'); j != -1 {
+		host = host[j+1:]
+	}
+	if j := strings.LastIndexByte(host, ':'); j != -1 && !strings.HasSuffix(host, "]") {
+		host = host[:j]
+	}
+	return host
+}
+
+// hllPrecision is the number of hash bits used to select a register.
+const hllPrecision = 14
+
+// hyperLogLog estimates the number of distinct strings added, as
+// described by Flajolet et al. in "HyperLogLog: the analysis of a
+// near-optimal cardinality estimation algorithm".
+type hyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+func (h *hyperLogLog) add(s string) {
+	x := hash64(s)
+	i := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() int64 {
+	const m = 1 << hllPrecision
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	e := alpha * m * m / sum
+	if e <= 2.5*m && zeros != 0 {
+		// Linear counting for small cardinalities
+		e = m * math.Log(float64(m)/float64(zeros))
+	}
+	return int64(e + 0.5)
+}
+
+// hash64 hashes a string with FNV-1a, followed by the SplitMix64
+// finalizer to spread the bits.
+func hash64(s string) uint64 {
+	x := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		x ^= uint64(s[i])
+		x *= 1099511628211
+	}
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollectStats(t *testing.T) {
+	const n = 100_000
+	s, err := CollectStats(NewURLTeamReader(&linesReader{n: n, step: 1}, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Links != n || s.MinSourceLen != 8 || s.MaxSourceLen != 8 {
+		t.Errorf("got %d links with source length %d-%d", s.Links, s.MinSourceLen, s.MaxSourceLen)
+	}
+	if u := s.UniqueSources(); u < n*97/100 || u > n*103/100 {
+		t.Errorf("got %d unique sources, want about %d", u, n)
+	}
+	if u := s.UniqueHosts(); u != 1 {
+		t.Errorf("got %d unique hosts, want 1", u)
+	}
+
+	const dump = "abc|http://example.com/\nabcd|https://user@Example.com:443/a\nab|http://example.org\nabc|http://[::1]:80/\n"
+	s, err = CollectStats(NewURLTeamReader(strings.NewReader(dump), 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "4 links, ~3 unique sources, ~3 unique target hosts, source length 2-4, 83 target bytes"
+	if got := s.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
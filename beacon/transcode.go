@@ -0,0 +1,128 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TranscodeOptions contains options for converting a URLTeam dump to an
+// RFC dump.
+type TranscodeOptions struct {
+	ShortcodeLen int // fixed shortcode length; <=0 for variable
+
+	// Prefix is the base URL of the shortener, written as the PREFIX
+	// meta field, e.g. "https://tinyurl.com/".
+	Prefix string
+
+	// Target, when set, is written as the TARGET meta field and the
+	// expansion of the template is stripped from targets. Links with
+	// empty targets, which URLTeam uses for deleted shortcodes, are
+	// written as source-only lines. Other targets that do not match the
+	// template are an error, unless Mismatched is set.
+	Target string
+
+	// Mismatched, when set, is called with each link with a target that
+	// does not match the Target template, which is then skipped.
+	Mismatched func(l *Link)
+
+	Creator   string    // CREATOR meta field, when set
+	Timestamp time.Time // TIMESTAMP meta field; the current time when zero
+
+	// Progress, when set, is called with the number of links written
+	// every ProgressInterval links and after the last link, if not
+	// already reported.
+	Progress         func(links int64)
+	ProgressInterval int64
+}
+
+// Transcode converts a URLTeam-format link dump to an RFC-format link
+// dump with a synthesized header. Links are streamed, so memory use is
+// constant.
+func Transcode(dst io.Writer, src io.Reader, opts TranscodeOptions) error {
+	r := NewURLTeamReader(src, opts.ShortcodeLen)
+	w := NewWriter(dst)
+	timestamp := opts.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	meta := []MetaField{{"FORMAT", "BEACON"}}
+	if opts.Prefix != "" {
+		meta = append(meta, MetaField{"PREFIX", opts.Prefix})
+	}
+	if opts.Target != "" {
+		meta = append(meta, MetaField{"TARGET", opts.Target})
+	}
+	if opts.Creator != "" {
+		meta = append(meta, MetaField{"CREATOR", opts.Creator})
+	}
+	meta = append(meta, MetaField{"TIMESTAMP", timestamp.UTC().Format(time.RFC3339)})
+	if err := w.WriteMeta(meta); err != nil {
+		return err
+	}
+	template := hasTargetTemplate(meta)
+	var n int64
+	for {
+		link, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if template && link.Target != "" {
+			id, ok := unexpandTemplate(opts.Target, link.Target)
+			if !ok && opts.Mismatched != nil {
+				opts.Mismatched(link)
+				continue
+			}
+			if !ok {
+				return fmt.Errorf("beacon: target for shortcode %q does not match TARGET template: %q", link.Source, link.Target)
+			}
+			link.Target = id
+		}
+		if err := w.WriteLink(link); err != nil {
+			return err
+		}
+		n++
+		if opts.Progress != nil && opts.ProgressInterval > 0 && n%opts.ProgressInterval == 0 {
+			opts.Progress(n)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if opts.Progress != nil && (n == 0 || opts.ProgressInterval <= 0 || n%opts.ProgressInterval != 0) {
+		opts.Progress(n)
+	}
+	return nil
+}
+
+// unexpandTemplate is the inverse of expandTemplate. It reports whether
+// expanding the template with the returned id yields s.
+func unexpandTemplate(template, s string) (id string, ok bool) {
+	prefix, suffix := template, ""
+	if i := strings.Index(template, "{ID}"); i != -1 {
+		prefix, suffix = template[:i], template[i+len("{ID}"):]
+	} else if i := strings.Index(template, "{+ID}"); i != -1 {
+		prefix, suffix = template[:i], template[i+len("{+ID}"):]
+	}
+	if !strings.HasPrefix(s, prefix) || !strings.HasSuffix(s[len(prefix):], suffix) {
+		return "", false
+	}
+	id = s[len(prefix) : len(s)-len(suffix)]
+	if unescaped, err := url.PathUnescape(id); err == nil {
+		if expandTemplate(template, unescaped) == s {
+			return unescaped, true
+		}
+	}
+	return id, expandTemplate(template, id) == s
+}
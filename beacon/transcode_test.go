@@ -0,0 +1,79 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTranscode(t *testing.T) {
+	const dump = "abc|http://example.com/a\nxyz|http://example.com/b%20c\n"
+	timestamp := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		opts TranscodeOptions
+		want string
+	}{
+		{TranscodeOptions{ShortcodeLen: 3, Prefix: "https://tinyurl.com/", Timestamp: timestamp},
+			"#FORMAT: BEACON\n#PREFIX: https://tinyurl.com/\n#TIMESTAMP: 2021-03-01T12:00:00Z\n\n" +
+				"abc|http://example.com/a\nxyz|http://example.com/b%20c\n"},
+		{TranscodeOptions{Target: "http://example.com/{ID}", Creator: "URLTeam", Timestamp: timestamp},
+			"#FORMAT: BEACON\n#TARGET: http://example.com/{ID}\n#CREATOR: URLTeam\n#TIMESTAMP: 2021-03-01T12:00:00Z\n\n" +
+				"abc||a\nxyz||b c\n"},
+	}
+	for i, tt := range tests {
+		var b strings.Builder
+		if err := Transcode(&b, strings.NewReader(dump), tt.opts); err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("#%d: got %q, want %q", i, got, tt.want)
+		}
+	}
+
+	var progress []int64
+	opts := TranscodeOptions{Progress: func(n int64) { progress = append(progress, n) }, ProgressInterval: 1}
+	if err := Transcode(&strings.Builder{}, strings.NewReader(dump), opts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(progress, []int64{1, 2}) {
+		t.Errorf("got progress %v", progress)
+	}
+
+	opts = TranscodeOptions{Target: "http://example.org/{ID}"}
+	if err := Transcode(&strings.Builder{}, strings.NewReader(dump), opts); err == nil {
+		t.Error("unmatched target got no error")
+	}
+
+	// Deleted shortcodes are written without targets and mismatched
+	// targets can be skipped.
+	const mixed = "abc|http://example.com/a\ndel|\nxyz|http://example.org/b\n"
+	var mismatched []string
+	opts = TranscodeOptions{
+		Target:     "http://example.com/{ID}",
+		Timestamp:  timestamp,
+		Mismatched: func(l *Link) { mismatched = append(mismatched, l.Source) },
+	}
+	var b strings.Builder
+	if err := Transcode(&b, strings.NewReader(mixed), opts); err != nil {
+		t.Fatal(err)
+	}
+	want := "#FORMAT: BEACON\n#TARGET: http://example.com/{ID}\n#TIMESTAMP: 2021-03-01T12:00:00Z\n\nabc||a\ndel\n"
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(mismatched, []string{"xyz"}) {
+		t.Errorf("got mismatched %q, want [xyz]", mismatched)
+	}
+	opts.Mismatched = nil
+	if err := Transcode(&strings.Builder{}, strings.NewReader("abc|http://example.com/a\ndel|\n"), opts); err != nil {
+		t.Errorf("got error %v for deleted shortcode", err)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Validate reads an RFC-format link dump in strict mode and returns all
+// violations, rather than stopping at the first.
+func Validate(r io.Reader) []error {
+	br := NewReader(r)
+	meta, err := br.Meta()
+	if err != nil {
+		return []error{err}
+	}
+	var errs []error
+	for i, m := range meta {
+		if err := checkMetaStrict(m, meta[:i]); err != nil {
+			line := br.metaLines[i]
+			setPosition(err, line, "")
+			errs = append(errs, fmt.Errorf("beacon: line %d: %w", line, err))
+		}
+	}
+	br.opts.Strict = true
+	for {
+		_, err := br.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if br.readErr != nil {
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// checkLinkURLs checks that the target and, when absolute, the source
+// of a link are URLs with an allowed scheme and without control
+// characters.
+func (r *Reader) checkLinkURLs(l *Link) error {
+	// Check before expansion, which percent-encodes control characters.
+	for _, tok := range []struct{ name, s string }{{"source", l.Source}, {"target", l.Target}} {
+		if i := strings.IndexFunc(tok.s, isControl); i != -1 {
+			return syntaxError(ControlChar, 0, "%s has control character %q: %q", tok.name, tok.s[i], tok.s)
+		}
+	}
+	if r.resolver == nil {
+		r.resolver = NewResolver(r.meta)
+	}
+	sourceURL, targetURL, err := r.resolver.resolve(l)
+	if err != nil {
+		serr := syntaxError(InvalidURL, 0, "%v", err)
+		serr.Err = err
+		return serr
+	}
+	if sourceURL.IsAbs() {
+		if err := r.checkScheme("source", sourceURL); err != nil {
+			return err
+		}
+	}
+	if targetURL != nil {
+		return r.checkScheme("target", targetURL)
+	}
+	return nil
+}
+
+func (r *Reader) checkScheme(name string, u *url.URL) error {
+	schemes := r.opts.AllowedSchemes
+	if schemes == nil {
+		schemes = DefaultAllowedSchemes
+	}
+	if !slices.Contains(schemes, strings.ToLower(u.Scheme)) {
+		return syntaxError(DisallowedScheme, 0, "%s has disallowed scheme %q: %q", name, u.Scheme, u)
+	}
+	return nil
+}
+
+func isControl(ch rune) bool {
+	return ch < 0x20 || ch == 0x7f
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStrict(t *testing.T) {
+	tests := []string{
+		"#FOO: bar\n\nfoo\n",
+		"#NAME: a\n#NAME: b\n\nfoo\n",
+		"#FORMAT: BEACON2\n\nfoo\n",
+		"#FORMAT: BEACON\n\n|http://example.com/\n",
+		"#FORMAT: BEACON\n\nfoo|http://[::1\n",
+		"#FORMAT: BEACON\n#PREFIX: http://[::1/\n\nfoo\n",
+	}
+	for i, dump := range tests {
+		r := NewReaderOptions(strings.NewReader(dump), &ReaderOptions{Strict: true})
+		if _, err := r.ReadAll(); err == nil {
+			t.Errorf("#%d: strict read of %q got no error", i, dump)
+		}
+		r = NewReader(strings.NewReader(dump))
+		if _, err := r.ReadAll(); err != nil {
+			t.Errorf("#%d: lenient read of %q: %v", i, dump, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dump := "#FORMAT: BEACON2\n#FOO: bar\n#NAME: a\n#NAME: b\n\nfoo\n|http://example.com/\nbar|http://[::1\n"
+	want := []string{
+		"beacon: line 1: FORMAT not BEACON",
+		"beacon: line 2: unknown meta field",
+		"beacon: line 4: duplicate meta field",
+		"beacon: line 7, offset 50: link has empty source",
+		"beacon: line 8, offset 71: resolve target",
+	}
+	errs := Validate(strings.NewReader(dump))
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors %q, want %d", len(errs), errs, len(want))
+	}
+	for i, err := range errs {
+		if !strings.HasPrefix(err.Error(), want[i]) {
+			t.Errorf("#%d: got error %q, want prefix %q", i, err, want[i])
+		}
+	}
+
+	// Meta errors are on the lines of their fields after a BOM too.
+	errs = Validate(strings.NewReader("\uFEFF" + dump))
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors %q with BOM, want %d", len(errs), errs, len(want))
+	}
+	for i, err := range errs[:3] {
+		if !strings.HasPrefix(err.Error(), want[i]) {
+			t.Errorf("#%d: got error %q with BOM, want prefix %q", i, err, want[i])
+		}
+	}
+}
+
+func TestValidateURLs(t *testing.T) {
+	const dump = "abc|http://example.com/\n" +
+		"abd|htp:/example\n" +
+		"abe|https://example.com/a\tb\n" +
+		"abf|example.com\n" +
+		"abg|mailto:a@example.com\n" +
+		"abh|FTP://example.com/\n" +
+		"abi|http://[::1\n"
+	opts := &ReaderOptions{Format: URLTeam, ShortcodeLen: 3, ValidateURLs: true, SkipInvalid: true}
+	r := NewReaderOptions(strings.NewReader(dump), opts)
+	links, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Link{
+		{"abc", "http://example.com/", ""},
+		{"abg", "mailto:a@example.com", ""},
+		{"abh", "FTP://example.com/", ""},
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+	if r.InvalidURLs() != 4 || r.Skipped() != 0 {
+		t.Errorf("got %d invalid URLs and %d skipped, want 4 and 0", r.InvalidURLs(), r.Skipped())
+	}
+	wantKinds := []SyntaxKind{DisallowedScheme, ControlChar, DisallowedScheme, InvalidURL}
+	for i, e := range r.Errors() {
+		var serr *SyntaxError
+		if !errors.As(e.Err, &serr) || serr.Kind != wantKinds[i] || serr.Line != []int{2, 3, 4, 7}[i] {
+			t.Errorf("error %d: got %v, want %v", i, e.Err, wantKinds[i])
+		}
+	}
+
+	// RFC sources are checked after expansion with PREFIX.
+	r = NewReaderOptions(strings.NewReader("#PREFIX: gopher://example.org/\n\nfoo|http://example.com/\n"),
+		&ReaderOptions{ValidateURLs: true, AllowedSchemes: []string{"http"}})
+	if _, err := r.Read(); err == nil || !strings.Contains(err.Error(), "source has disallowed scheme") {
+		t.Errorf("got error %v, want disallowed source scheme", err)
+	}
+}
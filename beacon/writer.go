@@ -0,0 +1,222 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writer writes BEACON link dumps. Output is buffered, so Flush must be
+// called after the last link is written.
+type Writer struct {
+	w           *bufio.Writer
+	format      Format
+	metaWritten bool
+	linkWritten bool
+	hasTarget   bool // whether the TARGET meta field is a template
+	gz          *gzip.Writer
+	closed      bool
+}
+
+// ErrWriterClosed is returned when writing to a closed Writer.
+var ErrWriterClosed = errors.New("beacon: write to closed writer")
+
+// NewWriter constructs a writer that writes RFC-format BEACON link
+// dumps.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// NewURLTeamWriter constructs a writer that writes URLTeam-format
+// BEACON link dumps. URLTeam dumps have no header and links cannot have
+// annotations.
+func NewURLTeamWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w), format: URLTeam}
+}
+
+// WriteMeta writes meta fields to the header. It may be called multiple
+// times, but not after the first link has been written. The FORMAT meta
+// field is always written first, as recommended by section 4.1, so it
+// is moved to the front or, when absent, "#FORMAT: BEACON" is written
+// before the first field. It is an error for FORMAT to be given after
+// the first call that writes fields.
+func (w *Writer) WriteMeta(meta []MetaField) error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	if w.format == URLTeam {
+		return errors.New("beacon: URLTeam dumps have no header")
+	}
+	if w.linkWritten {
+		return errors.New("beacon: meta written after link")
+	}
+	format := -1
+	for i, m := range meta {
+		if err := checkMeta(m); err != nil {
+			return err
+		}
+		if m.Name == "FORMAT" {
+			if w.metaWritten || format != -1 {
+				return errors.New("beacon: FORMAT meta field must be first and not repeated")
+			}
+			format = i
+		}
+	}
+	if len(meta) != 0 && !w.metaWritten {
+		value := "BEACON"
+		if format != -1 {
+			value = meta[format].Value
+		}
+		if _, err := fmt.Fprintf(w.w, "#FORMAT: %s\n", value); err != nil {
+			return err
+		}
+		w.metaWritten = true
+	}
+	for i, m := range meta {
+		if i == format {
+			continue
+		}
+		if _, err := fmt.Fprintf(w.w, "#%s: %s\n", m.Name, m.Value); err != nil {
+			return err
+		}
+	}
+	if hasTargetTemplate(meta) {
+		w.hasTarget = true
+	}
+	return nil
+}
+
+func checkMeta(m MetaField) error {
+	if m.Name == "" {
+		return errors.New("beacon: empty meta field name")
+	}
+	for i := 0; i < len(m.Name); i++ {
+		if ch := m.Name[i]; ch < 'A' || 'Z' < ch {
+			return fmt.Errorf("beacon: invalid character %q in meta field name: %q", ch, m.Name)
+		}
+	}
+	if strings.ContainsAny(m.Value, "\r\n") {
+		return fmt.Errorf("beacon: meta field %s contains line break: %q", m.Name, m.Value)
+	}
+	return nil
+}
+
+// WriteLink writes a link line. Links are written with the fewest
+// tokens that are unambiguous given the TARGET meta field. A target
+// with bars is always written as the third token, which absorbs the
+// rest of the line, while bars in the source or annotation are an
+// error.
+func (w *Writer) WriteLink(l *Link) error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	if w.format == URLTeam {
+		return w.writeLinkURLTeam(l)
+	}
+	if strings.ContainsAny(l.Source, "\r\n") ||
+		strings.ContainsAny(l.Annotation, "\r\n") ||
+		strings.ContainsAny(l.Target, "\r\n") {
+		return fmt.Errorf("beacon: link contains line break: %q", l)
+	}
+	if strings.Contains(l.Source, "|") {
+		return fmt.Errorf("beacon: source contains bar: %q", l.Source)
+	}
+	if strings.Contains(l.Annotation, "|") {
+		return fmt.Errorf("beacon: annotation for source %q contains bar: %q", l.Source, l.Annotation)
+	}
+	if err := w.writeSeparator(); err != nil {
+		return err
+	}
+	var err error
+	switch {
+	case l.Target == "" && l.Annotation == "":
+		_, err = fmt.Fprintf(w.w, "%s\n", l.Source)
+	case l.Target == "" && w.hasTarget:
+		_, err = fmt.Fprintf(w.w, "%s|%s\n", l.Source, l.Annotation)
+	case l.Annotation == "" && !w.hasTarget && !strings.Contains(l.Target, "|"):
+		_, err = fmt.Fprintf(w.w, "%s|%s\n", l.Source, l.Target)
+	default:
+		_, err = fmt.Fprintf(w.w, "%s|%s|%s\n", l.Source, l.Annotation, l.Target)
+	}
+	return err
+}
+
+// WriteLinkCount writes a link with a count as the annotation and no
+// target. When the TARGET meta field is a template, it is written as
+// SOURCE|COUNT; otherwise, as SOURCE|COUNT| to not be read as a target.
+func (w *Writer) WriteLinkCount(source string, count int) error {
+	if count < 0 {
+		return fmt.Errorf("beacon: negative count for source %q: %d", source, count)
+	}
+	return w.WriteLink(&Link{Source: source, Annotation: strconv.Itoa(count)})
+}
+
+func (w *Writer) writeLinkURLTeam(l *Link) error {
+	if l.Annotation != "" {
+		return fmt.Errorf("beacon: URLTeam link has annotation: %q", l)
+	}
+	if strings.ContainsAny(l.Source, "|\r\n") {
+		return fmt.Errorf("beacon: URLTeam shortcode contains bar or line break: %q", l.Source)
+	}
+	// Multi-line targets are only readable when the shortcode length is
+	// fixed, which the writer does not know.
+	if strings.ContainsAny(l.Target, "\r\n") {
+		return fmt.Errorf("beacon: target for shortcode %q contains line break: %q", l.Source, l.Target)
+	}
+	w.linkWritten = true
+	_, err := fmt.Fprintf(w.w, "%s|%s\n", l.Source, l.Target)
+	return err
+}
+
+// writeSeparator writes the blank line between the header and the
+// first link.
+func (w *Writer) writeSeparator() error {
+	if w.linkWritten {
+		return nil
+	}
+	w.linkWritten = true
+	if w.metaWritten {
+		return w.w.WriteByte('\n')
+	}
+	return nil
+}
+
+// Flush writes any buffered data to the underlying io.Writer. For a
+// gzip writer, the compressed data is flushed, but the stream is not
+// finalized.
+func (w *Writer) Flush() error {
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if w.gz != nil {
+		return w.gz.Flush()
+	}
+	return nil
+}
+
+// Close flushes any buffered data and, for a gzip writer, finalizes
+// the gzip stream. It does not close the underlying io.Writer. Calling
+// Close again has no effect and later writes return ErrWriterClosed.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	dumps := []string{
+		"",
+		"foo|http://example.com/\n",
+		"#FORMAT: BEACON\n#PREFIX: http://example.org/id/\n\nfoo\nbar|http://example.com/bar\nbaz|3|http://example.com/baz\nqux|label|\n",
+		"#FORMAT: BEACON\n\n",
+		"#FORMAT: BEACON\n#TARGET: http://example.com/{ID}\n\nfoo\nbar|label\nbaz||qux\nquux|3|corge\n",
+		"foo||http://example.com/?a=1|2\nbar|label|http://example.com/|\n",
+	}
+	for i, dump := range dumps {
+		r := NewReader(strings.NewReader(dump))
+		var b bytes.Buffer
+		w := NewWriter(&b)
+		meta, err := r.Meta()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if err := w.WriteMeta(meta); err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		for {
+			link, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("#%d: %v", i, err)
+				break
+			}
+			if err := w.WriteLink(link); err != nil {
+				t.Errorf("#%d: %v", i, err)
+				break
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Errorf("#%d: %v", i, err)
+		}
+		// A header without links has no separator line.
+		want := strings.TrimSuffix(dump, "\n\n")
+		if want != dump {
+			want += "\n"
+		}
+		if got := b.String(); got != want {
+			t.Errorf("#%d: round trip got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	for _, m := range []MetaField{{"", "x"}, {"Format", "BEACON"}, {"FORMAT2", "BEACON"}, {"DESCRIPTION", "a\nb"}} {
+		if err := w.WriteMeta([]MetaField{m}); err == nil {
+			t.Errorf("WriteMeta(%v) got no error", m)
+		}
+	}
+	if err := w.WriteLink(&Link{Source: "a", Target: "http://example.com/\n"}); err == nil {
+		t.Error("WriteLink with line break got no error")
+	}
+	if err := w.WriteLink(&Link{Source: "a|b", Target: "http://example.com/"}); err == nil {
+		t.Error("WriteLink with bar in source got no error")
+	}
+	if err := w.WriteLink(&Link{Source: "a", Annotation: "b|c", Target: "http://example.com/"}); err == nil {
+		t.Error("WriteLink with bar in annotation got no error")
+	}
+	if err := w.WriteLink(&Link{Source: "a"}); err != nil {
+		t.Error(err)
+	}
+	if err := w.WriteMeta([]MetaField{{"FORMAT", "BEACON"}}); err == nil {
+		t.Error("WriteMeta after link got no error")
+	}
+}
+
+func TestWriteMetaFormat(t *testing.T) {
+	tests := []struct {
+		meta [][]MetaField
+		want string
+	}{
+		{[][]MetaField{{{"NAME", "a"}, {"FORMAT", "BEACON"}}}, "#FORMAT: BEACON\n#NAME: a\n"},
+		{[][]MetaField{{{"NAME", "a"}}, {{"PREFIX", "http://example.org/"}}}, "#FORMAT: BEACON\n#NAME: a\n#PREFIX: http://example.org/\n"},
+		{[][]MetaField{nil, {{"FORMAT", "BEACON 2"}}}, "#FORMAT: BEACON 2\n"},
+		{[][]MetaField{nil}, ""},
+	}
+	for i, tt := range tests {
+		var b bytes.Buffer
+		w := NewWriter(&b)
+		for _, meta := range tt.meta {
+			if err := w.WriteMeta(meta); err != nil {
+				t.Fatalf("#%d: %v", i, err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("#%d: got %q, want %q", i, got, tt.want)
+		}
+	}
+
+	w := NewWriter(io.Discard)
+	if err := w.WriteMeta([]MetaField{{"NAME", "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteMeta([]MetaField{{"FORMAT", "BEACON"}}); err == nil {
+		t.Error("FORMAT after other meta got no error")
+	}
+	if err := NewWriter(io.Discard).WriteMeta([]MetaField{{"FORMAT", "BEACON"}, {"FORMAT", "BEACON"}}); err == nil {
+		t.Error("repeated FORMAT got no error")
+	}
+}
+
+func TestURLTeamWriterRoundTrip(t *testing.T) {
+	tests := []struct {
+		dump         string
+		shortcodeLen int
+	}{
+		{"", 0},
+		{"abc|http://example.com/\nabcd|http://example.com/a|b\n", 0},
+		{"abc|http://example.com/\nxyz|\n", 3},
+	}
+	for i, tt := range tests {
+		r := NewURLTeamReader(strings.NewReader(tt.dump), tt.shortcodeLen)
+		var b bytes.Buffer
+		w := NewURLTeamWriter(&b)
+		for {
+			link, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("#%d: %v", i, err)
+				break
+			}
+			if err := w.WriteLink(link); err != nil {
+				t.Errorf("#%d: %v", i, err)
+				break
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Errorf("#%d: %v", i, err)
+		}
+		if got := b.String(); got != tt.dump {
+			t.Errorf("#%d: round trip got %q, want %q", i, got, tt.dump)
+		}
+	}
+}
+
+func TestURLTeamWriterErrors(t *testing.T) {
+	w := NewURLTeamWriter(io.Discard)
+	if err := w.WriteMeta([]MetaField{{"FORMAT", "BEACON"}}); err == nil {
+		t.Error("WriteMeta got no error")
+	}
+	links := []*Link{
+		{Source: "abc", Target: "http://example.com/", Annotation: "1"},
+		{Source: "a|c", Target: "http://example.com/"},
+		{Source: "abc", Target: "http://example.com/\nfoo"},
+	}
+	for _, l := range links {
+		if err := w.WriteLink(l); err == nil {
+			t.Errorf("WriteLink(%q) got no error", l)
+		}
+	}
+	if err := w.WriteLink(&Link{Source: "abc", Target: "http://example.com/\nfoo"}); err == nil ||
+		!strings.Contains(err.Error(), `"abc"`) {
+		t.Errorf("error does not name shortcode: %v", err)
+	}
+}
+
+func TestWriteLinkCount(t *testing.T) {
+	tests := []struct {
+		meta []MetaField
+		want string
+	}{
+		{nil, "foo|3|\n"},
+		{[]MetaField{{"TARGET", "http://example.com/{ID}"}}, "#FORMAT: BEACON\n#TARGET: http://example.com/{ID}\n\nfoo|3\n"},
+	}
+	for i, tt := range tests {
+		var b bytes.Buffer
+		w := NewWriter(&b)
+		if err := w.WriteMeta(tt.meta); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if err := w.WriteLinkCount("foo", 3); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if err := w.WriteLinkCount("bar", -1); err == nil {
+			t.Errorf("#%d: negative count got no error", i)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("#%d: got %q, want %q", i, got, tt.want)
+		}
+		links, err := NewReader(&b).ReadAll()
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if count, ok := links[0].Count(); len(links) != 1 || count != 3 || !ok {
+			t.Errorf("#%d: got links %q", i, links)
+		}
+	}
+}
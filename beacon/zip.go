@@ -0,0 +1,70 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"archive/zip"
+	"io"
+	"path"
+	"strings"
+)
+
+// OpenZip opens a ZIP archive and reads the links in each link dump in
+// it in sequence. Link dumps are files with a .txt or .beacon extension,
+// optionally followed by a compression extension, e.g. .txt.xz. Other
+// files, such as metadata, are skipped.
+func OpenZip(filename string, opts *ReaderOptions) (*MultiReader, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	var dumps []*zip.File
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() && isDumpName(f.Name) {
+			dumps = append(dumps, f)
+		}
+	}
+	open := func(i int) (*Reader, string, error) {
+		f := dumps[i]
+		rc, err := f.Open()
+		if err != nil {
+			return nil, f.Name, err
+		}
+		r, err := NewCompressedReaderOptions(rc, opts)
+		if err != nil {
+			rc.Close()
+			return nil, f.Name, err
+		}
+		r.closer = multiCloser{r.closer, rc}
+		return r, f.Name, nil
+	}
+	return &MultiReader{n: len(dumps), open: open, closer: zr}, nil
+}
+
+func isDumpName(name string) bool {
+	switch ext := path.Ext(name); ext {
+	case ".gz", ".bz2", ".xz", ".zst":
+		name = strings.TrimSuffix(name, ext)
+	}
+	switch path.Ext(name) {
+	case ".txt", ".beacon":
+		return true
+	}
+	return false
+}
+
+type multiCloser []io.Closer
+
+func (mc multiCloser) Close() error {
+	var err error
+	for _, c := range mc {
+		if err1 := c.Close(); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
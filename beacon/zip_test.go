@@ -0,0 +1,76 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package beacon
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpenZip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "release.zip")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	files := []struct {
+		name, data string
+		gzip       bool
+	}{
+		{"project.meta.json", `{"name":"project"}`, false},
+		{"dumps/", "", false},
+		{"dumps/3.txt", "abc|http://example.com/a\n", false},
+		{"dumps/4.txt.gz", "abcd|http://example.com/b\n", true},
+		{"dumps/5.beacon", "abcde|http://example.com/c\n", false},
+		{"dumps/6.txt", "bad\n", false},
+	}
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.gzip {
+			gw := gzip.NewWriter(w)
+			io.WriteString(gw, file.data)
+			gw.Close()
+		} else {
+			io.WriteString(w, file.data)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	mr, err := OpenZip(filename, &ReaderOptions{Format: URLTeam})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	var links []Link
+	for {
+		link, err := mr.Read()
+		if err != nil {
+			if !strings.HasPrefix(err.Error(), "dumps/6.txt: beacon: line 1,") || mr.Name() != "dumps/6.txt" {
+				t.Errorf("got error %v in %s", err, mr.Name())
+			}
+			break
+		}
+		links = append(links, *link)
+	}
+	want := []Link{{"abc", "http://example.com/a", ""}, {"abcd", "http://example.com/b", ""}, {"abcde", "http://example.com/c", ""}}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got %q, want %q", links, want)
+	}
+}
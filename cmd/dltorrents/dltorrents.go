@@ -7,6 +7,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -25,7 +26,38 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := tinytown.DownloadTorrents(dir); err != nil {
+	err := tinytown.RunWithSignals(context.Background(), func(ctx context.Context) error {
+		d, err := tinytown.DownloadReleases(ctx, tinytown.DownloadOptions{
+			DataDir:  dir,
+			Progress: printProgress,
+		})
+		if d != nil {
+			if err := d.Close(); err != nil {
+				log.Print(err)
+			}
+		}
+		return err
+	})
+	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+func printProgress(p tinytown.DownloadProgress) {
+	switch p.State {
+	case tinytown.StateAdding:
+		fmt.Printf("Adding %s\n", p.ID)
+	case tinytown.StateTorrent:
+		fmt.Printf("%s: %d/%d bytes, %d peers\n", p.ID, p.BytesCompleted, p.BytesTotal, p.Peers)
+	case tinytown.StateHTTP:
+		fmt.Printf("%s: falling back to HTTP: %v\n", p.ID, p.Err)
+	case tinytown.StateDone:
+		fmt.Printf("%s: done\n", p.ID)
+	case tinytown.StateFailed:
+		fmt.Printf("%s: failed: %v\n", p.ID, p.Err)
+	case tinytown.StateSkipped:
+		fmt.Printf("%s: skipped\n", p.ID)
+	case tinytown.StateStalled:
+		fmt.Printf("%s: stalled at %d/%d bytes\n", p.ID, p.BytesCompleted, p.BytesTotal)
+	}
+}
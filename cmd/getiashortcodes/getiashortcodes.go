@@ -7,6 +7,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"regexp"
@@ -26,8 +27,8 @@ func main() {
 		alpha = os.Args[2]
 	}
 
-	s, ok := shorteners.Lookup[shortener]
-	if !ok {
+	s := shorteners.Lookup(shortener)
+	if s == nil {
 		var name, host string
 		if strings.ContainsRune(shortener, '.') {
 			name, host = strings.ReplaceAll(shortener, ".", "-"), shortener
@@ -46,7 +47,11 @@ func main() {
 		}
 	}
 
-	shortcodes, err := s.GetIAShortcodes()
+	shortcodes, err := s.GetIAShortcodesContext(context.Background(), &shorteners.IAOptions{
+		Progress: func(p shorteners.IAProgress) {
+			fmt.Fprintf(os.Stderr, "%v page %d: %d captures, %d shortcodes\n", p.Backend, p.Pages, p.Captures, p.Shortcodes)
+		},
+	})
 	for _, shortcode := range shortcodes {
 		fmt.Println(shortcode)
 	}
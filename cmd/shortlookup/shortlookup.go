@@ -19,8 +19,12 @@ func main() {
 		os.Exit(2)
 	}
 	dir, shortener, shortcodes := os.Args[1], os.Args[2], os.Args[3:]
-	if _, err := tinytown.SearchReleases(dir, shortener, shortcodes); err != nil {
+	links, err := tinytown.SearchReleases(dir, shortener, shortcodes)
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	for _, l := range links {
+		fmt.Printf("%s|%q\n", l.Source, l.Target)
+	}
 }
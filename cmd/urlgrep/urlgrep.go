@@ -24,7 +24,7 @@ func main() {
 	re, err := regexp.Compile(pattern)
 	try(err)
 
-	processLink := func(l *beacon.Link, m *tinytown.Meta, shortcodeLen int, releaseFilename, dumpFilename string) error {
+	processLink := func(m *tinytown.ProjectMeta, release string, l *beacon.Link) error {
 		if re.MatchString(l.Target) {
 			fmt.Println(l.Target)
 		}
@@ -1,11 +1,85 @@
 module github.com/andrewarchi/urlhero
 
-go 1.16
+go 1.23
 
 require (
 	github.com/anacrolix/torrent v1.25.1
 	github.com/andrewarchi/archive v0.0.0-20210213193640-3a6449eed2ec
 	github.com/andrewarchi/browser v0.0.0-20210409211550-aeb39920c5c7
 	github.com/hekmon/transmissionrpc v1.1.0
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.10
 	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
+	golang.org/x/sys v0.0.0-20210330210617-4fbd30eecc44
+	golang.org/x/text v0.21.0
+	golang.org/x/time v0.0.0-20201208040808-7e3f01d25324
+)
+
+require (
+	crawshaw.io/sqlite v0.3.3-0.20210127221821-98b1f83c5508 // indirect
+	github.com/RoaringBitmap/roaring v0.5.5 // indirect
+	github.com/anacrolix/dht/v2 v2.8.0 // indirect
+	github.com/anacrolix/envpprof v1.1.1 // indirect
+	github.com/anacrolix/go-libutp v1.0.4 // indirect
+	github.com/anacrolix/log v0.8.0 // indirect
+	github.com/anacrolix/missinggo v1.2.1 // indirect
+	github.com/anacrolix/missinggo/perf v1.0.0 // indirect
+	github.com/anacrolix/missinggo/v2 v2.5.0 // indirect
+	github.com/anacrolix/mmsg v1.0.0 // indirect
+	github.com/anacrolix/multiless v0.0.0-20200413040533-acfd16f65d5d // indirect
+	github.com/anacrolix/stm v0.2.1-0.20201002073511-c35a2c748c6a // indirect
+	github.com/anacrolix/sync v0.2.0 // indirect
+	github.com/anacrolix/upnp v0.1.2-0.20200416075019-5e9378ed1425 // indirect
+	github.com/anacrolix/utp v0.1.0 // indirect
+	github.com/benbjohnson/immutable v0.3.0 // indirect
+	github.com/bradfitz/iter v0.0.0-20191230175014-e8f45d346db8 // indirect
+	github.com/cheekybits/genny v1.0.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dustin/go-humanize v1.0.0 // indirect
+	github.com/edsrzf/mmap-go v1.0.0 // indirect
+	github.com/elliotchance/orderedmap v1.3.0 // indirect
+	github.com/glycerine/go-unsnap-stream v0.0.0-20210130063903-47dfef350d96 // indirect
+	github.com/golang/protobuf v1.4.3 // indirect
+	github.com/golang/snappy v0.0.2 // indirect
+	github.com/google/btree v1.0.0 // indirect
+	github.com/google/uuid v1.2.0 // indirect
+	github.com/gorilla/websocket v1.4.2 // indirect
+	github.com/hashicorp/go-cleanhttp v0.5.1 // indirect
+	github.com/hekmon/cunits/v2 v2.0.2 // indirect
+	github.com/huandu/xstrings v1.3.2 // indirect
+	github.com/lucas-clemente/quic-go v0.19.3 // indirect
+	github.com/marten-seemann/qtls v0.10.0 // indirect
+	github.com/marten-seemann/qtls-go1-15 v0.1.1 // indirect
+	github.com/mschoch/smat v0.2.0 // indirect
+	github.com/philhofer/fwd v1.1.1 // indirect
+	github.com/pierrec/lz4/v4 v4.1.3 // indirect
+	github.com/pion/datachannel v1.4.21 // indirect
+	github.com/pion/dtls/v2 v2.0.4 // indirect
+	github.com/pion/ice v0.7.18 // indirect
+	github.com/pion/logging v0.2.2 // indirect
+	github.com/pion/mdns v0.0.4 // indirect
+	github.com/pion/quic v0.1.4 // indirect
+	github.com/pion/randutil v0.1.0 // indirect
+	github.com/pion/rtcp v1.2.6 // indirect
+	github.com/pion/rtp v1.6.2 // indirect
+	github.com/pion/sctp v1.7.11 // indirect
+	github.com/pion/sdp/v2 v2.4.0 // indirect
+	github.com/pion/srtp v1.5.2 // indirect
+	github.com/pion/stun v0.3.5 // indirect
+	github.com/pion/transport v0.12.2 // indirect
+	github.com/pion/turn/v2 v2.0.5 // indirect
+	github.com/pion/udp v0.1.0 // indirect
+	github.com/pion/webrtc/v2 v2.2.26 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/rs/dnscache v0.0.0-20210201191234-295bba877686 // indirect
+	github.com/ryszard/goskiplist v0.0.0-20150312221310-2dfbae5fcf46 // indirect
+	github.com/spaolacci/murmur3 v1.1.0 // indirect
+	github.com/tinylib/msgp v1.1.5 // indirect
+	github.com/willf/bitset v1.1.11 // indirect
+	github.com/willf/bloom v2.0.3+incompatible // indirect
+	go.etcd.io/bbolt v1.3.5 // indirect
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad // indirect
+	golang.org/x/sync v0.10.0 // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+	google.golang.org/protobuf v1.25.0 // indirect
 )
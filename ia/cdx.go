@@ -0,0 +1,65 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ia
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CDXURL is the endpoint of the Wayback Machine CDX API. This can be
+// changed to use a local test server.
+var CDXURL = "https://web.archive.org/cdx/search/cdx"
+
+// CDXOptions contains options for a CDX API call.
+type CDXOptions struct {
+	MatchPrefix bool     // whether url is a prefix
+	Collapse    string   // field to collapse by; earliest captures with unique field is kept
+	Fields      []string // e.g. urlkey,timestamp,original,mimetype,statuscode,digest,length
+	// Filters are regular expressions that a field must match, as
+	// field:regexp, or not match, as !field:regexp, e.g., statuscode:3..
+	Filters   []string
+	Limit     int    // e.g. 100000
+	ResumeKey string // continues after the page that returned it
+}
+
+// CDXPage is a page of captures from the CDX API, in the same form as
+// from the timemap API.
+type CDXPage = TimemapPage
+
+// GetCDX gets a page of at most Limit Internet Archive captures of the
+// given URL from the CDX API, starting after ResumeKey, if set. Unlike
+// the timemap API, captures can be filtered by field.
+func GetCDX(ctx context.Context, pageURL string, options *CDXOptions) (*CDXPage, error) {
+	q := make(url.Values)
+	q.Set("url", pageURL)
+	q.Set("output", "json")
+	q.Set("showResumeKey", "true")
+	if options != nil {
+		if options.MatchPrefix {
+			q.Set("matchType", "prefix")
+		}
+		if options.Collapse != "" {
+			q.Set("collapse", options.Collapse)
+		}
+		if len(options.Fields) != 0 {
+			q.Set("fl", strings.Join(options.Fields, ","))
+		}
+		for _, filter := range options.Filters {
+			q.Add("filter", filter)
+		}
+		if options.Limit > 0 {
+			q.Set("limit", strconv.Itoa(options.Limit))
+		}
+		if options.ResumeKey != "" {
+			q.Set("resumeKey", options.ResumeKey)
+		}
+	}
+	return getCapturesPage(ctx, CDXURL+"?"+q.Encode())
+}
@@ -7,6 +7,7 @@
 package ia
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -17,16 +18,45 @@ import (
 	"github.com/andrewarchi/browser/jsonutil"
 )
 
+// TimemapURL is the endpoint of the Wayback Machine timemap API. This
+// can be changed to use a local test server.
+var TimemapURL = "https://web.archive.org/web/timemap/"
+
 // TimemapOptions contains options for a timemap API call.
 type TimemapOptions struct {
 	MatchPrefix bool     // whether url is a prefix (* wildcard is appended)
 	Collapse    string   // field to collapse by; earliest captures with unique field is kept
 	Fields      []string // e.g. urlkey,timestamp,endtimestamp,original,mimetype,statuscode,digest,redirect,robotflags,length,offset,filename,groupcount,uniqcount
 	Limit       int      // e.g. 100000
+	ResumeKey   string   // continues after the page that returned it
 }
 
 // GetTimemap gets a list of Internet Archive captures of the given URL.
+// At most Limit captures are returned; use GetTimemapPage to page
+// through more.
 func GetTimemap(pageURL string, options *TimemapOptions) ([][]string, error) {
+	page, err := getTimemap(context.Background(), pageURL, options, false)
+	if err != nil {
+		return nil, err
+	}
+	return page.Captures, nil
+}
+
+// TimemapPage is a page of captures from the timemap API.
+type TimemapPage struct {
+	Captures [][]string
+	// ResumeKey, when non-empty, is passed as TimemapOptions.ResumeKey
+	// to get the next page. It is empty after the last page.
+	ResumeKey string
+}
+
+// GetTimemapPage gets a page of at most Limit Internet Archive captures
+// of the given URL, starting after ResumeKey, if set.
+func GetTimemapPage(ctx context.Context, pageURL string, options *TimemapOptions) (*TimemapPage, error) {
+	return getTimemap(ctx, pageURL, options, true)
+}
+
+func getTimemap(ctx context.Context, pageURL string, options *TimemapOptions, resume bool) (*TimemapPage, error) {
 	// Timemap API, as observed on
 	// https://web.archive.org/web/*/https://dumps.wikimedia.org/other/shorturls/*
 
@@ -43,13 +73,30 @@ func GetTimemap(pageURL string, options *TimemapOptions) ([][]string, error) {
 		if len(options.Fields) != 0 {
 			q.Set("fl", strings.Join(options.Fields, ","))
 		}
-		// TODO paging
 		if options.Limit > 0 {
 			q.Set("limit", strconv.Itoa(options.Limit))
 		}
+		if options.ResumeKey != "" {
+			q.Set("resumeKey", options.ResumeKey)
+		}
+	}
+	if resume {
+		q.Set("showResumeKey", "true")
 	}
 
-	resp, err := checkResponse(http.Get("https://web.archive.org/web/timemap/?" + q.Encode()))
+	return getCapturesPage(ctx, TimemapURL+"?"+q.Encode())
+}
+
+// getCapturesPage requests a page of captures in the JSON output of the
+// timemap and CDX APIs, which is a header row, the captures, and, when
+// showResumeKey is set and there are more captures, an empty row and the
+// resume key.
+func getCapturesPage(ctx context.Context, reqURL string) (*TimemapPage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := checkResponse(http.DefaultClient.Do(req))
 	if err != nil {
 		return nil, err
 	}
@@ -62,7 +109,14 @@ func GetTimemap(pageURL string, options *TimemapOptions) ([][]string, error) {
 	if len(timemap) >= 1 {
 		timemap = timemap[1:] // Skip header row
 	}
-	return timemap, nil
+	var page TimemapPage
+	// The resume key follows the captures after an empty row.
+	if n := len(timemap); n >= 2 && len(timemap[n-2]) == 0 && len(timemap[n-1]) == 1 {
+		page.ResumeKey = timemap[n-1][0]
+		timemap = timemap[:n-2]
+	}
+	page.Captures = timemap
+	return &page, nil
 }
 
 // DecodeDigest decodes a base32-encoded SHA-1 digest.
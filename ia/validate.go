@@ -78,8 +78,15 @@ func ReadFileMeta(dir string) ([]FileMeta, error) {
 		return nil, err
 	}
 	defer f.Close()
+	return DecodeFileMeta(f)
+}
+
+// DecodeFileMeta decodes file metadata in the format of the
+// *_files.xml file of an item. Checksums are empty for files listed
+// without them.
+func DecodeFileMeta(r io.Reader) ([]FileMeta, error) {
 	var meta filesMeta
-	if err := xml.NewDecoder(f).Decode(&meta); err != nil {
+	if err := xml.NewDecoder(r).Decode(&meta); err != nil {
 		return nil, err
 	}
 	return meta.Files, nil
@@ -0,0 +1,131 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shorteners
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// Alphabet numbers the shortcodes of a sequential shortener. Shortcodes
+// are numbered by length, then as base-N numbers with the digits of the
+// alphabet, so, with the alphabet "0123456789", "0" through "9" are 0
+// through 9, "00" is 10, and "99" is 109. Leading zero digits are
+// significant.
+type Alphabet struct {
+	chars string
+	index [256]int16 // position of each byte in chars or -1
+}
+
+// NewAlphabet constructs an Alphabet from its digits in order. The
+// digits must be distinct ASCII characters and there must be at least
+// two.
+func NewAlphabet(chars string) (*Alphabet, error) {
+	if len(chars) < 2 {
+		return nil, fmt.Errorf("alphabet %q has fewer than 2 characters", chars)
+	}
+	a := &Alphabet{chars: chars}
+	for i := range a.index {
+		a.index[i] = -1
+	}
+	for i := 0; i < len(chars); i++ {
+		c := chars[i]
+		if c >= 0x80 {
+			return nil, fmt.Errorf("alphabet %q has non-ASCII character", chars)
+		}
+		if a.index[c] != -1 {
+			return nil, fmt.Errorf("alphabet %q has duplicate character %q", chars, c)
+		}
+		a.index[c] = int16(i)
+	}
+	return a, nil
+}
+
+// String returns the digits of the alphabet.
+func (a *Alphabet) String() string {
+	return a.chars
+}
+
+// Encode returns the shortcode numbered n.
+func (a *Alphabet) Encode(n uint64) string {
+	// Shortcodes numbered by length, then value, are bijective base-N
+	// numbers offset by one.
+	base := uint64(len(a.chars))
+	var code [64]byte
+	i := len(code)
+	for {
+		i--
+		code[i] = a.chars[n%base]
+		n /= base
+		if n == 0 {
+			break
+		}
+		n--
+	}
+	return string(code[i:])
+}
+
+// Decode returns the number of a shortcode. It is an error for the
+// shortcode to be empty, to have a character that is not in the
+// alphabet, or for its number to overflow a uint64.
+func (a *Alphabet) Decode(code string) (uint64, error) {
+	if code == "" {
+		return 0, fmt.Errorf("decode: empty shortcode")
+	}
+	base := uint64(len(a.chars))
+	var n uint64
+	for i := 0; i < len(code); i++ {
+		d := a.index[code[i]]
+		if d < 0 {
+			return 0, fmt.Errorf("decode %q: character %q not in alphabet", code, code[i])
+		}
+		// Subtract the offset of one with the last digit, so that the
+		// greatest shortcode does not overflow.
+		digit := uint64(d) + 1
+		if i == len(code)-1 {
+			digit--
+		}
+		hi, lo := bits.Mul64(n, base)
+		sum, carry := bits.Add64(lo, digit, 0)
+		if hi != 0 || carry != 0 {
+			return 0, fmt.Errorf("decode %q: overflows uint64", code)
+		}
+		n = sum
+	}
+	return n, nil
+}
+
+// Range is an inclusive range of shortcode numbers.
+type Range struct {
+	First, Last uint64
+}
+
+// Len returns the number of shortcodes in the range.
+func (r Range) Len() uint64 {
+	return r.Last - r.First + 1
+}
+
+// FindGaps returns the ranges of shortcode numbers between the least and
+// greatest of codes that are not in codes, in increasing order. Codes
+// that cannot be decoded with the alphabet are ignored.
+func FindGaps(codes []string, a *Alphabet) []Range {
+	ids := make([]uint64, 0, len(codes))
+	for _, code := range codes {
+		if id, err := a.Decode(code); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var gaps []Range
+	for i := 1; i < len(ids); i++ {
+		if ids[i] > ids[i-1]+1 {
+			gaps = append(gaps, Range{ids[i-1] + 1, ids[i] - 1})
+		}
+	}
+	return gaps
+}
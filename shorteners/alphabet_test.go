@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shorteners
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestAlphabet(t *testing.T) {
+	a, err := NewAlphabet("0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		N    uint64
+		Code string
+	}{
+		{0, "0"},
+		{9, "9"},
+		{10, "00"},
+		{19, "09"},
+		{20, "10"},
+		{109, "99"},
+		{110, "000"},
+		{1110, "0000"},
+		{math.MaxUint64, "07335632962598440505"},
+	}
+	for i, tt := range tests {
+		if code := a.Encode(tt.N); code != tt.Code {
+			t.Errorf("#%d: Encode(%d) = %q, want %q", i, tt.N, code, tt.Code)
+		}
+		if n, err := a.Decode(tt.Code); err != nil || n != tt.N {
+			t.Errorf("#%d: Decode(%q) = %d, %v, want %d", i, tt.Code, n, err, tt.N)
+		}
+	}
+
+	base62, err := NewAlphabet(Bfytw.Alphabet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []uint64{0, 61, 62, 3905, 3906, 1 << 40, math.MaxUint64} {
+		if got, err := base62.Decode(base62.Encode(n)); err != nil || got != n {
+			t.Errorf("Decode(Encode(%d)) = %d, %v", n, got, err)
+		}
+	}
+
+	for _, code := range []string{"", "12a", "07335632962598440506", "99999999999999999999"} {
+		if n, err := a.Decode(code); err == nil {
+			t.Errorf("Decode(%q) = %d, want error", code, n)
+		}
+	}
+	for _, chars := range []string{"", "0", "0120", "01é"} {
+		if _, err := NewAlphabet(chars); err == nil {
+			t.Errorf("NewAlphabet(%q) succeeded, want error", chars)
+		}
+	}
+}
+
+func TestFindGaps(t *testing.T) {
+	a, err := NewAlphabet("0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := []string{"7", "3", "4", "4", "9", "00", "02", "99", "000", "x"}
+	gaps := FindGaps(codes, a)
+	want := []Range{{5, 6}, {8, 8}, {11, 11}, {13, 108}}
+	if !reflect.DeepEqual(gaps, want) {
+		t.Errorf("got gaps %v, want %v", gaps, want)
+	}
+	if n := want[3].Len(); n != 96 {
+		t.Errorf("got length %d, want 96", n)
+	}
+	if gaps := FindGaps([]string{"5"}, a); len(gaps) != 0 {
+		t.Errorf("got gaps %v for a single code", gaps)
+	}
+}
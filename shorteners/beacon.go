@@ -0,0 +1,36 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shorteners
+
+import (
+	"io"
+	"time"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+// WriteShortcodeBeacon writes shortcodes as a BEACON link dump with only
+// sources, so that it can be compared with other dumps. The short URL of
+// the shortener, with {ID} for the shortcode, is the PREFIX and the
+// current time is the TIMESTAMP.
+func WriteShortcodeBeacon(w io.Writer, s *Shortener, codes []string) error {
+	bw := beacon.NewWriter(w)
+	meta := []beacon.MetaField{
+		{Name: "PREFIX", Value: s.URL("{ID}")},
+		{Name: "TIMESTAMP", Value: time.Now().UTC().Format(time.RFC3339)},
+		{Name: "CREATOR", Value: "urlhero"},
+	}
+	if err := bw.WriteMeta(meta); err != nil {
+		return err
+	}
+	for _, code := range codes {
+		if err := bw.WriteLink(&beacon.Link{Source: code}); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shorteners
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+func TestWriteShortcodeBeacon(t *testing.T) {
+	var b bytes.Buffer
+	start := time.Now().Truncate(time.Second)
+	if err := WriteShortcodeBeacon(&b, Bfytw, []string{"PanS", "80xn", "Zd0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := beacon.NewReader(&b)
+	h, err := r.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Prefix != "https://bfy.tw/{ID}" || h.Creator != "urlhero" {
+		t.Errorf("got header %+v", h)
+	}
+	if h.Timestamp.Before(start) || h.Timestamp.After(time.Now()) {
+		t.Errorf("got timestamp %v, want now", h.Timestamp)
+	}
+	links, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []beacon.Link{{Source: "PanS"}, {Source: "80xn"}, {Source: "Zd0"}}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got links %v, want %v", links, want)
+	}
+
+	if err := WriteShortcodeBeacon(&b, Bfytw, []string{"a|b"}); err == nil {
+		t.Error("wrote shortcode with bar")
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shorteners
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Label classifies a shortcode as generated by the shortener or chosen
+// by the user.
+type Label uint8
+
+// Shortcode labels.
+const (
+	Unknown   Label = iota // inconclusive
+	Generated              // sequential or random, from the alphabet
+	Vanity                 // custom, chosen by the user
+)
+
+func (l Label) String() string {
+	switch l {
+	case Unknown:
+		return "unknown"
+	case Generated:
+		return "generated"
+	case Vanity:
+		return "vanity"
+	}
+	return "Label(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Classification is the result of ClassifyCodes. The buckets are in the
+// order of the input.
+type Classification struct {
+	Generated []string
+	Vanity    []string
+	Unknown   []string
+	Labels    map[string]Label
+}
+
+// ClassifyOptions configures the heuristics of ClassifyCodesOptions.
+// Each of the length, dictionary word, and case heuristics that a
+// shortcode matches counts as one vanity signal. A shortcode with no
+// signals is generated, one with at least VanityScore is vanity, and
+// others are unknown. A shortcode with characters outside of the
+// alphabet is always vanity.
+type ClassifyOptions struct {
+	// LengthShare is the minimum fraction of the shortcodes within the
+	// alphabet that have a length for it to be considered a generated
+	// length. Shortcodes of other lengths have a vanity signal. It is
+	// 0.1 when 0 and the heuristic is disabled when <0.
+	LengthShare float64
+	// Words is the dictionary searched for in shortcodes, ignoring case.
+	// It is DefaultWords when nil.
+	Words []string
+	// MinWordLen is the length of the shortest dictionary word counted
+	// as a vanity signal. It is 4 when <=0.
+	MinWordLen int
+	// MinCaseLetters is the minimum number of letters for a shortcode to
+	// have a vanity signal for being cased like words, that is, with its
+	// letters all lowercase, all uppercase, or capitalized words. It
+	// only applies to alphabets with both cases, since random letters
+	// rarely form such patterns. It is 4 when <=0.
+	MinCaseLetters int
+	// VanityScore is the number of signals to label a shortcode as
+	// vanity. It is 2 when <=0.
+	VanityScore int
+}
+
+// DefaultWords is a dictionary of words common in vanity shortcodes.
+var DefaultWords = []string{
+	"about", "apply", "blog", "book", "call", "camp", "card", "care",
+	"class", "club", "code", "college", "conf", "contact", "course",
+	"data", "deal", "demo", "docs", "donate", "download", "event",
+	"faculty", "form", "free", "game", "give", "guide", "hello", "help",
+	"home", "info", "join", "learn", "library", "live", "login", "mail",
+	"meet", "menu", "more", "news", "offer", "online", "page", "party",
+	"photo", "plan", "play", "post", "promo", "read", "register", "sale",
+	"school", "shop", "show", "sign", "spring", "staff", "store",
+	"student", "study", "summer", "support", "survey", "team", "test",
+	"ticket", "time", "tour", "video", "vote", "watch", "week", "winter",
+	"work", "world", "year", "zoom",
+}
+
+// ClassifyCodes separates shortcodes generated by the shortener, which
+// can be enumerated, from vanity shortcodes chosen by users, using the
+// default options.
+func ClassifyCodes(codes []string, a *Alphabet) Classification {
+	return ClassifyCodesOptions(codes, a, ClassifyOptions{})
+}
+
+// ClassifyCodesOptions separates generated from vanity shortcodes with
+// the given thresholds. The heuristics that need an alphabet are
+// skipped when a is nil.
+func ClassifyCodesOptions(codes []string, a *Alphabet, opts ClassifyOptions) Classification {
+	if opts.LengthShare == 0 {
+		opts.LengthShare = 0.1
+	}
+	if opts.Words == nil {
+		opts.Words = DefaultWords
+	}
+	if opts.MinWordLen <= 0 {
+		opts.MinWordLen = 4
+	}
+	if opts.MinCaseLetters <= 0 {
+		opts.MinCaseLetters = 4
+	}
+	if opts.VanityScore <= 0 {
+		opts.VanityScore = 2
+	}
+	var words []string
+	for _, w := range opts.Words {
+		if len(w) >= opts.MinWordLen {
+			words = append(words, strings.ToLower(w))
+		}
+	}
+	mixedCase := a != nil && strings.ContainsAny(a.chars, "abcdefghijklmnopqrstuvwxyz") &&
+		strings.ContainsAny(a.chars, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+
+	lengths := make(map[int]int)
+	n := 0
+	for _, code := range codes {
+		if inAlphabet(code, a) {
+			lengths[len(code)]++
+			n++
+		}
+	}
+
+	c := Classification{Labels: make(map[string]Label, len(codes))}
+	for _, code := range codes {
+		if _, ok := c.Labels[code]; ok {
+			continue
+		}
+		label := Vanity
+		if inAlphabet(code, a) {
+			score := 0
+			if opts.LengthShare > 0 && float64(lengths[len(code)]) < opts.LengthShare*float64(n) {
+				score++
+			}
+			if containsWord(code, words) {
+				score++
+			}
+			if mixedCase && wordCased(code, opts.MinCaseLetters) {
+				score++
+			}
+			switch {
+			case score == 0:
+				label = Generated
+			case score < opts.VanityScore:
+				label = Unknown
+			}
+		}
+		c.Labels[code] = label
+		switch label {
+		case Generated:
+			c.Generated = append(c.Generated, code)
+		case Vanity:
+			c.Vanity = append(c.Vanity, code)
+		default:
+			c.Unknown = append(c.Unknown, code)
+		}
+	}
+	return c
+}
+
+// inAlphabet reports whether a shortcode is non-empty and consists only
+// of characters in the alphabet, or any characters, when a is nil.
+func inAlphabet(code string, a *Alphabet) bool {
+	if code == "" {
+		return false
+	}
+	if a == nil {
+		return true
+	}
+	for i := 0; i < len(code); i++ {
+		if a.index[code[i]] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// containsWord reports whether a shortcode contains any of the
+// lowercase words, ignoring case.
+func containsWord(code string, words []string) bool {
+	code = strings.ToLower(code)
+	for _, w := range words {
+		if strings.Contains(code, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// wordCased reports whether a shortcode has at least minLetters ASCII
+// letters and its letters are all lowercase, all uppercase, or form
+// capitalized words, like "summer", "NASA", or "SpringSale".
+func wordCased(code string, minLetters int) bool {
+	lower, upper, capitalized := true, true, true
+	letters := 0
+	for i := 0; i < len(code); {
+		if !isLetter(code[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(code) && isLetter(code[j]) {
+			j++
+		}
+		run := code[i:j]
+		lower = lower && strings.ToLower(run) == run
+		upper = upper && strings.ToUpper(run) == run
+		capitalized = capitalized && capitalizedWords(run)
+		letters += j - i
+		i = j
+	}
+	return letters >= minLetters && (lower || upper || capitalized)
+}
+
+// capitalizedWords reports whether a run of letters is a sequence of
+// capitalized words of at least three letters.
+func capitalizedWords(run string) bool {
+	for i := 0; i < len(run); {
+		if !isUpper(run[i]) {
+			return false
+		}
+		j := i + 1
+		for j < len(run) && !isUpper(run[j]) {
+			j++
+		}
+		if j-i < 3 {
+			return false
+		}
+		i = j
+	}
+	return true
+}
+
+func isLetter(b byte) bool { return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' }
+func isUpper(b byte) bool  { return 'A' <= b && b <= 'Z' }
@@ -0,0 +1,130 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shorteners
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyCodes(t *testing.T) {
+	a, err := NewAlphabet("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := []struct {
+		Code  string
+		Label Label
+	}{
+		{"2Xb1RlE", Generated},
+		{"1mRJ9dX", Generated},
+		{"3cXw9Qz", Generated},
+		{"2kV4iL8", Generated},
+		{"1yZv5Bq", Generated},
+		{"aB3dE9f", Generated},
+		{"3fG7hJk", Generated},
+		{"2pQ8rSt", Generated},
+		{"1uV2wXy", Generated},
+		{"3zA4bCd", Generated},
+		{"2eF6gHi", Generated},
+		{"1jK0lMn", Generated},
+		{"nytimes", Vanity},     // word, lowercase
+		{"SpringSale", Vanity},  // length, words, capitalized
+		{"hello", Vanity},       // length, word, lowercase
+		{"my-event", Vanity},    // outside alphabet
+		{"NASA2021", Vanity},    // length, uppercase
+		{"2abcdef", Unknown},    // lowercase
+		{"7tEaMq2", Unknown},    // word
+		{"xK9", Unknown},        // length
+		{"promo21", Vanity},     // word, lowercase
+		{"café", Vanity},        // outside alphabet
+		{"summer", Vanity},      // length, word, lowercase
+		{"zOom4Ab", Unknown},    // word
+		{"1jK0lMn", Generated},  // duplicate
+		{"", Vanity},            // empty
+		{"StudentLife", Vanity}, // length, word, capitalized
+		{"GOOGLEDOCS", Vanity},  // length, word, uppercase
+		{"kY9pF34", Generated},
+		{"Qy6nB3W", Generated},
+		{"wd25rq4", Unknown}, // lowercase
+		{"f5zr3QA", Generated},
+		{"7YeEEBY", Generated},
+		{"3ABp3e2", Generated},
+		{"zS8iq9y", Generated},
+		{"7AjzQHb", Generated},
+		{"6BAEcn6", Generated},
+		{"zJ4A3Dd", Generated},
+		{"vHyrNkt", Generated},
+		{"BXtnjfO", Generated},
+		{"bINf5Aj", Generated},
+		{"xvUlKsi", Generated},
+		{"C47wqaM", Generated},
+		{"l9Xvq2Z", Generated},
+		{"G4MzAOU", Generated},
+		{"QklImCv", Generated},
+		{"BPt4R5Y", Generated},
+		{"huIG43K", Generated},
+		{"IjFAHQs", Generated},
+		{"iJoUGm1", Generated},
+		{"YtmaD7v", Generated},
+		{"3dNi8Lf", Generated},
+		{"ppWTv5a", Generated},
+	}
+	codes := make([]string, len(sample))
+	for i, s := range sample {
+		codes[i] = s.Code
+	}
+
+	c := ClassifyCodes(codes, a)
+	var generated, vanity, unknown []string
+	seen := make(map[string]bool)
+	for i, s := range sample {
+		if got := c.Labels[s.Code]; got != s.Label {
+			t.Errorf("#%d: got label %s for %q, want %s", i, got, s.Code, s.Label)
+		}
+		if seen[s.Code] {
+			continue
+		}
+		seen[s.Code] = true
+		switch s.Label {
+		case Generated:
+			generated = append(generated, s.Code)
+		case Vanity:
+			vanity = append(vanity, s.Code)
+		default:
+			unknown = append(unknown, s.Code)
+		}
+	}
+	if !reflect.DeepEqual(c.Generated, generated) {
+		t.Errorf("got generated %q, want %q", c.Generated, generated)
+	}
+	if !reflect.DeepEqual(c.Vanity, vanity) {
+		t.Errorf("got vanity %q, want %q", c.Vanity, vanity)
+	}
+	if !reflect.DeepEqual(c.Unknown, unknown) {
+		t.Errorf("got unknown %q, want %q", c.Unknown, unknown)
+	}
+
+	// Thresholds are tunable per shortener.
+	c = ClassifyCodesOptions(codes, a, ClassifyOptions{VanityScore: 1})
+	for _, code := range []string{"2abcdef", "7tEaMq2", "xK9", "zOom4Ab"} {
+		if got := c.Labels[code]; got != Vanity {
+			t.Errorf("got label %s for %q with score 1, want vanity", got, code)
+		}
+	}
+	c = ClassifyCodesOptions(codes, a, ClassifyOptions{LengthShare: -1, Words: []string{}})
+	if got := c.Labels["xK9"]; got != Generated {
+		t.Errorf("got label %s for %q without length and words, want generated", got, "xK9")
+	}
+	if got := c.Labels["hello"]; got != Unknown {
+		t.Errorf("got label %s for %q without length and words, want unknown", got, "hello")
+	}
+	c = ClassifyCodesOptions(codes, a, ClassifyOptions{MinWordLen: 6})
+	if got := c.Labels["7tEaMq2"]; got != Generated {
+		t.Errorf("got label %s for %q with minimum word length 6, want generated", got, "7tEaMq2")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shorteners
+
+import (
+	"net/url"
+	"strings"
+)
+
+// The following CleanFuncs are common transforms of shortcodes, which
+// can be composed with ChainClean. Like any CleanFunc, they return an
+// empty string when the capture should be skipped.
+
+// StripQuery removes a query that was escaped into the path, as in
+// /abc%3Futm_source=x.
+func StripQuery(shortcode string, u *url.URL) string {
+	return trimAfterByte(shortcode, '?')
+}
+
+// StripFragment removes a fragment that was escaped into the path, as
+// in /abc%23top.
+func StripFragment(shortcode string, u *url.URL) string {
+	return trimAfterByte(shortcode, '#')
+}
+
+// TrimTrailingPunct removes trailing punctuation, which is often
+// captured with shortcodes that were scraped from prose.
+func TrimTrailingPunct(shortcode string, u *url.URL) string {
+	return strings.TrimRight(shortcode, `.,;:!?)'"`)
+}
+
+// StripPlusSuffix removes the + that requests a redirect preview, as on
+// bit.ly.
+func StripPlusSuffix(shortcode string, u *url.URL) string {
+	return strings.TrimSuffix(shortcode, "+")
+}
+
+// FirstPathSegment keeps only the first segment of the path.
+func FirstPathSegment(shortcode string, u *url.URL) string {
+	return trimAfterByte(shortcode, '/')
+}
+
+// StripExtensions returns a CleanFunc that removes any of the given file
+// extensions, with the leading dot, like ".html", from the end of the
+// shortcode, ignoring case, until none remain.
+func StripExtensions(exts ...string) CleanFunc {
+	return func(shortcode string, u *url.URL) string {
+		for stripped := true; stripped; {
+			stripped = false
+			for _, ext := range exts {
+				n := len(shortcode) - len(ext)
+				if ext != "" && n >= 0 && strings.EqualFold(shortcode[n:], ext) {
+					shortcode = shortcode[:n]
+					stripped = true
+				}
+			}
+		}
+		return shortcode
+	}
+}
+
+// ChainClean returns a CleanFunc that applies each CleanFunc in order,
+// stopping when the shortcode is empty.
+func ChainClean(fs ...CleanFunc) CleanFunc {
+	return func(shortcode string, u *url.URL) string {
+		for _, f := range fs {
+			if shortcode == "" {
+				break
+			}
+			shortcode = f(shortcode, u)
+		}
+		return shortcode
+	}
+}
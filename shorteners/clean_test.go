@@ -0,0 +1,64 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shorteners
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCleanHelpers(t *testing.T) {
+	var calls int
+	count := func(shortcode string, u *url.URL) string {
+		calls++
+		return shortcode
+	}
+	tests := []struct {
+		name  string
+		clean CleanFunc
+		url   string
+		want  string
+	}{
+		{"StripQuery", StripQuery, "http://bit.ly/2Xb1RlE%3Futm_source=twitter&utm_medium=social", "2Xb1RlE"},
+		{"StripQuery", StripQuery, "http://bit.ly/abc?ref=x", "abc"}, // unescaped queries are not in the path
+		{"StripQuery", StripQuery, "http://bit.ly/%3Futm_source=x", ""},
+		{"StripFragment", StripFragment, "http://bit.ly/1mRJ9dX%23.U8u3nhVQAqw", "1mRJ9dX"},
+		{"StripFragment", StripFragment, "http://bit.ly/%23", ""},
+		{"TrimTrailingPunct", TrimTrailingPunct, "http://bit.ly/1yZv5Bq).", "1yZv5Bq"},
+		{"TrimTrailingPunct", TrimTrailingPunct, "http://bit.ly/aBc12?!", "aBc12"},
+		{"TrimTrailingPunct", TrimTrailingPunct, `http://bit.ly/XyZ%22:`, "XyZ"},
+		{"TrimTrailingPunct", TrimTrailingPunct, "http://bit.ly/...", ""},
+		{"StripPlusSuffix", StripPlusSuffix, "http://bit.ly/2kV4iL8+", "2kV4iL8"},
+		{"StripPlusSuffix", StripPlusSuffix, "http://bit.ly/a+b", "a+b"},
+		{"FirstPathSegment", FirstPathSegment, "http://deb.li/p/debian/extra", "p"},
+		{"FirstPathSegment", FirstPathSegment, "http://bfy.tw/Ej4D/wordpress/wp-content/uploads/logo.png", "Ej4D"},
+		{"StripExtensions", StripExtensions(".html", ".php"), "http://qr.cx/index.PHP", "index"},
+		{"StripExtensions", StripExtensions(".html", ".php"), "http://qr.cx/abc.php.html", "abc"},
+		{"StripExtensions", StripExtensions(".html", ".php", ""), "http://qr.cx/abc.htm", "abc.htm"},
+		{"StripExtensions", StripExtensions(".html"), "http://qr.cx/.html", ""},
+		{"ChainClean", ChainClean(FirstPathSegment, StripQuery, StripPlusSuffix, TrimTrailingPunct),
+			"http://bit.ly/3cXw9Qz+%3Fs=09/amp", "3cXw9Qz"},
+		{"ChainClean", ChainClean(StripExtensions(".png"), StripFragment, TrimTrailingPunct),
+			"http://bit.ly/AbCd.%23x.png", "AbCd"},
+		{"ChainClean", ChainClean(StripQuery, count), "http://bit.ly/%3Fx", ""},
+		{"ChainClean", ChainClean(), "http://bit.ly/abc", "abc"},
+	}
+	for i, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if got := tt.clean(strings.TrimLeft(u.Path, "/"), u); got != tt.want {
+			t.Errorf("#%d: %s(%q) = %q, want %q", i, tt.name, tt.url, got, tt.want)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("ChainClean called %d functions after an empty shortcode", calls)
+	}
+}
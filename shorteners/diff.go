@@ -0,0 +1,138 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shorteners
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+// DiffSources compares the shortcodes captured by the Internet Archive
+// with the sources of a link dump, like a URLTeam release, and returns
+// the distinct shortcodes only in each. The dump is streamed and only
+// its sources are compared, so its targets are never held in memory.
+//
+// When less is non-nil, the dump must be sorted by less and is compared
+// in a single pass with a sorted copy of iaCodes, so only the codes of
+// the differences are held in memory, and both are returned in that
+// order. It is an error for the dump to be out of order. Otherwise, the
+// dump may be in any order and iaCodes is held in a set, and both are
+// returned in the order in which they appear.
+func DiffSources(iaCodes []string, dump *beacon.Reader, less func(a, b string) bool) (onlyIA, onlyDump []string, err error) {
+	if less != nil {
+		return diffSorted(iaCodes, dump, less)
+	}
+	inDump := make(map[string]bool, len(iaCodes))
+	for _, code := range iaCodes {
+		inDump[code] = false
+	}
+	dumpSeen := make(map[string]struct{})
+	for {
+		l, err := dump.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := inDump[l.Source]; ok {
+			inDump[l.Source] = true
+		} else if _, ok := dumpSeen[l.Source]; !ok {
+			dumpSeen[l.Source] = struct{}{}
+			onlyDump = append(onlyDump, l.Source)
+		}
+	}
+	for _, code := range iaCodes {
+		if !inDump[code] {
+			onlyIA = append(onlyIA, code)
+			inDump[code] = true // skip duplicates
+		}
+	}
+	return onlyIA, onlyDump, nil
+}
+
+func diffSorted(iaCodes []string, dump *beacon.Reader, less func(a, b string) bool) (onlyIA, onlyDump []string, err error) {
+	ia := make([]string, len(iaCodes))
+	copy(ia, iaCodes)
+	sort.SliceStable(ia, func(i, j int) bool { return less(ia[i], ia[j]) })
+	equal := func(a, b string) bool { return !less(a, b) && !less(b, a) }
+
+	i := 0
+	prev, first := "", true
+	for {
+		l, err := dump.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		code := l.Source
+		if !first {
+			if less(code, prev) {
+				line, _ := dump.Position()
+				return nil, nil, fmt.Errorf("diff sources: dump not sorted at line %d: %q before %q", line, prev, code)
+			}
+			if equal(code, prev) {
+				continue
+			}
+		}
+		prev, first = code, false
+		for i < len(ia) && less(ia[i], code) {
+			onlyIA = appendDistinct(onlyIA, ia[i], equal)
+			i++
+		}
+		if i < len(ia) && equal(ia[i], code) {
+			for i < len(ia) && equal(ia[i], code) {
+				i++
+			}
+		} else {
+			onlyDump = append(onlyDump, code)
+		}
+	}
+	for ; i < len(ia); i++ {
+		onlyIA = appendDistinct(onlyIA, ia[i], equal)
+	}
+	return onlyIA, onlyDump, nil
+}
+
+// appendDistinct appends code to sorted codes, unless it equals the
+// last.
+func appendDistinct(codes []string, code string, equal func(a, b string) bool) []string {
+	if len(codes) != 0 && equal(codes[len(codes)-1], code) {
+		return codes
+	}
+	return append(codes, code)
+}
+
+// DiffDumpFile compares the shortcodes captured by the Internet Archive
+// with the sources of a link dump file, as described by DiffSources,
+// without requiring the dump to be sorted. The dump may be compressed
+// with gzip, bzip2, xz, or zstd and its format is detected.
+func (s *Shortener) DiffDumpFile(iaCodes []string, filename string) (onlyIA, onlyDump []string, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	rc, err := beacon.Decompress(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	defer rc.Close()
+	r, err := beacon.NewAutoReader(rc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	onlyIA, onlyDump, err = DiffSources(iaCodes, r, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s: %w", s.Name, filename, err)
+	}
+	return onlyIA, onlyDump, nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shorteners
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+func TestDiffSources(t *testing.T) {
+	iaCodes := []string{"e", "a", "c", "a", "g"}
+	less := func(a, b string) bool { return a < b }
+	tests := []struct {
+		Dump     string
+		Less     func(a, b string) bool
+		OnlyIA   []string
+		OnlyDump []string
+	}{
+		{"b|http://b\nc|http://c\nc|http://c2\nd|http://d\ng|http://g\n", less, []string{"a", "e"}, []string{"b", "d"}},
+		{"d|http://d\nc|http://c\nb|http://b\ng|http://g\nd|http://d\n", nil, []string{"e", "a"}, []string{"d", "b"}},
+		{"", less, []string{"a", "c", "e", "g"}, nil},
+		{"a|http://a\nc|http://c\ne|http://e\ng|http://g\nh|http://h\n", less, nil, []string{"h"}},
+	}
+	for i, tt := range tests {
+		r := beacon.NewURLTeamReader(strings.NewReader(tt.Dump), 0)
+		onlyIA, onlyDump, err := DiffSources(iaCodes, r, tt.Less)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(onlyIA, tt.OnlyIA) || !reflect.DeepEqual(onlyDump, tt.OnlyDump) {
+			t.Errorf("#%d: got %q and %q, want %q and %q", i, onlyIA, onlyDump, tt.OnlyIA, tt.OnlyDump)
+		}
+	}
+
+	r := beacon.NewURLTeamReader(strings.NewReader("c|http://c\nb|http://b\n"), 0)
+	if _, _, err := DiffSources(iaCodes, r, less); err == nil || !strings.Contains(err.Error(), "not sorted") {
+		t.Errorf("got error %v for unsorted dump", err)
+	}
+}
+
+func TestDiffDumpFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "bfy-tw.txt.gz")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	zw.Write([]byte("PanS|http://example.com/1\nZd0|http://example.com/2\n"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	onlyIA, onlyDump, err := Bfytw.DiffDumpFile([]string{"80xn", "PanS"}, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"80xn"}; !reflect.DeepEqual(onlyIA, want) {
+		t.Errorf("got only IA %q, want %q", onlyIA, want)
+	}
+	if want := []string{"Zd0"}; !reflect.DeepEqual(onlyDump, want) {
+		t.Errorf("got only dump %q, want %q", onlyDump, want)
+	}
+}
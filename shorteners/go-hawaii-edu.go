@@ -29,7 +29,7 @@ var GoHawaiiEdu = &Shortener{
 			return ""
 		}
 		// Remove redirect preview
-		return strings.TrimSuffix(shortcode, "+")
+		return StripPlusSuffix(shortcode, u)
 	},
 	HasVanity: false,
 }
@@ -0,0 +1,304 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shorteners
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/andrewarchi/urlhero/ia"
+)
+
+// DefaultPageSize is the default number of captures requested from the
+// Internet Archive at once.
+const DefaultPageSize = 100000
+
+// Backend is the Internet Archive API that captures are queried from.
+// The shortcodes found differ between them.
+type Backend int
+
+const (
+	// BackendTimemap queries the timemap API, which returns captures of
+	// any status, including 404 pages and robots.txt.
+	BackendTimemap Backend = iota
+	// BackendCDX queries the CDX API for only the captures that
+	// redirected, with status 3xx.
+	BackendCDX
+)
+
+func (b Backend) String() string {
+	switch b {
+	case BackendTimemap:
+		return "timemap"
+	case BackendCDX:
+		return "cdx"
+	}
+	return fmt.Sprintf("Backend(%d)", int(b))
+}
+
+// IAOptions configures GetIAShortcodesContext and EachIAShortcode.
+type IAOptions struct {
+	// PageSize is the number of captures requested at once. It is
+	// DefaultPageSize when <=0.
+	PageSize int
+	// Backend is the API to query, BackendTimemap by default.
+	Backend Backend
+	// AcceptOK, with BackendCDX, also accepts captures with status 200,
+	// for shorteners that redirect with a meta refresh or script.
+	AcceptOK bool
+	// Progress, when non-nil, is called after each page of captures.
+	Progress func(IAProgress)
+	// Seen, when non-nil, deduplicates shortcodes instead of a new
+	// MapSet. Shortcodes that it already contains are skipped.
+	Seen ShortcodeSet
+	// FoldCase deduplicates shortcodes case-insensitively, for shorteners
+	// that ignore case, keeping the form that is seen first. Shortcodes
+	// are checked against the pattern of the shortener in lower case and
+	// are added to Seen in lower case.
+	FoldCase bool
+	// CaseCollision, when non-nil with FoldCase, is called once for each
+	// form of a shortcode that differs in case from the first form seen,
+	// which can show whether a shortener is actually case-sensitive.
+	CaseCollision func(CaseCollision)
+}
+
+// IAProgress is the progress of querying the captures of a shortener.
+type IAProgress struct {
+	Backend    Backend
+	Pages      int // pages fetched
+	Captures   int // captures fetched
+	Shortcodes int // distinct shortcodes so far
+
+	Host           string // host being queried
+	HostCaptures   int    // captures fetched for Host
+	HostShortcodes int    // shortcodes first found on Host
+}
+
+// GetIAShortcodes queries all the shortcodes that have been archived on
+// the Internet Archive.
+func (s *Shortener) GetIAShortcodes() ([]string, error) {
+	return s.GetIAShortcodesContext(context.Background(), nil)
+}
+
+// GetIAShortcodesContext queries all the shortcodes that have been
+// archived on the Internet Archive, paging through the captures of the
+// host and each alias of the shortener until the API of the Backend
+// option reports no more. Shortcodes are deduplicated across hosts. When
+// a full page is returned without a key to resume from, the shortcodes
+// so far are returned with an error, since later captures would be
+// missed. URLs that cannot be cleaned to a valid shortcode are reported
+// together in the error, after the valid shortcodes are collected.
+func (s *Shortener) GetIAShortcodesContext(ctx context.Context, opts *IAOptions) ([]string, error) {
+	var shortcodes []string
+	err := s.eachIAShortcode(ctx, opts, "GetIAShortcodes", nil, func(shortcode string) error {
+		shortcodes = append(shortcodes, shortcode)
+		return nil
+	})
+	s.Sort(shortcodes)
+	return shortcodes, err
+}
+
+// GetIAShortcodesLenient is like GetIAShortcodesContext, but collects
+// the URLs that cannot be parsed or that clean to a shortcode that does
+// not match the pattern of the shortener, instead of reporting them as
+// errors. These are often captures of URLs with encoded spaces or of
+// other files on the host.
+func (s *Shortener) GetIAShortcodesLenient(ctx context.Context, opts *IAOptions) (shortcodes []string, invalid []InvalidShortcode, err error) {
+	err = s.eachIAShortcode(ctx, opts, "GetIAShortcodes", func(is InvalidShortcode) {
+		invalid = append(invalid, is)
+	}, func(shortcode string) error {
+		shortcodes = append(shortcodes, shortcode)
+		return nil
+	})
+	s.Sort(shortcodes)
+	return shortcodes, invalid, err
+}
+
+// EachIAShortcode queries all the shortcodes that have been archived on
+// the Internet Archive, like GetIAShortcodesContext, and calls fn with
+// each distinct shortcode as the pages of captures arrive, without
+// holding them in memory or sorting them. Shortcodes are deduplicated
+// with the Seen option, which may be backed by disk for shorteners with
+// many shortcodes. When fn returns an error, querying stops and the
+// error is returned. URLs that cannot be cleaned to a valid shortcode
+// are reported together in the error at the end.
+func (s *Shortener) EachIAShortcode(ctx context.Context, opts *IAOptions, fn func(shortcode string) error) error {
+	return s.eachIAShortcode(ctx, opts, "EachIAShortcode", nil, fn)
+}
+
+// eachIAShortcode calls fn with each distinct shortcode of the captures
+// of the hosts of the shortener. Cleaning errors are tagged with tag,
+// unless invalid is non-nil, in which case invalid shortcodes are passed
+// to it.
+func (s *Shortener) eachIAShortcode(ctx context.Context, opts *IAOptions, tag string, invalid func(InvalidShortcode), fn func(shortcode string) error) error {
+	if opts == nil {
+		opts = &IAOptions{}
+	}
+	set := s.newShortcodeSet(opts.Seen)
+	set.folder = newCaseFolder(opts.FoldCase, opts.CaseCollision)
+	set.invalid = invalid
+	n := 0
+	err := s.queryIA(ctx, opts, "original", []string{"original"}, func(capture []string) error {
+		shortcode, ok := set.add(capture[0])
+		if !ok {
+			return nil
+		}
+		n++
+		return fn(shortcode)
+	}, func() int { return n })
+	if err != nil {
+		return err
+	}
+	return set.err(tag)
+}
+
+// ShortcodeCapture is when a shortcode was captured by the Internet
+// Archive.
+type ShortcodeCapture struct {
+	Code        string
+	First, Last time.Time
+	Captures    int // captures of any URL that cleans to Code
+}
+
+// GetIAShortcodeCaptures queries all the shortcodes that have been
+// archived on the Internet Archive, like GetIAShortcodesContext, with
+// the times of their first and last captures and the number of
+// captures. Every capture is requested, instead of one per URL, so
+// there are many more pages than for GetIAShortcodesContext. The
+// captures are sorted by shortcode, as with Sort. With FoldCase,
+// captures are aggregated case-insensitively under the form seen first.
+func (s *Shortener) GetIAShortcodeCaptures(ctx context.Context, opts *IAOptions) ([]ShortcodeCapture, error) {
+	if opts == nil {
+		opts = &IAOptions{}
+	}
+	folder := newCaseFolder(opts.FoldCase, opts.CaseCollision)
+	captures := make(map[string]*ShortcodeCapture)
+	var errs []error
+	err := s.queryIA(ctx, opts, "", []string{"original", "timestamp"}, func(capture []string) error {
+		if len(capture) < 2 {
+			return nil
+		}
+		shortcode, err := s.clean(capture[0], opts.FoldCase)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		} else if shortcode == "" {
+			return nil
+		}
+		t, err := time.Parse(ia.TimestampFormat, capture[1])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: capture of %q: %w", s.Name, capture[0], err))
+			return nil
+		}
+		key := folder.key(shortcode)
+		c, ok := captures[key]
+		if !ok {
+			captures[key] = &ShortcodeCapture{Code: shortcode, First: t, Last: t, Captures: 1}
+			return nil
+		}
+		if t.Before(c.First) {
+			c.First = t
+		}
+		if t.After(c.Last) {
+			c.Last = t
+		}
+		c.Captures++
+		return nil
+	}, func() int { return len(captures) })
+
+	sorted := make([]ShortcodeCapture, 0, len(captures))
+	for _, c := range captures {
+		sorted = append(sorted, *c)
+	}
+	less := s.less()
+	sort.Slice(sorted, func(i, j int) bool { return less(sorted[i].Code, sorted[j].Code) })
+	if err == nil && len(errs) != 0 {
+		err = &multiError{"GetIAShortcodeCaptures", errs}
+	}
+	return sorted, err
+}
+
+// queryIA pages through the captures of the hosts of the shortener,
+// with the given fields, collapsed by a field, if any, and calls add for
+// each, stopping at the first error from add. count returns the number
+// of distinct shortcodes so far, for progress.
+func (s *Shortener) queryIA(ctx context.Context, opts *IAOptions, collapse string, fields []string, add func(capture []string) error, count func() int) error {
+	if opts == nil {
+		opts = &IAOptions{}
+	}
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	var getPage func(host, resumeKey string) (*ia.TimemapPage, error)
+	switch opts.Backend {
+	case BackendTimemap:
+		getPage = func(host, resumeKey string) (*ia.TimemapPage, error) {
+			return ia.GetTimemapPage(ctx, host, &ia.TimemapOptions{
+				Collapse:    collapse,
+				Fields:      fields,
+				MatchPrefix: true,
+				Limit:       pageSize,
+				ResumeKey:   resumeKey,
+			})
+		}
+	case BackendCDX:
+		filter := "statuscode:3.."
+		if opts.AcceptOK {
+			filter = "statuscode:(200|3..)"
+		}
+		getPage = func(host, resumeKey string) (*ia.TimemapPage, error) {
+			return ia.GetCDX(ctx, host, &ia.CDXOptions{
+				Collapse:    collapse,
+				Fields:      fields,
+				Filters:     []string{filter},
+				MatchPrefix: true,
+				Limit:       pageSize,
+				ResumeKey:   resumeKey,
+			})
+		}
+	default:
+		return fmt.Errorf("%s: unknown backend %v", s.Name, opts.Backend)
+	}
+	progress := IAProgress{Backend: opts.Backend}
+	for _, host := range s.Hosts() {
+		progress.Host, progress.HostCaptures, progress.HostShortcodes = host, 0, 0
+		resumeKey := ""
+		for {
+			page, err := getPage(host, resumeKey)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %v page %d: %w", s.Name, host, opts.Backend, progress.Pages+1, err)
+			}
+			n := count()
+			for _, capture := range page.Captures {
+				if len(capture) != 0 {
+					if err := add(capture); err != nil {
+						return err
+					}
+				}
+			}
+			progress.Pages++
+			progress.Captures += len(page.Captures)
+			progress.Shortcodes = count()
+			progress.HostCaptures += len(page.Captures)
+			progress.HostShortcodes += progress.Shortcodes - n
+			if opts.Progress != nil {
+				opts.Progress(progress)
+			}
+			if page.ResumeKey == "" {
+				if len(page.Captures) >= pageSize {
+					return fmt.Errorf("%s: %s: %v truncated at %d captures without a resume key", s.Name, host, opts.Backend, progress.HostCaptures)
+				}
+				break
+			}
+			resumeKey = page.ResumeKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shorteners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrewarchi/urlhero/beacon"
+	"golang.org/x/time/rate"
+)
+
+// ResolveOptions configures Resolve.
+type ResolveOptions struct {
+	// Concurrency is the number of shortcodes resolved at once. It is 1
+	// when <=0.
+	Concurrency int
+	// RateLimit is the maximum number of requests per second to each
+	// host, including the hosts of redirects. It is unlimited when <=0.
+	RateLimit float64
+	// Timeout is the time limit for resolving each shortcode, including
+	// redirects. There is no limit when 0.
+	Timeout time.Duration
+	// Method is the HTTP method, http.MethodHead or http.MethodGet. It is
+	// HEAD when empty. Some shorteners only redirect GET requests.
+	Method string
+	// Client, when non-nil, makes the requests instead of
+	// http.DefaultClient. Its CheckRedirect is replaced.
+	Client *http.Client
+}
+
+// ResolveResult is the result of resolving a shortcode.
+type ResolveResult struct {
+	Code       string
+	URL        string   // final URL, after redirects
+	Redirects  []string // URLs redirected through, excluding the short and final URLs
+	StatusCode int      // status of the final URL or 0, when not requested or it failed
+	// Err is nil when the shortcode redirected, wraps ErrNotFound or
+	// ErrParked when the shortcode does not exist, and is otherwise a
+	// network or HTTP error, which may succeed when retried.
+	Err error
+	// FinalErr is the error from following the redirects, such as when
+	// the final URL is dead or unreachable. The shortcode still resolved,
+	// so Err is nil.
+	FinalErr error
+}
+
+var (
+	// ErrNotFound is reported for shortcodes to which the shortener
+	// responds with 404 Not Found or 410 Gone.
+	ErrNotFound = errors.New("shortcode not found")
+	// ErrParked is reported for shortcodes that redirect to a domain
+	// parking service, usually since the shortener is defunct.
+	ErrParked = errors.New("shortcode redirects to parked domain")
+)
+
+// ParkingHosts are the hosts of domain parking services, which are
+// checked, along with their subdomains, for ErrParked.
+var ParkingHosts = []string{
+	"afternic.com",
+	"bodis.com",
+	"dan.com",
+	"domainmarket.com",
+	"hugedomains.com",
+	"parkingcrew.net",
+	"sedo.com",
+	"sedoparking.com",
+	"undeveloped.com",
+}
+
+// maxRedirects is the number of redirects followed when resolving.
+const maxRedirects = 10
+
+// Target returns the URL that the short URL redirects to, which is the
+// first redirect, or false, when it did not redirect.
+func (r ResolveResult) Target() (string, bool) {
+	if r.Err != nil {
+		return "", false
+	}
+	if len(r.Redirects) != 0 {
+		return r.Redirects[0], true
+	}
+	return r.URL, true
+}
+
+// Link converts the result to a link from the shortcode to its target,
+// annotated with the status code of the final URL, if any. It returns
+// false when the shortcode did not resolve.
+func (r ResolveResult) Link() (beacon.Link, bool) {
+	target, ok := r.Target()
+	if !ok {
+		return beacon.Link{}, false
+	}
+	l := beacon.Link{Source: r.Code, Target: target}
+	if r.StatusCode != 0 {
+		l.Annotation = strconv.Itoa(r.StatusCode)
+	}
+	return l, true
+}
+
+// Resolve requests the short URL of each shortcode and follows its
+// redirects. The results are sent on the returned channel in the order
+// that they finish, which is closed once all have been sent or ctx is
+// done. The channel must be received from until it is closed or ctx
+// must be canceled. A shortcode that does not redirect is reported with
+// ErrNotFound for status 404 or 410 and, otherwise, with an error for
+// its status.
+func Resolve(ctx context.Context, s *Shortener, codes []string, opts ResolveOptions) (<-chan ResolveResult, error) {
+	if s.Prefix == "" {
+		return nil, fmt.Errorf("%s: resolve: shortener has no prefix", s.Name)
+	}
+	method := opts.Method
+	switch method {
+	case "":
+		method = http.MethodHead
+	case http.MethodHead, http.MethodGet:
+	default:
+		return nil, fmt.Errorf("%s: resolve: unsupported method %s", s.Name, method)
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	client := http.DefaultClient
+	if opts.Client != nil {
+		client = opts.Client
+	}
+	if opts.RateLimit > 0 {
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		c := *client
+		c.Transport = &limitTransport{base: base, limit: rate.Limit(opts.RateLimit)}
+		client = &c
+	}
+
+	jobs := make(chan string)
+	results := make(chan ResolveResult, concurrency)
+	go func() {
+		defer close(jobs)
+		for _, code := range codes {
+			select {
+			case jobs <- code:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for code := range jobs {
+				r := resolve(ctx, s, client, method, opts.Timeout, code)
+				select {
+				case results <- r:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results, nil
+}
+
+// resolve requests the short URL of a shortcode and follows its
+// redirects.
+func resolve(ctx context.Context, s *Shortener, client *http.Client, method string, timeout time.Duration, code string) ResolveResult {
+	r := ResolveResult{Code: code, URL: s.URL(code)}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.URL, nil)
+	if err != nil {
+		r.Err = fmt.Errorf("%s: resolve %s: %w", s.Name, code, err)
+		return r
+	}
+	var hops []string
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		hops = append(hops, req.URL.String())
+		return nil
+	}
+	resp, err := c.Do(req)
+	if err == nil {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		r.StatusCode = resp.StatusCode
+	}
+	if len(hops) != 0 {
+		r.URL, r.Redirects = hops[len(hops)-1], hops[:len(hops)-1]
+		for _, hop := range hops {
+			if isParked(hop) {
+				r.Err = fmt.Errorf("%s: resolve %s: %w", s.Name, code, ErrParked)
+				return r
+			}
+		}
+		if err != nil {
+			// The shortcode redirected, but its target could not be
+			// reached, which is not retried.
+			r.FinalErr = fmt.Errorf("%s: resolve %s: follow redirect: %w", s.Name, code, err)
+		}
+		return r
+	}
+	if err != nil {
+		r.Err = fmt.Errorf("%s: resolve %s: %w", s.Name, code, err)
+		return r
+	}
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		r.Err = fmt.Errorf("%s: resolve %s: %w", s.Name, code, ErrNotFound)
+	default:
+		r.Err = fmt.Errorf("%s: resolve %s: no redirect: %s", s.Name, code, resp.Status)
+	}
+	return r
+}
+
+// isParked reports whether a URL is on the host of a domain parking
+// service.
+func isParked(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := getHostname(u)
+	for _, parking := range ParkingHosts {
+		if host == parking || strings.HasSuffix(host, "."+parking) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitTransport limits the rate of requests to each host.
+type limitTransport struct {
+	base  http.RoundTripper
+	limit rate.Limit
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	l, ok := t.limiters[req.URL.Host]
+	if !ok {
+		if t.limiters == nil {
+			t.limiters = make(map[string]*rate.Limiter)
+		}
+		l = rate.NewLimiter(t.limit, 1)
+		t.limiters[req.URL.Host] = l
+	}
+	t.mu.Unlock()
+	if err := l.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
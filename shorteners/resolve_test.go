@@ -0,0 +1,147 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shorteners
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+func TestResolve(t *testing.T) {
+	parking := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer parking.Close()
+	parkingURL := strings.Replace(parking.URL, "127.0.0.1", "localhost", 1)
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	deadURL := dead.URL + "/page"
+	dead.Close()
+	defer func(hosts []string) { ParkingHosts = hosts }(ParkingHosts)
+	ParkingHosts = []string{"localhost"}
+
+	var (
+		mu      sync.Mutex
+		methods []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/abc":
+			http.Redirect(w, r, "/landing?from=abc", http.StatusMovedPermanently)
+		case "/landing":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		case "/final":
+			w.WriteHeader(http.StatusOK)
+		case "/def":
+			http.Redirect(w, r, "/final", http.StatusMovedPermanently)
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		case "/parked":
+			http.Redirect(w, r, parkingURL+"/?domain=example", http.StatusFound)
+		case "/dead":
+			http.Redirect(w, r, deadURL, http.StatusMovedPermanently)
+		case "/busy":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	s := &Shortener{Name: "example", Host: "ex.test", Prefix: srv.URL + "/"}
+
+	results, err := Resolve(context.Background(), s, []string{"abc", "def", "gone", "missing", "parked", "dead", "busy"}, ResolveOptions{Method: http.MethodGet})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]ResolveResult)
+	for r := range results {
+		got[r.Code] = r
+	}
+	abc := got["abc"]
+	if abc.Err != nil || abc.URL != srv.URL+"/final" || abc.StatusCode != http.StatusOK ||
+		!reflect.DeepEqual(abc.Redirects, []string{srv.URL + "/landing?from=abc"}) {
+		t.Errorf("got result %+v for abc", abc)
+	}
+	if l, ok := abc.Link(); !ok || l != (beacon.Link{Source: "abc", Target: srv.URL + "/landing?from=abc", Annotation: "200"}) {
+		t.Errorf("got link %v, %t for abc", l, ok)
+	}
+	if l, ok := got["def"].Link(); !ok || l.Target != srv.URL+"/final" {
+		t.Errorf("got link %v, %t for def", l, ok)
+	}
+	for _, code := range []string{"gone", "missing"} {
+		if r := got[code]; !errors.Is(r.Err, ErrNotFound) {
+			t.Errorf("got result %+v for %s, want not found", r, code)
+		}
+	}
+	if r := got["parked"]; !errors.Is(r.Err, ErrParked) {
+		t.Errorf("got result %+v for parked, want parked", r)
+	}
+	// A shortcode to a dead target resolves, without a final status.
+	if r := got["dead"]; r.Err != nil || r.FinalErr == nil || r.StatusCode != 0 || r.URL != deadURL {
+		t.Errorf("got result %+v for dead, want resolved with final error", r)
+	}
+	if l, ok := got["dead"].Link(); !ok || l != (beacon.Link{Source: "dead", Target: deadURL}) {
+		t.Errorf("got link %v, %t for dead", l, ok)
+	}
+	if r := got["busy"]; r.Err == nil || errors.Is(r.Err, ErrNotFound) || r.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got result %+v for busy, want retryable error", r)
+	}
+	if _, ok := got["gone"].Link(); ok {
+		t.Error("got link for unresolved shortcode")
+	}
+	for _, m := range methods {
+		if m != http.MethodGet {
+			t.Errorf("got method %s, want GET", m)
+		}
+	}
+
+	// Requests to each host are rate limited and network errors are not
+	// mistaken for missing shortcodes.
+	methods = nil
+	start := time.Now()
+	results, err = Resolve(context.Background(), s, []string{"gone", "missing", "busy"}, ResolveOptions{Concurrency: 3, RateLimit: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for r := range results {
+		codes = append(codes, r.Code)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("resolved 3 shortcodes at 20/s in %v", elapsed)
+	}
+	sort.Strings(codes)
+	if want := []string{"busy", "gone", "missing"}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("got codes %q, want %q", codes, want)
+	}
+	if len(methods) != 3 || methods[0] != http.MethodHead {
+		t.Errorf("got methods %q, want HEAD", methods)
+	}
+
+	srv.Close()
+	results, err = Resolve(context.Background(), s, []string{"abc"}, ResolveOptions{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := <-results; r.Err == nil || errors.Is(r.Err, ErrNotFound) || errors.Is(r.Err, ErrParked) {
+		t.Errorf("got result %+v from closed server, want network error", r)
+	}
+
+	if _, err := Resolve(context.Background(), s, nil, ResolveOptions{Method: http.MethodPost}); err == nil {
+		t.Error("resolved with POST")
+	}
+}
@@ -10,77 +10,205 @@ package shorteners
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"net/url"
 	"regexp"
 	"sort"
 	"strings"
-
-	"github.com/andrewarchi/urlhero/ia"
+	"sync"
 )
 
+// Shortener describes a URL shortening website.
 type Shortener struct {
 	Name         string
 	Host         string
-	Prefix       string
+	Aliases      []string // other hosts that serve the same shortcodes
+	Prefix       string   // short URL without the shortcode
 	Alphabet     string
 	Pattern      *regexp.Regexp
 	CleanFunc    CleanFunc
 	IsVanityFunc IsVanityFunc
+	LessFunc     LessFunc // ordering of shortcodes; see Sort
 	HasVanity    bool
 }
 
 type CleanFunc func(shortcode string, u *url.URL) string
 type IsVanityFunc func(shortcode string) bool
+type LessFunc func(a, b string) bool
 
-var Shorteners = []*Shortener{
-	Allst,
-	Bfytw,
-	Debli,
-	GoHawaiiEdu,
-	MobyTo,
-	Qrcx,
-	Rbgy,
-	RedHt,
-	ShortIm,
-	SUconnEdu,
-}
-
-var Lookup = make(map[string]*Shortener)
+var registry = struct {
+	sync.RWMutex
+	shorteners []*Shortener
+	lookup     map[string]*Shortener // by name, host, and alias
+	hosts      map[string]*Shortener // by host and alias
+}{lookup: make(map[string]*Shortener), hosts: make(map[string]*Shortener)}
 
 func init() {
-	for _, s := range Shorteners {
-		if _, ok := Lookup[s.Name]; ok {
-			panic(fmt.Errorf("multiple shorteners with name %s", s.Name))
-		}
-		if _, ok := Lookup[s.Host]; ok {
-			panic(fmt.Errorf("multiple shorteners with host %s", s.Host))
+	for _, s := range []*Shortener{
+		Allst,
+		Bfytw,
+		Debli,
+		GoHawaiiEdu,
+		MobyTo,
+		Qrcx,
+		Rbgy,
+		RedHt,
+		ShortIm,
+		SUconnEdu,
+	} {
+		Register(s)
+	}
+}
+
+// Register adds a shortener to the registry, so that it can be found by
+// Lookup and is included in All. When LessFunc is nil, it is set to the
+// default ordering of Sort, which is numeric by Alphabet, if any. It
+// panics when a shortener with the same name, host, or alias is already
+// registered.
+func Register(s *Shortener) {
+	registry.Lock()
+	defer registry.Unlock()
+	keys := append([]string{s.Name, s.Host}, s.Aliases...)
+	for _, key := range keys {
+		if _, ok := registry.lookup[key]; ok {
+			panic(fmt.Errorf("shorteners: multiple shorteners with name or host %s", key))
 		}
-		Lookup[s.Name] = s
-		Lookup[s.Host] = s
 	}
+	if s.LessFunc == nil {
+		s.LessFunc = s.less()
+	}
+	for _, key := range keys {
+		registry.lookup[key] = s
+	}
+	for _, host := range s.Hosts() {
+		registry.hosts[host] = s
+	}
+	registry.shorteners = append(registry.shorteners, s)
+}
+
+// Lookup returns the registered shortener with the given name, host, or
+// alias, or nil. A www. prefix on the host is ignored.
+func Lookup(nameOrHost string) *Shortener {
+	registry.RLock()
+	defer registry.RUnlock()
+	if s, ok := registry.lookup[nameOrHost]; ok {
+		return s
+	}
+	return registry.lookup[strings.TrimPrefix(nameOrHost, "www.")]
+}
+
+// Match returns the registered shortener for the host of a URL, or its
+// aliases, ignoring a www. prefix, and the shortcode cleaned from the
+// URL. It returns nil when the host is not of a registered shortener or
+// the URL has no valid shortcode.
+func Match(u *url.URL) (*Shortener, string) {
+	host := strings.ToLower(u.Hostname())
+	registry.RLock()
+	s, ok := registry.hosts[host]
+	if !ok {
+		s, ok = registry.hosts[strings.TrimPrefix(host, "www.")]
+	}
+	registry.RUnlock()
+	if !ok {
+		return nil, ""
+	}
+	shortcode, err := s.CleanURL(u)
+	if err != nil || shortcode == "" {
+		return nil, ""
+	}
+	return s, shortcode
+}
+
+// IsShortURL reports whether a URL is a short URL of a registered
+// shortener, as determined by Match. The scheme may be omitted, as in
+// bfy.tw/PanS.
+func IsShortURL(rawURL string) bool {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	s, _ := Match(u)
+	return s != nil
+}
+
+// All returns the registered shorteners, sorted by name.
+func All() []*Shortener {
+	registry.RLock()
+	all := append([]*Shortener(nil), registry.shorteners...)
+	registry.RUnlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// Hosts returns the host and aliases of the shortener.
+func (s *Shortener) Hosts() []string {
+	return append([]string{s.Host}, s.Aliases...)
+}
+
+// URL returns the short URL for a shortcode.
+func (s *Shortener) URL(shortcode string) string {
+	return s.Prefix + shortcode
 }
 
 // Clean extracts the shortcode from a URL. An empty string is returned
 // when no shortcode can be found.
 func (s *Shortener) Clean(shortURL string) (string, error) {
+	return s.clean(shortURL, false)
+}
+
+func (s *Shortener) clean(shortURL string, fold bool) (string, error) {
 	u, err := url.Parse(shortURL)
 	if err != nil {
 		return "", err
 	}
-	return s.CleanURL(u)
+	return s.cleanURL(u, fold)
 }
 
 // CleanURL extracts the shortcode from a URL. An empty string is
-// returned when no shortcode can be found.
+// returned when no shortcode can be found. A shortcode that does not
+// match Pattern is reported with an *InvalidShortcodeError.
 func (s *Shortener) CleanURL(u *url.URL) (string, error) {
+	return s.cleanURL(u, false)
+}
+
+// cleanURL is like CleanURL, but, when fold is set, checks the shortcode
+// against Pattern in lower case.
+func (s *Shortener) cleanURL(u *url.URL, fold bool) (string, error) {
 	shortcode := cleanURL(u, s.CleanFunc)
-	if shortcode != "" && s.Pattern != nil && !s.Pattern.MatchString(shortcode) {
-		return "", fmt.Errorf("%s: shortcode %q does not match alphabet %s after cleaning: %q", s.Name, shortcode, s.Pattern, u)
+	check := shortcode
+	if fold {
+		check = strings.ToLower(shortcode)
+	}
+	if shortcode != "" && s.Pattern != nil && !s.Pattern.MatchString(check) {
+		return "", &InvalidShortcodeError{s, InvalidShortcode{shortcode, u.String()}}
 	}
 	return shortcode, nil
 }
 
+// InvalidShortcode is a shortcode that does not match the pattern of its
+// shortener after cleaning, with the URL that it was cleaned from.
+// Shortcode is empty when the URL could not be parsed.
+type InvalidShortcode struct {
+	Shortcode string
+	URL       string
+}
+
+// InvalidShortcodeError is returned by CleanURL for a shortcode that
+// does not match the pattern of its shortener.
+type InvalidShortcodeError struct {
+	Shortener *Shortener
+	InvalidShortcode
+}
+
+func (err *InvalidShortcodeError) Error() string {
+	return fmt.Sprintf("%s: shortcode %q does not match alphabet %s after cleaning: %q",
+		err.Shortener.Name, err.Shortcode, err.Shortener.Pattern, err.URL)
+}
+
 func cleanURL(u *url.URL, clean CleanFunc) string {
 	shortcode := strings.TrimLeft(u.Path, "/")
 	// Remove trailing junk (escapes are nbsp and zwsp)
@@ -117,27 +245,135 @@ func isCommonFile(shortcode string) bool {
 // CleanURLs extracts, deduplicates, and sorts the shortcodes in slice
 // of URLs.
 func (s *Shortener) CleanURLs(urls []string) ([]string, error) {
-	shortcodesMap := make(map[string]struct{})
+	set := s.newShortcodeSet(nil)
 	var shortcodes []string
-	var errs []error
 	for _, shortURL := range urls {
-		shortcode, err := s.Clean(shortURL)
-		if err != nil {
-			errs = append(errs, err)
-			continue
-		} else if shortcode == "" {
-			continue
-		}
-		if _, ok := shortcodesMap[shortcode]; !ok {
-			shortcodesMap[shortcode] = struct{}{}
+		if shortcode, ok := set.add(shortURL); ok {
 			shortcodes = append(shortcodes, shortcode)
 		}
 	}
 	s.Sort(shortcodes)
-	if len(errs) != 0 {
-		return shortcodes, &multiError{"CleanURLs", errs}
+	return shortcodes, set.err("CleanURLs")
+}
+
+// ShortcodeSet is a set of shortcodes, which deduplicates the shortcodes
+// streamed by EachIAShortcode. Implementations may be backed by disk or
+// be probabilistic, like a Bloom filter, in which case a shortcode that
+// is falsely reported as present is skipped.
+type ShortcodeSet interface {
+	// Add adds a shortcode and reports whether it was not already in the
+	// set.
+	Add(shortcode string) bool
+}
+
+// MapSet is a ShortcodeSet in memory.
+type MapSet map[string]struct{}
+
+// Add adds a shortcode and reports whether it was not already in the
+// set.
+func (m MapSet) Add(shortcode string) bool {
+	if _, ok := m[shortcode]; ok {
+		return false
+	}
+	m[shortcode] = struct{}{}
+	return true
+}
+
+// shortcodeSet deduplicates the shortcodes cleaned from URLs. When
+// invalid is non-nil, URLs that cannot be parsed or that clean to an
+// invalid shortcode are passed to it instead of reported as errors.
+type shortcodeSet struct {
+	s       *Shortener
+	seen    ShortcodeSet
+	folder  caseFolder
+	invalid func(InvalidShortcode)
+	errs    []error
+}
+
+// newShortcodeSet returns a shortcodeSet that deduplicates with seen or,
+// when nil, with a new MapSet.
+func (s *Shortener) newShortcodeSet(seen ShortcodeSet) *shortcodeSet {
+	if seen == nil {
+		seen = make(MapSet)
+	}
+	return &shortcodeSet{s: s, seen: seen}
+}
+
+// add cleans a URL and returns its shortcode and true, if any and new.
+func (set *shortcodeSet) add(shortURL string) (string, bool) {
+	shortcode, err := set.s.clean(shortURL, set.folder.fold)
+	if err != nil {
+		var invalidErr *InvalidShortcodeError
+		var urlErr *url.Error
+		switch {
+		case set.invalid != nil && errors.As(err, &invalidErr):
+			set.invalid(invalidErr.InvalidShortcode)
+		case set.invalid != nil && errors.As(err, &urlErr):
+			set.invalid(InvalidShortcode{URL: shortURL})
+		default:
+			set.errs = append(set.errs, err)
+		}
+		return "", false
+	} else if shortcode == "" {
+		return "", false
+	}
+	return shortcode, set.seen.Add(set.folder.key(shortcode))
+}
+
+// CaseCollision is a shortcode that differs only in case from a
+// shortcode seen before it, which it was folded together with.
+type CaseCollision struct {
+	First, Other string
+}
+
+// caseFolder folds the case of shortcodes, when fold is set, and reports
+// each form of a shortcode that differs in case from the first form to
+// collision, if non-nil.
+type caseFolder struct {
+	fold      bool
+	collision func(CaseCollision)
+	first     map[string]string   // first form by folded shortcode
+	reported  map[string]struct{} // forms reported to collision
+}
+
+func newCaseFolder(fold bool, collision func(CaseCollision)) caseFolder {
+	f := caseFolder{fold: fold}
+	if fold && collision != nil {
+		f.collision = collision
+		f.first = make(map[string]string)
+		f.reported = make(map[string]struct{})
+	}
+	return f
+}
+
+// key returns the shortcode, in lower case when folding, for
+// deduplication.
+func (f *caseFolder) key(shortcode string) string {
+	if !f.fold {
+		return shortcode
+	}
+	key := strings.ToLower(shortcode)
+	if f.collision == nil {
+		return key
+	}
+	first, ok := f.first[key]
+	if !ok {
+		f.first[key] = shortcode
+	} else if first != shortcode {
+		if _, ok := f.reported[shortcode]; !ok {
+			f.reported[shortcode] = struct{}{}
+			f.collision(CaseCollision{first, shortcode})
+		}
 	}
-	return shortcodes, nil
+	return key
+}
+
+// err returns any errors from cleaning, tagged with tag.
+func (set *shortcodeSet) err(tag string) error {
+	if len(set.errs) != 0 {
+		return &multiError{tag, set.errs}
+	}
+	return nil
 }
 
 // IsVanity returns true when a shortcode is a vanity code. There are
@@ -147,42 +383,83 @@ func (s *Shortener) IsVanity(shortcode string) bool {
 	return s.IsVanityFunc != nil && s.IsVanityFunc(shortcode)
 }
 
-// Sort sorts shorter codes first and generated codes before vanity
-// codes.
+// Sort sorts shortcodes with LessFunc, if set, or otherwise by their
+// numeric value in Alphabet, with AlphabetLess, or by
+// LengthThenLexicalLess, when there is no alphabet, and generated codes
+// before vanity codes.
 func (s *Shortener) Sort(shortcodes []string) {
-	less := func(a, b string) bool {
-		return (len(a) == len(b) && a < b) || len(a) < len(b)
+	less := s.less()
+	sort.Slice(shortcodes, func(i, j int) bool {
+		return less(shortcodes[i], shortcodes[j])
+	})
+}
+
+// less returns the ordering of shortcodes used by Sort.
+func (s *Shortener) less() LessFunc {
+	if s.LessFunc != nil {
+		return s.LessFunc
+	}
+	less := LengthThenLexicalLess
+	if s.Alphabet != "" {
+		less = AlphabetLess(s.Alphabet)
 	}
 	if s.IsVanityFunc != nil {
+		codeLess := less
 		less = func(a, b string) bool {
 			aVanity := s.IsVanityFunc(a)
 			bVanity := s.IsVanityFunc(b)
-			return (aVanity == bVanity && ((len(a) == len(b) && a < b) || len(a) < len(b))) ||
-				(!aVanity && bVanity)
+			return (aVanity == bVanity && codeLess(a, b)) || (!aVanity && bVanity)
 		}
 	}
-	sort.Slice(shortcodes, func(i, j int) bool {
-		return less(shortcodes[i], shortcodes[j])
-	})
+	return less
 }
 
-// GetIAShortcodes queries all the shortcodes that have been archived on
-// the Internet Archive.
-func (s *Shortener) GetIAShortcodes() ([]string, error) {
-	timemap, err := ia.GetTimemap(s.Host, &ia.TimemapOptions{
-		Collapse:    "original",
-		Fields:      []string{"original"},
-		MatchPrefix: true,
-		Limit:       100000,
-	})
-	if err != nil {
-		return nil, err
+// LexicalLess orders shortcodes lexically by bytes.
+func LexicalLess(a, b string) bool {
+	return a < b
+}
+
+// LengthThenLexicalLess orders shorter shortcodes first and shortcodes
+// of the same length lexically by bytes.
+func LengthThenLexicalLess(a, b string) bool {
+	return (len(a) == len(b) && a < b) || len(a) < len(b)
+}
+
+// AlphabetLess returns an ordering of shortcodes by their numeric value
+// as base-N numbers in an alphabet of single-byte digits, shorter codes
+// first, as numbered by Alphabet. Shortcodes with bytes that are not in
+// the alphabet sort last, ordered by LengthThenLexicalLess.
+func AlphabetLess(alphabet string) LessFunc {
+	var index [256]int16
+	for i := range index {
+		index[i] = -1
+	}
+	for i := len(alphabet) - 1; i >= 0; i-- {
+		index[alphabet[i]] = int16(i)
 	}
-	urls := make([]string, len(timemap))
-	for i, link := range timemap {
-		urls[i] = link[0]
+	valid := func(code string) bool {
+		for i := 0; i < len(code); i++ {
+			if index[code[i]] < 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return func(a, b string) bool {
+		aValid, bValid := valid(a), valid(b)
+		if !aValid || !bValid {
+			return aValid || (!bValid && LengthThenLexicalLess(a, b))
+		}
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		for i := 0; i < len(a); i++ {
+			if da, db := index[a[i]], index[b[i]]; da != db {
+				return da < db
+			}
+		}
+		return false
 	}
-	return s.CleanURLs(urls)
 }
 
 // getHostname gets the hostname of the given URL, without www or the
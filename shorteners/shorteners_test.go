@@ -6,11 +6,28 @@
 
 package shorteners
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewarchi/urlhero/ia"
+)
 
 func TestIAGetShortcodes(t *testing.T) {
 	t.Skip()
-	for _, s := range Shorteners {
+	for _, s := range All() {
 		shortcodes, err := s.GetIAShortcodes()
 		if err != nil {
 			t.Errorf("%s: %v", s.Name, err)
@@ -20,6 +37,434 @@ func TestIAGetShortcodes(t *testing.T) {
 	}
 }
 
+func TestGetIAShortcodesPaging(t *testing.T) {
+	pages := map[string][][]string{
+		"bfy.tw":      {{"original"}, {"http://bfy.tw/PanS"}, {"http://bfy.tw/80xn="}, {}, {"key1"}},
+		"bfy.tw key1": {{"original"}, {"http://bfy.tw/favicon.ico"}, {"https://bfy.tw/PanS"}, {}, {"key2"}},
+		"bfy.tw key2": {{"original"}, {"http://bfy.tw/7JAH"}},
+	}
+	defer serveTimemap(t, 2, []string{"original"}, pages)()
+
+	var progress []IAProgress
+	shortcodes, err := Bfytw.GetIAShortcodesContext(context.Background(), &IAOptions{
+		PageSize: 2,
+		Progress: func(p IAProgress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"7JAH", "80xn", "PanS"}; !reflect.DeepEqual(shortcodes, want) {
+		t.Errorf("got shortcodes %q, want %q", shortcodes, want)
+	}
+	wantProgress := []IAProgress{
+		{Pages: 1, Captures: 2, Shortcodes: 2, Host: "bfy.tw", HostCaptures: 2, HostShortcodes: 2},
+		{Pages: 2, Captures: 4, Shortcodes: 2, Host: "bfy.tw", HostCaptures: 4, HostShortcodes: 2},
+		{Pages: 3, Captures: 5, Shortcodes: 3, Host: "bfy.tw", HostCaptures: 5, HostShortcodes: 3},
+	}
+	if !reflect.DeepEqual(progress, wantProgress) {
+		t.Errorf("got progress %v, want %v", progress, wantProgress)
+	}
+
+	// A full page without a resume key is truncated.
+	pages["bfy.tw"] = pages["bfy.tw"][:3]
+	if _, err := Bfytw.GetIAShortcodesContext(context.Background(), &IAOptions{PageSize: 2}); err == nil {
+		t.Error("got no error for truncated timemap")
+	}
+}
+
+func TestGetIAShortcodesCDX(t *testing.T) {
+	// Captures by status, as filtered by the CDX API
+	captures := map[string][]string{
+		"301": {"http://bfy.tw/PanS", "http://bfy.tw/80xn"},
+		"200": {"http://bfy.tw/7JAH"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("url") != "bfy.tw" || q.Get("matchType") != "prefix" || q.Get("showResumeKey") != "true" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		re, err := regexp.Compile("^" + strings.TrimPrefix(q.Get("filter"), "statuscode:") + "$")
+		if err != nil || !strings.HasPrefix(q.Get("filter"), "statuscode:") {
+			t.Errorf("unexpected filter %q", q.Get("filter"))
+			return
+		}
+		page := [][]string{{"original"}}
+		for _, status := range []string{"200", "301"} {
+			if re.MatchString(status) {
+				for _, u := range captures[status] {
+					page = append(page, []string{u})
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+	defer func(cdxURL string) { ia.CDXURL = cdxURL }(ia.CDXURL)
+	ia.CDXURL = srv.URL
+
+	tests := []struct {
+		AcceptOK   bool
+		Shortcodes []string
+	}{
+		{false, []string{"80xn", "PanS"}},
+		{true, []string{"7JAH", "80xn", "PanS"}},
+	}
+	for i, tt := range tests {
+		var progress []IAProgress
+		shortcodes, err := Bfytw.GetIAShortcodesContext(context.Background(), &IAOptions{
+			Backend:  BackendCDX,
+			AcceptOK: tt.AcceptOK,
+			Progress: func(p IAProgress) { progress = append(progress, p) },
+		})
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(shortcodes, tt.Shortcodes) {
+			t.Errorf("#%d: got shortcodes %q, want %q", i, shortcodes, tt.Shortcodes)
+		}
+		if len(progress) != 1 || progress[0].Backend != BackendCDX {
+			t.Errorf("#%d: got progress %v, want CDX backend", i, progress)
+		}
+	}
+}
+
+func TestGetIAShortcodesLenient(t *testing.T) {
+	pages := map[string][][]string{
+		"bfy.tw": {{"original"}, {"http://bfy.tw/PanS"}, {"http://bfy.tw/ab-cd"}, {"http://bfy.tw/%zz"}, {"http://bfy.tw/7JAH"}},
+	}
+	defer serveTimemap(t, 10, []string{"original"}, pages)()
+
+	shortcodes, err := Bfytw.GetIAShortcodesContext(context.Background(), &IAOptions{PageSize: 10})
+	if want := []string{"7JAH", "PanS"}; !reflect.DeepEqual(shortcodes, want) {
+		t.Errorf("got shortcodes %q, want %q", shortcodes, want)
+	}
+	if err == nil {
+		t.Error("got no error for invalid shortcodes")
+	}
+
+	shortcodes, invalid, err := Bfytw.GetIAShortcodesLenient(context.Background(), &IAOptions{PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"7JAH", "PanS"}; !reflect.DeepEqual(shortcodes, want) {
+		t.Errorf("got shortcodes %q, want %q", shortcodes, want)
+	}
+	wantInvalid := []InvalidShortcode{
+		{"ab-cd", "http://bfy.tw/ab-cd"},
+		{"", "http://bfy.tw/%zz"},
+	}
+	if !reflect.DeepEqual(invalid, wantInvalid) {
+		t.Errorf("got invalid %q, want %q", invalid, wantInvalid)
+	}
+}
+
+// serveTimemap serves pages of timemap captures by host, followed by the
+// resume key for later pages, and returns a function to stop serving.
+func serveTimemap(t *testing.T, limit int, fields []string, pages map[string][][]string) func() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("limit") != strconv.Itoa(limit) || q.Get("showResumeKey") != "true" ||
+			q.Get("fl") != strings.Join(fields, ",") {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		page, ok := pages[strings.TrimSpace(q.Get("url")+" "+q.Get("resumeKey"))]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	timemapURL := ia.TimemapURL
+	ia.TimemapURL = srv.URL + "/"
+	return func() {
+		ia.TimemapURL = timemapURL
+		srv.Close()
+	}
+}
+
+func TestGetIAShortcodesAliases(t *testing.T) {
+	s := &Shortener{
+		Name:    "example",
+		Host:    "ex.test",
+		Aliases: []string{"www.ex.test", "example.test"},
+		Pattern: regexp.MustCompile(`^[0-9a-z]+$`),
+		CleanFunc: func(shortcode string, u *url.URL) string {
+			// The legacy host links to previews.
+			if getHostname(u) == "example.test" {
+				shortcode = strings.TrimPrefix(shortcode, "p/")
+			}
+			return shortcode
+		},
+	}
+	pages := map[string][][]string{
+		"ex.test":      {{"original"}, {"http://ex.test/abc"}, {"http://ex.test/def"}},
+		"www.ex.test":  {{"original"}, {"http://www.ex.test/abc"}},
+		"example.test": {{"original"}, {"http://example.test/p/def"}, {"http://example.test/p/ghi"}},
+	}
+	defer serveTimemap(t, 10, []string{"original"}, pages)()
+
+	var progress []IAProgress
+	shortcodes, err := s.GetIAShortcodesContext(context.Background(), &IAOptions{
+		PageSize: 10,
+		Progress: func(p IAProgress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"abc", "def", "ghi"}; !reflect.DeepEqual(shortcodes, want) {
+		t.Errorf("got shortcodes %q, want %q", shortcodes, want)
+	}
+	wantProgress := []IAProgress{
+		{Pages: 1, Captures: 2, Shortcodes: 2, Host: "ex.test", HostCaptures: 2, HostShortcodes: 2},
+		{Pages: 2, Captures: 3, Shortcodes: 2, Host: "www.ex.test", HostCaptures: 1, HostShortcodes: 0},
+		{Pages: 3, Captures: 5, Shortcodes: 3, Host: "example.test", HostCaptures: 2, HostShortcodes: 1},
+	}
+	if !reflect.DeepEqual(progress, wantProgress) {
+		t.Errorf("got progress %v, want %v", progress, wantProgress)
+	}
+}
+
+// countingSet is a ShortcodeSet that counts its additions.
+type countingSet struct {
+	MapSet
+	adds int
+}
+
+func (set *countingSet) Add(shortcode string) bool {
+	set.adds++
+	return set.MapSet.Add(shortcode)
+}
+
+func TestEachIAShortcode(t *testing.T) {
+	pages := map[string][][]string{
+		"bfy.tw": {
+			{"original"},
+			{"http://bfy.tw/PanS"},
+			{"http://bfy.tw/80xn"},
+			{"http://bfy.tw/PanS?utm_source=x"},
+			{"http://bfy.tw/Zd0"},
+		},
+	}
+	defer serveTimemap(t, 10, []string{"original"}, pages)()
+
+	// Shortcodes already in the set are skipped.
+	seen := &countingSet{MapSet: MapSet{"80xn": {}}}
+	var shortcodes []string
+	err := Bfytw.EachIAShortcode(context.Background(), &IAOptions{PageSize: 10, Seen: seen}, func(shortcode string) error {
+		shortcodes = append(shortcodes, shortcode)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"PanS", "Zd0"}; !reflect.DeepEqual(shortcodes, want) {
+		t.Errorf("got shortcodes %q, want %q", shortcodes, want)
+	}
+	if seen.adds != 4 {
+		t.Errorf("got %d additions to set, want 4", seen.adds)
+	}
+
+	errStop := errors.New("stop")
+	shortcodes = nil
+	err = Bfytw.EachIAShortcode(context.Background(), &IAOptions{PageSize: 10}, func(shortcode string) error {
+		shortcodes = append(shortcodes, shortcode)
+		return errStop
+	})
+	if err != errStop {
+		t.Errorf("got error %v, want %v", err, errStop)
+	}
+	if want := []string{"PanS"}; !reflect.DeepEqual(shortcodes, want) {
+		t.Errorf("got shortcodes %q after stopping, want %q", shortcodes, want)
+	}
+}
+
+func TestGetIAShortcodesFoldCase(t *testing.T) {
+	s := &Shortener{
+		Name:    "example",
+		Host:    "ex.test",
+		Pattern: regexp.MustCompile(`^[0-9a-z]+$`),
+	}
+	pages := map[string][][]string{
+		"ex.test": {
+			{"original"},
+			{"http://ex.test/AbC"},
+			{"http://ex.test/abc"},
+			{"http://ex.test/ABC"},
+			{"http://ex.test/ABC?ref=x"},
+			{"http://ex.test/def"},
+		},
+	}
+	defer serveTimemap(t, 10, []string{"original"}, pages)()
+
+	var collisions []CaseCollision
+	shortcodes, err := s.GetIAShortcodesContext(context.Background(), &IAOptions{
+		PageSize:      10,
+		FoldCase:      true,
+		CaseCollision: func(c CaseCollision) { collisions = append(collisions, c) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"AbC", "def"}; !reflect.DeepEqual(shortcodes, want) {
+		t.Errorf("got shortcodes %q, want %q", shortcodes, want)
+	}
+	if want := []CaseCollision{{"AbC", "abc"}, {"AbC", "ABC"}}; !reflect.DeepEqual(collisions, want) {
+		t.Errorf("got collisions %v, want %v", collisions, want)
+	}
+
+	// Without folding, upper case does not match the pattern.
+	if _, err := s.GetIAShortcodesContext(context.Background(), &IAOptions{PageSize: 10}); err == nil {
+		t.Error("got no error for upper case shortcodes without folding")
+	}
+}
+
+func TestGetIAShortcodeCaptures(t *testing.T) {
+	pages := map[string][][]string{
+		"bfy.tw": {
+			{"original", "timestamp"},
+			{"http://bfy.tw/PanS", "20200102030405"},
+			{"https://bfy.tw/PanS", "20190102030405"},
+			{"http://bfy.tw/80xn=", "20210102030405"},
+			{}, {"key1"},
+		},
+		"bfy.tw key1": {
+			{"original", "timestamp"},
+			{"http://bfy.tw/PanS", "20210102030405"},
+			{"http://bfy.tw/robots.txt", "20210102030405"},
+		},
+	}
+	defer serveTimemap(t, 3, []string{"original", "timestamp"}, pages)()
+
+	captures, err := Bfytw.GetIAShortcodeCaptures(context.Background(), &IAOptions{PageSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := func(year int) time.Time { return time.Date(year, 1, 2, 3, 4, 5, 0, time.UTC) }
+	want := []ShortcodeCapture{
+		{"80xn", date(2021), date(2021), 1},
+		{"PanS", date(2019), date(2021), 3},
+	}
+	if !reflect.DeepEqual(captures, want) {
+		t.Errorf("got captures %v, want %v", captures, want)
+	}
+}
+
+func TestLess(t *testing.T) {
+	tests := []struct {
+		Less LessFunc
+		Want []string
+	}{
+		{LexicalLess, []string{"10", "2", "B", "a", "ab", "b"}},
+		{LengthThenLexicalLess, []string{"2", "B", "a", "b", "10", "ab"}},
+		// Digits and letters interleaved, with upper case last
+		{AlphabetLess("0a1b2B"), []string{"a", "b", "2", "B", "ab", "10"}},
+	}
+	for i, tt := range tests {
+		codes := []string{"b", "10", "a", "B", "ab", "2"}
+		sort.Slice(codes, func(i, j int) bool { return tt.Less(codes[i], codes[j]) })
+		if !reflect.DeepEqual(codes, tt.Want) {
+			t.Errorf("#%d: got order %q, want %q", i, codes, tt.Want)
+		}
+	}
+
+	// Codes with characters outside of the alphabet sort last.
+	codes := []string{"b-1", "ba", "a", "_"}
+	sort.Slice(codes, func(i, j int) bool { return AlphabetLess("ba")(codes[i], codes[j]) })
+	if want := []string{"a", "ba", "_", "b-1"}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("got order %q, want %q", codes, want)
+	}
+
+	s := &Shortener{Alphabet: "9876543210", IsVanityFunc: func(code string) bool { return len(code) > 2 }}
+	codes = []string{"123", "09", "90", "1", "9"}
+	s.Sort(codes)
+	if want := []string{"9", "1", "90", "09", "123"}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("got order %q, want %q", codes, want)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	tests := []struct {
+		key string
+		s   *Shortener
+	}{
+		{"bfy-tw", Bfytw},
+		{"bfy.tw", Bfytw},
+		{"www.bfy.tw", Bfytw},
+		{"s.uconn.edu", SUconnEdu},
+		{"bfy.tw.example", nil},
+		{"example.com", nil},
+	}
+	for i, tt := range tests {
+		if s := Lookup(tt.key); s != tt.s {
+			t.Errorf("#%d: Lookup(%q) = %v, want %v", i, tt.key, s, tt.s)
+		}
+	}
+
+	defer func(shorteners []*Shortener, lookup, hosts map[string]*Shortener) {
+		registry.shorteners, registry.lookup, registry.hosts = shorteners, lookup, hosts
+	}(registry.shorteners, maps.Clone(registry.lookup), maps.Clone(registry.hosts))
+	s := &Shortener{Name: "example-test", Host: "example.test", Aliases: []string{"ex.test"}, Alphabet: "zyx"}
+	Register(s)
+	if got := Lookup("ex.test"); got != s {
+		t.Errorf("Lookup alias = %v, want %v", got, s)
+	}
+	if s.LessFunc == nil || !s.LessFunc("y", "x") {
+		t.Error("registered shortener not ordered by alphabet")
+	}
+	all := All()
+	if len(all) != 11 || !sort.SliceIsSorted(all, func(i, j int) bool { return all[i].Name < all[j].Name }) {
+		t.Errorf("All() returned %d shorteners, want 11 sorted by name", len(all))
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate host did not panic")
+		}
+	}()
+	Register(&Shortener{Name: "bfy-tw-2", Host: "bfy.tw"})
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		URL       string
+		S         *Shortener
+		Shortcode string
+	}{
+		{"https://bfy.tw/PanS", Bfytw, "PanS"},
+		{"http://www.bfy.tw:80/80xn=", Bfytw, "80xn"},
+		{"HTTPS://BFY.TW/PanS", Bfytw, "PanS"},
+		{"https://s.uconn.edu/ABC", SUconnEdu, "abc"},
+		{"http://go.hawaii.edu/Vf+", GoHawaiiEdu, "Vf"},
+		{"https://bfy.tw/", nil, ""},
+		{"https://bfy.tw/robots.txt", nil, ""},
+		{"https://bfy-tw/PanS", nil, ""}, // name, not host
+		{"https://example.com/PanS", nil, ""},
+		{"https://bfy.tw.example.com/PanS", nil, ""},
+	}
+	for i, tt := range tests {
+		u, err := url.Parse(tt.URL)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		s, shortcode := Match(u)
+		if s != tt.S || shortcode != tt.Shortcode {
+			t.Errorf("#%d: Match(%q) = %v, %q, want %v, %q", i, tt.URL, s, shortcode, tt.S, tt.Shortcode)
+		}
+	}
+
+	for _, raw := range []string{"https://bfy.tw/PanS", "bfy.tw/PanS", "www.red.ht/abc"} {
+		if !IsShortURL(raw) {
+			t.Errorf("IsShortURL(%q) = false, want true", raw)
+		}
+	}
+	for _, raw := range []string{"https://example.com/PanS", "bfy.tw", "%zz", ""} {
+		if IsShortURL(raw) {
+			t.Errorf("IsShortURL(%q) = true, want false", raw)
+		}
+	}
+}
+
 func TestClean(t *testing.T) {
 	tests := []struct {
 		s              *Shortener
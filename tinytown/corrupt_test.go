@@ -0,0 +1,140 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+func TestProcessReleasesCorrupt(t *testing.T) {
+	root := t.TempDir()
+	release := filepath.Join(root, "urlteam_2021-01-01")
+	good := filepath.Join(release, "good.2021-01-01.zip")
+	bad := filepath.Join(release, "bad.2021-01-01.zip")
+	writeZip(t, good, []zipEntry{
+		{"good.meta.json.xz", `{"name":"good"}`},
+		{"1.txt.xz", "a|http://example.com/a\n"},
+	})
+	writeZip(t, bad, []zipEntry{
+		{"bad.meta.json.xz", `{"name":"bad"}`},
+		{"1.txt.xz", "b|http://example.com/b\n"},
+	})
+	badContent, err := os.ReadFile(bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncate := func() {
+		if err := os.WriteFile(bad, badContent[:len(badContent)/2], 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	process := func(opts *ProcessOptions) ([]string, error) {
+		var got []string
+		err := ProcessReleasesOptions(context.Background(), root, opts, func(m *ProjectMeta, release string, l *beacon.Link) error {
+			got = append(got, l.Source)
+			return nil
+		})
+		sort.Strings(got)
+		return got, err
+	}
+
+	truncate()
+	got, err := process(nil)
+	var corruptErr *CorruptFilesError
+	if !errors.As(err, &corruptErr) {
+		t.Fatalf("got error %v, want CorruptFilesError", err)
+	}
+	if len(corruptErr.Files) != 1 || corruptErr.Files[0].ID != "urlteam_2021-01-01" ||
+		corruptErr.Files[0].Name != "bad.2021-01-01.zip" || !errors.Is(err, corruptErr.Files[0].Err) {
+		t.Errorf("got corrupt files %+v", corruptErr.Files)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Redownloading the file recovers it.
+	var redownloaded []string
+	got, err = process(&ProcessOptions{Redownload: func(ctx context.Context, id, name, filename string) error {
+		redownloaded = append(redownloaded, id+"/"+name)
+		return os.WriteFile(filename, badContent, 0o666)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"urlteam_2021-01-01/bad.2021-01-01.zip"}; !reflect.DeepEqual(redownloaded, want) {
+		t.Errorf("redownloaded %q, want %q", redownloaded, want)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Errors from fn are not treated as corruption.
+	errStop := errors.New("stop")
+	err = ProcessReleasesOptions(context.Background(), root, &ProcessOptions{
+		Redownload: func(ctx context.Context, id, name, filename string) error {
+			t.Errorf("redownloaded %s/%s after error from fn", id, name)
+			return nil
+		},
+	}, func(m *ProjectMeta, release string, l *beacon.Link) error {
+		return errStop
+	})
+	if err != errStop {
+		t.Errorf("got error %v, want %v", err, errStop)
+	}
+}
+
+func TestRedownloadFile(t *testing.T) {
+	content := "complete"
+	served := "complete"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata/item":
+			fmt.Fprintf(w, `{"files":[{"name":"sub/a.zip","size":"%d","md5":"%x"}]}`, len(content), md5.Sum([]byte(content)))
+		case "/download/item/sub/a.zip":
+			w.Write([]byte(served))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	filename := filepath.Join(t.TempDir(), "a.zip")
+	if err := os.WriteFile(filename, []byte("corrupt"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := redownloadFile(context.Background(), srv.URL, "item", "sub/a.zip", filename); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	} else if string(got) != content {
+		t.Errorf("got %q, want %q", got, content)
+	}
+
+	served = "mismatch"
+	if err := redownloadFile(context.Background(), srv.URL, "item", "sub/a.zip", filename); err == nil {
+		t.Error("got nil error for checksum mismatch")
+	}
+	if _, err := os.Stat(filename); err == nil {
+		t.Error("kept file with checksum mismatch")
+	}
+	if err := redownloadFile(context.Background(), srv.URL, "item", "missing.zip", filename); err == nil {
+		t.Error("got nil error for missing file")
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrInsufficientSpace is matched by an *InsufficientSpaceError with
+// errors.Is.
+var ErrInsufficientSpace = errors.New("tinytown: insufficient disk space")
+
+// InsufficientSpaceError is returned when the data directory does not
+// have enough space available for the releases to be downloaded.
+type InsufficientSpaceError struct {
+	Dir       string
+	Required  int64 // bytes
+	Available int64 // bytes
+}
+
+func (err *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("tinytown: insufficient disk space in %s: %s required, %s available",
+		err.Dir, formatBytes(err.Required), formatBytes(err.Available))
+}
+
+// Is reports whether target is ErrInsufficientSpace.
+func (err *InsufficientSpaceError) Is(target error) bool {
+	return target == ErrInsufficientSpace
+}
+
+// DiskSpaceMargin is the space that must remain available in the data
+// directory for a Downloader to start another release. When less is
+// available, new releases wait until space is freed.
+var DiskSpaceMargin int64 = 1 << 30
+
+const diskCheckInterval = time.Minute
+
+var errDiskSpaceUnsupported = errors.New("tinytown: disk space unsupported on this platform")
+
+// availableSpace returns the bytes available to the user on the file
+// system containing dir. Tests replace it.
+var availableSpace = diskAvailable
+
+// checkDiskSpace returns an *InsufficientSpaceError, when fewer than
+// required bytes are available in dir. It does not fail on platforms
+// where available space cannot be queried.
+func checkDiskSpace(dir string, required int64) error {
+	dir = existingDir(dir)
+	available, err := availableSpace(dir)
+	if err == errDiskSpaceUnsupported {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if required > available {
+		return &InsufficientSpaceError{Dir: dir, Required: required, Available: available}
+	}
+	return nil
+}
+
+// existingDir returns dir or its nearest existing ancestor, since the
+// data directory may not have been created yet.
+func existingDir(dir string) string {
+	if dir == "" {
+		dir = "."
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// requiredSpace estimates the bytes needed to finish downloading
+// releases into dir. The files matched by filter are used for releases
+// with files listed and the item size otherwise, less the sizes of
+// files already present.
+func requiredSpace(dir string, releases []Release, filter fileFilter) int64 {
+	var required int64
+	for _, r := range releases {
+		itemDir := filepath.Join(dir, r.Identifier)
+		if r.Files == nil {
+			if n := r.ItemSize - dirSize(itemDir); n > 0 {
+				required += n
+			}
+			continue
+		}
+		for _, f := range r.Files {
+			if f.Name == r.Identifier+"_archive.torrent" || !filter.match(f.Name) {
+				continue
+			}
+			n := f.Size
+			if fi, err := os.Stat(filepath.Join(itemDir, filepath.FromSlash(f.Name))); err == nil {
+				n -= fi.Size()
+			}
+			if n > 0 {
+				required += n
+			}
+		}
+	}
+	return required
+}
+
+// dirSize returns the total size of the regular files in dir.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if fi, err := d.Info(); err == nil {
+				size += fi.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
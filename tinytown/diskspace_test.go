@@ -0,0 +1,86 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+func TestCheckDiskSpace(t *testing.T) {
+	defer func(f func(string) (int64, error)) { availableSpace = f }(availableSpace)
+	availableSpace = func(dir string) (int64, error) { return 100, nil }
+
+	dir := t.TempDir()
+	writeFiles(t, filepath.Join(dir, "a"), map[string]string{"a.zip": "aaaa", "b.zip": "bb"})
+	releases := []Release{
+		{Identifier: "a", Files: []ReleaseFile{
+			{Name: "a.zip", Size: 4},
+			{Name: "b.zip", Size: 8},
+			{Name: "c.zip", Size: 16},
+			{Name: "a_archive.torrent", Size: 32},
+		}},
+		{Identifier: "b", ItemSize: 64},
+	}
+	if n := requiredSpace(dir, releases, fileFilter{}); n != 6+16+64 {
+		t.Errorf("got %d bytes required, want %d", n, 6+16+64)
+	}
+	if n := requiredSpace(dir, releases[:1], newFileFilter([]string{"c"}, nil)); n != 16 {
+		t.Errorf("got %d bytes required with filter, want %d", n, 16)
+	}
+
+	if err := checkDiskSpace(filepath.Join(dir, "missing"), 100); err != nil {
+		t.Errorf("got error %v, want nil", err)
+	}
+	err := checkDiskSpace(dir, 101)
+	var spaceErr *InsufficientSpaceError
+	if !errors.Is(err, ErrInsufficientSpace) || !errors.As(err, &spaceErr) {
+		t.Fatalf("got error %v, want %v", err, ErrInsufficientSpace)
+	}
+	if spaceErr.Required != 101 || spaceErr.Available != 100 {
+		t.Errorf("got %d required and %d available, want 101 and 100", spaceErr.Required, spaceErr.Available)
+	}
+}
+
+func TestDownloaderWaitSpace(t *testing.T) {
+	defer func(f func(string) (int64, error)) { availableSpace = f }(availableSpace)
+	var available atomic.Int64
+	availableSpace = func(dir string) (int64, error) { return available.Load(), nil }
+
+	defer func(newConf func() *torrent.ClientConfig) { newClientConfig = newConf }(newClientConfig)
+	newClientConfig = func() *torrent.ClientConfig { return torrent.TestingConfig(t) }
+	d, err := NewDownloader(DownloadOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- d.waitSpace() }()
+	select {
+	case err := <-errc:
+		t.Fatalf("admitted with no space: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	d.Close()
+	if err := <-errc; err != ErrDownloaderClosed {
+		t.Errorf("got error %v, want %v", err, ErrDownloaderClosed)
+	}
+
+	available.Store(DiskSpaceMargin)
+	d, err = NewDownloader(DownloadOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.waitSpace(); err != nil {
+		t.Errorf("got error %v with space", err)
+	}
+}
@@ -9,115 +9,373 @@
 package tinytown
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 
-	"github.com/anacrolix/torrent"
-	"github.com/anacrolix/torrent/storage"
-	"github.com/andrewarchi/browser/jsonutil"
+	"github.com/andrewarchi/urlhero/ia"
 )
 
+// BaseURL is the base URL of the Internet Archive, against which all
+// release, metadata, and download requests are made. This can be
+// changed to use a mirror or a local test server.
+var BaseURL = "https://archive.org"
+
+// HTTPClient is the client for all HTTP requests made by this package,
+// except those of the torrent client and those with a Transport or
+// ProxyURL in DownloadOptions.
+var HTTPClient = http.DefaultClient
+
 // DownloadTorrents downloads all terroroftinytown releases via torrent.
 func DownloadTorrents(dir string) error {
-	ids, err := GetReleaseIDs()
+	return DownloadTorrentsContext(context.Background(), dir)
+}
+
+// DownloadTorrentsContext downloads all terroroftinytown releases via
+// torrent into dir, as described by DownloadReleases, with default
+// options. When ctx is done, the torrent client is closed and ctx.Err()
+// is returned. Downloaded pieces are kept, so a later call resumes.
+func DownloadTorrentsContext(ctx context.Context, dir string) error {
+	d, err := DownloadReleases(ctx, DownloadOptions{DataDir: dir})
+	if d != nil {
+		d.Close()
+	}
+	return err
+}
+
+// DownloadReleases downloads all terroroftinytown releases with a new
+// Downloader. Items that fail both via torrent and HTTP are skipped and
+// their errors are joined in the returned error. The returned Downloader
+// is non-nil whenever it was started, even with an error, and must be
+// closed by the caller. When ctx is done, the Downloader is closed.
+// Unless IgnoreDiskSpace is set, an *InsufficientSpaceError is returned
+// before starting, when the data directory cannot fit the releases.
+func DownloadReleases(ctx context.Context, opts DownloadOptions) (*Downloader, error) {
+	ctx = opts.context(ctx)
+	releases, err := scrapeReleases(ctx, BaseURL)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	releases = dateRange{opts.From, opts.To}.filterReleases(ctx, releases)
+	if !opts.IgnoreDiskSpace {
+		filter := newFileFilter(opts.Projects, opts.FileFilter)
+		if !filter.all() {
+			if err := getReleaseFiles(ctx, BaseURL, releases); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkDiskSpace(opts.DataDir, requiredSpace(opts.DataDir, releases, filter)); err != nil {
+			return nil, err
+		}
 	}
+	ids := releaseIDs(releases)
+	d, err := NewDownloader(opts)
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { d.Close() })
+	defer stop()
 
-	conf := torrent.NewDefaultClientConfig()
-	conf.DataDir = dir
-	conf.DefaultStorage = storage.NewMMap(dir)
-	c, err := torrent.NewClient(conf)
+	d.addAll(ids)
+	err = d.Wait(ctx)
+	if ctx.Err() != nil {
+		return d, ctx.Err()
+	}
+	return d, err
+}
+
+// downloadItem downloads the files of an item over HTTP into dir/<id>,
+// which is where the torrent client stores them. Existing files are
+// kept when they match their listed checksum.
+func downloadItem(ctx context.Context, baseURL, id, dir string, filter fileFilter) error {
+	files, err := getItemFiles(ctx, baseURL, id)
 	if err != nil {
 		return err
 	}
-
-	for i, id := range ids {
-		fmt.Printf("(%d/%d) Adding %s\n", i+1, len(ids), id)
-		filename, err := saveTorrentFile(id, dir)
-		if err != nil {
+	itemDir := filepath.Join(dir, id)
+	for _, f := range files {
+		if f.Name == id+"_archive.torrent" {
+			continue // not included in the torrent
+		}
+		if !filter.match(f.Name) {
+			continue
+		}
+		filename := filepath.Join(itemDir, filepath.FromSlash(f.Name))
+		if _, err := os.Stat(filename); err == nil {
+			// Torrent storage preallocates files, so they may be
+			// incomplete.
+			if len(f.MD5) != 0 && ia.ValidateFile(filename, f.MD5, nil, nil) == nil {
+				continue
+			}
+			if err := os.Remove(filename); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(filename), 0o777); err != nil {
 			return err
 		}
-		t, err := c.AddTorrentFromFile(filename)
-		if err != nil {
+		u := baseURL + "/download/" + id + "/" + (&url.URL{Path: f.Name}).EscapedPath()
+		if err := saveFile(ctx, u, filename); err != nil {
 			return err
 		}
-		t.DownloadAll()
-		if i%15 == 14 {
-			c.WaitAll()
+	}
+	return nil
+}
+
+// RedownloadFile downloads a file of a release from archive.org to
+// filename over HTTP, replacing any existing file, and checks it against
+// its listed checksum. It can be used as ProcessOptions.Redownload.
+func RedownloadFile(ctx context.Context, id, name, filename string) error {
+	return redownloadFile(ctx, BaseURL, id, name, filename)
+}
+
+func redownloadFile(ctx context.Context, baseURL, id, name, filename string) error {
+	files, err := getItemFiles(ctx, baseURL, id)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.Name == name {
+			return fetchFile(ctx, baseURL, id, f, filename)
+		}
+	}
+	return fmt.Errorf("tinytown: %s: no file %s", id, name)
+}
+
+// fetchFile downloads a file of an item to filename over HTTP, replacing
+// any existing file, and checks it against its listed checksum.
+func fetchFile(ctx context.Context, baseURL, id string, f ReleaseFile, filename string) error {
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o777); err != nil {
+		return err
+	}
+	u := baseURL + "/download/" + id + "/" + (&url.URL{Path: f.Name}).EscapedPath()
+	if err := saveFile(ctx, u, filename); err != nil {
+		return err
+	}
+	if len(f.MD5) != 0 {
+		if err := ia.ValidateFile(filename, f.MD5, nil, nil); err != nil {
+			os.Remove(filename)
+			return err
 		}
 	}
-	c.WaitAll()
 	return nil
 }
 
 // GetReleaseIDs queries the Internet Archive for the identifiers of all
 // incremental terroroftinytown releases.
 func GetReleaseIDs() ([]string, error) {
-	url := "https://archive.org/services/search/v1/scrape?q=subject:terroroftinytown&count=10000"
-	resp, err := httpGet(url)
+	return GetReleaseIDsContext(context.Background())
+}
+
+// GetReleaseIDsContext queries the Internet Archive for the identifiers
+// of all incremental terroroftinytown releases, sorted by publication
+// date ascending.
+func GetReleaseIDsContext(ctx context.Context) ([]string, error) {
+	releases, err := scrapeReleases(ctx, BaseURL)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return releaseIDs(releases), nil
+}
 
-	type Scrape struct {
-		Items []struct {
-			Identifier string `json:"identifier"`
-		} `json:"items"`
-		Count int `json:"count"`
-		Total int `json:"total"`
-		// TODO fields for error response
-	}
-	var items Scrape
-	if err := jsonutil.Decode(resp.Body, &items); err != nil {
-		return nil, err
-	}
+// GetTinybackReleaseIDs queries the Internet Archive for the identifiers
+// of all first-generation TinyBack releases.
+func GetTinybackReleaseIDs() ([]string, error) {
+	return GetTinybackReleaseIDsContext(context.Background())
+}
 
-	// TODO handle paging
-	if items.Count != items.Total {
-		return nil, fmt.Errorf("tinytown: queried %d of %d releases", items.Count, items.Total)
+// GetTinybackReleaseIDsContext queries the Internet Archive for the
+// identifiers of all first-generation TinyBack releases, sorted by
+// publication date ascending. Their dumps are processed by
+// ProcessReleases alongside terroroftinytown releases.
+func GetTinybackReleaseIDsContext(ctx context.Context) ([]string, error) {
+	releases, err := scrapeQuery(ctx, BaseURL, tinybackReleaseQuery)
+	if err != nil {
+		return nil, err
 	}
+	return releaseIDs(releases), nil
+}
 
-	ids := make([]string, len(items.Items))
-	for i, item := range items.Items {
-		ids[i] = item.Identifier
+func releaseIDs(releases []Release) []string {
+	ids := make([]string, len(releases))
+	for i, r := range releases {
+		ids[i] = r.Identifier
 	}
-	return ids, nil
+	return ids
 }
 
-func saveTorrentFile(id, dir string) (string, error) {
-	url := "https://archive.org/download/" + id + "/" + id + "_archive.torrent"
+func saveTorrentFile(ctx context.Context, baseURL, id, dir string) (string, error) {
+	url := baseURL + "/download/" + id + "/" + id + "_archive.torrent"
 	filename := filepath.Join(dir, path.Base(url))
-	return filename, saveFile(url, filename)
+	return filename, saveFile(ctx, url, filename)
 }
 
-func saveFile(url, filename string) error {
+// saveFile downloads url to filename, unless it already exists. Data is
+// written to filename.part and renamed when complete, so a truncated
+// file is never left at filename. An interrupted download is resumed
+// with a range request, which is conditional on the ETag of the
+// original response, if any, as saved in filename.part.etag.
+func saveFile(ctx context.Context, url, filename string) error {
 	if _, err := os.Stat(filename); err == nil {
 		return nil
 	}
 
-	resp, err := httpGet(url)
+	part := filename + ".part"
+	etagFile := part + ".etag"
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0o666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	var header http.Header
+	if offset != 0 {
+		header = http.Header{"Range": {"bytes=" + strconv.FormatInt(offset, 10) + "-"}}
+		if etag, err := os.ReadFile(etagFile); err == nil && len(etag) != 0 {
+			header.Set("If-Range", string(etag))
+		}
+	}
+	resp, err := getRetry(ctx, url, header)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset != 0:
+		if contentRangeStart(resp.Header.Get("Content-Range")) != offset {
+			// The range does not continue the part file, so start over.
+			resp.Body.Close()
+			if err := f.Truncate(0); err != nil {
+				return err
+			}
+			f.Close()
+			os.Remove(etagFile)
+			return saveFile(ctx, url, filename)
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset != 0:
+		if contentRangeSize(resp.Header.Get("Content-Range")) == offset {
+			// The part file is already complete.
+			return finishPart(f, part, filename)
+		}
+		// The part file is longer than the resource, so start over.
+		f.Close()
+		os.Remove(part)
+		os.Remove(etagFile)
+		return saveFile(ctx, url, filename)
+	case resp.StatusCode == http.StatusOK:
+		// The server ignored the range or the resource changed, so start
+		// over.
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		offset = 0
+		if err := saveETag(etagFile, resp.Header.Get("ETag")); err != nil {
+			return err
+		}
+	default:
+		if offset == 0 {
+			f.Close()
+			os.Remove(part)
+		}
+		return fmt.Errorf("tinytown: %w", &statusError{resp.Status, resp.StatusCode, nil})
+	}
 
-	f, err := os.Create(filename)
+	n, err := io.Copy(f, resp.Body)
 	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return err
 	}
-	defer f.Close()
-	_, err = io.Copy(f, resp.Body)
-	return err
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		if n > resp.ContentLength {
+			f.Close()
+			os.Remove(part)
+			os.Remove(etagFile)
+		}
+		return fmt.Errorf("tinytown: %s: got %d bytes, want %d", url, offset+n, offset+resp.ContentLength)
+	}
+	if err := finishPart(f, part, filename); err != nil {
+		return err
+	}
+	os.Remove(etagFile)
+	return nil
+}
+
+// saveETag saves a strong ETag for validating a later range request or
+// removes the saved ETag when there is none. Weak ETags cannot be used
+// with If-Range.
+func saveETag(etagFile, etag string) error {
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		err := os.Remove(etagFile)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return err
+	}
+	return os.WriteFile(etagFile, []byte(etag), 0o666)
+}
+
+// contentRangeStart returns the first byte position from a satisfied
+// Content-Range header, like "bytes 100-1233/1234", or -1.
+func contentRangeStart(header string) int64 {
+	r, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return -1
+	}
+	start, _, ok := strings.Cut(r, "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// contentRangeSize returns the complete length from an unsatisfied
+// Content-Range header, like "bytes */1234", or -1.
+func contentRangeSize(header string) int64 {
+	size, ok := strings.CutPrefix(header, "bytes */")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func finishPart(f *os.File, part, filename string) error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(part, filename)
 }
 
-func httpGet(url string) (*http.Response, error) {
-	resp, err := http.Get(url)
+// httpGet sends a GET request, with retries, and checks that the status
+// is 200.
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	resp, err := getRetry(ctx, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,277 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSaveFileCancel(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	half := len(content) / 2
+	var resume atomic.Bool
+	sent := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if resume.Load() {
+			http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+			return
+		}
+		w.Header().Set("Content-Length", "10000")
+		w.Write(content[:half])
+		w.(http.Flusher).Flush()
+		close(sent)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	filename := filepath.Join(t.TempDir(), "file")
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- saveFile(ctx, srv.URL, filename) }()
+	<-sent
+	// Wait for the written data to reach the part file.
+	for i := 0; i < 100; i++ {
+		if fi, err := os.Stat(filename + ".part"); err == nil && fi.Size() == int64(half) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got error %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("saveFile did not return after cancel")
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("incomplete file was renamed: %v", err)
+	}
+	part, err := os.ReadFile(filename + ".part")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(part, content[:half]) {
+		t.Fatalf("got %d bytes in part file, want %d", len(part), half)
+	}
+
+	// Resume with a range request.
+	resume.Store(true)
+	if err := saveFile(context.Background(), srv.URL, filename); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("got %d bytes, want %d", len(got), len(content))
+	}
+	if _, err := os.Stat(filename + ".part"); !os.IsNotExist(err) {
+		t.Errorf("part file remains: %v", err)
+	}
+}
+
+func TestSaveFileResume(t *testing.T) {
+	content := []byte("0123456789")
+	etag := `"v2"`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		Part, ETag string
+	}{
+		{"01234", `"v2"`},        // resumed
+		{"abcde", `"v1"`},        // changed, so restarted
+		{"0123456789", ""},       // already complete
+		{"0123456789ab", `"v2"`}, // longer than the resource
+	}
+	for i, tt := range tests {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "file")
+		if err := os.WriteFile(filename+".part", []byte(tt.Part), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		if tt.ETag != "" {
+			if err := os.WriteFile(filename+".part.etag", []byte(tt.ETag), 0o666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := saveFile(context.Background(), srv.URL, filename); err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		got, err := os.ReadFile(filename)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+		} else if !bytes.Equal(got, content) {
+			t.Errorf("#%d: got %q, want %q", i, got, content)
+		}
+		for _, name := range []string{filename + ".part", filename + ".part.etag"} {
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Errorf("#%d: %s remains: %v", i, filepath.Base(name), err)
+			}
+		}
+	}
+}
+
+func TestSaveFileResumeWrongRange(t *testing.T) {
+	content := []byte("0123456789")
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if r.Header.Get("Range") != "" {
+			// Respond with a range other than the one requested.
+			r.Header.Set("Range", "bytes=2-")
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	filename := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(filename+".part", []byte("01234"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveFile(context.Background(), srv.URL, filename); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("got %q, want %q", got, content)
+	}
+	if want := []string{"bytes=5-", ""}; !reflect.DeepEqual(ranges, want) {
+		t.Errorf("got ranges %q, want %q", ranges, want)
+	}
+}
+
+func TestDownloadItem(t *testing.T) {
+	files := map[string]string{
+		"item_archive.torrent": "torrent",
+		"a.zip":                "complete",
+		"sub/b.zip":            "preallocated",
+		"c.txt":                "missing",
+	}
+	type file struct {
+		Name string `json:"name"`
+		MD5  string `json:"md5,omitempty"`
+	}
+	var listing struct {
+		Files []file `json:"files"`
+	}
+	for name, content := range files {
+		listing.Files = append(listing.Files, file{name, fmt.Sprintf("%x", md5.Sum([]byte(content)))})
+	}
+	var downloaded []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metadata/item" {
+			json.NewEncoder(w).Encode(listing)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/download/item/")
+		content, ok := files[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		downloaded = append(downloaded, name)
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	itemDir := filepath.Join(dir, "item")
+	if err := os.MkdirAll(filepath.Join(itemDir, "sub"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(itemDir, "a.zip"), []byte("complete"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(itemDir, "sub", "b.zip"), make([]byte, len("preallocated")), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := downloadItem(context.Background(), srv.URL, "item", dir, fileFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(downloaded)
+	if want := []string{"c.txt", "sub/b.zip"}; !reflect.DeepEqual(downloaded, want) {
+		t.Errorf("downloaded %q, want %q", downloaded, want)
+	}
+	for name, content := range files {
+		if name == "item_archive.torrent" {
+			continue
+		}
+		got, err := os.ReadFile(filepath.Join(itemDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Error(err)
+		} else if string(got) != content {
+			t.Errorf("%s: got %q, want %q", name, got, content)
+		}
+	}
+}
+
+func TestSaveTorrentFile(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/download/item/item_archive.torrent" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("torrent"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		filename, err := saveTorrentFile(context.Background(), srv.URL, "item", dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(dir, "item_archive.torrent"); filename != want {
+			t.Errorf("saved to %s, want %s", filename, want)
+		}
+		if got, err := os.ReadFile(filename); err != nil {
+			t.Error(err)
+		} else if string(got) != "torrent" {
+			t.Errorf("got %q, want %q", got, "torrent")
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("got %d requests, want 1 for an existing file", n)
+	}
+
+	filename, err := saveTorrentFile(context.Background(), srv.URL, "missing", dir)
+	if err == nil {
+		t.Error("got nil error for missing torrent")
+	}
+	if _, err := os.Stat(filename); err == nil {
+		t.Errorf("%s saved for missing torrent", filename)
+	}
+}
@@ -0,0 +1,663 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/storage"
+	"golang.org/x/time/rate"
+)
+
+// DownloadOptions configures DownloadReleases.
+type DownloadOptions struct {
+	// DataDir is the directory that releases are downloaded into.
+	DataDir string
+	// MaxConcurrent is the maximum number of releases downloaded at once.
+	// The next release is started as soon as one finishes. It is
+	// DefaultMaxConcurrent when <=0.
+	MaxConcurrent int
+	// SeedAfterDownload keeps completed torrents seeding until the
+	// Downloader is closed. Otherwise, torrents are dropped once
+	// complete.
+	SeedAfterDownload bool
+	// UploadRateLimit and DownloadRateLimit limit torrent transfer rates
+	// in bytes per second. Zero is unlimited.
+	UploadRateLimit, DownloadRateLimit int64
+	// DisableDHT and DisablePEX disable finding peers with the DHT and
+	// peer exchange. Peers are still found with trackers.
+	DisableDHT, DisablePEX bool
+	// WebseedsOnly downloads torrents only from the archive.org web
+	// seeds listed in the torrent files, without connecting to any peers
+	// or trackers or listening for connections, for networks that block
+	// them. Each torrent then effectively becomes a resumable HTTP
+	// download with several concurrent range requests, which is verified
+	// piece by piece.
+	WebseedsOnly bool
+	// Progress, when non-nil, is called when a release changes state and
+	// every ProgressInterval while downloading via torrent. It may be
+	// called concurrently for different releases.
+	Progress func(DownloadProgress)
+	// ProgressInterval is the interval between progress samples. It is
+	// DefaultProgressInterval when <=0.
+	ProgressInterval time.Duration
+	// Verify checks each release against its archive.org checksums
+	// once downloaded and re-downloads missing and corrupt files over
+	// HTTP.
+	Verify bool
+	// Projects, when non-empty, restricts downloads to the project zips
+	// of these shortener projects, named like <project>.<date>.zip.
+	// Releases without any are skipped.
+	Projects []string
+	// FileFilter, when set, further restricts downloads to the files for
+	// which it returns true, by their slash-separated paths within the
+	// release, like bitly.2014-05-07-21-17-02.zip. Other files in each
+	// torrent are not requested, though the parts of them that share a
+	// piece with a selected file are written. Releases without any
+	// selected files are skipped and the progress and completion of a
+	// release only count its selected files.
+	FileFilter func(path string) bool
+	// From and To, when non-zero, restrict downloads to the releases
+	// published at or after From and before To. Releases without a
+	// valid publication date are downloaded, with a warning.
+	From, To time.Time
+	// IgnoreDiskSpace disables checking that the data directory has
+	// space for the releases before downloading and pausing new
+	// releases while less than DiskSpaceMargin is available.
+	IgnoreDiskSpace bool
+	// Logger receives records of state changes, retried requests, and
+	// fallbacks to HTTP. It is slog.Default() when nil.
+	Logger *slog.Logger
+	// StallTimeout is the duration without any newly completed bytes
+	// after which a torrent is abandoned. It is the StallTimeout variable
+	// when <=0.
+	StallTimeout time.Duration
+	// Transport, when set, is used for all HTTP requests to archive.org,
+	// including those of torrent web seeds. Tracker requests use its
+	// Proxy when it is an *http.Transport. Otherwise, requests use
+	// HTTPClient and the web seed and tracker requests of the torrent
+	// client use the proxy from the environment, as with
+	// http.ProxyFromEnvironment, which honors HTTPS_PROXY.
+	Transport http.RoundTripper
+	// ProxyURL, when set and Transport is not, is the proxy for all HTTP
+	// requests, including those to web seeds and trackers. Credentials
+	// for an authenticated proxy can be given as its user info.
+	ProxyURL *url.URL
+	// NoHTTPFallback disables downloading releases over HTTP. Releases
+	// whose torrents stall are dropped and reported together by Wait in
+	// a *StallError, so that they can be retried later, and releases
+	// whose torrents cannot be added fail.
+	NoHTTPFallback bool
+	// Schedule, when non-empty, restricts downloading to these windows
+	// of time. Outside of them, the Downloader is paused, as with Pause,
+	// and it is resumed when the next window starts.
+	Schedule []TimeWindow
+}
+
+func (opts *DownloadOptions) logger() *slog.Logger {
+	if opts.Logger != nil {
+		return opts.Logger
+	}
+	return slog.Default()
+}
+
+// DefaultMaxConcurrent is the default maximum number of releases
+// downloaded at once.
+const DefaultMaxConcurrent = 4
+
+// StallTimeout is the default duration without progress after which a
+// torrent is abandoned and its item is instead downloaded over HTTP.
+var StallTimeout = 10 * time.Minute
+
+const (
+	pollInterval = time.Second
+	rateBurst    = 1 << 16 // must fit a 16 KiB chunk
+)
+
+var errStalled = errors.New("stalled")
+
+// ErrDownloaderClosed is returned when adding to a closed Downloader.
+var ErrDownloaderClosed = errors.New("tinytown: downloader closed")
+
+// newClientConfig constructs the torrent client config. Tests replace it
+// to keep the client local.
+var newClientConfig = torrent.NewDefaultClientConfig
+
+// Downloader downloads releases with a torrent client. Torrents that
+// make no progress within StallTimeout are dropped and their items are
+// downloaded directly from archive.org into the same layout.
+type Downloader struct {
+	opts    DownloadOptions
+	filter  fileFilter
+	log     *slog.Logger
+	baseURL string
+	client  *torrent.Client
+	storage storage.ClientImplCloser
+	ctx     context.Context // canceled by Close
+	cancel  context.CancelFunc
+	sem     chan struct{}
+
+	mu       sync.Mutex
+	closed   bool
+	errs     []error
+	stalled  []StalledRelease
+	progress map[string]DownloadProgress
+	started  map[string]time.Time
+	watchers map[string][]chan DownloadProgress // by download
+	active   int                                // releases added and not finished
+	idle     chan struct{}                      // closed while none are active
+
+	pausedManual    bool          // by Pause
+	outsideSchedule bool          // by the Schedule option
+	resumed         chan struct{} // closed while not paused
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewDownloader constructs a Downloader and starts its torrent client.
+// The Downloader must be closed to release the client.
+func NewDownloader(opts DownloadOptions) (*Downloader, error) {
+	conf := newClientConfig()
+	conf.DataDir = opts.DataDir
+	st := storage.NewMMap(opts.DataDir)
+	conf.DefaultStorage = st
+	conf.Seed = opts.SeedAfterDownload
+	if opts.UploadRateLimit > 0 {
+		conf.UploadRateLimiter = rate.NewLimiter(rate.Limit(opts.UploadRateLimit), rateBurst)
+	}
+	if opts.DownloadRateLimit > 0 {
+		conf.DownloadRateLimiter = rate.NewLimiter(rate.Limit(opts.DownloadRateLimit), rateBurst)
+	}
+	configureTorrentHTTP(conf, &opts)
+	conf.NoDHT = conf.NoDHT || opts.DisableDHT || opts.WebseedsOnly
+	conf.DisablePEX = conf.DisablePEX || opts.DisablePEX || opts.WebseedsOnly
+	if opts.WebseedsOnly {
+		conf.DisableTrackers = true
+		conf.DisableTCP = true
+		conf.DisableUTP = true
+		conf.NoDefaultPortForwarding = true
+	}
+	c, err := torrent.NewClient(conf)
+	if err != nil {
+		st.Close()
+		return nil, err
+	}
+	maxConcurrent := opts.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = DefaultMaxConcurrent
+	}
+	log := opts.logger()
+	ctx, cancel := context.WithCancel(opts.context(context.Background()))
+	d := &Downloader{
+		opts:     opts,
+		filter:   newFileFilter(opts.Projects, opts.FileFilter),
+		log:      log,
+		baseURL:  BaseURL,
+		client:   c,
+		storage:  st,
+		ctx:      ctx,
+		cancel:   cancel,
+		sem:      make(chan struct{}, maxConcurrent),
+		progress: make(map[string]DownloadProgress),
+		started:  make(map[string]time.Time),
+		watchers: make(map[string][]chan DownloadProgress),
+		resumed:  make(chan struct{}),
+		idle:     make(chan struct{}),
+	}
+	close(d.resumed)
+	close(d.idle)
+	if len(opts.Schedule) != 0 {
+		d.setPaused(func() { d.outsideSchedule = !scheduleAllows(opts.Schedule, time.Now()) })
+		go d.runSchedule()
+	}
+	return d, nil
+}
+
+// Add starts downloading the release with the given identifier via
+// torrent. When MaxConcurrent releases are downloading, Add blocks
+// until one finishes, and while paused, it blocks until resumed. Errors
+// while downloading are reported by Wait. When Projects or FileFilter
+// is set and the release contains no selected files, according to the
+// archive.org metadata API, it is skipped and the torrent is nil.
+func (d *Downloader) Add(id string) (*torrent.Torrent, error) {
+	if err := d.acquire(); err != nil {
+		return nil, err
+	}
+	d.report(DownloadProgress{ID: id, State: StateAdding})
+	if !d.filter.all() {
+		files, err := getItemFiles(d.ctx, d.baseURL, id)
+		if err != nil {
+			d.release()
+			return nil, err
+		}
+		if !d.filter.matchAny(files) {
+			d.report(DownloadProgress{ID: id, State: StateSkipped})
+			d.release()
+			return nil, nil
+		}
+	}
+	t, err := addTorrent(d.ctx, d.client, d.baseURL, id, d.opts.DataDir, d.filter)
+	if err != nil {
+		d.release()
+		return nil, err
+	}
+	d.mu.Lock()
+	if d.paused() {
+		// Paused since acquiring the slot.
+		t.DisallowDataDownload()
+	}
+	d.mu.Unlock()
+	go func() {
+		defer d.release()
+		d.finish(id, t, nil)
+	}()
+	return t, nil
+}
+
+// addAll adds each release, falling back to HTTP for those whose
+// torrents cannot be added, until d is closed.
+func (d *Downloader) addAll(ids []string) {
+	for _, id := range ids {
+		if _, err := d.Add(id); err != nil {
+			if err == ErrDownloaderClosed {
+				return
+			}
+			if err := d.addHTTP(id, err); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// download downloads a single release, falling back to HTTP as with
+// addAll, and waits for it to finish. Skipped releases are not an error.
+func (d *Downloader) download(ctx context.Context, id string) error {
+	done := make(chan DownloadProgress, 1)
+	d.mu.Lock()
+	d.watchers[id] = append(d.watchers[id], done)
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.watchers[id] = slices.DeleteFunc(d.watchers[id], func(ch chan DownloadProgress) bool { return ch == done })
+		if len(d.watchers[id]) == 0 {
+			delete(d.watchers, id)
+		}
+	}()
+
+	if _, err := d.Add(id); err != nil {
+		if err == ErrDownloaderClosed {
+			return err
+		}
+		if err := d.addHTTP(id, err); err != nil {
+			return err
+		}
+	}
+	select {
+	case p := <-done:
+		switch p.State {
+		case StateFailed:
+			return p.Err
+		case StateStalled:
+			return fmt.Errorf("tinytown: download %s: %w", id, p.Err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-d.ctx.Done():
+		return ErrDownloaderClosed
+	}
+}
+
+// addHTTP starts downloading the release with the given identifier over
+// HTTP only, after adding the torrent failed with err.
+func (d *Downloader) addHTTP(id string, err error) error {
+	if err := d.acquire(); err != nil {
+		return err
+	}
+	go func() {
+		defer d.release()
+		d.finish(id, nil, err)
+	}()
+	return nil
+}
+
+// acquire waits until not paused, for a download slot, and for disk
+// space.
+func (d *Downloader) acquire() error {
+	if err := d.waitResumed(); err != nil {
+		return err
+	}
+	if err := d.waitSpace(); err != nil {
+		return err
+	}
+	select {
+	case d.sem <- struct{}{}:
+	case <-d.ctx.Done():
+		return ErrDownloaderClosed
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		<-d.sem
+		return ErrDownloaderClosed
+	}
+	if d.active == 0 {
+		d.idle = make(chan struct{})
+	}
+	d.active++
+	return nil
+}
+
+// waitSpace waits until the data directory has at least
+// DiskSpaceMargin bytes available, unless IgnoreDiskSpace is set.
+func (d *Downloader) waitSpace() error {
+	if d.opts.IgnoreDiskSpace {
+		return nil
+	}
+	dir := existingDir(d.opts.DataDir)
+	for {
+		available, err := availableSpace(dir)
+		if err != nil || available >= DiskSpaceMargin {
+			return nil
+		}
+		t := time.NewTimer(diskCheckInterval)
+		select {
+		case <-t.C:
+		case <-d.ctx.Done():
+			t.Stop()
+			return ErrDownloaderClosed
+		}
+	}
+}
+
+func (d *Downloader) release() {
+	<-d.sem
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active--
+	if d.active == 0 {
+		close(d.idle)
+	}
+}
+
+// idleChan returns a channel that is closed once no releases are
+// active.
+func (d *Downloader) idleChan() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.idle
+}
+
+// finish waits for a torrent to complete, falling back to HTTP when it
+// stalls or when t is nil because adding it failed with err, and
+// records any error.
+func (d *Downloader) finish(id string, t *torrent.Torrent, err error) {
+	var total int64
+	if t != nil {
+		interval := d.opts.ProgressInterval
+		if interval <= 0 {
+			interval = DefaultProgressInterval
+		}
+		d.report(torrentProgress(id, StateTorrent, t, d.filter))
+		stall := d.opts.StallTimeout
+		if stall <= 0 {
+			stall = StallTimeout
+		}
+		var sampled time.Time
+		err = waitTorrent(d.ctx, t, d.filter, stall, d.Paused, func() {
+			if time.Since(sampled) >= interval {
+				d.report(torrentProgress(id, StateTorrent, t, d.filter))
+				sampled = time.Now()
+			}
+		})
+		var completed int64
+		completed, total = selectedBytes(t, d.filter)
+		if err == nil {
+			if !d.opts.SeedAfterDownload {
+				t.Drop()
+			}
+			d.complete(id, t, total)
+			return
+		}
+		t.Drop()
+		if err == errStalled && d.opts.NoHTTPFallback && d.ctx.Err() == nil {
+			d.mu.Lock()
+			d.stalled = append(d.stalled, StalledRelease{id, completed, total})
+			d.mu.Unlock()
+			d.report(DownloadProgress{ID: id, State: StateStalled, BytesCompleted: completed, BytesTotal: total, Err: err})
+			return
+		}
+	}
+	if d.ctx.Err() != nil {
+		return
+	}
+	if d.opts.NoHTTPFallback {
+		d.fail(id, total, err)
+		return
+	}
+	if d.waitResumed() != nil {
+		return
+	}
+	d.report(DownloadProgress{ID: id, State: StateHTTP, BytesTotal: total, Err: err})
+	if err := downloadItem(d.ctx, d.baseURL, id, d.opts.DataDir, d.filter); err != nil {
+		d.fail(id, total, err)
+		return
+	}
+	d.complete(id, nil, total)
+}
+
+// complete verifies a downloaded release, when enabled, and reports it
+// as done.
+func (d *Downloader) complete(id string, t *torrent.Torrent, total int64) {
+	if d.opts.Verify {
+		if err := d.verify(id, t, total); err != nil {
+			d.fail(id, total, err)
+			return
+		}
+	}
+	d.report(DownloadProgress{ID: id, State: StateDone, BytesCompleted: total, BytesTotal: total})
+}
+
+// verify checks a release against its checksums and re-downloads
+// missing and corrupt files over HTTP, after dropping its torrent, if
+// any.
+func (d *Downloader) verify(id string, t *torrent.Torrent, total int64) error {
+	d.report(DownloadProgress{ID: id, State: StateVerifying, BytesTotal: total})
+	vr, err := verifyRelease(d.ctx, d.baseURL, d.opts.DataDir, id, &VerifyOptions{Projects: d.opts.Projects, FileFilter: d.opts.FileFilter})
+	if err != nil {
+		return err
+	}
+	if len(vr.Missing) == 0 && len(vr.Corrupt) == 0 {
+		return nil
+	}
+	if t != nil {
+		t.Drop()
+	}
+	for _, name := range vr.Corrupt {
+		if err := os.Remove(filepath.Join(d.opts.DataDir, id, filepath.FromSlash(name))); err != nil {
+			return err
+		}
+	}
+	err = fmt.Errorf("%d missing and %d corrupt files", len(vr.Missing), len(vr.Corrupt))
+	d.report(DownloadProgress{ID: id, State: StateHTTP, BytesTotal: total, Err: err})
+	if err := downloadItem(d.ctx, d.baseURL, id, d.opts.DataDir, d.filter); err != nil {
+		return err
+	}
+	d.report(DownloadProgress{ID: id, State: StateVerifying, BytesTotal: total})
+	if vr, err = verifyRelease(d.ctx, d.baseURL, d.opts.DataDir, id, &VerifyOptions{Projects: d.opts.Projects, FileFilter: d.opts.FileFilter}); err != nil {
+		return err
+	}
+	if len(vr.Missing) != 0 || len(vr.Corrupt) != 0 {
+		return fmt.Errorf("%d missing and %d corrupt files after re-download", len(vr.Missing), len(vr.Corrupt))
+	}
+	return nil
+}
+
+// fail records the error of a release, unless d is closed.
+func (d *Downloader) fail(id string, total int64, err error) {
+	if d.ctx.Err() != nil {
+		return
+	}
+	err = fmt.Errorf("tinytown: download %s: %w", id, err)
+	d.mu.Lock()
+	d.errs = append(d.errs, err)
+	d.mu.Unlock()
+	d.report(DownloadProgress{ID: id, State: StateFailed, BytesTotal: total, Err: err})
+}
+
+// Wait waits for all added releases to finish downloading or for ctx to
+// be done. It returns the errors of releases that failed both via
+// torrent and HTTP and a *StallError for releases that stalled with
+// NoHTTPFallback, joined, or ctx.Err(). Completed torrents continue
+// seeding, when enabled, until the Downloader is closed.
+func (d *Downloader) Wait(ctx context.Context) error {
+	select {
+	case <-d.idleChan():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	errs := d.errs
+	if len(d.stalled) != 0 {
+		errs = append(errs, &StallError{d.stalled})
+	}
+	d.errs, d.stalled = nil, nil
+	return errors.Join(errs...)
+}
+
+// StallError is returned by Wait for the releases whose torrents
+// stalled, when HTTP fallback is disabled.
+type StallError struct {
+	Releases []StalledRelease
+}
+
+// StalledRelease is a release whose torrent stalled.
+type StalledRelease struct {
+	ID             string
+	BytesCompleted int64
+	BytesTotal     int64
+}
+
+// Percent returns the percentage of the release that was completed.
+func (r StalledRelease) Percent() float64 {
+	if r.BytesTotal == 0 {
+		return 0
+	}
+	return 100 * float64(r.BytesCompleted) / float64(r.BytesTotal)
+}
+
+func (err *StallError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "tinytown: %d stalled torrents:", len(err.Releases))
+	for i, r := range err.Releases {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, " %s (%.1f%%)", r.ID, r.Percent())
+	}
+	return b.String()
+}
+
+// Close stops all downloads and seeding, closes the torrent client, and
+// flushes storage. Torrents are paused first, so that no more data is
+// written while in-flight releases stop. Downloaded pieces are kept, so
+// a later Downloader resumes them. It is safe to call more than once.
+func (d *Downloader) Close() error {
+	d.closeOnce.Do(func() {
+		d.mu.Lock()
+		d.closed = true
+		d.mu.Unlock()
+		for _, t := range d.client.Torrents() {
+			t.DisallowDataDownload()
+		}
+		d.cancel()
+		<-d.idleChan()
+		d.client.Close()
+		d.closeErr = d.storage.Close()
+	})
+	return d.closeErr
+}
+
+// addTorrent adds the torrent for a release and starts downloading the
+// files matched by filter.
+func addTorrent(ctx context.Context, c *torrent.Client, baseURL, id, dir string, filter fileFilter) (*torrent.Torrent, error) {
+	filename, err := saveTorrentFile(ctx, baseURL, id, dir)
+	if err != nil {
+		return nil, err
+	}
+	t, err := c.AddTorrentFromFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if filter.all() {
+		t.DownloadAll()
+		return t, nil
+	}
+	for _, f := range t.Files() {
+		if filter.match(f.DisplayPath()) {
+			f.Download()
+		} else {
+			f.SetPriority(torrent.PiecePriorityNone)
+		}
+	}
+	return t, nil
+}
+
+// waitTorrent waits for the files of a torrent matched by filter to
+// complete, calling poll while they are incomplete. It returns
+// errStalled, if no bytes are completed within stall, not counting time
+// while paused reports true, or ctx.Err(), if ctx is done.
+func waitTorrent(ctx context.Context, t *torrent.Torrent, filter fileFilter, stall time.Duration, paused func() bool, poll func()) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	completed, total := selectedBytes(t, filter)
+	progressed := time.Now()
+	for completed < total {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		poll()
+		if n, _ := selectedBytes(t, filter); n != completed || paused() {
+			completed, progressed = n, time.Now()
+		} else if time.Since(progressed) >= stall {
+			return errStalled
+		}
+	}
+	return nil
+}
+
+// selectedBytes returns the completed and total bytes of the files of a
+// torrent matched by filter.
+func selectedBytes(t *torrent.Torrent, filter fileFilter) (completed, total int64) {
+	if filter.all() {
+		return t.BytesCompleted(), t.Length()
+	}
+	for _, f := range t.Files() {
+		if filter.match(f.DisplayPath()) {
+			completed += f.BytesCompleted()
+			total += f.Length()
+		}
+	}
+	return completed, total
+}
@@ -0,0 +1,424 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestDownloader(t *testing.T) {
+	const id = "urlteam_test"
+	content := bytes.Repeat([]byte("terroroftinytown"), 1<<12)
+
+	seedDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(seedDir, id), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(seedDir, id, "example.zip"), content, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	info := metainfo.Info{PieceLength: 1 << 14}
+	if err := info.BuildFromFilePath(filepath.Join(seedDir, id)); err != nil {
+		t.Fatal(err)
+	}
+	var mi metainfo.MetaInfo
+	var err error
+	if mi.InfoBytes, err = bencode.Marshal(info); err != nil {
+		t.Fatal(err)
+	}
+	var torrentFile bytes.Buffer
+	if err := mi.Write(&torrentFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// Seed the item from a local client without DHT or trackers.
+	seedConf := torrent.TestingConfig(t)
+	seedConf.DataDir = seedDir
+	seedConf.Seed = true
+	seeder, err := torrent.NewClient(seedConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seeder.Close()
+	st, err := seeder.AddTorrent(&mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.VerifyData()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/download/"+id+"/"+id+"_archive.torrent" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(torrentFile.Bytes())
+	}))
+	defer srv.Close()
+
+	defer func(newConf func() *torrent.ClientConfig) { newClientConfig = newConf }(newClientConfig)
+	newClientConfig = func() *torrent.ClientConfig { return torrent.TestingConfig(t) }
+	dir := t.TempDir()
+	var states []DownloadState
+	d, err := NewDownloader(DownloadOptions{
+		DataDir: dir,
+		Progress: func(p DownloadProgress) {
+			if p.ID != id {
+				t.Errorf("progress for %q, want %q", p.ID, id)
+			}
+			if len(states) == 0 || states[len(states)-1] != p.State {
+				states = append(states, p.State)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.baseURL = srv.URL
+	tt, err := d.Add(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt.AddClientPeer(seeder)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wantStates := []DownloadState{StateAdding, StateTorrent, StateDone}
+	if !reflect.DeepEqual(states, wantStates) {
+		t.Errorf("got states %v, want %v", states, wantStates)
+	}
+	size := int64(len(content))
+	got := d.Stats()
+	got.Peers = 0 // the seeder may be disconnected once complete
+	if want := (DownloadStats{Done: 1, BytesCompleted: size, BytesTotal: size}); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+	if _, err := d.Add(id); err != ErrDownloaderClosed {
+		t.Errorf("got error %v after close, want %v", err, ErrDownloaderClosed)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, id, "example.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("downloaded %d bytes differ from %d seeded", len(data), len(content))
+	}
+}
+
+func TestDownloaderWebseedsOnly(t *testing.T) {
+	const id = "urlteam_webseed"
+	content := bytes.Repeat([]byte("terroroftinytown"), 1<<14)
+
+	seedDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(seedDir, id), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(seedDir, id, "example.zip"), content, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	info := metainfo.Info{PieceLength: 1 << 14}
+	if err := info.BuildFromFilePath(filepath.Join(seedDir, id)); err != nil {
+		t.Fatal(err)
+	}
+
+	var ranges atomic.Int32
+	srv := newWebseedServer(t, id, info, content, &ranges)
+	defer srv.Close()
+
+	defer func(newConf func() *torrent.ClientConfig) { newClientConfig = newConf }(newClientConfig)
+	newClientConfig = func() *torrent.ClientConfig { return torrent.TestingConfig(t) }
+	dir := t.TempDir()
+	var states []DownloadState
+	d, err := NewDownloader(DownloadOptions{
+		DataDir:      dir,
+		WebseedsOnly: true,
+		Progress: func(p DownloadProgress) {
+			if len(states) == 0 || states[len(states)-1] != p.State {
+				states = append(states, p.State)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.baseURL = srv.URL
+	if _, err := d.Add(id); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := []DownloadState{StateAdding, StateTorrent, StateDone}; !reflect.DeepEqual(states, want) {
+		t.Errorf("got states %v, want %v", states, want)
+	}
+	if ranges.Load() == 0 {
+		t.Error("web seed received no range requests")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id, "example.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("downloaded %d bytes differ from %d served", len(data), len(content))
+	}
+}
+
+// newWebseedServer serves an item with a single file, example.zip, as
+// archive.org does, with the download directory as the web seed. Range
+// requests for the file are counted in ranges.
+func newWebseedServer(t *testing.T, id string, info metainfo.Info, content []byte, ranges *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/download/" + id + "/" + id + "_archive.torrent":
+			mi := metainfo.MetaInfo{UrlList: []string{"http://" + r.Host + "/download/"}}
+			var err error
+			if mi.InfoBytes, err = bencode.Marshal(info); err != nil {
+				t.Error(err)
+			}
+			mi.Write(w)
+		case "/download/" + id + "/example.zip":
+			if r.Header.Get("Range") != "" {
+				ranges.Add(1)
+			}
+			http.ServeContent(w, r, "example.zip", time.Time{}, bytes.NewReader(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestDownloaderFileFilter(t *testing.T) {
+	const id = "urlteam_filter"
+	files := map[string][]byte{
+		"bitly.zip": bytes.Repeat([]byte("bitly"), 1<<13),
+		"isgd.zip":  bytes.Repeat([]byte("isgd"), 1<<13),
+	}
+
+	seedDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(seedDir, id), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(seedDir, id, name), content, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Piece boundaries align with the files, so that no piece of isgd.zip
+	// is needed.
+	info := metainfo.Info{PieceLength: 1 << 13}
+	if err := info.BuildFromFilePath(filepath.Join(seedDir, id)); err != nil {
+		t.Fatal(err)
+	}
+
+	var requests sync.Map
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/download/" + id + "/" + id + "_archive.torrent":
+			mi := metainfo.MetaInfo{UrlList: []string{"http://" + r.Host + "/download/"}}
+			var err error
+			if mi.InfoBytes, err = bencode.Marshal(info); err != nil {
+				t.Error(err)
+			}
+			mi.Write(w)
+		case "/metadata/" + id:
+			w.Write([]byte(`{"files":[{"name":"bitly.zip"},{"name":"isgd.zip"}]}`))
+		default:
+			name, ok := strings.CutPrefix(r.URL.Path, "/download/"+id+"/")
+			content, ok2 := files[name]
+			if !ok || !ok2 {
+				http.NotFound(w, r)
+				return
+			}
+			requests.Store(name, true)
+			http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+		}
+	}))
+	defer srv.Close()
+
+	defer func(newConf func() *torrent.ClientConfig) { newClientConfig = newConf }(newClientConfig)
+	newClientConfig = func() *torrent.ClientConfig { return torrent.TestingConfig(t) }
+	dir := t.TempDir()
+	var last DownloadProgress
+	d, err := NewDownloader(DownloadOptions{
+		DataDir:        dir,
+		WebseedsOnly:   true,
+		NoHTTPFallback: true,
+		FileFilter:     func(path string) bool { return strings.HasPrefix(path, "bitly.") },
+		Progress:       func(p DownloadProgress) { last = p },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.baseURL = srv.URL
+	if _, err := d.Add(id); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	size := int64(len(files["bitly.zip"]))
+	if last.State != StateDone || last.BytesCompleted != size || last.BytesTotal != size {
+		t.Errorf("got progress %+v, want done with %d bytes", last, size)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id, "bitly.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, files["bitly.zip"]) {
+		t.Errorf("downloaded %d bytes differ from %d served", len(data), len(files["bitly.zip"]))
+	}
+	if _, ok := requests.Load("isgd.zip"); ok {
+		t.Error("unselected file was requested from the web seed")
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, id, "isgd.zip")); err == nil && bytes.Equal(data, files["isgd.zip"]) {
+		t.Error("unselected file was downloaded")
+	}
+}
+
+func TestDownloaderStall(t *testing.T) {
+	const id = "urlteam_stall"
+	info := metainfo.Info{Name: id, PieceLength: 1 << 14, Length: 1 << 15, Pieces: make([]byte, 40)}
+	var mi metainfo.MetaInfo
+	var err error
+	if mi.InfoBytes, err = bencode.Marshal(info); err != nil {
+		t.Fatal(err)
+	}
+	var torrentFile bytes.Buffer
+	if err := mi.Write(&torrentFile); err != nil {
+		t.Fatal(err)
+	}
+	var httpRequests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/download/"+id+"/"+id+"_archive.torrent" {
+			w.Write(torrentFile.Bytes())
+			return
+		}
+		httpRequests.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	defer func(newConf func() *torrent.ClientConfig) { newClientConfig = newConf }(newClientConfig)
+	newClientConfig = func() *torrent.ClientConfig { return torrent.TestingConfig(t) }
+	var states []DownloadState
+	d, err := NewDownloader(DownloadOptions{
+		DataDir:        t.TempDir(),
+		StallTimeout:   time.Second,
+		NoHTTPFallback: true,
+		Progress: func(p DownloadProgress) {
+			if len(states) == 0 || states[len(states)-1] != p.State {
+				states = append(states, p.State)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.baseURL = srv.URL
+	if _, err := d.Add(id); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err = d.Wait(ctx)
+	var stallErr *StallError
+	if !errors.As(err, &stallErr) {
+		t.Fatalf("got error %v, want StallError", err)
+	}
+	want := []StalledRelease{{ID: id, BytesTotal: 1 << 15}}
+	if !reflect.DeepEqual(stallErr.Releases, want) {
+		t.Errorf("got stalled %+v, want %+v", stallErr.Releases, want)
+	}
+	if want := []DownloadState{StateAdding, StateTorrent, StateStalled}; !reflect.DeepEqual(states, want) {
+		t.Errorf("got states %v, want %v", states, want)
+	}
+	if n := httpRequests.Load(); n != 0 {
+		t.Errorf("got %d HTTP requests, want none without fallback", n)
+	}
+	if s := d.Stats(); s.Stalled != 1 {
+		t.Errorf("got stats %+v, want 1 stalled", s)
+	}
+}
+
+func TestDownloaderWaitCanceled(t *testing.T) {
+	defer func(newConf func() *torrent.ClientConfig) { newClientConfig = newConf }(newClientConfig)
+	newClientConfig = func() *torrent.ClientConfig { return torrent.TestingConfig(t) }
+	d, err := NewDownloader(DownloadOptions{DataDir: t.TempDir(), IgnoreDiskSpace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Abandoned waits do not leave goroutines behind.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		if err := d.Wait(ctx); err != context.Canceled {
+			t.Fatalf("got error %v, want %v", err, context.Canceled)
+		}
+	}
+	if after := runtime.NumGoroutine(); after >= before+100 {
+		t.Errorf("got %d goroutines after canceled waits, previously %d", after, before)
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- d.Wait(context.Background()) }()
+	select {
+	case err := <-errc:
+		t.Fatalf("returned while active: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	d.release()
+	if err := <-errc; err != nil {
+		t.Errorf("got error %v, want nil", err)
+	}
+	if err := d.acquire(); err != nil {
+		t.Fatal(err)
+	}
+	d.release()
+	if err := d.Wait(context.Background()); err != nil {
+		t.Errorf("got error %v after second release, want nil", err)
+	}
+}
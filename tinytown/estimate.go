@@ -0,0 +1,224 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// MetadataCacheDir is the name of the directory in the data directory in
+// which EstimateSize caches archive.org metadata responses.
+const MetadataCacheDir = ".tinytown-metadata"
+
+// SizeEstimate is the size of the releases that DownloadReleases would
+// download with the same options, from item metadata.
+type SizeEstimate struct {
+	Releases []ReleaseSize // releases with selected files or unknown size
+
+	Total   int64 // bytes in releases of known size
+	Unknown int   // releases of unknown size
+}
+
+// ReleaseSize is the part of a SizeEstimate for a single release.
+type ReleaseSize struct {
+	Identifier string
+	Size       int64 // bytes of selected files or -1, when unknown
+	Err        error // error requesting the metadata, when unknown
+}
+
+// itemMetadata is a response from the archive.org metadata API.
+type itemMetadata struct {
+	ItemSize int64         `json:"item_size"`
+	Files    []ReleaseFile `json:"files"`
+}
+
+// EstimateSize returns the total bytes of the releases that
+// DownloadReleases would download with opts, as described by
+// EstimateSizes. Releases of unknown size are not counted and are logged
+// as warnings.
+func EstimateSize(ctx context.Context, opts DownloadOptions) (int64, error) {
+	ctx = opts.context(ctx)
+	e, err := estimateSizes(ctx, BaseURL, opts)
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range e.Releases {
+		if r.Size < 0 {
+			loggerFrom(ctx).Warn("release of unknown size", "id", r.Identifier, "err", r.Err)
+		}
+	}
+	return e.Total, nil
+}
+
+// EstimateSizes reports the size of each release that DownloadReleases
+// would download with opts, without starting the torrent client or
+// checking the data directory. Releases are filtered by From and To and
+// sized with the archive.org metadata API: by item_size or the sum of
+// its file sizes or, with Projects or FileFilter, by the sum of the
+// selected files. Metadata responses are cached in
+// DataDir/MetadataCacheDir until the item is added to. A release whose
+// metadata cannot be requested is reported with unknown size, instead of
+// failing the estimate.
+func EstimateSizes(ctx context.Context, opts DownloadOptions) (*SizeEstimate, error) {
+	ctx = opts.context(ctx)
+	return estimateSizes(ctx, BaseURL, opts)
+}
+
+func estimateSizes(ctx context.Context, baseURL string, opts DownloadOptions) (*SizeEstimate, error) {
+	releases, err := scrapeReleases(ctx, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	releases = dateRange{opts.From, opts.To}.filterReleases(ctx, releases)
+	filter := newFileFilter(opts.Projects, opts.FileFilter)
+	cacheDir := filepath.Join(opts.DataDir, MetadataCacheDir)
+
+	sizes := make([]ReleaseSize, len(releases))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, metadataWorkers)
+	for i := range releases {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			r := &releases[i]
+			sizes[i] = ReleaseSize{Identifier: r.Identifier, Size: -1}
+			meta, err := getCachedMetadata(ctx, baseURL, cacheDir, r)
+			if err != nil {
+				sizes[i].Err = err
+				return
+			}
+			sizes[i].Size = meta.size(r.Identifier, filter)
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var e SizeEstimate
+	for _, r := range sizes {
+		switch {
+		case r.Size < 0:
+			e.Unknown++
+		case r.Size == 0 && !filter.all():
+			continue // no selected files
+		default:
+			e.Total += r.Size
+		}
+		e.Releases = append(e.Releases, r)
+	}
+	return &e, nil
+}
+
+// size returns the bytes of the files of the item selected by filter.
+// Without a filter, it is the listed item size, if any.
+func (m *itemMetadata) size(id string, filter fileFilter) int64 {
+	if filter.all() && m.ItemSize > 0 {
+		return m.ItemSize
+	}
+	var size int64
+	for _, f := range m.Files {
+		if !filter.all() && (f.Name == id+"_archive.torrent" || !filter.match(f.Name)) {
+			continue
+		}
+		size += f.Size
+	}
+	return size
+}
+
+// getCachedMetadata requests the metadata of a release, using the
+// response cached in cacheDir, unless the release has been added to
+// since. Failing to write the cache is not an error.
+func getCachedMetadata(ctx context.Context, baseURL, cacheDir string, r *Release) (*itemMetadata, error) {
+	filename := filepath.Join(cacheDir, r.Identifier+".json")
+	if fi, err := os.Stat(filename); err == nil && fi.ModTime().After(r.AddedDate) {
+		if data, err := os.ReadFile(filename); err == nil {
+			var meta itemMetadata
+			if json.Unmarshal(data, &meta) == nil && (meta.ItemSize > 0 || len(meta.Files) != 0) {
+				return &meta, nil
+			}
+		}
+	}
+
+	resp, err := httpGet(ctx, baseURL+"/metadata/"+r.Identifier)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var meta itemMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("tinytown: metadata for item %s: %w", r.Identifier, err)
+	}
+	if meta.ItemSize <= 0 && len(meta.Files) == 0 {
+		return nil, fmt.Errorf("tinytown: no files listed for item %s", r.Identifier)
+	}
+	if err := writeCache(filename, data); err != nil {
+		loggerFrom(ctx).Warn("caching metadata", "id", r.Identifier, "err", err)
+	}
+	return &meta, nil
+}
+
+// writeCache atomically replaces a cache file by writing to a temporary
+// file and renaming it.
+func writeCache(filename string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o777); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// String formats the estimate as a table with a row for each release and
+// a row of totals.
+func (e *SizeEstimate) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprint(w, "Release\tSize\n")
+	for _, r := range e.Releases {
+		if r.Size < 0 {
+			fmt.Fprintf(w, "%s\tunknown\n", r.Identifier)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\n", r.Identifier, formatBytes(r.Size))
+		}
+	}
+	fmt.Fprintf(w, "Total (%d releases", len(e.Releases))
+	if e.Unknown != 0 {
+		fmt.Fprintf(w, ", %d unknown", e.Unknown)
+	}
+	fmt.Fprintf(w, ")\t%s\n", formatBytes(e.Total))
+	w.Flush()
+	return b.String()
+}
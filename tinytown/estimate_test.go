@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestEstimateSizes(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests = make(map[string]int)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/services/search/v1/scrape":
+			w.Write([]byte(`{"items":[
+				{"identifier":"a","publicdate":"2015-07-29T07:11:17Z"},
+				{"identifier":"b","publicdate":"2016-01-01T12:00:00Z","addeddate":"2999-01-01T00:00:00Z"},
+				{"identifier":"c","publicdate":"2016-02-01T12:00:00Z"}
+			],"count":3,"total":3}`))
+		case "/metadata/a":
+			w.Write([]byte(`{"item_size":100,"files":[
+				{"name":"foo.2015-07-29.zip","size":"4"},
+				{"name":"bar.2015-07-29.zip","size":"8"},
+				{"name":"a_archive.torrent","size":"1"}
+			]}`))
+		case "/metadata/b":
+			w.Write([]byte(`{"files":[{"name":"bar.2016-01-01.zip","size":"16"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		e, err := estimateSizes(context.Background(), srv.URL, DownloadOptions{DataDir: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Total != 116 || e.Unknown != 1 || len(e.Releases) != 3 {
+			t.Fatalf("#%d: got %+v, want total 116 with 1 unknown of 3 releases", i, e)
+		}
+		if r := e.Releases[2]; r.Identifier != "c" || r.Size != -1 || r.Err == nil {
+			t.Errorf("#%d: got %+v for unknown release", i, r)
+		}
+	}
+	// a is cached, but b is added to after the cache was written.
+	if n := requests["/metadata/a"]; n != 1 {
+		t.Errorf("got %d requests for a, want 1", n)
+	}
+	if n := requests["/metadata/b"]; n != 2 {
+		t.Errorf("got %d requests for b, want 2", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, MetadataCacheDir, "a.json")); err != nil {
+		t.Error(err)
+	}
+
+	e, err := estimateSizes(context.Background(), srv.URL, DownloadOptions{DataDir: dir, Projects: []string{"foo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "" +
+		"Release                        Size\n" +
+		"a                              4 B\n" +
+		"c                              unknown\n" +
+		"Total (2 releases, 1 unknown)  4 B\n"
+	if s := e.String(); s != want {
+		t.Errorf("got table\n%s\nwant\n%s", s, want)
+	}
+}
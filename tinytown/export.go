@@ -0,0 +1,301 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+// DefaultChunkLinks is the default number of links of a project held in
+// memory by ExportBeacon before they are spilled to disk.
+const DefaultChunkLinks = 1 << 20
+
+// ExportOptions configures ExportBeacon.
+type ExportOptions struct {
+	// Process configures the processing of the releases. It may be nil.
+	Process *ProcessOptions
+	// Sort sorts the links of each project by shortcode, then target.
+	// Chunks of ChunkLinks links are sorted in memory and spilled to
+	// disk, then merged. Unsorted links are written in the order that
+	// they are visited.
+	Sort bool
+	// ChunkLinks is the number of links of a project held in memory
+	// before spilling to disk. It is DefaultChunkLinks when <=0.
+	ChunkLinks int
+	// GzipLevel is the gzip compression level of the outputs. It is
+	// gzip.DefaultCompression when 0.
+	GzipLevel int
+	// TempDir is the directory for spilled chunks. It is os.TempDir()
+	// when empty.
+	TempDir string
+	// Exported, when set, is called after the file for each project is
+	// written.
+	Exported func(ExportedProject)
+}
+
+// ExportedProject reports the BEACON file written for a project by
+// ExportBeacon.
+type ExportedProject struct {
+	Project    string
+	Filename   string
+	Links      int64 // links written
+	Duplicates int64 // links dropped with the same shortcode and target
+	Invalid    int64 // links dropped with line breaks, which BEACON cannot represent
+}
+
+// ExportBeacon processes the releases in dir, as with
+// ProcessReleasesOptions, and writes the links of each project to a
+// gzip-compressed BEACON file, outDir/<project>.beacon.gz. Links with
+// the same shortcode and target, such as from incremental releases of a
+// project, are written once. Without Sort, duplicates are tracked in
+// memory. The PREFIX header is from the URL template in the project
+// metadata of the latest release.
+func ExportBeacon(dir, outDir string, opts ExportOptions) error {
+	return ExportBeaconContext(context.Background(), dir, outDir, opts)
+}
+
+// ExportBeaconContext is like ExportBeacon, but stops when ctx is done.
+// Files are only written once processing has finished.
+func ExportBeaconContext(ctx context.Context, dir, outDir string, opts ExportOptions) error {
+	tmp, err := os.MkdirTemp(opts.TempDir, "tinytown-export-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	e := &exporter{
+		tmp:      tmp,
+		sort:     opts.Sort,
+		chunk:    opts.ChunkLinks,
+		projects: make(map[string]*exportProject),
+	}
+	if e.chunk <= 0 {
+		e.chunk = DefaultChunkLinks
+	}
+	if err := ProcessReleasesOptions(ctx, dir, opts.Process, e.add); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, 0o777); err != nil {
+		return err
+	}
+	level := opts.GzipLevel
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	names := make([]string, 0, len(e.projects))
+	for name := range e.projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ep, err := e.write(name, outDir, level)
+		if err != nil {
+			return err
+		}
+		if opts.Exported != nil {
+			opts.Exported(ep)
+		}
+	}
+	return nil
+}
+
+// exporter collects the links of each project into chunk files.
+type exporter struct {
+	tmp   string
+	sort  bool
+	chunk int
+
+	mu       sync.Mutex
+	projects map[string]*exportProject
+}
+
+type exportProject struct {
+	meta    *ProjectMeta
+	release string // release of meta
+	links   []beacon.Link
+	chunks  []string
+	invalid int64
+}
+
+func (e *exporter) add(m *ProjectMeta, release string, l *beacon.Link) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.projects[m.Name]
+	if !ok {
+		p = &exportProject{}
+		e.projects[m.Name] = p
+	}
+	if p.meta == nil || release > p.release {
+		p.meta, p.release = m, release
+	}
+	if strings.ContainsAny(l.Source, "|\r\n") || strings.ContainsAny(l.Target, "\r\n") {
+		p.invalid++
+		return nil
+	}
+	p.links = append(p.links, beacon.Link{Source: l.Source, Target: l.Target})
+	if len(p.links) >= e.chunk {
+		return e.spill(p)
+	}
+	return nil
+}
+
+// spill writes the links held in memory for a project to a new chunk
+// file, sorted when sorting.
+func (e *exporter) spill(p *exportProject) error {
+	if len(p.links) == 0 {
+		return nil
+	}
+	if e.sort {
+		sort.Slice(p.links, func(i, j int) bool {
+			return linkLess(&p.links[i], &p.links[j])
+		})
+	}
+	f, err := os.CreateTemp(e.tmp, "chunk-*")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := beacon.NewWriter(f)
+	for i := range p.links {
+		if err := w.WriteLink(&p.links[i]); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	p.chunks = append(p.chunks, f.Name())
+	p.links = p.links[:0]
+	return nil
+}
+
+// write writes the BEACON file for a project from its chunks.
+func (e *exporter) write(name, outDir string, level int) (ExportedProject, error) {
+	p := e.projects[name]
+	ep := ExportedProject{
+		Project:  name,
+		Filename: filepath.Join(outDir, name+".beacon.gz"),
+		Invalid:  p.invalid,
+	}
+	if err := e.spill(p); err != nil {
+		return ep, err
+	}
+	var readers []*beacon.Reader
+	for _, chunk := range p.chunks {
+		f, err := os.Open(chunk)
+		if err != nil {
+			return ep, err
+		}
+		defer f.Close()
+		readers = append(readers, beacon.NewReader(f))
+	}
+
+	part := ep.Filename + ".part"
+	f, err := os.Create(part)
+	if err != nil {
+		return ep, err
+	}
+	defer f.Close()
+	w, err := beacon.NewGzipWriterOptions(f, &beacon.GzipOptions{Level: level, Name: name + ".beacon"})
+	if err != nil {
+		return ep, err
+	}
+	if err := w.WriteMeta(exportMeta(p.meta)); err != nil {
+		return ep, err
+	}
+	if e.sort {
+		err = writeSortedUnique(w, beacon.Merge(linkLess, readers...), &ep)
+	} else {
+		err = writeUnique(w, beacon.NewDedupReader(beacon.NewMultiReader(readers...)), &ep)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(part)
+		return ep, err
+	}
+	if err := w.Close(); err != nil {
+		return ep, err
+	}
+	if err := f.Sync(); err != nil {
+		return ep, err
+	}
+	return ep, finishPart(f, part, ep.Filename)
+}
+
+// writeSortedUnique writes sorted links, dropping adjacent duplicates.
+func writeSortedUnique(w *beacon.Writer, r beacon.LinkReader, ep *ExportedProject) error {
+	var last *beacon.Link
+	for {
+		l, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if last != nil && l.Source == last.Source && l.Target == last.Target {
+			ep.Duplicates++
+			continue
+		}
+		if err := w.WriteLink(l); err != nil {
+			return err
+		}
+		ep.Links++
+		last = l
+	}
+}
+
+func writeUnique(w *beacon.Writer, r *beacon.DedupReader, ep *ExportedProject) error {
+	for {
+		l, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := w.WriteLink(l); err != nil {
+			return err
+		}
+		ep.Links++
+	}
+	ep.Duplicates = r.Dropped()
+	return nil
+}
+
+// exportMeta returns the header for the BEACON file of a project. The
+// URL template of the project, like http://example.com/{shortcode},
+// becomes the PREFIX and targets are written as is.
+func exportMeta(m *ProjectMeta) []beacon.MetaField {
+	var meta []beacon.MetaField
+	if m.URLTemplate != "" {
+		prefix := strings.ReplaceAll(m.URLTemplate, "{shortcode}", "{ID}")
+		meta = append(meta, beacon.MetaField{Name: "PREFIX", Value: prefix})
+	}
+	return append(meta, beacon.MetaField{Name: "TARGET", Value: "{+ID}"})
+}
+
+func linkLess(a, b *beacon.Link) bool {
+	if a.Source != b.Source {
+		return a.Source < b.Source
+	}
+	return a.Target < b.Target
+}
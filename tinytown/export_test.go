@@ -0,0 +1,101 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+func TestExportBeacon(t *testing.T) {
+	root := t.TempDir()
+	writeZip(t, filepath.Join(root, "urlteam_2014-06-01", "isgd.2014-05-07-21-17-02.zip"), []zipEntry{
+		{"isgd.meta.json.xz", `{"name":"isgd","url_template":"http://is.gd/{shortcode}"}`},
+		{"22.txt.xz", "bb|http://example.com/b\nab|http://example.com/a\n"},
+	})
+	writeZip(t, filepath.Join(root, "urlteam_2014-07-01", "isgd.2014-06-07-21-17-02.zip"), []zipEntry{
+		{"isgd.meta.json.xz", `{"name":"isgd","url_template":"https://is.gd/{shortcode}"}`},
+		{"22.txt.xz", "ab|http://example.com/a\nab|http://example.com/a2\ncc|http://example.com/c|d\n"},
+	})
+	writeZip(t, filepath.Join(root, "urlteam_2014-07-01", "bitly.2014-06-07-21-17-02.zip"), []zipEntry{
+		{"bitly.meta.json.xz", `{"name":"bitly","url_template":"http://bit.ly/{shortcode}"}`},
+		{"1.txt.xz", "z|http://example.com/z\n"},
+	})
+
+	for _, sorted := range []bool{false, true} {
+		out := t.TempDir()
+		var exported []ExportedProject
+		opts := ExportOptions{
+			Sort:       sorted,
+			ChunkLinks: 2,
+			Exported:   func(ep ExportedProject) { exported = append(exported, ep) },
+		}
+		if err := ExportBeacon(root, out, opts); err != nil {
+			t.Fatal(err)
+		}
+		want := []ExportedProject{
+			{Project: "bitly", Filename: filepath.Join(out, "bitly.beacon.gz"), Links: 1},
+			{Project: "isgd", Filename: filepath.Join(out, "isgd.beacon.gz"), Links: 4, Duplicates: 1},
+		}
+		if !reflect.DeepEqual(exported, want) {
+			t.Errorf("sort %t: got %+v, want %+v", sorted, exported, want)
+		}
+
+		prefix, links := readExport(t, filepath.Join(out, "isgd.beacon.gz"))
+		if prefix != "https://is.gd/{ID}" {
+			t.Errorf("sort %t: got PREFIX %q", sorted, prefix)
+		}
+		wantLinks := []string{
+			"ab|http://example.com/a",
+			"ab|http://example.com/a2",
+			"bb|http://example.com/b",
+			"cc|http://example.com/c|d",
+		}
+		if !sorted {
+			if sort.StringsAreSorted(links) {
+				t.Errorf("sort %t: links unexpectedly sorted: %q", sorted, links)
+			}
+			sort.Strings(links)
+		}
+		if !reflect.DeepEqual(links, wantLinks) {
+			t.Errorf("sort %t: got links %q, want %q", sorted, links, wantLinks)
+		}
+	}
+}
+
+func readExport(t *testing.T, filename string) (string, []string) {
+	t.Helper()
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := beacon.NewCompressedReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var links []string
+	for {
+		l, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		links = append(links, l.Source+"|"+l.Target)
+	}
+	prefix, _ := r.MetaValue("PREFIX")
+	return prefix, links
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+)
+
+// projectFilter matches the files of releases by shortener project. A
+// nil filter matches every file.
+type projectFilter map[string]struct{}
+
+func newProjectFilter(projects []string) projectFilter {
+	if len(projects) == 0 {
+		return nil
+	}
+	pf := make(projectFilter, len(projects))
+	for _, project := range projects {
+		pf[project] = struct{}{}
+	}
+	return pf
+}
+
+// match reports whether a file, by its slash-separated path in a
+// release, is a project zip for one of the projects.
+func (pf projectFilter) match(name string) bool {
+	if pf == nil {
+		return true
+	}
+	project, ok := zipProject(name)
+	return ok && pf.matchProject(project)
+}
+
+// matchProject reports whether a project is one of the projects.
+func (pf projectFilter) matchProject(project string) bool {
+	if pf == nil {
+		return true
+	}
+	_, ok := pf[project]
+	return ok
+}
+
+// matchAny reports whether any of the files of a release are matched.
+func (pf projectFilter) matchAny(files []ReleaseFile) bool {
+	for _, f := range files {
+		if pf.match(f.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileFilter selects the files of releases to download by project and
+// by DownloadOptions.FileFilter. The zero filter selects every file.
+type fileFilter struct {
+	projects projectFilter
+	fn       func(path string) bool
+}
+
+func newFileFilter(projects []string, fn func(path string) bool) fileFilter {
+	return fileFilter{newProjectFilter(projects), fn}
+}
+
+// all reports whether every file is selected.
+func (ff fileFilter) all() bool {
+	return ff.projects == nil && ff.fn == nil
+}
+
+// match reports whether a file, by its slash-separated path in a
+// release, is selected.
+func (ff fileFilter) match(name string) bool {
+	return ff.projects.match(name) && (ff.fn == nil || ff.fn(name))
+}
+
+// matchAny reports whether any of the files of a release are selected.
+func (ff fileFilter) matchAny(files []ReleaseFile) bool {
+	for _, f := range files {
+		if ff.match(f.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// zipProject returns the project of a project zip in a release, which
+// is named like <project>.<date>.zip.
+func zipProject(name string) (string, bool) {
+	base := path.Base(name)
+	if !strings.HasSuffix(base, ".zip") {
+		return "", false
+	}
+	project, _, ok := strings.Cut(base, ".")
+	return project, ok && project != ""
+}
+
+// dateRange matches release dates at or after from and before to. A
+// zero bound is unbounded.
+type dateRange struct {
+	from, to time.Time
+}
+
+func (r dateRange) unbounded() bool {
+	return r.from.IsZero() && r.to.IsZero()
+}
+
+func (r dateRange) contains(t time.Time) bool {
+	return (r.from.IsZero() || !t.Before(r.from)) && (r.to.IsZero() || t.Before(r.to))
+}
+
+// filterReleases returns the releases with publication dates in r.
+// Releases without a valid date are kept, with a warning.
+func (r dateRange) filterReleases(ctx context.Context, releases []Release) []Release {
+	if r.unbounded() {
+		return releases
+	}
+	var filtered []Release
+	for _, rel := range releases {
+		if rel.PublicDate.IsZero() {
+			loggerFrom(ctx).Warn("including release without date", "id", rel.Identifier)
+		} else if !r.contains(rel.PublicDate) {
+			continue
+		}
+		filtered = append(filtered, rel)
+	}
+	return filtered
+}
+
+// zipDateLayouts are the layouts of the dates in project zip names.
+var zipDateLayouts = []string{"2006-01-02-15-04-05", "20060102T150405Z", "2006-01-02"}
+
+// zipDate returns the date of a project zip in a release, which is
+// named like <project>.<date>.zip, such as
+// bitly.2014-05-07-21-17-02.zip.
+func zipDate(name string) (time.Time, bool) {
+	base := strings.TrimSuffix(path.Base(name), ".zip")
+	_, date, ok := strings.Cut(base, ".")
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range zipDateLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProjectFilter(t *testing.T) {
+	filter := newProjectFilter([]string{"bitly", "isgd"})
+	tests := []struct {
+		Name  string
+		Match bool
+	}{
+		{"bitly.20210101T000000Z.zip", true},
+		{"sub/isgd.2021-01-01.zip", true},
+		{"isgd.zip", true},
+		{"tinyurl.20210101T000000Z.zip", false},
+		{"bitly.20210101T000000Z.txt", false},
+		{"bitly_files.xml", false},
+		{".zip", false},
+	}
+	for i, tt := range tests {
+		if got := filter.match(tt.Name); got != tt.Match {
+			t.Errorf("#%d: match(%q) = %t, want %t", i, tt.Name, got, tt.Match)
+		}
+	}
+	if !newProjectFilter(nil).match("bitly_files.xml") {
+		t.Error("nil filter does not match all files")
+	}
+}
+
+func TestZipDate(t *testing.T) {
+	tests := []struct {
+		Name string
+		Date time.Time
+		OK   bool
+	}{
+		{"bitly.2014-05-07-21-17-02.zip", time.Date(2014, 5, 7, 21, 17, 2, 0, time.UTC), true},
+		{"sub/bitly.20210101T000000Z.zip", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"isgd.2021-01-02.zip", time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), true},
+		{"isgd.zip", time.Time{}, false},
+		{"isgd.latest.zip", time.Time{}, false},
+		{"isgd/1.txt.xz", time.Time{}, false},
+	}
+	for i, tt := range tests {
+		date, ok := zipDate(tt.Name)
+		if !date.Equal(tt.Date) || ok != tt.OK {
+			t.Errorf("#%d: zipDate(%q) = %v, %t, want %v, %t", i, tt.Name, date, ok, tt.Date, tt.OK)
+		}
+	}
+}
+
+func TestDateRangeFilterReleases(t *testing.T) {
+	releases := []Release{
+		{Identifier: "undated"},
+		{Identifier: "2012", PublicDate: time.Date(2012, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{Identifier: "2013", PublicDate: time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Identifier: "2015", PublicDate: time.Date(2015, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{Identifier: "2016", PublicDate: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	tests := []struct {
+		From, To time.Time
+		IDs      []string
+	}{
+		{time.Time{}, time.Time{}, []string{"undated", "2012", "2013", "2015", "2016"}},
+		{time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), []string{"undated", "2013", "2015"}},
+		{time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}, []string{"undated", "2015", "2016"}},
+		{time.Time{}, time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC), []string{"undated", "2012"}},
+	}
+	for i, tt := range tests {
+		got := releaseIDs(dateRange{tt.From, tt.To}.filterReleases(context.Background(), releases))
+		if !reflect.DeepEqual(got, tt.IDs) {
+			t.Errorf("#%d: got %q, want %q", i, got, tt.IDs)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// journalEntry is a line in a processing journal, which records a link
+// dump that has been completely processed. When every dump in a release
+// file has been processed, a line for the whole file is added with
+// Complete set, no Entry, and its size and total link count. A line
+// with Replaced set drops the earlier lines for a file that was replaced
+// at that time, as recorded by SyncReleases.
+type journalEntry struct {
+	File     string     `json:"file"`             // release file, relative to the processed directory
+	Entry    string     `json:"entry,omitempty"`  // dump name within the file
+	Size     int64      `json:"size,omitempty"`   // size of the compressed dump or complete file
+	SHA256   string     `json:"sha256,omitempty"` // hex checksum of the compressed dump
+	Links    int        `json:"links"`
+	Complete bool       `json:"complete,omitempty"` // all dumps in File are processed
+	Empty    bool       `json:"empty,omitempty"`    // File is complete, with dumps, but no links
+	Replaced *time.Time `json:"replaced,omitempty"` // File was replaced
+}
+
+type journalKey struct {
+	file, entry string
+}
+
+// journal is an append-only file of JSON lines, which is synced after
+// each line, so that at most the last line is lost or partial on a
+// crash. Invalid lines are ignored when reading.
+type journal struct {
+	mu       sync.Mutex
+	f        *os.File
+	done     map[journalKey]journalEntry
+	replaced map[string]time.Time // latest replacement of each file
+}
+
+// openJournal opens or creates a journal. With reprocess, the entries
+// already in it are ignored, but new entries are still appended.
+func openJournal(filename string, reprocess bool) (*journal, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	j := &journal{
+		f:        f,
+		done:     make(map[journalKey]journalEntry),
+		replaced: make(map[string]time.Time),
+	}
+	if err := j.read(reprocess); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *journal) read(reprocess bool) error {
+	br := bufio.NewReader(j.f)
+	var last byte = '\n'
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) != 0 {
+			last = line[len(line)-1]
+			var e journalEntry
+			if json.Unmarshal(bytes.TrimSpace(line), &e) == nil {
+				if e.Replaced != nil {
+					j.drop(e.File, *e.Replaced)
+				} else if !reprocess {
+					j.done[journalKey{e.File, e.Entry}] = e
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if last != '\n' {
+		// Terminate a partial line from a crash, so that it does not
+		// join with the next entry.
+		if _, err := j.f.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drop removes the entries of a file that was replaced at t.
+func (j *journal) drop(file string, t time.Time) {
+	for k := range j.done {
+		if k.file == file {
+			delete(j.done, k)
+		}
+	}
+	if t.After(j.replaced[file]) {
+		j.replaced[file] = t
+	}
+}
+
+// invalidate drops the entries of files replaced since they were
+// journaled, given the times they were replaced, and appends a line for
+// each, so that they stay dropped. Replacements already in the journal
+// are ignored.
+func (j *journal) invalidate(replaced map[string]time.Time) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for file, t := range replaced {
+		if !t.After(j.replaced[file]) {
+			continue
+		}
+		if err := j.append(journalEntry{File: file, Replaced: &t}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// has reports whether a dump of the given size has been journaled. It
+// is false for a nil journal.
+func (j *journal) has(file, entry string, size int64) bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e, ok := j.done[journalKey{file, entry}]
+	return ok && e.Size == size
+}
+
+// add appends an entry and syncs the file. It does nothing for a nil
+// journal.
+func (j *journal) add(e journalEntry) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.append(e)
+}
+
+// append writes an entry and syncs the file. j.mu must be held.
+func (j *journal) append(e journalEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := j.f.Write(line); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	if e.Replaced != nil {
+		j.drop(e.File, *e.Replaced)
+	} else {
+		j.done[journalKey{e.File, e.Entry}] = e
+	}
+	return nil
+}
+
+// completed returns the line marking a release file of the given size
+// as completely processed, if any. It is false for a nil journal.
+func (j *journal) completed(file string, size int64) (journalEntry, bool) {
+	if j == nil {
+		return journalEntry{}, false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e, ok := j.done[journalKey{file, ""}]
+	return e, ok && e.Complete && e.Size == size
+}
+
+// complete adds a line marking a release file of the given size as
+// completely processed, with the total links of its journaled dumps.
+func (j *journal) complete(file string, size int64) (journalEntry, error) {
+	e := journalEntry{File: file, Size: size, Complete: true}
+	dumps := 0
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for k, d := range j.done {
+		if k.file == file && k.entry != "" {
+			e.Links += d.Links
+			dumps++
+		}
+	}
+	e.Empty = dumps != 0 && e.Links == 0
+	return e, j.append(e)
+}
+
+func (j *journal) Close() error {
+	return j.f.Close()
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+func TestProcessReleasesJournal(t *testing.T) {
+	root := t.TempDir()
+	release := filepath.Join(root, "urlteam_2021-01-01")
+	writeZip(t, filepath.Join(release, "foo.2021-01-01.zip"), []zipEntry{
+		{"foo.meta.json.xz", `{"name":"foo"}`},
+		{"1.txt.xz", "a|http://example.com/a\nb|http://example.com/b\n"},
+		{"22.txt.xz", "aa|http://example.com/aa\n"},
+	})
+	journalFile := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	errStop := errors.New("stop")
+	run := func(opts ProcessOptions, stopAt string) ([]string, error) {
+		t.Helper()
+		opts.Journal = journalFile
+		var got []string
+		err := ProcessReleasesOptions(context.Background(), root, &opts, func(m *ProjectMeta, release string, l *beacon.Link) error {
+			if l.Source == stopAt {
+				return errStop
+			}
+			got = append(got, l.Source)
+			return nil
+		})
+		sort.Strings(got)
+		return got, err
+	}
+
+	// Interrupt the second dump, so that only the first is journaled.
+	if _, err := run(ProcessOptions{}, "aa"); err != errStop {
+		t.Fatalf("got error %v, want %v", err, errStop)
+	}
+	entries := readJournal(t, journalFile)
+	if len(entries) != 1 || entries[0].File != "urlteam_2021-01-01/foo.2021-01-01.zip" ||
+		entries[0].Entry != "1.txt.xz" || entries[0].Links != 2 || len(entries[0].SHA256) != 64 {
+		t.Fatalf("got journal %+v", entries)
+	}
+
+	// Simulate a crash while writing an entry.
+	f, err := os.OpenFile(journalFile, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"file":"urlteam_2021-01-01/foo.2021-01-01.zip","entry":"22.tx`)
+	f.Close()
+
+	got, err := run(ProcessOptions{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"aa"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resumed: got %q, want %q", got, want)
+	}
+	entries = readJournal(t, journalFile)
+	if len(entries) != 3 || entries[1].Entry != "22.txt.xz" ||
+		!entries[2].Complete || entries[2].Entry != "" || entries[2].Links != 3 {
+		t.Errorf("got journal %+v", entries)
+	}
+
+	got, err = run(ProcessOptions{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("completed: got %q, want none", got)
+	}
+	if n := len(readJournal(t, journalFile)); n != 3 {
+		t.Errorf("completed: got %d journal entries, want 3", n)
+	}
+
+	got, err = run(ProcessOptions{Reprocess: true}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "aa", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reprocessed: got %q, want %q", got, want)
+	}
+}
+
+// readJournal reads the valid entries of a journal.
+func TestJournalInvalidate(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "journal")
+	j, err := openJournal(filename, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []journalEntry{
+		{File: "r/a.zip", Entry: "1.txt.xz", Size: 10, Links: 1},
+		{File: "r/b.zip", Entry: "1.txt.xz", Size: 20, Links: 2},
+	} {
+		if err := j.add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := j.complete("r/a.zip", 100); err != nil {
+		t.Fatal(err)
+	}
+	replaced := map[string]time.Time{"r/a.zip": time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := j.invalidate(replaced); err != nil {
+		t.Fatal(err)
+	}
+	check := func(j *journal, wantA bool) {
+		t.Helper()
+		if got := j.has("r/a.zip", "1.txt.xz", 10); got != wantA {
+			t.Errorf("has a = %t, want %t", got, wantA)
+		}
+		if _, got := j.completed("r/a.zip", 100); got != wantA {
+			t.Errorf("completed a = %t, want %t", got, wantA)
+		}
+		if !j.has("r/b.zip", "1.txt.xz", 20) {
+			t.Error("has b = false, want true")
+		}
+	}
+	check(j, false)
+	// Processing the replaced file again journals it after the
+	// replacement.
+	if err := j.add(journalEntry{File: "r/a.zip", Entry: "1.txt.xz", Size: 10, Links: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.complete("r/a.zip", 100); err != nil {
+		t.Fatal(err)
+	}
+	check(j, true)
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err = openJournal(filename, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	check(j, true)
+	// The same replacement is not applied again.
+	if err := j.invalidate(replaced); err != nil {
+		t.Fatal(err)
+	}
+	check(j, true)
+	if n := len(readJournal(t, filename)); n != 6 {
+		t.Errorf("got %d journal lines, want 6", n)
+	}
+}
+
+func readJournal(t *testing.T, filename string) []journalEntry {
+	t.Helper()
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []journalEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e journalEntry
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
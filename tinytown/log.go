@@ -0,0 +1,52 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// loggerKey is the context key for the logger used by requests made on
+// behalf of a Downloader.
+type loggerKey struct{}
+
+func withLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// loggerFrom returns the logger in ctx or slog.Default().
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// logState logs a change in the state of a release. started is when the
+// release was added.
+func logState(l *slog.Logger, p DownloadProgress, started time.Time) {
+	switch p.State {
+	case StateAdding:
+		l.Info("adding release", "id", p.ID)
+	case StateTorrent:
+		l.Info("downloading via torrent", "id", p.ID, "bytes", p.BytesTotal)
+	case StateHTTP:
+		l.Warn("downloading via HTTP", "id", p.ID, "bytes", p.BytesTotal, "err", p.Err)
+	case StateVerifying:
+		l.Info("verifying release", "id", p.ID, "bytes", p.BytesTotal)
+	case StateDone:
+		l.Info("release done", "id", p.ID, "bytes", p.BytesTotal, "duration", time.Since(started))
+	case StateFailed:
+		l.Error("release failed", "id", p.ID, "bytes", p.BytesTotal, "duration", time.Since(started), "err", p.Err)
+	case StateSkipped:
+		l.Info("skipped release", "id", p.ID)
+	case StateStalled:
+		l.Warn("torrent stalled", "id", p.ID, "bytes", p.BytesTotal, "completed", p.BytesCompleted, "duration", time.Since(started))
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// recordHandler captures log records.
+type recordHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+// messages returns the messages of the records with the given id
+// attribute.
+func (h *recordHandler) messages(id string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var msgs []string
+	for _, r := range h.records {
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == "id" && a.Value.String() == id {
+				msgs = append(msgs, r.Message)
+				return false
+			}
+			return true
+		})
+	}
+	return msgs
+}
+
+func TestDownloaderLog(t *testing.T) {
+	const id = "item"
+	srv := newItemServer(t, id, map[string]string{"a.zip": "aaaa"})
+	defer srv.Close()
+
+	defer func(newConf func() *torrent.ClientConfig) { newClientConfig = newConf }(newClientConfig)
+	newClientConfig = func() *torrent.ClientConfig { return torrent.TestingConfig(t) }
+	var h recordHandler
+	d, err := NewDownloader(DownloadOptions{DataDir: t.TempDir(), Verify: true, Logger: slog.New(&h)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.baseURL = srv.URL
+	d.addAll([]string{id})
+	if err := d.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"adding release", "downloading via HTTP", "verifying release", "release done"}
+	if got := h.messages(id); !reflect.DeepEqual(got, want) {
+		t.Errorf("got messages %q, want %q", got, want)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	done := h.records[len(h.records)-1]
+	var duration bool
+	done.Attrs(func(a slog.Attr) bool {
+		duration = duration || a.Key == "duration" && a.Value.Kind() == slog.KindDuration
+		return true
+	})
+	if !duration {
+		t.Errorf("no duration in %v", done)
+	}
+}
+
+func TestGetRetryLog(t *testing.T) {
+	defer func(r RetryPolicy) { Retry = r }(Retry)
+	Retry = RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	var h recordHandler
+	resp, err := getRetry(withLogger(context.Background(), slog.New(&h)), srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(h.records) != 1 || h.records[0].Message != "retrying request" || h.records[0].Level != slog.LevelWarn {
+		t.Errorf("got records %v, want a retry warning", h.records)
+	}
+}
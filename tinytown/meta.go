@@ -0,0 +1,70 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/andrewarchi/archive"
+	"github.com/andrewarchi/browser/jsonutil"
+)
+
+// ProjectMeta contains the tracker settings for a shortener project,
+// from the *.meta.json.xz file in each project release. Shortcode
+// lengths are not recorded in the metadata and are instead given by the
+// names of the link dumps.
+type ProjectMeta struct {
+	Name              string  `json:"name"`
+	MinVersion        int     `json:"min_version"`        // minimum library version
+	MinClientVersion  int     `json:"min_client_version"` // minimum pipeline version
+	Alphabet          string  `json:"alphabet"`
+	URLTemplate       string  `json:"url_template"`
+	RequestDelay      float64 `json:"request_delay"`     // e.g. 0.5
+	RedirectCodes     []int   `json:"redirect_codes"`    // HTTP codes
+	NoRedirectCodes   []int   `json:"no_redirect_codes"` // HTTP codes
+	UnavailableCodes  []int   `json:"unavailable_codes"` // HTTP codes
+	BannedCodes       []int   `json:"banned_codes"`      // HTTP codes
+	BodyRegex         string  `json:"body_regex"`
+	LocationAntiRegex string  `json:"location_anti_regex"`
+	Method            string  `json:"method"` // HTTP method, e.g. "head"
+	Enabled           bool    `json:"enabled"`
+	Autoqueue         bool    `json:"autoqueue"`
+	NumCountPerItem   int     `json:"num_count_per_item"`
+	MaxNumItems       int     `json:"max_num_items"`
+	LowerSequenceNum  int64   `json:"lower_sequence_num"`
+	AutoreleaseTime   int     `json:"autorelease_time"`
+}
+
+// Meta is the former name of ProjectMeta.
+//
+// Deprecated: Use ProjectMeta.
+type Meta = ProjectMeta
+
+var xzMagic = []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}
+
+// ReadProjectMeta reads project metadata as JSON, either uncompressed or
+// compressed with xz, as in releases.
+func ReadProjectMeta(r io.Reader) (*ProjectMeta, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(xzMagic)); bytes.Equal(magic, xzMagic) {
+		xr, err := archive.NewXZReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer xr.Close()
+		r = xr
+	} else {
+		r = br
+	}
+	var m ProjectMeta
+	if err := jsonutil.Decode(r, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+func TestReadProjectMeta(t *testing.T) {
+	const js = `{"name":"example","alphabet":"0123456789abcdef","url_template":"http://example.com/{shortcode}","method":"head","banned_codes":[420,429],"request_delay":0.5}`
+	want := &ProjectMeta{
+		Name:         "example",
+		Alphabet:     "0123456789abcdef",
+		URLTemplate:  "http://example.com/{shortcode}",
+		Method:       "head",
+		BannedCodes:  []int{420, 429},
+		RequestDelay: 0.5,
+	}
+
+	var xzBuf bytes.Buffer
+	xw, err := xz.NewWriter(&xzBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := xw.Write([]byte(js)); err != nil {
+		t.Fatal(err)
+	}
+	if err := xw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, data := range []string{js, xzBuf.String()} {
+		m, err := ReadProjectMeta(strings.NewReader(data))
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, want) {
+			t.Errorf("#%d: got %+v, want %+v", i, m, want)
+		}
+	}
+}
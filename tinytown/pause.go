@@ -0,0 +1,157 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import "time"
+
+// TimeWindow is a daily window of time in the local time zone, as
+// offsets from midnight, like 18*time.Hour to 8*time.Hour. A window that
+// ends at or before its start spans midnight, so equal Start and End
+// span a whole day.
+type TimeWindow struct {
+	Start, End time.Duration
+	// Weekdays, when non-empty, restricts the window to the days on which
+	// it starts.
+	Weekdays []time.Weekday
+}
+
+// contains reports whether t is within the window.
+func (w TimeWindow) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	// The window may have started the day before and span midnight.
+	for _, day := range []time.Time{midnight, midnight.AddDate(0, 0, -1)} {
+		if !w.on(day.Weekday()) {
+			continue
+		}
+		start, end := day.Add(w.Start), day.Add(w.End)
+		if w.End <= w.Start {
+			end = day.AddDate(0, 0, 1).Add(w.End)
+		}
+		if !t.Before(start) && t.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w TimeWindow) on(day time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range w.Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleAllows reports whether t is within any of the windows of a
+// schedule. An empty schedule allows any time.
+func scheduleAllows(schedule []TimeWindow, t time.Time) bool {
+	if len(schedule) == 0 {
+		return true
+	}
+	t = t.Local()
+	for _, w := range schedule {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleInterval is the interval at which the Schedule option is
+// checked.
+var scheduleInterval = time.Minute
+
+// Pause pauses downloading until Resume is called. Active torrents stop
+// requesting data, but stay in the client with their verified pieces,
+// so they continue from where they left off, and they do not stall
+// while paused. No more releases are started, so Add blocks. Releases
+// that are already downloading over HTTP are finished.
+func (d *Downloader) Pause() {
+	d.setPaused(func() { d.pausedManual = true })
+}
+
+// Resume resumes downloading after Pause. Downloading remains paused
+// while outside of the Schedule option.
+func (d *Downloader) Resume() {
+	d.setPaused(func() { d.pausedManual = false })
+}
+
+// Paused reports whether downloading is paused, by Pause or by the
+// Schedule option.
+func (d *Downloader) Paused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.paused()
+}
+
+// runSchedule pauses and resumes downloading according to the Schedule
+// option until d is closed.
+func (d *Downloader) runSchedule() {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.ctx.Done():
+			return
+		}
+		outside := !scheduleAllows(d.opts.Schedule, time.Now())
+		d.setPaused(func() { d.outsideSchedule = outside })
+	}
+}
+
+// setPaused calls update to set whether downloading is paused manually
+// or by the schedule, with d.mu held, and, when that changes whether it
+// is paused at all, pauses or resumes the torrents.
+func (d *Downloader) setPaused(update func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	was := d.paused()
+	update()
+	if d.closed || d.paused() == was {
+		return
+	}
+	reason := "schedule"
+	if d.pausedManual {
+		reason = "manual"
+	}
+	if d.paused() {
+		d.resumed = make(chan struct{})
+		for _, t := range d.client.Torrents() {
+			t.DisallowDataDownload()
+		}
+		d.log.Info("downloads paused", "reason", reason)
+	} else {
+		close(d.resumed)
+		for _, t := range d.client.Torrents() {
+			t.AllowDataDownload()
+		}
+		d.log.Info("downloads resumed")
+	}
+}
+
+// paused reports whether downloading is paused. d.mu must be held.
+func (d *Downloader) paused() bool {
+	return d.pausedManual || d.outsideSchedule
+}
+
+// waitResumed waits until downloading is not paused.
+func (d *Downloader) waitResumed() error {
+	d.mu.Lock()
+	resumed := d.resumed
+	d.mu.Unlock()
+	select {
+	case <-resumed:
+		return nil
+	case <-d.ctx.Done():
+		return ErrDownloaderClosed
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestScheduleAllows(t *testing.T) {
+	// 2021-03-01 is a Monday.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2021, 3, day, hour, min, 0, 0, time.Local)
+	}
+	evenings := TimeWindow{Start: 18 * time.Hour, End: 8 * time.Hour}
+	weekends := TimeWindow{Weekdays: []time.Weekday{time.Saturday, time.Sunday}}
+	tests := []struct {
+		Schedule []TimeWindow
+		Time     time.Time
+		Allowed  bool
+	}{
+		{nil, at(1, 12, 0), true},
+		{[]TimeWindow{evenings}, at(1, 12, 0), false},
+		{[]TimeWindow{evenings}, at(1, 17, 59), false},
+		{[]TimeWindow{evenings}, at(1, 18, 0), true},
+		{[]TimeWindow{evenings}, at(2, 7, 59), true},
+		{[]TimeWindow{evenings}, at(2, 8, 0), false},
+		{[]TimeWindow{{Start: 9 * time.Hour, End: 17 * time.Hour}}, at(1, 12, 0), true},
+		{[]TimeWindow{{Start: 9 * time.Hour, End: 17 * time.Hour}}, at(1, 17, 0), false},
+		{[]TimeWindow{weekends}, at(6, 12, 0), true},
+		{[]TimeWindow{weekends}, at(8, 0, 0), false},
+		{[]TimeWindow{evenings, weekends}, at(7, 12, 0), true},
+		// Windows continue past midnight into a day that they do not start
+		// on.
+		{[]TimeWindow{{Start: 22 * time.Hour, End: 2 * time.Hour, Weekdays: []time.Weekday{time.Sunday}}}, at(8, 1, 0), true},
+		{[]TimeWindow{{Start: 22 * time.Hour, End: 2 * time.Hour, Weekdays: []time.Weekday{time.Sunday}}}, at(8, 23, 0), false},
+	}
+	for i, tt := range tests {
+		if got := scheduleAllows(tt.Schedule, tt.Time); got != tt.Allowed {
+			t.Errorf("#%d: scheduleAllows(%v) = %t, want %t", i, tt.Time, got, tt.Allowed)
+		}
+	}
+}
+
+func TestDownloaderPause(t *testing.T) {
+	const id = "urlteam_pause"
+	content := bytes.Repeat([]byte("terroroftinytown"), 1<<12)
+
+	seedDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(seedDir, id), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(seedDir, id, "example.zip"), content, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	info := metainfo.Info{PieceLength: 1 << 14}
+	if err := info.BuildFromFilePath(filepath.Join(seedDir, id)); err != nil {
+		t.Fatal(err)
+	}
+	var ranges atomic.Int32
+	srv := newWebseedServer(t, id, info, content, &ranges)
+	defer srv.Close()
+
+	defer func(newConf func() *torrent.ClientConfig) { newClientConfig = newConf }(newClientConfig)
+	newClientConfig = func() *torrent.ClientConfig { return torrent.TestingConfig(t) }
+	// A window that ended an hour ago, so paused from the start.
+	now := time.Now()
+	sinceMidnight := now.Sub(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	window := TimeWindow{Start: (sinceMidnight + 22*time.Hour) % (24 * time.Hour), End: (sinceMidnight + 23*time.Hour) % (24 * time.Hour)}
+	d, err := NewDownloader(DownloadOptions{
+		DataDir:      t.TempDir(),
+		WebseedsOnly: true,
+		Schedule:     []TimeWindow{window},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.baseURL = srv.URL
+	if s := d.Stats(); !s.Paused {
+		t.Fatalf("got stats %+v, want paused outside of schedule", s)
+	}
+
+	added := make(chan error, 1)
+	go func() {
+		_, err := d.Add(id)
+		added <- err
+	}()
+	select {
+	case err := <-added:
+		t.Fatalf("Add returned %v while paused", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Resuming does not override the schedule.
+	d.Resume()
+	if !d.Paused() {
+		t.Fatal("resumed outside of schedule")
+	}
+	d.setPaused(func() { d.outsideSchedule = false })
+	if d.Paused() {
+		t.Fatal("still paused within schedule")
+	}
+	if err := <-added; err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s := d.Stats(); s.Paused || s.Done != 1 {
+		t.Errorf("got stats %+v, want 1 done and not paused", s)
+	}
+
+	d.Pause()
+	if s := d.Stats(); !s.Paused {
+		t.Errorf("got stats %+v, want paused", s)
+	}
+	d.Resume()
+	if d.Paused() {
+		t.Error("still paused after Resume")
+	}
+}
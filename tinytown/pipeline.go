@@ -0,0 +1,159 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+// PipelineOptions configures ProcessReleaseOptions.
+type PipelineOptions struct {
+	// Downloader, when set, downloads the release. Its DataDir must be
+	// the data directory of the call. Otherwise, concurrent calls with
+	// the same data directory share a Downloader with default options
+	// and Verify set, which is closed once none are using it.
+	Downloader *Downloader
+	// Cleanup removes the release directory and its torrent file once
+	// the release has been processed without error.
+	Cleanup bool
+}
+
+// ProcessRelease downloads a single release into dir/<id>, verifies it,
+// and calls fn on every link of its project zips and TinyBack dumps,
+// along with the name of the shortener project, as described by
+// ProcessReleaseOptions.
+func ProcessRelease(ctx context.Context, id, dir string, fn func(project string, l *beacon.Link) error) error {
+	return ProcessReleaseOptions(ctx, id, dir, nil, fn)
+}
+
+// ProcessReleaseOptions downloads a single release into dir/<id> via
+// torrent, with HTTP fallback, verifies it against its archive.org
+// checksums, and calls fn on every link of the project zips and
+// TinyBack dumps selected by the Projects and FileFilter options of the
+// Downloader. Files that cannot be read are downloaded again over HTTP
+// once; those that still cannot be read are reported in a
+// *CorruptFilesError. It is safe for concurrent use with different
+// identifiers and the same data directory, which is the intended use
+// from a queue worker. When ctx is done, it stops and returns ctx.Err().
+// The download itself stops when no other calls are using the shared
+// Downloader.
+func ProcessReleaseOptions(ctx context.Context, id, dir string, opts *PipelineOptions, fn func(project string, l *beacon.Link) error) error {
+	if opts == nil {
+		opts = &PipelineOptions{}
+	}
+	d := opts.Downloader
+	if d == nil {
+		var done func()
+		var err error
+		d, done, err = acquireDownloader(dir)
+		if err != nil {
+			return err
+		}
+		defer done()
+	} else if filepath.Clean(d.opts.DataDir) != filepath.Clean(dir) {
+		return fmt.Errorf("tinytown: downloader data directory %s is not %s", d.opts.DataDir, dir)
+	}
+	ctx = d.opts.context(ctx)
+
+	if err := d.download(ctx, id); err != nil {
+		return err
+	}
+	if !d.opts.Verify {
+		vr, err := verifyRelease(ctx, d.baseURL, dir, id, &VerifyOptions{Projects: d.opts.Projects, FileFilter: d.opts.FileFilter})
+		if err != nil {
+			return err
+		}
+		if len(vr.Missing) != 0 || len(vr.Corrupt) != 0 {
+			return fmt.Errorf("tinytown: %s: %d missing and %d corrupt files", id, len(vr.Missing), len(vr.Corrupt))
+		}
+	}
+
+	itemDir := filepath.Join(dir, id)
+	files, err := findReleaseFiles(itemDir, d.filter.projects)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	jobs := files[:0]
+	for _, rf := range files {
+		if d.filter.match(rf.name) {
+			jobs = append(jobs, rf)
+		}
+	}
+	p := &processState{
+		redownload: func(ctx context.Context, id, name, filename string) error {
+			return redownloadFile(ctx, d.baseURL, id, name, filename)
+		},
+	}
+	err = processAll(ctx, jobs, 1, p, func(m *ProjectMeta, release string, l *beacon.Link) error {
+		return fn(m.Name, l)
+	})
+	if len(p.corrupt) != 0 {
+		err = errors.Join(err, &CorruptFilesError{p.corrupt})
+	}
+	if err != nil || !opts.Cleanup {
+		return err
+	}
+	if err := os.RemoveAll(itemDir); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, id+"_archive.torrent")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// sharedDownloaders are the Downloaders shared by concurrent calls of
+// ProcessReleaseOptions, by data directory.
+var sharedDownloaders struct {
+	sync.Mutex
+	m map[string]*sharedDownloader
+}
+
+type sharedDownloader struct {
+	d    *Downloader
+	refs int
+}
+
+// acquireDownloader returns the shared Downloader for a data directory,
+// starting it if needed, and a function to release it, which closes it
+// once it is no longer used.
+func acquireDownloader(dir string) (*Downloader, func(), error) {
+	key, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	sharedDownloaders.Lock()
+	defer sharedDownloaders.Unlock()
+	sd, ok := sharedDownloaders.m[key]
+	if !ok {
+		d, err := NewDownloader(DownloadOptions{DataDir: dir, Verify: true})
+		if err != nil {
+			return nil, nil, err
+		}
+		if sharedDownloaders.m == nil {
+			sharedDownloaders.m = make(map[string]*sharedDownloader)
+		}
+		sd = &sharedDownloader{d: d}
+		sharedDownloaders.m[key] = sd
+	}
+	sd.refs++
+	return sd.d, func() {
+		sharedDownloaders.Lock()
+		defer sharedDownloaders.Unlock()
+		if sd.refs--; sd.refs == 0 {
+			delete(sharedDownloaders.m, key)
+			sd.d.Close()
+		}
+	}, nil
+}
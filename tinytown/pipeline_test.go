@@ -0,0 +1,101 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+func TestProcessRelease(t *testing.T) {
+	// Releases without torrents are downloaded over HTTP.
+	ids := []string{"urlteam_2021-01-01", "urlteam_2021-02-01"}
+	seedDir := t.TempDir()
+	mux := http.NewServeMux()
+	for i, id := range ids {
+		name := "foo." + id[len("urlteam_"):] + ".zip"
+		filename := filepath.Join(seedDir, id, name)
+		writeZip(t, filename, []zipEntry{
+			{"foo.meta.json.xz", `{"name":"foo"}`},
+			{"1.txt.xz", string(rune('a'+i)) + "|http://example.com/" + id + "\n"},
+		})
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := newItemServer(t, id, map[string]string{name: string(content)})
+		defer srv.Close()
+		mux.Handle("/download/"+id+"/", srv.Config.Handler)
+		mux.Handle("/metadata/"+id, srv.Config.Handler)
+	}
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	defer func(baseURL string) { BaseURL = baseURL }(BaseURL)
+	BaseURL = srv.URL
+	defer func(newConf func() *torrent.ClientConfig) { newClientConfig = newConf }(newClientConfig)
+	newClientConfig = func() *torrent.ClientConfig { return torrent.TestingConfig(t) }
+
+	dir := t.TempDir()
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		links []string
+		errs  = make([]error, len(ids))
+	)
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = ProcessReleaseOptions(context.Background(), id, dir, &PipelineOptions{Cleanup: i == 0}, func(project string, l *beacon.Link) error {
+				mu.Lock()
+				defer mu.Unlock()
+				links = append(links, project+" "+l.Source+" "+l.Target)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+		}
+	}
+	sort.Strings(links)
+	want := []string{
+		"foo a http://example.com/urlteam_2021-01-01",
+		"foo b http://example.com/urlteam_2021-02-01",
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got links %q, want %q", links, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ids[0])); !os.IsNotExist(err) {
+		t.Errorf("release %s not cleaned up: %v", ids[0], err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ids[1], "foo.2021-02-01.zip")); err != nil {
+		t.Errorf("release %s removed without Cleanup: %v", ids[1], err)
+	}
+	if n := len(sharedDownloaders.m); n != 0 {
+		t.Errorf("got %d shared downloaders after returning, want none", n)
+	}
+
+	err := ProcessRelease(context.Background(), "urlteam_missing", dir, func(string, *beacon.Link) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "urlteam_missing") {
+		t.Errorf("got error %v for missing release", err)
+	}
+}
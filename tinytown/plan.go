@@ -0,0 +1,120 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// DownloadPlan is what DownloadReleases would download with the same
+// options.
+type DownloadPlan struct {
+	Releases []ReleasePlan // releases with selected files
+
+	Files           int // selected files
+	FilesPresent    int // selected files already in the data directory
+	BytesToDownload int64
+	BytesPresent    int64
+}
+
+// ReleasePlan is the part of a DownloadPlan for a single release.
+type ReleasePlan struct {
+	Identifier      string
+	Files           int
+	FilesPresent    int
+	BytesToDownload int64
+	BytesPresent    int64
+}
+
+// Plan reports what DownloadReleases would download with opts, without
+// starting the torrent client.
+func Plan(opts DownloadOptions) (*DownloadPlan, error) {
+	return PlanContext(context.Background(), opts)
+}
+
+// PlanContext reports what DownloadReleases would download with opts,
+// without starting the torrent client. Release files are listed with
+// the archive.org metadata API and filtered by Projects and FileFilter.
+// A file is counted as present when it exists in the data directory
+// with the listed size; since torrent storage preallocates files, it may
+// still be incomplete.
+func PlanContext(ctx context.Context, opts DownloadOptions) (*DownloadPlan, error) {
+	return plan(opts.context(ctx), BaseURL, opts)
+}
+
+func plan(ctx context.Context, baseURL string, opts DownloadOptions) (*DownloadPlan, error) {
+	releases, err := scrapeReleases(ctx, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	releases = dateRange{opts.From, opts.To}.filterReleases(ctx, releases)
+	if err := getReleaseFiles(ctx, baseURL, releases); err != nil {
+		return nil, err
+	}
+	filter := newFileFilter(opts.Projects, opts.FileFilter)
+	var p DownloadPlan
+	for _, r := range releases {
+		rp := ReleasePlan{Identifier: r.Identifier}
+		for _, f := range r.Files {
+			if f.Name == r.Identifier+"_archive.torrent" || !filter.match(f.Name) {
+				continue
+			}
+			rp.Files++
+			filename := filepath.Join(opts.DataDir, r.Identifier, filepath.FromSlash(f.Name))
+			if fi, err := os.Stat(filename); err == nil && fi.Mode().IsRegular() && fi.Size() == f.Size {
+				rp.FilesPresent++
+				rp.BytesPresent += f.Size
+			} else {
+				rp.BytesToDownload += f.Size
+			}
+		}
+		if rp.Files == 0 {
+			continue
+		}
+		p.Releases = append(p.Releases, rp)
+		p.Files += rp.Files
+		p.FilesPresent += rp.FilesPresent
+		p.BytesToDownload += rp.BytesToDownload
+		p.BytesPresent += rp.BytesPresent
+	}
+	return &p, nil
+}
+
+// String formats the plan as a table with a row for each release and
+// a row of totals.
+func (p *DownloadPlan) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprint(w, "Release\tFiles\tPresent\tTo download\tPresent size\n")
+	for _, r := range p.Releases {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", r.Identifier, r.Files, r.FilesPresent,
+			formatBytes(r.BytesToDownload), formatBytes(r.BytesPresent))
+	}
+	fmt.Fprintf(w, "Total (%d releases)\t%d\t%d\t%s\t%s\n", len(p.Releases), p.Files, p.FilesPresent,
+		formatBytes(p.BytesToDownload), formatBytes(p.BytesPresent))
+	w.Flush()
+	return b.String()
+}
+
+// formatBytes formats a byte count with a binary unit prefix.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
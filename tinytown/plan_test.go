@@ -0,0 +1,103 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/services/search/v1/scrape":
+			w.Write([]byte(`{"items":[
+				{"identifier":"a","publicdate":"2015-07-29T07:11:17Z"},
+				{"identifier":"b","publicdate":"2016-01-01T12:00:00Z"}
+			],"count":2,"total":2}`))
+		case "/metadata/a":
+			w.Write([]byte(`{"files":[
+				{"name":"foo.2015-07-29.zip","size":"4"},
+				{"name":"bar.2015-07-29.zip","size":"8"},
+				{"name":"a_archive.torrent","size":"1"}
+			]}`))
+		case "/metadata/b":
+			w.Write([]byte(`{"files":[{"name":"bar.2016-01-01.zip","size":"16"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	writeFiles(t, filepath.Join(dir, "a"), map[string]string{
+		"foo.2015-07-29.zip": "foo!",
+		"bar.2015-07-29.zip": "short",
+	})
+
+	p, err := plan(context.Background(), srv.URL, DownloadOptions{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DownloadPlan{
+		Releases: []ReleasePlan{
+			{Identifier: "a", Files: 2, FilesPresent: 1, BytesToDownload: 8, BytesPresent: 4},
+			{Identifier: "b", Files: 1, BytesToDownload: 16},
+		},
+		Files:           3,
+		FilesPresent:    1,
+		BytesToDownload: 24,
+		BytesPresent:    4,
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+
+	p, err = plan(context.Background(), srv.URL, DownloadOptions{DataDir: dir, Projects: []string{"foo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = &DownloadPlan{
+		Releases:     []ReleasePlan{{Identifier: "a", Files: 1, FilesPresent: 1, BytesPresent: 4}},
+		Files:        1,
+		FilesPresent: 1,
+		BytesPresent: 4,
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+	const wantString = "" +
+		"Release             Files  Present  To download  Present size\n" +
+		"a                   1      1        0 B          4 B\n" +
+		"Total (1 releases)  1      1        0 B          4 B\n"
+	if s := p.String(); s != wantString {
+		t.Errorf("got table\n%s\nwant\n%s", s, wantString)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		N    int64
+		Want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 30, "5.0 GiB"},
+		{2 << 40, "2.0 TiB"},
+	}
+	for i, tt := range tests {
+		if got := formatBytes(tt.N); got != tt.Want {
+			t.Errorf("#%d: formatBytes(%d) = %q, want %q", i, tt.N, got, tt.Want)
+		}
+	}
+}
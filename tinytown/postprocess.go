@@ -0,0 +1,107 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// PostProcess is an action taken on a release file by
+// ProcessReleasesOptions once the journal records it as completely
+// processed. The zero value is Keep.
+type PostProcess struct {
+	action    postAction
+	zstdLevel int
+}
+
+type postAction uint8
+
+const (
+	postKeep postAction = iota
+	postDelete
+	postRecompress
+)
+
+var (
+	// Keep leaves release files as they are.
+	Keep = PostProcess{}
+	// Delete removes release files.
+	Delete = PostProcess{action: postDelete}
+)
+
+// RecompressZstd replaces release files with copies compressed with zstd
+// at the given level, as in the zstd command, named with a .zst suffix.
+// The original is only removed once the copy has been synced to disk.
+func RecompressZstd(level int) PostProcess {
+	return PostProcess{action: postRecompress, zstdLevel: level}
+}
+
+// apply applies the action to a release file, which has been completed
+// in the journal with e. Files without links are only changed when the
+// journal explicitly marks them as empty.
+func (p PostProcess) apply(filename string, e journalEntry) error {
+	if p.action == postKeep || !e.Complete || (e.Links == 0 && !e.Empty) {
+		return nil
+	}
+	switch p.action {
+	case postDelete:
+		return os.Remove(filename)
+	case postRecompress:
+		if err := recompressZstd(filename, p.zstdLevel); err != nil {
+			return fmt.Errorf("tinytown: recompress %s: %w", filename, err)
+		}
+		return os.Remove(filename)
+	}
+	return nil
+}
+
+// recompressZstd writes a zstd-compressed copy of filename to
+// filename.zst. The copy is written to filename.zst.part, synced, and
+// renamed, so that a complete filename.zst implies a durable copy.
+func recompressZstd(filename string, level int) error {
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	part := filename + ".zst.part"
+	dst, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	if err := writeZstd(dst, src, level); err != nil {
+		dst.Close()
+		os.Remove(part)
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		os.Remove(part)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(part)
+		return err
+	}
+	return os.Rename(part, filename+".zst")
+}
+
+func writeZstd(w io.Writer, r io.Reader, level int) error {
+	zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, r); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
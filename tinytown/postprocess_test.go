@@ -0,0 +1,96 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andrewarchi/urlhero/beacon"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestProcessReleasesPostProcess(t *testing.T) {
+	tests := []struct {
+		post     PostProcess
+		wantOrig []bool // whether each zip remains
+		wantZstd []bool // whether each zip has a .zst copy
+	}{
+		{Keep, []bool{true, true, true}, []bool{false, false, false}},
+		{Delete, []bool{false, false, true}, []bool{false, false, false}},
+		{RecompressZstd(3), []bool{false, false, true}, []bool{true, true, false}},
+	}
+	names := []string{"links.2021-01-01.zip", "empty.2021-01-01.zip", "nodumps.2021-01-01.zip"}
+	for i, tt := range tests {
+		root := t.TempDir()
+		release := filepath.Join(root, "urlteam_2021-01-01")
+		writeZip(t, filepath.Join(release, names[0]), []zipEntry{
+			{"links.meta.json.xz", `{"name":"links"}`},
+			{"1.txt.xz", "a|http://example.com/a\n"},
+		})
+		writeZip(t, filepath.Join(release, names[1]), []zipEntry{
+			{"empty.meta.json.xz", `{"name":"empty"}`},
+			{"1.txt.xz", ""},
+		})
+		// Without dumps, a zip is not marked as empty, so it is kept.
+		writeZip(t, filepath.Join(release, names[2]), []zipEntry{
+			{"nodumps.meta.json.xz", `{"name":"nodumps"}`},
+		})
+		orig, err := os.ReadFile(filepath.Join(release, names[0]))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opts := &ProcessOptions{Journal: filepath.Join(t.TempDir(), "journal"), PostProcess: tt.post}
+		err = ProcessReleasesOptions(context.Background(), root, opts, func(m *ProjectMeta, release string, l *beacon.Link) error {
+			return nil
+		})
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		for k, name := range names {
+			filename := filepath.Join(release, name)
+			if _, err := os.Stat(filename); (err == nil) != tt.wantOrig[k] {
+				t.Errorf("#%d: %s exists: %t, want %t", i, name, err == nil, tt.wantOrig[k])
+			}
+			if _, err := os.Stat(filename + ".zst"); (err == nil) != tt.wantZstd[k] {
+				t.Errorf("#%d: %s.zst exists: %t, want %t", i, name, err == nil, tt.wantZstd[k])
+			}
+		}
+		if tt.wantZstd[0] {
+			compressed, err := os.ReadFile(filepath.Join(release, names[0]+".zst"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			zr, err := zstd.NewReader(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := zr.DecodeAll(compressed, nil)
+			zr.Close()
+			if err != nil {
+				t.Errorf("#%d: %v", i, err)
+			} else if !bytes.Equal(got, orig) {
+				t.Errorf("#%d: recompressed zip differs from original", i)
+			}
+		}
+	}
+}
+
+func TestProcessReleasesPostProcessJournal(t *testing.T) {
+	opts := &ProcessOptions{PostProcess: Delete}
+	err := ProcessReleasesOptions(context.Background(), t.TempDir(), opts, func(m *ProjectMeta, release string, l *beacon.Link) error {
+		return nil
+	})
+	if err == nil {
+		t.Error("got nil error for PostProcess without Journal")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// DownloadState is the state of a release download.
+type DownloadState uint8
+
+// Download states, in the order that a release passes through them.
+const (
+	StateAdding    DownloadState = iota // fetching the torrent file
+	StateTorrent                        // downloading via torrent
+	StateHTTP                           // downloading via HTTP
+	StateVerifying                      // checking checksums
+	StateDone                           // complete
+	StateFailed                         // failed via both torrent and HTTP
+	StateSkipped                        // contains none of the projects
+	StateStalled                        // torrent stalled without HTTP fallback
+)
+
+var downloadStateNames = [...]string{
+	StateAdding:    "adding",
+	StateTorrent:   "torrent",
+	StateHTTP:      "HTTP",
+	StateVerifying: "verifying",
+	StateDone:      "done",
+	StateFailed:    "failed",
+	StateSkipped:   "skipped",
+	StateStalled:   "stalled",
+}
+
+func (s DownloadState) String() string {
+	if int(s) < len(downloadStateNames) {
+		return downloadStateNames[s]
+	}
+	return fmt.Sprintf("DownloadState(%d)", s)
+}
+
+// DefaultProgressInterval is the default interval between progress
+// samples of a torrent.
+const DefaultProgressInterval = 5 * time.Second
+
+// DownloadProgress is a progress update for a release.
+type DownloadProgress struct {
+	ID             string
+	State          DownloadState
+	BytesCompleted int64
+	BytesTotal     int64 // 0 when unknown
+	Peers          int   // active torrent peers
+	// Err is the error for StateFailed and StateStalled or, for
+	// StateHTTP, the reason that the torrent was abandoned or that files
+	// are re-downloaded after verifying.
+	Err error
+}
+
+// DownloadStats is an aggregate snapshot of the releases added to a
+// Downloader, as of their latest progress samples.
+type DownloadStats struct {
+	Active         int // releases adding or downloading
+	Done           int
+	Failed         int
+	Skipped        int
+	Stalled        int
+	BytesCompleted int64
+	BytesTotal     int64
+	Peers          int
+	Paused         bool // by Pause or the Schedule option
+}
+
+// Stats returns an aggregate snapshot of the releases added to d.
+func (d *Downloader) Stats() DownloadStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := DownloadStats{Paused: d.paused()}
+	for _, p := range d.progress {
+		switch p.State {
+		case StateDone:
+			s.Done++
+		case StateFailed:
+			s.Failed++
+		case StateSkipped:
+			s.Skipped++
+		case StateStalled:
+			s.Stalled++
+		default:
+			s.Active++
+		}
+		s.BytesCompleted += p.BytesCompleted
+		s.BytesTotal += p.BytesTotal
+		s.Peers += p.Peers
+	}
+	return s
+}
+
+// report records the progress of a release, logs changes in its state,
+// and passes it to the Progress option.
+func (d *Downloader) report(p DownloadProgress) {
+	d.mu.Lock()
+	prev, ok := d.progress[p.ID]
+	d.progress[p.ID] = p
+	if p.State == StateAdding {
+		d.started[p.ID] = time.Now()
+	}
+	started := d.started[p.ID]
+	if p.State >= StateDone { // final
+		for _, ch := range d.watchers[p.ID] {
+			select {
+			case ch <- p:
+			default:
+			}
+		}
+	}
+	d.mu.Unlock()
+	if !ok || prev.State != p.State {
+		logState(d.log, p, started)
+	}
+	if d.opts.Progress != nil {
+		d.opts.Progress(p)
+	}
+}
+
+// torrentProgress samples the progress of the files of a torrent
+// matched by filter.
+func torrentProgress(id string, state DownloadState, t *torrent.Torrent, filter fileFilter) DownloadProgress {
+	completed, total := selectedBytes(t, filter)
+	return DownloadProgress{
+		ID:             id,
+		State:          state,
+		BytesCompleted: completed,
+		BytesTotal:     total,
+		Peers:          t.Stats().ActivePeers,
+	}
+}
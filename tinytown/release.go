@@ -0,0 +1,172 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andrewarchi/browser/jsonutil"
+)
+
+// Release is an incremental terroroftinytown release on the Internet
+// Archive.
+type Release struct {
+	Identifier string
+	Title      string
+	PublicDate time.Time
+	AddedDate  time.Time // when the item was last added to; may be zero
+	ItemSize   int64     // total size of the item in bytes
+	Files      []ReleaseFile
+}
+
+// ReleaseFile is a file in a release, from the archive.org metadata API.
+type ReleaseFile struct {
+	Name  string       `json:"name"` // relative to the item root
+	Size  int64        `json:"size,string"`
+	MD5   jsonutil.Hex `json:"md5"`
+	MTime int64        `json:"mtime,string,omitempty"` // Unix time of the last upload, if listed
+}
+
+// metadataWorkers is the number of concurrent metadata API requests.
+const metadataWorkers = 8
+
+// GetReleases queries the Internet Archive for all incremental
+// terroroftinytown releases and their files, sorted by publication date
+// ascending.
+func GetReleases() ([]Release, error) {
+	return GetReleasesContext(context.Background())
+}
+
+// GetReleasesContext queries the Internet Archive for all incremental
+// terroroftinytown releases and their files, sorted by publication date
+// ascending. File listings are requested from the metadata API for each
+// release.
+func GetReleasesContext(ctx context.Context) ([]Release, error) {
+	releases, err := scrapeReleases(ctx, BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := getReleaseFiles(ctx, BaseURL, releases); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// Scrape API queries for releases of each generation.
+const (
+	releaseQuery         = "subject:terroroftinytown"
+	tinybackReleaseQuery = "identifier:URLTeamTorrentRelease*"
+)
+
+// scrapeReleases queries the scrape API for all releases, without their
+// files, sorted by publication date ascending.
+func scrapeReleases(ctx context.Context, baseURL string) ([]Release, error) {
+	return scrapeQuery(ctx, baseURL, releaseQuery)
+}
+
+// releaseFields are the scrape API fields of a Release.
+var releaseFields = []string{"identifier", "title", "publicdate", "addeddate", "item_size"}
+
+// scrapeQuery queries the scrape API for the items matching a query,
+// without their files, sorted by publication date ascending.
+func scrapeQuery(ctx context.Context, baseURL, query string) ([]Release, error) {
+	var releases []Release
+	err := scrapeSearch(ctx, baseURL, query, releaseFields, func(item ScrapeItem) error {
+		var fields struct {
+			Identifier string `json:"identifier"`
+			Title      string `json:"title"`
+			PublicDate string `json:"publicdate"` // e.g. "2015-07-29T07:11:17Z"
+			AddedDate  string `json:"addeddate"`
+			ItemSize   int64  `json:"item_size"`
+		}
+		if err := item.Decode(&fields); err != nil {
+			return err
+		}
+		date, err := time.Parse(time.RFC3339, fields.PublicDate)
+		if err != nil {
+			// Releases without a date sort first and are kept by date
+			// filters.
+			loggerFrom(ctx).Warn("invalid release date", "id", fields.Identifier, "err", err)
+		}
+		var added time.Time
+		if fields.AddedDate != "" {
+			added, err = time.Parse(time.RFC3339, fields.AddedDate)
+			if err != nil {
+				return fmt.Errorf("tinytown: release %s: %w", fields.Identifier, err)
+			}
+		}
+		releases = append(releases, Release{
+			Identifier: fields.Identifier,
+			Title:      fields.Title,
+			PublicDate: date,
+			AddedDate:  added,
+			ItemSize:   fields.ItemSize,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].PublicDate.Before(releases[j].PublicDate)
+	})
+	return releases, nil
+}
+
+// getReleaseFiles fills in the files of each release.
+func getReleaseFiles(ctx context.Context, baseURL string, releases []Release) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	sem := make(chan struct{}, metadataWorkers)
+	for i := range releases {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			files, err := getItemFiles(ctx, baseURL, releases[i].Identifier)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				return
+			}
+			releases[i].Files = files
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.Join(errs...)
+}
+
+func getItemFiles(ctx context.Context, baseURL, id string) ([]ReleaseFile, error) {
+	resp, err := httpGet(ctx, baseURL+"/metadata/"+id)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var item struct {
+		Files []ReleaseFile `json:"files"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		return nil, err
+	}
+	if len(item.Files) == 0 {
+		return nil, fmt.Errorf("tinytown: no files listed for item %s", id)
+	}
+	return item.Files, nil
+}
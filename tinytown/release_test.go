@@ -0,0 +1,141 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetReleases(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/services/search/v1/scrape":
+			w.Write([]byte(`{"items":[
+				{"identifier":"urlteam_2016-01-01","title":"B","publicdate":"2016-01-01T12:00:00Z","addeddate":"2016-01-02T00:00:00Z","item_size":200},
+				{"identifier":"urlteam_2015-07-29","title":"A","publicdate":"2015-07-29T07:11:17Z","item_size":100}
+			],"count":2,"total":2}`))
+		case "/metadata/urlteam_2015-07-29":
+			w.Write([]byte(`{"created":1,"files":[{"name":"a.zip","size":"100","md5":"00ff","source":"original"}]}`))
+		case "/metadata/urlteam_2016-01-01":
+			w.Write([]byte(`{"files":[{"name":"b.zip","size":"150"},{"name":"b_files.xml"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	releases, err := scrapeReleases(ctx, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := getReleaseFiles(ctx, srv.URL, releases); err != nil {
+		t.Fatal(err)
+	}
+	want := []Release{{
+		Identifier: "urlteam_2015-07-29",
+		Title:      "A",
+		PublicDate: time.Date(2015, 7, 29, 7, 11, 17, 0, time.UTC),
+		ItemSize:   100,
+		Files:      []ReleaseFile{{Name: "a.zip", Size: 100, MD5: []byte{0x00, 0xff}}},
+	}, {
+		Identifier: "urlteam_2016-01-01",
+		Title:      "B",
+		PublicDate: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC),
+		AddedDate:  time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC),
+		ItemSize:   200,
+		Files:      []ReleaseFile{{Name: "b.zip", Size: 150}, {Name: "b_files.xml"}},
+	}}
+	if !reflect.DeepEqual(releases, want) {
+		t.Errorf("got %+v, want %+v", releases, want)
+	}
+}
+
+func TestGetReleaseIDsPaging(t *testing.T) {
+	pages := map[string]string{
+		"":       `{"items":[{"identifier":"c","publicdate":"2017-01-01T00:00:00Z"},{"identifier":"a","publicdate":"2015-01-01T00:00:00Z"}],"count":2,"total":3,"cursor":"page 2"}`,
+		"page 2": `{"items":[{"identifier":"b","publicdate":"2016-01-01T00:00:00Z"}],"count":1,"total":3}`,
+	}
+	var cursors []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/search/v1/scrape" || r.URL.Query().Get("q") != releaseQuery {
+			http.NotFound(w, r)
+			return
+		}
+		cursor := r.URL.Query().Get("cursor")
+		cursors = append(cursors, cursor)
+		w.Write([]byte(pages[cursor]))
+	}))
+	defer srv.Close()
+	defer func(u string, c *http.Client) { BaseURL, HTTPClient = u, c }(BaseURL, HTTPClient)
+	BaseURL, HTTPClient = srv.URL, srv.Client()
+
+	ids, err := GetReleaseIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got %q, want %q", ids, want)
+	}
+	if want := []string{"", "page 2"}; !reflect.DeepEqual(cursors, want) {
+		t.Errorf("requested cursors %q, want %q", cursors, want)
+	}
+
+	// A page missing from the total is an error.
+	pages["page 2"] = `{"items":[],"count":0,"total":3}`
+	if _, err := GetReleaseIDs(); err == nil {
+		t.Error("got nil error for incomplete results")
+	}
+}
+
+func TestScrapeReleasesError(t *testing.T) {
+	defer func(r RetryPolicy) { Retry = r }(Retry)
+	Retry = RetryPolicy{MaxAttempts: 1}
+	tests := []struct {
+		Status int
+		Body   string
+		Err    *ScrapeError
+	}{
+		{http.StatusBadRequest,
+			`{"error":"Could not parse query: subject:(terroroftinytown","errorType":"InvalidQuery","forensics":{"q":"subject:(terroroftinytown"}}`,
+			&ScrapeError{http.StatusBadRequest, "InvalidQuery", "Could not parse query: subject:(terroroftinytown"}},
+		{http.StatusTooManyRequests,
+			`{"error":"Too many requests; slow down","errorType":"RateLimitExceeded"}`,
+			&ScrapeError{http.StatusTooManyRequests, "RateLimitExceeded", "Too many requests; slow down"}},
+		{http.StatusOK,
+			`{"error":"search engine unavailable"}`,
+			&ScrapeError{http.StatusOK, "", "search engine unavailable"}},
+		{http.StatusOK, `{"items":[],"count":0,"total":0}`, nil},
+		{http.StatusOK, `{"items":[],"count":0}`, nil},
+	}
+	for i, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.Status)
+			w.Write([]byte(tt.Body))
+		}))
+		releases, err := scrapeReleases(context.Background(), srv.URL)
+		srv.Close()
+		if tt.Err == nil {
+			if err != nil || len(releases) != 0 {
+				t.Errorf("#%d: got %v, %v, want empty result", i, releases, err)
+			}
+			continue
+		}
+		var scrapeErr *ScrapeError
+		if !errors.As(err, &scrapeErr) {
+			t.Errorf("#%d: got error %v, want ScrapeError", i, err)
+		} else if !reflect.DeepEqual(scrapeErr, tt.Err) {
+			t.Errorf("#%d: got %+v, want %+v", i, scrapeErr, tt.Err)
+		}
+	}
+}
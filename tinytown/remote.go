@@ -0,0 +1,256 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andrewarchi/archive"
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+// Block sizes for range requests. Sequential reads double the block
+// size up to the maximum, so that streaming a dump takes few requests,
+// while scattered reads of zip directories stay small.
+const (
+	minRemoteBlock = 64 << 10
+	maxRemoteBlock = 8 << 20
+)
+
+// RemoteRelease is a release on archive.org, whose project zips are
+// read with HTTP range requests instead of being downloaded.
+type RemoteRelease struct {
+	ID    string
+	Files []ReleaseFile // all files in the item
+
+	ctx     context.Context
+	baseURL string
+
+	mu   sync.Mutex
+	zips map[string]*zip.Reader
+}
+
+// OpenRemoteRelease lists the files of a release with the archive.org
+// metadata API. Zip central directories are fetched when first needed.
+// ctx is used for all requests made by the release.
+func OpenRemoteRelease(ctx context.Context, id string) (*RemoteRelease, error) {
+	return openRemoteRelease(ctx, BaseURL, id)
+}
+
+func openRemoteRelease(ctx context.Context, baseURL, id string) (*RemoteRelease, error) {
+	files, err := getItemFiles(ctx, baseURL, id)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteRelease{
+		ID:      id,
+		Files:   files,
+		ctx:     ctx,
+		baseURL: baseURL,
+		zips:    make(map[string]*zip.Reader),
+	}, nil
+}
+
+// Zips returns the names of the project zips in the release.
+func (r *RemoteRelease) Zips() []string {
+	var names []string
+	for _, f := range r.Files {
+		if _, ok := zipProject(f.Name); ok {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// Entries returns the entries of a project zip, fetching its central
+// directory.
+func (r *RemoteRelease) Entries(zipName string) ([]*zip.File, error) {
+	zr, err := r.openZip(zipName)
+	if err != nil {
+		return nil, err
+	}
+	return zr.File, nil
+}
+
+// OpenEntry opens an entry in a project zip. Its bytes are streamed with
+// range requests as they are read.
+func (r *RemoteRelease) OpenEntry(zipName, name string) (io.ReadCloser, error) {
+	zr, err := r.openZip(zipName)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if f.Name == name {
+			return f.Open()
+		}
+	}
+	return nil, fmt.Errorf("tinytown: %s/%s: no entry %s", r.ID, zipName, name)
+}
+
+func (r *RemoteRelease) openZip(zipName string) (*zip.Reader, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if zr, ok := r.zips[zipName]; ok {
+		return zr, nil
+	}
+	var size int64 = -1
+	for _, f := range r.Files {
+		if f.Name == zipName {
+			size = f.Size
+			break
+		}
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("tinytown: %s: no file %s", r.ID, zipName)
+	}
+	ra := &httpReaderAt{
+		ctx: r.ctx,
+		url: r.baseURL + "/download/" + r.ID + "/" + (&url.URL{Path: zipName}).EscapedPath(),
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("tinytown: %s/%s: %w", r.ID, zipName, err)
+	}
+	r.zips[zipName] = zr
+	return zr, nil
+}
+
+// GrepRemote looks up a shortcode in the project zip of a release on
+// archive.org, reading only the link dump for its length with range
+// requests. It returns nil when the shortcode is not in the release.
+func GrepRemote(ctx context.Context, id, project, shortcode string) (*beacon.Link, error) {
+	r, err := OpenRemoteRelease(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return r.Grep(project, shortcode)
+}
+
+// Grep looks up a shortcode in the project zip for a project, reading
+// only the link dump for its length. It returns nil when the shortcode
+// is not in the release.
+func (r *RemoteRelease) Grep(project, shortcode string) (*beacon.Link, error) {
+	for _, zipName := range r.Zips() {
+		if p, _ := zipProject(zipName); p != project {
+			continue
+		}
+		entries, err := r.Entries(zipName)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range entries {
+			if !strings.HasSuffix(f.Name, ".txt.xz") ||
+				len(path.Base(f.Name))-len(".txt.xz") != len(shortcode) {
+				continue
+			}
+			l, err := grepDump(f, shortcode)
+			if l != nil || err != nil {
+				return l, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+func grepDump(f *zip.File, shortcode string) (*beacon.Link, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	xr, err := archive.NewXZReader(rc)
+	if err != nil {
+		return nil, err
+	}
+	defer xr.Close()
+	br := beacon.NewURLTeamReader(xr, len(shortcode))
+	for {
+		l, err := br.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if l.Source == shortcode {
+			return l, nil
+		}
+	}
+}
+
+// httpReaderAt reads a remote file with range requests. The most
+// recently fetched block is cached.
+type httpReaderAt struct {
+	ctx context.Context
+	url string
+
+	mu        sync.Mutex
+	block     []byte
+	blockOff  int64
+	blockSize int
+}
+
+func (h *httpReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= h.blockOff && pos < h.blockOff+int64(len(h.block)) {
+			n += copy(p[n:], h.block[pos-h.blockOff:])
+			continue
+		}
+		if err := h.fetch(pos, len(p)-n); err != nil {
+			return n, err
+		}
+		if len(h.block) == 0 {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
+
+// fetch fetches the block at off, which is at least want bytes, unless
+// the file ends sooner.
+func (h *httpReaderAt) fetch(off int64, want int) error {
+	switch {
+	case h.block != nil && off == h.blockOff+int64(len(h.block)):
+		h.blockSize = min(2*h.blockSize, maxRemoteBlock)
+	default:
+		h.blockSize = minRemoteBlock
+	}
+	size := max(h.blockSize, want)
+	header := http.Header{"Range": {"bytes=" + strconv.FormatInt(off, 10) + "-" + strconv.FormatInt(off+int64(size)-1, 10)}}
+	resp, err := getRetry(h.ctx, h.url, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		h.block, h.blockOff = h.block[:0], off
+		return nil
+	default:
+		return fmt.Errorf("tinytown: range request: http status %s", resp.Status)
+	}
+	block, err := io.ReadAll(io.LimitReader(resp.Body, int64(size)))
+	if err != nil {
+		return err
+	}
+	h.block, h.blockOff = block, off
+	return nil
+}
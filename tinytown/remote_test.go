@@ -0,0 +1,108 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+func TestRemoteRelease(t *testing.T) {
+	// Random targets keep the large dump from compressing well.
+	rng := rand.New(rand.NewPCG(1, 2))
+	var large strings.Builder
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&large, "%06d|http://example.com/%016x\n", i, rng.Uint64())
+	}
+	filename := filepath.Join(t.TempDir(), "isgd.2021-01-01.zip")
+	writeZip(t, filename, []zipEntry{
+		{"isgd.meta.json.xz", `{"name":"isgd"}`},
+		{"isgd/12.txt.xz", "ab|http://example.com/ab\ncd|http://example.com/cd\n"},
+		{"isgd/123456.txt.xz", large.String()},
+	})
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests, transferred atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata/release":
+			fmt.Fprintf(w, `{"files":[{"name":"isgd.2021-01-01.zip","size":"%d"},{"name":"release_files.xml"}]}`, len(content))
+		case "/download/release/isgd.2021-01-01.zip":
+			requests.Add(1)
+			cw := &countingWriter{ResponseWriter: w}
+			http.ServeContent(cw, r, "", time.Time{}, bytes.NewReader(content))
+			transferred.Add(cw.n)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	r, err := openRemoteRelease(context.Background(), srv.URL, "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.Zips(), []string{"isgd.2021-01-01.zip"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got zips %q, want %q", got, want)
+	}
+	l, err := r.Grep("isgd", "cd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&beacon.Link{Source: "cd", Target: "http://example.com/cd"}); !reflect.DeepEqual(l, want) {
+		t.Errorf("got %v, want %v", l, want)
+	}
+	if n := transferred.Load(); n >= int64(len(content)) {
+		t.Errorf("transferred %d bytes of %d", n, len(content))
+	}
+
+	l, err = r.Grep("isgd", "099999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l == nil || l.Source != "099999" {
+		t.Errorf("got %v, want 099999", l)
+	}
+	for _, code := range []string{"zz", "1234567"} {
+		if l, err := r.Grep("isgd", code); l != nil || err != nil {
+			t.Errorf("%s: got %v, %v, want not found", code, l, err)
+		}
+	}
+	if l, err := r.Grep("tinyurl", "ab"); l != nil || err != nil {
+		t.Errorf("got %v, %v for other project, want not found", l, err)
+	}
+	if n := requests.Load(); n > 10 {
+		t.Errorf("made %d range requests", n)
+	}
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures how HTTP requests are retried on 429 and 5xx
+// responses and network errors. Only GET requests are made, so all
+// requests are safe to retry.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	// Requests are not retried when it is <=1.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry, which doubles with
+	// each attempt up to MaxBackoff. Delays are randomly jittered down to
+	// half. A longer Retry-After from the server takes precedence.
+	MinBackoff, MaxBackoff time.Duration
+}
+
+// Retry is the retry policy for all HTTP requests made by this package.
+var Retry = RetryPolicy{
+	MaxAttempts: 5,
+	MinBackoff:  time.Second,
+	MaxBackoff:  time.Minute,
+}
+
+// backoff returns the jittered delay after the given failed attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// getRetry sends a GET request with the given header, retrying
+// according to Retry. Responses with statuses other than 429 and 5xx
+// are returned for the caller to check. When retries are exhausted, the
+// error includes the number of attempts.
+func getRetry(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	policy := Retry
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := httpClientFrom(ctx).Do(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var wait time.Duration
+		if err == nil {
+			wait = retryAfter(resp.Header.Get("Retry-After"))
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			err = &statusError{resp.Status, resp.StatusCode, body}
+		}
+		if attempt >= policy.MaxAttempts {
+			if attempt == 1 {
+				return nil, fmt.Errorf("tinytown: GET %s: %w", url, err)
+			}
+			return nil, fmt.Errorf("tinytown: GET %s: giving up after %d attempts: %w", url, attempt, err)
+		}
+		if d := policy.backoff(attempt); d > wait {
+			wait = d
+		}
+		loggerFrom(ctx).Warn("retrying request", "url", url, "attempt", attempt, "wait", wait, "err", err)
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// statusError is an unexpected response status, such as a retryable
+// status after retries are exhausted.
+type statusError struct {
+	Status     string
+	StatusCode int
+	Body       []byte // start of the response body
+}
+
+func (err *statusError) Error() string {
+	return "http status " + err.Status
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryAfter parses a Retry-After header as either delay seconds or an
+// HTTP date.
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
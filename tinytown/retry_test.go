@@ -0,0 +1,79 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetRetry(t *testing.T) {
+	defer func(r RetryPolicy) { Retry = r }(Retry)
+	Retry = RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond}
+
+	tests := []struct {
+		Statuses []int // status of each attempt
+		Attempts int
+		Err      string
+	}{
+		{[]int{200}, 1, ""},
+		{[]int{503, 429, 200}, 3, ""},
+		{[]int{404}, 1, ""},
+		{[]int{500, 502, 503, 200}, 3, "giving up after 3 attempts: http status 503"},
+	}
+	for i, tt := range tests {
+		attempts := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			status := tt.Statuses[attempts]
+			attempts++
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+			w.WriteHeader(status)
+			io.WriteString(w, "body")
+		}))
+		resp, err := getRetry(context.Background(), srv.URL, nil)
+		srv.Close()
+		if attempts != tt.Attempts {
+			t.Errorf("#%d: made %d attempts, want %d", i, attempts, tt.Attempts)
+		}
+		if tt.Err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.Err) {
+				t.Errorf("#%d: got error %v, want %q", i, err, tt.Err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if want := tt.Statuses[len(tt.Statuses)-1]; resp.StatusCode != want {
+			t.Errorf("#%d: got status %d, want %d", i, resp.StatusCode, want)
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if d := retryAfter("120"); d != 2*time.Minute {
+		t.Errorf("got %v, want 2m", d)
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if d := retryAfter(date); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("got %v, want about 1h", d)
+	}
+	for _, header := range []string{"", "-1", "soon", "Mon, 02 Jan 2006 15:04:05 GMT"} {
+		if d := retryAfter(header); d != 0 {
+			t.Errorf("%q: got %v, want 0", header, d)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+
+	"github.com/andrewarchi/browser/jsonutil"
+)
+
+// scrapePageSize is the number of items requested per page, which is
+// the maximum allowed by the scrape API.
+const scrapePageSize = 10000
+
+// ScrapeItem is an item in the results of the scrape API, as a JSON
+// object with the requested fields.
+type ScrapeItem json.RawMessage
+
+// UnmarshalJSON sets the item to a copy of data.
+func (item *ScrapeItem) UnmarshalJSON(data []byte) error {
+	*item = append((*item)[:0], data...)
+	return nil
+}
+
+// Decode decodes the fields of the item into v, requiring fields to
+// match strictly.
+func (item ScrapeItem) Decode(v any) error {
+	return jsonutil.Decode(bytes.NewReader(item), v)
+}
+
+// ScrapeError is an error payload returned by the archive.org scrape
+// API, such as for an invalid query or rate limiting.
+type ScrapeError struct {
+	StatusCode int    // HTTP status code
+	Type       string // errorType, if any
+	Message    string
+}
+
+func (err *ScrapeError) Error() string {
+	if err.Type != "" {
+		return fmt.Sprintf("tinytown: scrape API: %s: %s", err.Type, err.Message)
+	}
+	return "tinytown: scrape API: " + err.Message
+}
+
+// ScrapeSearch queries the archive.org scrape API for the items matching
+// a query, such as "collection:urlteam", and calls fn on each, with the
+// given fields. When fields is empty, items only have an identifier.
+// Results are requested in pages, following the cursor of each page,
+// and requests are retried according to Retry, which waits as long as
+// requested when rate limited. Error payloads are returned as
+// *ScrapeError. Iteration stops at the first error returned by fn,
+// which is returned as is.
+func ScrapeSearch(ctx context.Context, query string, fields []string, fn func(ScrapeItem) error) error {
+	return scrapeSearch(ctx, BaseURL, query, fields, fn)
+}
+
+func scrapeSearch(ctx context.Context, baseURL, query string, fields []string, fn func(ScrapeItem) error) error {
+	n := 0
+	cursor := ""
+	for {
+		page, err := scrapePage(ctx, baseURL, query, fields, cursor)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			if err := fn(item); err != nil {
+				return err
+			}
+			n++
+		}
+		if page.Cursor == "" {
+			if page.Total != 0 && n != page.Total {
+				return fmt.Errorf("tinytown: scraped %d of %d items", n, page.Total)
+			}
+			return nil
+		}
+		cursor = page.Cursor
+	}
+}
+
+// scrapeResponse is a page of results from the scrape API. Cursor is
+// set when there are more pages.
+type scrapeResponse struct {
+	Items  []ScrapeItem `json:"items"`
+	Count  int          `json:"count"`
+	Total  int          `json:"total"`
+	Cursor string       `json:"cursor"`
+}
+
+// scrapePage requests the page of results at cursor, which is empty for
+// the first page.
+func scrapePage(ctx context.Context, baseURL, query string, fields []string, cursor string) (*scrapeResponse, error) {
+	url := baseURL + "/services/search/v1/scrape?q=" + neturl.QueryEscape(query)
+	if len(fields) != 0 {
+		url += "&fields=" + neturl.QueryEscape(strings.Join(fields, ","))
+	}
+	url += fmt.Sprintf("&count=%d", scrapePageSize)
+	if cursor != "" {
+		url += "&cursor=" + neturl.QueryEscape(cursor)
+	}
+	resp, err := getRetry(ctx, url, nil)
+	if err != nil {
+		// Rate limiting errors are returned once retries are exhausted.
+		var statusErr *statusError
+		if errors.As(err, &statusErr) {
+			if scrapeErr := decodeScrapeError(statusErr.StatusCode, statusErr.Body); scrapeErr != nil {
+				return nil, scrapeErr
+			}
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if scrapeErr := decodeScrapeError(resp.StatusCode, body); scrapeErr != nil {
+		return nil, scrapeErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tinytown: http status %s", resp.Status)
+	}
+	var page scrapeResponse
+	if err := jsonutil.Decode(bytes.NewReader(body), &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// decodeScrapeError decodes an error payload from the scrape API, if
+// body is one. It is checked before strictly decoding items, because
+// the fields of error payloads vary.
+func decodeScrapeError(statusCode int, body []byte) *ScrapeError {
+	var payload struct {
+		Error     string `json:"error"`
+		ErrorType string `json:"errorType"`
+	}
+	if json.Unmarshal(body, &payload) != nil || payload.Error == "" {
+		return nil
+	}
+	return &ScrapeError{
+		StatusCode: statusCode,
+		Type:       payload.ErrorType,
+		Message:    payload.Error,
+	}
+}
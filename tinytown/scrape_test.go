@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestScrapeSearch(t *testing.T) {
+	pages := map[string]string{
+		"":   `{"items":[{"identifier":"a","title":"A"},{"identifier":"b","title":"B"}],"count":2,"total":5,"cursor":"c2"}`,
+		"c2": `{"items":[{"identifier":"c","title":"C"},{"identifier":"d","title":"D"}],"count":2,"total":5,"cursor":"c3"}`,
+		"c3": `{"items":[{"identifier":"e","title":"E"}],"count":1,"total":5}`,
+	}
+	var cursors []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/services/search/v1/scrape" || q.Get("q") != "collection:urlteam" || q.Get("fields") != "identifier,title" {
+			http.NotFound(w, r)
+			return
+		}
+		cursor := q.Get("cursor")
+		cursors = append(cursors, cursor)
+		w.Write([]byte(pages[cursor]))
+	}))
+	defer srv.Close()
+
+	type item struct {
+		Identifier string `json:"identifier"`
+		Title      string `json:"title"`
+	}
+	var items []item
+	err := scrapeSearch(context.Background(), srv.URL, "collection:urlteam", []string{"identifier", "title"}, func(si ScrapeItem) error {
+		var it item
+		if err := si.Decode(&it); err != nil {
+			return err
+		}
+		items = append(items, it)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []item{{"a", "A"}, {"b", "B"}, {"c", "C"}, {"d", "D"}, {"e", "E"}}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got %v, want %v", items, want)
+	}
+	if want := []string{"", "c2", "c3"}; !reflect.DeepEqual(cursors, want) {
+		t.Errorf("requested cursors %q, want %q", cursors, want)
+	}
+
+	// An error from fn stops iteration without requesting more pages.
+	errStop := errors.New("stop")
+	cursors, items = nil, nil
+	err = scrapeSearch(context.Background(), srv.URL, "collection:urlteam", []string{"identifier", "title"}, func(si ScrapeItem) error {
+		var it item
+		if err := si.Decode(&it); err != nil {
+			return err
+		}
+		if it.Identifier == "c" {
+			return errStop
+		}
+		items = append(items, it)
+		return nil
+	})
+	if err != errStop {
+		t.Errorf("got error %v, want %v", err, errStop)
+	}
+	if want := []item{{"a", "A"}, {"b", "B"}}; !reflect.DeepEqual(items, want) {
+		t.Errorf("got %v, want %v", items, want)
+	}
+	if want := []string{"", "c2"}; !reflect.DeepEqual(cursors, want) {
+		t.Errorf("requested cursors %q, want %q", cursors, want)
+	}
+
+	// Unrequested fields are an error when decoding strictly.
+	err = scrapeSearch(context.Background(), srv.URL, "collection:urlteam", []string{"identifier", "title"}, func(si ScrapeItem) error {
+		var it struct {
+			Identifier string `json:"identifier"`
+		}
+		return si.Decode(&it)
+	})
+	if err == nil {
+		t.Error("got nil error for unknown field")
+	}
+}
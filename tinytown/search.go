@@ -7,7 +7,6 @@
 package tinytown
 
 import (
-	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -44,9 +43,8 @@ func SearchReleases(root, shortener string, shortcodes []string) ([]*beacon.Link
 			filename := filepath.Join(dir, name)
 			// TODO only search link dumps with shortcode length in the set of
 			// lengths being searched for.
-			fn := func(l *beacon.Link, m *Meta, shortcodeLen int, releaseFilename, dumpFilename string) error {
+			fn := func(l *beacon.Link, m *ProjectMeta, shortcodeLen int, releaseFilename, dumpFilename string) error {
 				if _, ok := shortcodeMap[l.Source]; ok {
-					fmt.Printf("%s|%q\n", l.Source, l.Target)
 					links = append(links, l)
 				}
 				return nil
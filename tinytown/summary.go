@@ -0,0 +1,177 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+// SummaryFile is the name of the file in the processed directory to
+// which ProcessReleasesOptions writes per-project statistics.
+const SummaryFile = "summary.json"
+
+// ProjectSummary is statistics of the links processed for a shortener
+// project, keyed in a summary by the project name from its file names.
+type ProjectSummary struct {
+	Links           int64  `json:"links"`
+	Shortcodes      int64  `json:"shortcodes"` // distinct shortcodes
+	MinShortcodeLen int    `json:"min_shortcode_len"`
+	MaxShortcodeLen int    `json:"max_shortcode_len"`
+	FirstRelease    string `json:"first_release"` // by name, which is chronological for terroroftinytown releases
+	LastRelease     string `json:"last_release"`
+	Bytes           int64  `json:"bytes"` // size of the processed project zips and TinyBack dumps
+}
+
+// merge adds the statistics of s2 to s. Distinct shortcodes are summed,
+// since the shortcodes themselves are not kept, so a shortcode that is
+// found again in a later run is counted twice.
+func (s *ProjectSummary) merge(s2 *ProjectSummary) {
+	s.Links += s2.Links
+	s.Shortcodes += s2.Shortcodes
+	if s.MinShortcodeLen == 0 || (s2.MinShortcodeLen != 0 && s2.MinShortcodeLen < s.MinShortcodeLen) {
+		s.MinShortcodeLen = s2.MinShortcodeLen
+	}
+	s.MaxShortcodeLen = max(s.MaxShortcodeLen, s2.MaxShortcodeLen)
+	if s.FirstRelease == "" || (s2.FirstRelease != "" && s2.FirstRelease < s.FirstRelease) {
+		s.FirstRelease = s2.FirstRelease
+	}
+	s.LastRelease = max(s.LastRelease, s2.LastRelease)
+	s.Bytes += s2.Bytes
+}
+
+// ReadSummary reads the per-project statistics written to
+// dir/SummaryFile by ProcessReleasesOptions.
+func ReadSummary(dir string) (map[string]ProjectSummary, error) {
+	data, err := os.ReadFile(filepath.Join(dir, SummaryFile))
+	if err != nil {
+		return nil, err
+	}
+	var summary map[string]ProjectSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// summarizer accumulates statistics of the files that are completely
+// processed. Shortcodes are kept in memory to count distinct ones.
+type summarizer struct {
+	mu         sync.Mutex
+	projects   map[string]*ProjectSummary
+	shortcodes map[string]map[string]struct{}
+}
+
+func newSummarizer() *summarizer {
+	return &summarizer{
+		projects:   make(map[string]*ProjectSummary),
+		shortcodes: make(map[string]map[string]struct{}),
+	}
+}
+
+// fileSummary is the statistics of a single file, which are added to
+// the summary only once it is completely processed.
+type fileSummary struct {
+	project    string
+	summary    ProjectSummary
+	shortcodes map[string]struct{}
+}
+
+func newFileSummary(project, release string, size int64) *fileSummary {
+	return &fileSummary{
+		project:    project,
+		summary:    ProjectSummary{FirstRelease: release, LastRelease: release, Bytes: size},
+		shortcodes: make(map[string]struct{}),
+	}
+}
+
+func (fs *fileSummary) add(l *beacon.Link) {
+	s := &fs.summary
+	s.Links++
+	fs.shortcodes[l.Source] = struct{}{}
+	if n := len(l.Source); s.MinShortcodeLen == 0 || n < s.MinShortcodeLen {
+		s.MinShortcodeLen = n
+	}
+	s.MaxShortcodeLen = max(s.MaxShortcodeLen, len(l.Source))
+}
+
+// add adds a completely processed file. It does nothing for a nil
+// summarizer.
+func (s *summarizer) add(fs *fileSummary) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := s.shortcodes[fs.project]
+	if seen == nil {
+		seen = make(map[string]struct{})
+		s.shortcodes[fs.project] = seen
+	}
+	fs.summary.Shortcodes = 0
+	for code := range fs.shortcodes {
+		if _, ok := seen[code]; !ok {
+			seen[code] = struct{}{}
+			fs.summary.Shortcodes++
+		}
+	}
+	ps := s.projects[fs.project]
+	if ps == nil {
+		ps = &ProjectSummary{}
+		s.projects[fs.project] = ps
+	}
+	ps.merge(&fs.summary)
+}
+
+// write writes the summary to dir/SummaryFile, merged with the existing
+// summary when incremental. The file is replaced atomically.
+func (s *summarizer) write(dir string, incremental bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := make(map[string]*ProjectSummary, len(s.projects))
+	if incremental {
+		// A missing or corrupt summary is replaced.
+		if prev, err := ReadSummary(dir); err == nil {
+			for project, ps := range prev {
+				summary[project] = &ps
+			}
+		}
+	}
+	for project, ps := range s.projects {
+		if prev, ok := summary[project]; ok {
+			prev.merge(ps)
+		} else {
+			summary[project] = ps
+		}
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, SummaryFile+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), filepath.Join(dir, SummaryFile)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
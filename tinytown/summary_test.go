@@ -0,0 +1,102 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+func TestProcessReleasesSummary(t *testing.T) {
+	root := t.TempDir()
+	writeZip(t, filepath.Join(root, "urlteam_2021-01-01", "foo.2021-01-01.zip"), []zipEntry{
+		{"foo.meta.json.xz", `{"name":"foo"}`},
+		{"1.txt.xz", "a|http://example.com/a\nb|http://example.com/b\n"},
+		{"333.txt.xz", "abc|http://example.com/abc\n"},
+	})
+	writeZip(t, filepath.Join(root, "urlteam_2021-02-01", "foo.2021-02-01.zip"), []zipEntry{
+		{"foo.meta.json.xz", `{"name":"foo"}`},
+		{"1.txt.xz", "a|http://example.com/a\n"},
+	})
+	writeZip(t, filepath.Join(root, "urlteam_2021-02-01", "bar.2021-02-01.zip"), []zipEntry{
+		{"bar.meta.json.xz", `{"name":"bar"}`},
+		{"22.txt.xz", "xy|http://example.com/xy\n"},
+	})
+	size := func(release, name string) int64 {
+		fi, err := os.Stat(filepath.Join(root, release, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Size()
+	}
+	fooBytes := size("urlteam_2021-01-01", "foo.2021-01-01.zip") + size("urlteam_2021-02-01", "foo.2021-02-01.zip")
+	barBytes := size("urlteam_2021-02-01", "bar.2021-02-01.zip")
+	process := func(opts *ProcessOptions) {
+		t.Helper()
+		opts.Summary = true
+		err := ProcessReleasesOptions(context.Background(), root, opts, func(m *ProjectMeta, release string, l *beacon.Link) error {
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	journal := filepath.Join(t.TempDir(), "journal")
+	process(&ProcessOptions{Journal: journal, Projects: []string{"foo"}})
+	got, err := ReadSummary(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foo := ProjectSummary{
+		Links:           4,
+		Shortcodes:      3,
+		MinShortcodeLen: 1,
+		MaxShortcodeLen: 3,
+		FirstRelease:    "urlteam_2021-01-01",
+		LastRelease:     "urlteam_2021-02-01",
+		Bytes:           fooBytes,
+	}
+	if want := map[string]ProjectSummary{"foo": foo}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// An incremental run merges new projects and keeps skipped ones.
+	process(&ProcessOptions{Journal: journal})
+	got, err = ReadSummary(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bar := ProjectSummary{
+		Links:           1,
+		Shortcodes:      1,
+		MinShortcodeLen: 2,
+		MaxShortcodeLen: 2,
+		FirstRelease:    "urlteam_2021-02-01",
+		LastRelease:     "urlteam_2021-02-01",
+		Bytes:           barBytes,
+	}
+	want := map[string]ProjectSummary{"foo": foo, "bar": bar}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("incremental: got %+v, want %+v", got, want)
+	}
+
+	// Without a journal, the summary is replaced.
+	process(&ProcessOptions{})
+	got, err = ReadSummary(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("full: got %+v, want %+v", got, want)
+	}
+}
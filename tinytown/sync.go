@@ -0,0 +1,297 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SyncStateFile is the name of the file in the data directory in which
+// SyncReleases records the releases that it has downloaded.
+const SyncStateFile = ".tinytown-sync.json"
+
+// syncState is the persisted state of SyncReleases.
+type syncState struct {
+	LastRun  time.Time                `json:"last_run"`
+	Releases map[string]syncedRelease `json:"releases"`
+	// Replaced records the files of completed releases that were
+	// replaced on archive.org and fetched again, by their path in the
+	// data directory, with when they were fetched. Processing journals
+	// drop their entries for these files.
+	Replaced map[string]time.Time `json:"replaced,omitempty"`
+}
+
+// syncedRelease is a release completed by SyncReleases.
+type syncedRelease struct {
+	ItemSize int64         `json:"item_size"`
+	Files    []ReleaseFile `json:"files"`
+}
+
+// SyncReleases downloads the terroroftinytown releases that are new
+// since the last sync into dir.
+func SyncReleases(dir string, opts DownloadOptions) error {
+	return SyncReleasesContext(context.Background(), dir, opts)
+}
+
+// SyncReleasesContext downloads terroroftinytown releases into dir with
+// a Downloader, like DownloadReleases, but skips releases completed by
+// a previous sync, unless they have been added to since its last run.
+// Completed releases, with their file sizes and checksums, are recorded
+// in dir/SyncStateFile, which is replaced atomically as each release
+// completes. The files of completed releases are listed again and those
+// that were replaced or added on archive.org, by their size, checksum,
+// or modification time, are fetched over HTTP. Replaced files are
+// recorded, so that the journals of ProcessReleasesOptions drop their
+// entries for them and they are processed again. When ctx is done, the
+// downloads are stopped as with Downloader.Close and the state of the
+// completed releases is saved before returning ctx.Err(). When the
+// state is missing or corrupt, every release is checked. The DataDir
+// option is ignored. Disk space is checked as with DownloadReleases.
+func SyncReleasesContext(ctx context.Context, dir string, opts DownloadOptions) error {
+	return syncReleases(ctx, BaseURL, dir, opts)
+}
+
+func syncReleases(ctx context.Context, baseURL, dir string, opts DownloadOptions) error {
+	ctx = opts.context(ctx)
+	start := time.Now()
+	s := &syncer{dir: dir, state: readSyncState(dir)}
+	releases, err := scrapeReleases(ctx, baseURL)
+	if err != nil {
+		return err
+	}
+	releases = dateRange{opts.From, opts.To}.filterReleases(ctx, releases)
+	var pending, completed []Release
+	for _, r := range releases {
+		if _, ok := s.state.Releases[r.Identifier]; ok {
+			if !r.AddedDate.After(s.state.LastRun) {
+				completed = append(completed, r)
+				continue
+			}
+			delete(s.state.Releases, r.Identifier)
+		}
+		pending = append(pending, r)
+	}
+	if err := getReleaseFiles(ctx, baseURL, pending); err != nil {
+		return err
+	}
+	if err := getReleaseFiles(ctx, baseURL, completed); err != nil {
+		return err
+	}
+	filter := newFileFilter(opts.Projects, opts.FileFilter)
+	var changed []changedRelease
+	for _, r := range completed {
+		if files := s.changedFiles(r, filter); len(files) != 0 {
+			changed = append(changed, changedRelease{r, files})
+		}
+	}
+	if !opts.IgnoreDiskSpace {
+		required := requiredSpace(dir, pending, filter)
+		for _, c := range changed {
+			required += requiredSpace(dir, []Release{{Identifier: c.Identifier, Files: c.files}}, filter)
+		}
+		if err := checkDiskSpace(dir, required); err != nil {
+			return err
+		}
+	}
+	var fetchErrs []error
+	for _, c := range changed {
+		if err := s.refetch(ctx, baseURL, c); err != nil {
+			fetchErrs = append(fetchErrs, err)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	s.pending = make(map[string]*Release, len(pending))
+	ids := make([]string, len(pending))
+	for i := range pending {
+		s.pending[pending[i].Identifier] = &pending[i]
+		ids[i] = pending[i].Identifier
+	}
+
+	opts.DataDir = dir
+	progress := opts.Progress
+	opts.Progress = func(p DownloadProgress) {
+		if p.State == StateDone {
+			s.complete(p.ID)
+		}
+		if progress != nil {
+			progress(p)
+		}
+	}
+	d, err := NewDownloader(opts)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	d.baseURL = baseURL
+	stop := context.AfterFunc(ctx, func() { d.Close() })
+	defer stop()
+
+	d.addAll(ids)
+	err = d.Wait(ctx)
+	if ctx.Err() != nil {
+		// Stop the downloads, so that no more releases complete, and save
+		// those that did, without advancing the last run.
+		d.Close()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := errors.Join(s.err, s.save()); err != nil {
+			return errors.Join(ctx.Err(), err)
+		}
+		return ctx.Err()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.LastRun = start
+	return errors.Join(err, errors.Join(fetchErrs...), s.err, s.save())
+}
+
+// syncer records releases in the sync state as they complete.
+type syncer struct {
+	dir     string
+	pending map[string]*Release
+
+	mu    sync.Mutex
+	state *syncState
+	err   error // first error saving the state
+}
+
+func (s *syncer) complete(id string) {
+	r, ok := s.pending[id]
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Releases[id] = syncedRelease{ItemSize: r.ItemSize, Files: r.Files}
+	if err := s.save(); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// changedRelease is a completed release with files that were replaced
+// or added since it was synced.
+type changedRelease struct {
+	Release
+	files []ReleaseFile
+}
+
+// changedFiles returns the files of a completed release, as listed now,
+// that differ from those recorded when it was synced or are new. A file
+// with the same size and checksum is unchanged, even when its
+// modification time differs. Files without a checksum are compared by
+// size and modification time, when listed.
+func (s *syncer) changedFiles(r Release, filter fileFilter) []ReleaseFile {
+	synced := make(map[string]ReleaseFile)
+	for _, f := range s.state.Releases[r.Identifier].Files {
+		synced[f.Name] = f
+	}
+	var changed []ReleaseFile
+	for _, f := range r.Files {
+		if f.Name == r.Identifier+"_archive.torrent" || !filter.match(f.Name) {
+			continue
+		}
+		old, ok := synced[f.Name]
+		if ok && old.Size == f.Size {
+			if len(f.MD5) != 0 && bytes.Equal(old.MD5, f.MD5) {
+				continue
+			}
+			if len(f.MD5) == 0 && (old.MTime == 0 || f.MTime == 0 || old.MTime == f.MTime) {
+				continue
+			}
+		}
+		changed = append(changed, f)
+	}
+	return changed
+}
+
+// refetch fetches the changed files of a completed release over HTTP,
+// then records the release with its files as listed now. Files that
+// were in the release before are recorded as replaced.
+func (s *syncer) refetch(ctx context.Context, baseURL string, c changedRelease) error {
+	s.mu.Lock()
+	old := s.state.Releases[c.Identifier].Files
+	s.mu.Unlock()
+	for _, f := range c.files {
+		replaced := slices.ContainsFunc(old, func(o ReleaseFile) bool { return o.Name == f.Name })
+		if replaced {
+			loggerFrom(ctx).Warn("fetching replaced release file", "id", c.Identifier, "file", f.Name)
+		} else {
+			loggerFrom(ctx).Info("fetching added release file", "id", c.Identifier, "file", f.Name)
+		}
+		filename := filepath.Join(s.dir, c.Identifier, filepath.FromSlash(f.Name))
+		if err := fetchFile(ctx, baseURL, c.Identifier, f, filename); err != nil {
+			return err
+		}
+		if replaced {
+			s.mu.Lock()
+			s.state.Replaced[c.Identifier+"/"+f.Name] = time.Now().UTC()
+			err := s.save()
+			s.mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Releases[c.Identifier] = syncedRelease{ItemSize: c.ItemSize, Files: c.Files}
+	return s.save()
+}
+
+// save atomically replaces the state file by writing to a temporary file
+// and renaming it.
+func (s *syncer) save() error {
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, SyncStateFile+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), filepath.Join(s.dir, SyncStateFile)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// readSyncState reads the state file in dir. A missing or corrupt state
+// is treated as empty, so that every release is checked.
+func readSyncState(dir string) *syncState {
+	var state syncState
+	data, err := os.ReadFile(filepath.Join(dir, SyncStateFile))
+	if err != nil || json.Unmarshal(data, &state) != nil {
+		state = syncState{}
+	}
+	if state.Releases == nil {
+		state.Releases = make(map[string]syncedRelease)
+	}
+	if state.Replaced == nil {
+		state.Replaced = make(map[string]time.Time)
+	}
+	return &state
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+func TestSyncReleases(t *testing.T) {
+	files := map[string]string{"a": "aaaa", "b": "bbbb"}
+	added := map[string]string{"a": "2015-07-29T07:11:17Z", "b": "2016-01-01T12:00:00Z"}
+	var (
+		mu      sync.Mutex
+		queried []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/services/search/v1/scrape" {
+			fmt.Fprintf(w, `{"items":[
+				{"identifier":"a","publicdate":"2015-07-29T07:11:17Z","addeddate":%q},
+				{"identifier":"b","publicdate":"2016-01-01T12:00:00Z","addeddate":%q}
+			],"count":2,"total":2}`, added["a"], added["b"])
+			return
+		}
+		if id := strings.TrimPrefix(r.URL.Path, "/metadata/"); id != r.URL.Path {
+			var listed []string
+			for name, content := range files {
+				if strings.HasPrefix(name, id) {
+					listed = append(listed, fmt.Sprintf(`{"name":"%s.zip","size":"%d","md5":"%x"}`, name, len(content), md5.Sum([]byte(content))))
+				}
+			}
+			fmt.Fprintf(w, `{"files":[%s]}`, strings.Join(listed, ","))
+			return
+		}
+		if id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/download/"), "_archive.torrent"); ok {
+			queried = append(queried, path.Base(id))
+			http.NotFound(w, r)
+			return
+		}
+		for name, content := range files {
+			if r.URL.Path == "/download/"+name[:1]+"/"+name+".zip" {
+				w.Write([]byte(content))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	defer func(newConf func() *torrent.ClientConfig) { newClientConfig = newConf }(newClientConfig)
+	newClientConfig = func() *torrent.ClientConfig { return torrent.TestingConfig(t) }
+	dir := t.TempDir()
+	run := func(want ...string) {
+		t.Helper()
+		mu.Lock()
+		queried = nil
+		mu.Unlock()
+		if err := syncReleases(context.Background(), srv.URL, dir, DownloadOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		// The torrent of each synced release is requested, possibly more
+		// than once, and then it is downloaded over HTTP.
+		sort.Strings(queried)
+		var got []string
+		for i, id := range queried {
+			if i == 0 || queried[i-1] != id {
+				got = append(got, id)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("synced %q, want %q", got, want)
+		}
+	}
+
+	run("a", "b")
+	for id, content := range files {
+		got, err := os.ReadFile(filepath.Join(dir, id, id+".zip"))
+		if err != nil {
+			t.Error(err)
+		} else if string(got) != content {
+			t.Errorf("%s: got %q, want %q", id, got, content)
+		}
+	}
+	state := readSyncState(dir)
+	if len(state.Releases) != 2 || state.LastRun.IsZero() {
+		t.Errorf("got state %+v, want 2 releases", state)
+	}
+	if f := state.Releases["a"].Files; len(f) != 1 || f[0].Name != "a.zip" || f[0].Size != 4 {
+		t.Errorf("got files %+v for a", f)
+	}
+
+	run()
+
+	mu.Lock()
+	added["b"] = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	mu.Unlock()
+	run("b")
+
+	// A completed release with a replaced and an added file has only
+	// those files fetched.
+	mu.Lock()
+	added["b"] = "2016-01-01T12:00:00Z"
+	files["a"] = "AAAAA"
+	files["a2"] = "a2"
+	mu.Unlock()
+	run()
+	for name, content := range map[string]string{"a": "AAAAA", "a2": "a2"} {
+		got, err := os.ReadFile(filepath.Join(dir, "a", name+".zip"))
+		if err != nil {
+			t.Error(err)
+		} else if string(got) != content {
+			t.Errorf("%s: got %q, want %q", name, got, content)
+		}
+	}
+	state = readSyncState(dir)
+	if _, ok := state.Replaced["a/a.zip"]; !ok || len(state.Replaced) != 1 {
+		t.Errorf("got replaced %v, want a/a.zip", state.Replaced)
+	}
+	if f := state.Releases["a"].Files; len(f) != 2 {
+		t.Errorf("got files %+v for a", f)
+	}
+	run()
+
+	if err := os.WriteFile(filepath.Join(dir, SyncStateFile), []byte("{corrupt"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	run("a", "b")
+}
+
+func TestSyncReleasesCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/services/search/v1/scrape":
+			w.Write([]byte(`{"items":[
+				{"identifier":"a","publicdate":"2015-07-29T07:11:17Z"},
+				{"identifier":"b","publicdate":"2016-01-01T12:00:00Z"}
+			],"count":2,"total":2}`))
+		case "/metadata/a", "/metadata/b":
+			id := path.Base(r.URL.Path)
+			fmt.Fprintf(w, `{"files":[{"name":"%s.zip","size":"4"}]}`, id)
+		case "/download/a/a.zip":
+			w.Write([]byte("aaaa"))
+		case "/download/b/b.zip":
+			// Hang until the download is stopped.
+			w.Header().Set("Content-Length", "4")
+			w.Write([]byte("b"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	defer func(newConf func() *torrent.ClientConfig) { newClientConfig = newConf }(newClientConfig)
+	newClientConfig = func() *torrent.ClientConfig { return torrent.TestingConfig(t) }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]bool)
+	)
+	dir := t.TempDir()
+	err := syncReleases(ctx, srv.URL, dir, DownloadOptions{
+		Progress: func(p DownloadProgress) {
+			mu.Lock()
+			defer mu.Unlock()
+			seen[p.ID+" "+p.State.String()] = true
+			// Cancel once a is done and b is in flight.
+			if seen["a done"] && seen["b HTTP"] {
+				cancel()
+			}
+		},
+	})
+	if err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	state := readSyncState(dir)
+	if _, ok := state.Releases["a"]; !ok || len(state.Releases) != 1 {
+		t.Errorf("got releases %v, want only a", state.Releases)
+	}
+	if !state.LastRun.IsZero() {
+		t.Errorf("got last run %v after cancellation, want zero", state.LastRun)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b", "b.zip")); err == nil {
+		t.Error("incomplete b.zip left in place")
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// FetchTorrentFiles downloads the torrent file of every terroroftinytown
+// release into dir.
+func FetchTorrentFiles(dir string) ([]string, error) {
+	return FetchTorrentFilesContext(context.Background(), dir)
+}
+
+// FetchTorrentFilesContext downloads the torrent file of every
+// terroroftinytown release into dir as <id>_archive.torrent, without
+// downloading any content. Torrent files that already exist are kept,
+// unless they cannot be parsed, in which case they are downloaded
+// again. Interrupted downloads are resumed. The identifiers of releases
+// that have no torrent file on archive.org are returned.
+func FetchTorrentFilesContext(ctx context.Context, dir string) ([]string, error) {
+	return fetchTorrentFiles(ctx, BaseURL, dir)
+}
+
+func fetchTorrentFiles(ctx context.Context, baseURL, dir string) ([]string, error) {
+	releases, err := scrapeReleases(ctx, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, r := range releases {
+		if err := ctx.Err(); err != nil {
+			return missing, err
+		}
+		id := r.Identifier
+		filename := filepath.Join(dir, id+"_archive.torrent")
+		if _, err := os.Stat(filename); err == nil {
+			_, err := metainfo.LoadFromFile(filename)
+			if err == nil {
+				continue
+			}
+			loggerFrom(ctx).Warn("downloading corrupt torrent file again", "id", id, "err", err)
+			if err := os.Remove(filename); err != nil {
+				return missing, err
+			}
+		}
+		if _, err := saveTorrentFile(ctx, baseURL, id, dir); err != nil {
+			var statusErr *statusError
+			if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+				missing = append(missing, id)
+				continue
+			}
+			return missing, err
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestFetchTorrentFiles(t *testing.T) {
+	info := metainfo.Info{Name: "item", PieceLength: 1 << 14, Length: 1, Pieces: make([]byte, 20)}
+	mi := metainfo.MetaInfo{}
+	var err error
+	if mi.InfoBytes, err = bencode.Marshal(info); err != nil {
+		t.Fatal(err)
+	}
+	var torrentFile bytes.Buffer
+	if err := mi.Write(&torrentFile); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu         sync.Mutex
+		downloaded []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/services/search/v1/scrape":
+			w.Write([]byte(`{"items":[
+				{"identifier":"a","publicdate":"2015-01-01T00:00:00Z"},
+				{"identifier":"b","publicdate":"2016-01-01T00:00:00Z"},
+				{"identifier":"c","publicdate":"2017-01-01T00:00:00Z"},
+				{"identifier":"d","publicdate":"2018-01-01T00:00:00Z"}
+			],"count":4,"total":4}`))
+		case "/download/a/a_archive.torrent", "/download/b/b_archive.torrent", "/download/d/d_archive.torrent":
+			mu.Lock()
+			downloaded = append(downloaded, filepath.Base(r.URL.Path))
+			mu.Unlock()
+			w.Write(torrentFile.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	// a is valid and kept, b is corrupt and downloaded again.
+	if err := os.WriteFile(filepath.Join(dir, "a_archive.torrent"), torrentFile.Bytes(), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b_archive.torrent"), []byte("d8:announce"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	missing, err := fetchTorrentFiles(context.Background(), srv.URL, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"c"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("got missing %q, want %q", missing, want)
+	}
+	sort.Strings(downloaded)
+	if want := []string{"b_archive.torrent", "d_archive.torrent"}; !reflect.DeepEqual(downloaded, want) {
+		t.Errorf("downloaded %q, want %q", downloaded, want)
+	}
+	for _, id := range []string{"a", "b", "d"} {
+		if _, err := metainfo.LoadFromFile(filepath.Join(dir, id+"_archive.torrent")); err != nil {
+			t.Errorf("%s: %v", id, err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("got files %q, want 3 torrent files", names)
+	}
+}
@@ -7,6 +7,7 @@
 package tinytown
 
 import (
+	"context"
 	"encoding/hex"
 
 	"github.com/andrewarchi/browser/jsonutil"
@@ -30,7 +31,12 @@ type ProjectStats struct {
 }
 
 func GetHealth() (*Health, error) {
-	resp, err := httpGet(Tracker + "/api/health")
+	return GetHealthContext(context.Background())
+}
+
+// GetHealthContext queries the health of the tracker.
+func GetHealthContext(ctx context.Context) (*Health, error) {
+	resp, err := httpGet(ctx, Tracker+"/api/health")
 	if err != nil {
 		return nil, err
 	}
@@ -7,22 +7,33 @@
 package tinytown
 
 import (
+	"context"
 	"fmt"
 
 	trpc "github.com/hekmon/transmissionrpc"
 )
 
 func DownloadTransmission(c *trpc.Client, dir string) error {
+	return DownloadTransmissionContext(context.Background(), c, dir)
+}
+
+// DownloadTransmissionContext adds all terroroftinytown releases to a
+// Transmission daemon. Adding stops when ctx is done, but torrents that
+// were already added continue to download in the daemon.
+func DownloadTransmissionContext(ctx context.Context, c *trpc.Client, dir string) error {
 	if err := checkVersion(c); err != nil {
 		return err
 	}
-	ids, err := GetReleaseIDs()
+	ids, err := GetReleaseIDsContext(ctx)
 	if err != nil {
 		return err
 	}
 	for i, id := range ids {
-		fmt.Printf("(%d/%d) Adding %s\n", i+1, len(ids), id)
-		filename, err := saveTorrentFile(id, dir)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		loggerFrom(ctx).Info("adding release to Transmission", "id", id, "index", i+1, "total", len(ids))
+		filename, err := saveTorrentFile(ctx, BaseURL, id, dir)
 		if err != nil {
 			return err
 		}
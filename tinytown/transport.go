@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/anacrolix/torrent"
+)
+
+// webseedMaxConnsPerHost is the connection limit of the web seed
+// client, as in torrent.WebseedHttpClient.
+const webseedMaxConnsPerHost = 10
+
+// httpClientKey is the context key for the HTTP client used by requests
+// made on behalf of a Downloader.
+type httpClientKey struct{}
+
+func withHTTPClient(ctx context.Context, c *http.Client) context.Context {
+	return context.WithValue(ctx, httpClientKey{}, c)
+}
+
+// httpClientFrom returns the HTTP client in ctx or HTTPClient.
+func httpClientFrom(ctx context.Context) *http.Client {
+	if c, ok := ctx.Value(httpClientKey{}).(*http.Client); ok {
+		return c
+	}
+	return HTTPClient
+}
+
+// context returns ctx with the logger and HTTP client for opts.
+func (opts *DownloadOptions) context(ctx context.Context) context.Context {
+	ctx = withLogger(ctx, opts.logger())
+	if rt := opts.transport(); rt != nil {
+		ctx = withHTTPClient(ctx, &http.Client{Transport: rt})
+	}
+	return ctx
+}
+
+// transport returns the transport for plain HTTP requests, or nil to use
+// HTTPClient.
+func (opts *DownloadOptions) transport() http.RoundTripper {
+	if opts.Transport != nil {
+		return opts.Transport
+	}
+	if opts.ProxyURL != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.Proxy = http.ProxyURL(opts.ProxyURL)
+		return t
+	}
+	return nil
+}
+
+// proxy returns the proxy for tracker requests, which the torrent
+// client makes with its own transport.
+func (opts *DownloadOptions) proxy() func(*http.Request) (*url.URL, error) {
+	if t, ok := opts.Transport.(*http.Transport); ok {
+		return t.Proxy
+	}
+	if opts.Transport == nil && opts.ProxyURL != nil {
+		return http.ProxyURL(opts.ProxyURL)
+	}
+	return http.ProxyFromEnvironment
+}
+
+// configureTorrentHTTP routes the HTTP requests of the torrent client,
+// to trackers and web seeds, like the plain HTTP requests for opts.
+func configureTorrentHTTP(conf *torrent.ClientConfig, opts *DownloadOptions) {
+	if conf.HTTPProxy == nil {
+		conf.HTTPProxy = opts.proxy()
+	}
+	rt := opts.transport()
+	if rt == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.MaxConnsPerHost = webseedMaxConnsPerHost
+		rt = t
+	}
+	torrent.WebseedHttpClient = &http.Client{Transport: rt}
+}
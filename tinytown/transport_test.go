@@ -0,0 +1,135 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestDownloaderProxy(t *testing.T) {
+	const id = "urlteam_proxy"
+	content := bytes.Repeat([]byte("terroroftinytown"), 1<<14)
+	seedDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(seedDir, id), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(seedDir, id, "example.zip"), content, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	info := metainfo.Info{PieceLength: 1 << 14}
+	if err := info.BuildFromFilePath(filepath.Join(seedDir, id)); err != nil {
+		t.Fatal(err)
+	}
+	var ranges atomic.Int32
+	srv := newWebseedServer(t, id, info, content, &ranges)
+	defer srv.Close()
+
+	// The proxy forwards absolute-form requests and counts them by path.
+	// CONNECT requests are counted, but refused, since the server does
+	// not use TLS.
+	var (
+		mu      sync.Mutex
+		proxied = make(map[string]int)
+	)
+	wantAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	forward := &http.Transport{}
+	defer forward.CloseIdleConnections()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if r.Method == http.MethodConnect {
+			proxied["CONNECT"]++
+		} else if r.URL.IsAbs() {
+			proxied[r.URL.Path]++
+		}
+		mu.Unlock()
+		if r.Method == http.MethodConnect || !r.URL.IsAbs() {
+			http.Error(w, "not a proxy request", http.StatusMethodNotAllowed)
+			return
+		}
+		if auth := r.Header.Get("Proxy-Authorization"); auth != wantAuth {
+			http.Error(w, "bad proxy credentials", http.StatusProxyAuthRequired)
+			return
+		}
+		req := r.Clone(r.Context())
+		req.RequestURI = ""
+		req.Header.Del("Proxy-Authorization")
+		resp, err := forward.RoundTrip(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyURL.User = url.UserPassword("user", "pass")
+
+	defer func(c *http.Client) { torrent.WebseedHttpClient = c }(torrent.WebseedHttpClient)
+	defer func(newConf func() *torrent.ClientConfig) { newClientConfig = newConf }(newClientConfig)
+	newClientConfig = func() *torrent.ClientConfig { return torrent.TestingConfig(t) }
+	dir := t.TempDir()
+	d, err := NewDownloader(DownloadOptions{
+		DataDir:      dir,
+		WebseedsOnly: true,
+		ProxyURL:     proxyURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.baseURL = srv.URL
+	if _, err := d.Add(id); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if n := proxied["/download/"+id+"/"+id+"_archive.torrent"]; n == 0 {
+		t.Error("torrent file was not requested through the proxy")
+	}
+	if n := proxied["/download/"+id+"/example.zip"]; n == 0 || int32(n) != ranges.Load() {
+		t.Errorf("got %d web seed requests through the proxy, want all %d", n, ranges.Load())
+	}
+	if n := proxied["CONNECT"]; n != 0 {
+		t.Errorf("got %d CONNECT requests, want 0", n)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id, "example.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("downloaded %d bytes differ from %d served", len(data), len(content))
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/andrewarchi/urlhero/ia"
+)
+
+// VerifyResult lists the files of a release that do not match the
+// checksums published by archive.org. Names are relative to the item
+// directory and use forward slashes.
+type VerifyResult struct {
+	Missing    []string // listed, but not present locally
+	Corrupt    []string // present, but with a mismatched size or checksum
+	Extra      []string // present locally, but not listed
+	Unverified []string // present, but listed without a checksum
+}
+
+// OK reports whether no files are missing, corrupt, or extra.
+func (vr *VerifyResult) OK() bool {
+	return len(vr.Missing) == 0 && len(vr.Corrupt) == 0 && len(vr.Extra) == 0
+}
+
+// VerifyOptions configures VerifyReleaseContext.
+type VerifyOptions struct {
+	// Progress, when non-nil, is called while hashing a file with the
+	// number of bytes hashed so far and the size of the file.
+	Progress func(name string, hashed, size int64)
+	// Projects, when non-empty, restricts checking to the project zips
+	// of these shortener projects, as with DownloadOptions.Projects.
+	// Other listed files are neither missing nor extra.
+	Projects []string
+	// FileFilter, when set, further restricts checking to the files for
+	// which it returns true, as with DownloadOptions.FileFilter.
+	FileFilter func(path string) bool
+}
+
+// verifyProgressBytes is the number of bytes hashed between progress
+// reports.
+const verifyProgressBytes = 64 << 20
+
+// VerifyRelease checks the files of a release downloaded into
+// dir/<id> against the checksums in its <id>_files.xml on archive.org.
+func VerifyRelease(dir, id string) (*VerifyResult, error) {
+	return VerifyReleaseContext(context.Background(), dir, id, nil)
+}
+
+// VerifyReleaseContext checks the files of a release downloaded into
+// dir/<id> against the checksums in its <id>_files.xml on archive.org.
+// Files are hashed as streams, so large files are not held in memory.
+// The files XML and the torrent are not part of the torrent layout and
+// are not checked.
+func VerifyReleaseContext(ctx context.Context, dir, id string, opts *VerifyOptions) (*VerifyResult, error) {
+	return verifyRelease(ctx, BaseURL, dir, id, opts)
+}
+
+func verifyRelease(ctx context.Context, baseURL, dir, id string, opts *VerifyOptions) (*VerifyResult, error) {
+	files, err := getFileMeta(ctx, baseURL, id)
+	if err != nil {
+		return nil, err
+	}
+	var filter fileFilter
+	if opts != nil {
+		filter = newFileFilter(opts.Projects, opts.FileFilter)
+	}
+	itemDir := filepath.Join(dir, id)
+	var vr VerifyResult
+	listed := make(map[string]struct{}, len(files))
+	for i := range files {
+		f := &files[i]
+		if f.Name == id+"_files.xml" || f.Name == id+"_archive.torrent" {
+			continue
+		}
+		listed[f.Name] = struct{}{}
+		if !filter.match(f.Name) {
+			continue
+		}
+		ok, err := verifyFile(ctx, filepath.Join(itemDir, filepath.FromSlash(f.Name)), f, opts)
+		switch {
+		case os.IsNotExist(err):
+			vr.Missing = append(vr.Missing, f.Name)
+		case err != nil:
+			return nil, err
+		case !ok:
+			vr.Corrupt = append(vr.Corrupt, f.Name)
+		case len(f.SHA1) == 0 && len(f.MD5) == 0 && len(f.CRC32) == 0:
+			vr.Unverified = append(vr.Unverified, f.Name)
+		}
+	}
+
+	err = filepath.WalkDir(itemDir, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filename == itemDir {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(itemDir, filename)
+		if err != nil {
+			return err
+		}
+		if _, ok := listed[filepath.ToSlash(rel)]; !ok {
+			vr.Extra = append(vr.Extra, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(vr.Missing)
+	sort.Strings(vr.Corrupt)
+	sort.Strings(vr.Extra)
+	sort.Strings(vr.Unverified)
+	return &vr, nil
+}
+
+func getFileMeta(ctx context.Context, baseURL, id string) ([]ia.FileMeta, error) {
+	resp, err := httpGet(ctx, baseURL+"/download/"+id+"/"+id+"_files.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ia.DecodeFileMeta(resp.Body)
+}
+
+// verifyFile reports whether a file matches its listed size and
+// strongest listed checksum. Files listed without a checksum are only
+// checked by size.
+func verifyFile(ctx context.Context, filename string, fm *ia.FileMeta, opts *VerifyOptions) (bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	size := fi.Size()
+	if fm.Size != 0 && size != fm.Size {
+		return false, nil
+	}
+
+	var h hash.Hash
+	var sum []byte
+	switch {
+	case len(fm.SHA1) != 0:
+		h, sum = sha1.New(), fm.SHA1
+	case len(fm.MD5) != 0:
+		h, sum = md5.New(), fm.MD5
+	case len(fm.CRC32) != 0:
+		h, sum = crc32.NewIEEE(), fm.CRC32
+	default:
+		return true, nil
+	}
+
+	var hashed int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		n, err := io.CopyN(h, f, verifyProgressBytes)
+		hashed += n
+		if opts != nil && opts.Progress != nil {
+			opts.Progress(fm.Name, hashed, size)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return bytes.Equal(h.Sum(nil), sum), nil
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+)
+
+// newItemServer serves the files XML, metadata listing, and files of
+// an item. Files named in unsummed are listed without checksums.
+func newItemServer(t *testing.T, id string, files map[string]string, unsummed ...string) *httptest.Server {
+	t.Helper()
+	var xml strings.Builder
+	xml.WriteString("<files>\n")
+	fmt.Fprintf(&xml, "<file name=%q source=\"metadata\"><format>Metadata</format></file>\n", id+"_files.xml")
+	type file struct {
+		Name string `json:"name"`
+		MD5  string `json:"md5,omitempty"`
+	}
+	var listing struct {
+		Files []file `json:"files"`
+	}
+	for name, content := range files {
+		if contains(unsummed, name) {
+			fmt.Fprintf(&xml, "<file name=%q source=\"original\"/>\n", name)
+			listing.Files = append(listing.Files, file{Name: name})
+			continue
+		}
+		md5Sum := fmt.Sprintf("%x", md5.Sum([]byte(content)))
+		fmt.Fprintf(&xml, "<file name=%q source=\"original\"><size>%d</size><md5>%s</md5><sha1>%x</sha1></file>\n",
+			name, len(content), md5Sum, sha1.Sum([]byte(content)))
+		listing.Files = append(listing.Files, file{name, md5Sum})
+	}
+	xml.WriteString("</files>\n")
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/download/" + id + "/" + id + "_files.xml":
+			w.Write([]byte(xml.String()))
+			return
+		case "/metadata/" + id:
+			json.NewEncoder(w).Encode(listing)
+			return
+		}
+		content, ok := files[strings.TrimPrefix(r.URL.Path, "/download/"+id+"/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyRelease(t *testing.T) {
+	const id = "item"
+	srv := newItemServer(t, id, map[string]string{
+		"good.zip":      "good",
+		"sub/good.zip":  "good too",
+		"corrupt.zip":   "original",
+		"truncated.zip": "original",
+		"missing.zip":   "missing",
+		"unsummed.zip":  "unsummed",
+	}, "unsummed.zip")
+	defer srv.Close()
+
+	dir := t.TempDir()
+	writeFiles(t, filepath.Join(dir, id), map[string]string{
+		"good.zip":       "good",
+		"sub/good.zip":   "good too",
+		"corrupt.zip":    "0riginal",
+		"truncated.zip":  "orig",
+		"unsummed.zip":   "anything",
+		"extra.zip.part": "extra",
+	})
+
+	var hashed []string
+	opts := &VerifyOptions{Progress: func(name string, n, size int64) {
+		if n == size {
+			hashed = append(hashed, name)
+		}
+	}}
+	vr, err := verifyRelease(context.Background(), srv.URL, dir, id, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &VerifyResult{
+		Missing:    []string{"missing.zip"},
+		Corrupt:    []string{"corrupt.zip", "truncated.zip"},
+		Extra:      []string{"extra.zip.part"},
+		Unverified: []string{"unsummed.zip"},
+	}
+	if !reflect.DeepEqual(vr, want) {
+		t.Errorf("got %+v, want %+v", vr, want)
+	}
+	if vr.OK() {
+		t.Error("result is OK")
+	}
+	if len(hashed) != 3 {
+		t.Errorf("hashed %q, want 3 files", hashed)
+	}
+}
+
+func TestDownloaderVerify(t *testing.T) {
+	const id = "item"
+	files := map[string]string{"a.zip": "aaaa", "b.zip": "bbbb"}
+	srv := newItemServer(t, id, files)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	writeFiles(t, filepath.Join(dir, id), map[string]string{"a.zip": "aaab"})
+
+	defer func(newConf func() *torrent.ClientConfig) { newClientConfig = newConf }(newClientConfig)
+	newClientConfig = func() *torrent.ClientConfig { return torrent.TestingConfig(t) }
+	d, err := NewDownloader(DownloadOptions{DataDir: dir, Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.baseURL = srv.URL
+	if err := d.verify(id, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(dir, id, name))
+		if err != nil {
+			t.Error(err)
+		} else if string(got) != content {
+			t.Errorf("%s: got %q, want %q", name, got, content)
+		}
+	}
+}
@@ -8,77 +8,390 @@ package tinytown
 
 import (
 	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/andrewarchi/archive"
-	"github.com/andrewarchi/browser/jsonutil"
 	"github.com/andrewarchi/urlhero/beacon"
 )
 
-// Meta contains link dump metadata from a *.meta.json.xz file.
-type Meta struct {
-	Name              string  `json:"name"`
-	MinVersion        int     `json:"min_version"`        // minimum library version
-	MinClientVersion  int     `json:"min_client_version"` // minimum pipeline version
-	Alphabet          string  `json:"alphabet"`
-	URLTemplate       string  `json:"url_template"`
-	RequestDelay      float64 `json:"request_delay"`     // e.g. 0.5
-	RedirectCodes     []int   `json:"redirect_codes"`    // HTTP codes
-	NoRedirectCodes   []int   `json:"no_redirect_codes"` // HTTP codes
-	UnavailableCodes  []int   `json:"unavailable_codes"` // HTTP codes
-	BannedCodes       []int   `json:"banned_codes"`      // HTTP codes
-	BodyRegex         string  `json:"body_regex"`
-	LocationAntiRegex string  `json:"location_anti_regex"`
-	Method            string  `json:"method"` // HTTP method, e.g. "head"
-	Enabled           bool    `json:"enabled"`
-	Autoqueue         bool    `json:"autoqueue"`
-	NumCountPerItem   int     `json:"num_count_per_item"`
-	MaxNumItems       int     `json:"max_num_items"`
-	LowerSequenceNum  int64   `json:"lower_sequence_num"`
-	AutoreleaseTime   int     `json:"autorelease_time"`
-}
-
 // ProcessFunc is the type of function that is called for each link
 // visited.
-type ProcessFunc func(l *beacon.Link, m *Meta, shortcodeLen int, releaseFilename, dumpFilename string) error
+type ProcessFunc func(l *beacon.Link, m *ProjectMeta, shortcodeLen int, releaseFilename, dumpFilename string) error
+
+// ReleaseFunc is the type of function that is called for each link
+// visited by ProcessReleases, along with the project metadata and the
+// name of the release directory.
+type ReleaseFunc func(m *ProjectMeta, release string, l *beacon.Link) error
+
+// Serialize returns a ReleaseFunc that calls fn from one goroutine at a
+// time, for use with ProcessOptions.Workers.
+func (fn ReleaseFunc) Serialize() ReleaseFunc {
+	var mu sync.Mutex
+	return func(m *ProjectMeta, release string, l *beacon.Link) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return fn(m, release, l)
+	}
+}
+
+// ProcessOptions configures ProcessReleasesOptions.
+type ProcessOptions struct {
+	// Projects, when non-empty, restricts processing to the project zips
+	// and TinyBack dumps of these shortener projects, as with
+	// DownloadOptions.Projects.
+	Projects []string
+	// Workers is the number of files processed concurrently. It is 1
+	// when <=0.
+	Workers int
+	// From and To, when non-zero, restrict processing to the project
+	// zips dated at or after From and before To, by the dates in their
+	// names, like bitly.2014-05-07-21-17-02.zip. Files without a valid
+	// date, such as TinyBack dumps, are processed, with a warning.
+	From, To time.Time
+	// Journal, when set, is the path of a journal file, to which a line
+	// is appended with the checksum and link count of each link dump
+	// once it has been processed. Dumps already in the journal are
+	// skipped, so an interrupted run can be resumed. A dump interrupted
+	// midway is processed again from the start. Files in dir that
+	// SyncReleases fetched again, after they were replaced on
+	// archive.org, are processed again.
+	Journal string
+	// Reprocess ignores the dumps already in the journal, but still
+	// records processed dumps in it.
+	Reprocess bool
+	// PostProcess is applied to each project zip or TinyBack dump once
+	// the journal records all of its dumps as processed. Anything but
+	// Keep requires a Journal.
+	PostProcess PostProcess
+	// Summary writes statistics for each project to dir/SummaryFile once
+	// processing stops, even with an error. With a Journal, and without
+	// Reprocess, they are merged with the existing summary, which covers
+	// the files skipped by this run. A file is only counted once all of
+	// its dumps are processed, so the dumps of a file interrupted in an
+	// earlier run, which were journaled then, are missed.
+	Summary bool
+	// Redownload, when set, is called to replace a release file that
+	// cannot be read, such as a truncated zip or a dump with a CRC error,
+	// after which the file is processed once more. The links read before
+	// the error are visited again, except for those in journaled dumps.
+	// id is the release directory and name is the path of the file
+	// within it. RedownloadFile downloads it from archive.org.
+	Redownload func(ctx context.Context, id, name, filename string) error
+}
+
+// ProcessReleases walks dir and processes every project zip within it
+// by calling fn on every link, along with the project metadata and the
+// name of the release directory containing the zip. Processing stops at
+// the first error returned by fn. First-generation TinyBack releases in
+// dir are processed too, as described by ProcessTinybackDump.
+func ProcessReleases(dir string, fn ReleaseFunc) error {
+	return ProcessReleasesOptions(context.Background(), dir, nil, fn)
+}
+
+// ProcessReleaseProjects is like ProcessReleases, but only processes
+// the project zips and TinyBack dumps of the given shortener projects,
+// as with DownloadOptions.Projects. All are processed when projects is
+// empty.
+func ProcessReleaseProjects(dir string, projects []string, fn ReleaseFunc) error {
+	return ProcessReleasesOptions(context.Background(), dir, &ProcessOptions{Projects: projects}, fn)
+}
 
-// ProcessReleases processes every release in a directory by calling fn
-// on every link.
-func ProcessReleases(root string, fn ProcessFunc) error {
-	// TODO allow user to skip releases or projects.
-	rootContents, err := os.ReadDir(root)
+// ProcessReleasesOptions is like ProcessReleases, with options. With
+// more than one worker, fn is called concurrently for different files,
+// so it must be safe for concurrent use or be wrapped with Serialize.
+// The links of a file, which is a single project in a single release,
+// are always visited in order from one goroutine. The first error from
+// fn or ctx cancels the remaining files and is returned. Files that
+// cannot be read, even after Redownload, are skipped and reported
+// together in a *CorruptFilesError.
+func ProcessReleasesOptions(ctx context.Context, dir string, opts *ProcessOptions, fn ReleaseFunc) error {
+	if opts == nil {
+		opts = &ProcessOptions{}
+	}
+	jobs, err := findReleaseFiles(dir, newProjectFilter(opts.Projects))
 	if err != nil {
 		return err
 	}
-	for _, release := range rootContents {
-		if !release.IsDir() {
-			continue
-		}
-		dir := filepath.Join(root, release.Name())
-		dirContents, err := os.ReadDir(dir)
+	if dates := (dateRange{opts.From, opts.To}); !dates.unbounded() {
+		jobs = dates.filterFiles(ctx, jobs)
+	}
+	if opts.PostProcess != Keep && opts.Journal == "" {
+		return fmt.Errorf("tinytown: PostProcess requires a Journal")
+	}
+	p := &processState{post: opts.PostProcess, redownload: opts.Redownload}
+	if opts.Journal != "" {
+		p.journal, err = openJournal(opts.Journal, opts.Reprocess)
 		if err != nil {
 			return err
 		}
-		for _, file := range dirContents {
-			filename := filepath.Join(dir, file.Name())
-			if !strings.HasSuffix(filename, ".zip") {
-				continue
+		defer p.journal.Close()
+		if err := p.journal.invalidate(readSyncState(dir).Replaced); err != nil {
+			return err
+		}
+	}
+	if opts.Summary {
+		p.summary = newSummarizer()
+	}
+	err = processAll(ctx, jobs, opts.Workers, p, fn)
+	if len(p.corrupt) != 0 {
+		err = errors.Join(err, &CorruptFilesError{p.corrupt})
+	}
+	if p.summary != nil {
+		incremental := opts.Journal != "" && !opts.Reprocess
+		err = errors.Join(err, p.summary.write(dir, incremental))
+	}
+	return err
+}
+
+// CorruptFilesError is returned by ProcessReleasesOptions, once the
+// other files are processed, when release files could not be read.
+type CorruptFilesError struct {
+	Files []CorruptFile
+}
+
+// CorruptFile is a release file that could not be read.
+type CorruptFile struct {
+	ID   string // release directory
+	Name string // path within the release directory
+	Err  error
+}
+
+func (err *CorruptFilesError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "tinytown: %d corrupt release files", len(err.Files))
+	for _, f := range err.Files {
+		fmt.Fprintf(&b, "\n\t%s/%s: %v", f.ID, f.Name, f.Err)
+	}
+	return b.String()
+}
+
+func (err *CorruptFilesError) Unwrap() []error {
+	errs := make([]error, len(err.Files))
+	for i, f := range err.Files {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// processState is the state shared by the files processed by
+// ProcessReleasesOptions.
+type processState struct {
+	journal    *journal    // may be nil
+	post       PostProcess // requires journal
+	summary    *summarizer // may be nil
+	redownload func(ctx context.Context, id, name, filename string) error
+
+	mu      sync.Mutex
+	corrupt []CorruptFile
+}
+
+// processAll processes jobs with a pool of workers. The first error
+// cancels the remaining jobs and is returned.
+func processAll(ctx context.Context, jobs []releaseFile, workers int, p *processState, fn ReleaseFunc) error {
+	workers = min(workers, len(jobs))
+	if workers <= 1 {
+		for _, job := range jobs {
+			if err := job.run(ctx, p, fn); err != nil {
+				return err
 			}
-			if err := ProcessProject(filename, fn); err != nil {
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	ch := make(chan releaseFile)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range ch {
+				if err := job.run(ctx, p, fn); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+send:
+	for _, job := range jobs {
+		select {
+		case ch <- job:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(ch)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// releaseFile is a project zip or TinyBack dump to be processed.
+type releaseFile struct {
+	filename string
+	rel      string // slash-separated path relative to the walked directory
+	release  string
+	name     string // slash-separated path within the release directory
+	project  string // from the file name
+	process  func(ctx context.Context, filename, rel string, j *journal, fn ProcessFunc) error
+}
+
+// ctxCheckInterval is the number of links between checks for
+// cancellation.
+const ctxCheckInterval = 1024
+
+func (rf releaseFile) run(ctx context.Context, p *processState, fn ReleaseFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fi, err := os.Stat(rf.filename)
+	if err != nil {
+		return err
+	}
+	if e, ok := p.journal.completed(rf.rel, fi.Size()); ok {
+		// Processed by an earlier run, which included it in the summary.
+		return p.post.apply(rf.filename, e)
+	}
+	fs, corrupt, err := rf.read(ctx, p, fi.Size(), fn)
+	if corrupt && p.redownload != nil {
+		loggerFrom(ctx).Warn("downloading corrupt release file again", "id", rf.release, "file", rf.name, "err", err)
+		if rerr := p.redownload(ctx, rf.release, rf.name, rf.filename); rerr != nil {
+			err = errors.Join(err, rerr)
+		} else if fi, err = os.Stat(rf.filename); err == nil {
+			fs, corrupt, err = rf.read(ctx, p, fi.Size(), fn)
+		}
+	}
+	if corrupt {
+		p.mu.Lock()
+		p.corrupt = append(p.corrupt, CorruptFile{rf.release, rf.name, err})
+		p.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p.summary.add(fs)
+	if p.journal == nil {
+		return nil
+	}
+	e, err := p.journal.complete(rf.rel, fi.Size())
+	if err != nil {
+		return err
+	}
+	return p.post.apply(rf.filename, e)
+}
+
+// read processes the links of the file, returning its statistics, if
+// summarized. Errors other than from fn or ctx, or from parsing a link,
+// are reported as corrupt.
+func (rf releaseFile) read(ctx context.Context, p *processState, size int64, fn ReleaseFunc) (fs *fileSummary, corrupt bool, err error) {
+	if p.summary != nil {
+		fs = newFileSummary(rf.project, rf.release, size)
+	}
+	n := 0
+	var stopped bool
+	err = rf.process(ctx, rf.filename, rf.rel, p.journal, func(l *beacon.Link, m *ProjectMeta, shortcodeLen int, releaseFilename, dumpFilename string) error {
+		if n++; n%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				stopped = true
 				return err
 			}
 		}
+		if fs != nil {
+			fs.add(l)
+		}
+		if err := fn(m, rf.release, l); err != nil {
+			stopped = true
+			return err
+		}
+		return nil
+	})
+	var syntaxErr *beacon.SyntaxError
+	corrupt = err != nil && !stopped && ctx.Err() == nil && !errors.As(err, &syntaxErr)
+	return fs, corrupt, err
+}
+
+// filterFiles returns the release files dated in r. Files without a
+// valid date are kept, with a warning.
+func (r dateRange) filterFiles(ctx context.Context, files []releaseFile) []releaseFile {
+	var filtered []releaseFile
+	for _, rf := range files {
+		if date, ok := zipDate(rf.name); !ok {
+			loggerFrom(ctx).Warn("including release file without date", "id", rf.release, "file", rf.name)
+		} else if !r.contains(date) {
+			continue
+		}
+		filtered = append(filtered, rf)
 	}
-	return nil
+	return filtered
+}
+
+// findReleaseFiles walks dir for project zips and TinyBack dumps matched
+// by filter.
+func findReleaseFiles(dir string, filter projectFilter) ([]releaseFile, error) {
+	var files []releaseFile
+	err := filepath.WalkDir(dir, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch name := d.Name(); {
+		case strings.HasSuffix(name, ".zip"):
+			if filter.match(name) {
+				project, _ := zipProject(name)
+				files = append(files, releaseFile{filename, rel, filepath.Base(filepath.Dir(filename)), name, project, processProject})
+			}
+		case strings.HasSuffix(name, ".txt.xz"):
+			// TinyBack dumps are in <release>/<project>/.
+			project := filepath.Dir(filename)
+			if filter.matchProject(filepath.Base(project)) {
+				files = append(files, releaseFile{filename, rel, filepath.Base(filepath.Dir(project)),
+					filepath.Base(project) + "/" + name, filepath.Base(project), processTinybackDump})
+			}
+		}
+		return nil
+	})
+	return files, err
 }
 
 // ProcessProject processes every link dump in a project release by
 // calling fn on every link.
 func ProcessProject(filename string, fn ProcessFunc) error {
+	return processProject(context.Background(), filename, "", nil, fn)
+}
+
+// processProject is ProcessProject, skipping the dumps in j and adding
+// processed dumps to j, under the name rel.
+func processProject(ctx context.Context, filename, rel string, j *journal, fn ProcessFunc) error {
 	zr, err := zip.OpenReader(filename)
 	if err != nil {
 		return err
@@ -93,7 +406,10 @@ func ProcessProject(filename string, fn ProcessFunc) error {
 		return err
 	}
 	for _, f := range dumps {
-		if err := processLinkDump(f, filename, meta, fn); err != nil {
+		if j.has(rel, f.Name, int64(f.UncompressedSize64)) {
+			continue
+		}
+		if err := processLinkDump(ctx, f, filename, rel, meta, j, fn); err != nil {
 			return err
 		}
 	}
@@ -103,84 +419,146 @@ func ProcessProject(filename string, fn ProcessFunc) error {
 func classifyFiles(files []*zip.File, filename string) (meta *zip.File, dumps []*zip.File, err error) {
 	// Before 2015-07-29, project zip archives were sorted with meta
 	// first, followed by dumps in increasing shortcode length. Later
-	// archives do not sort files.
-meta:
-	switch {
-	case len(files) == 0:
+	// archives do not sort files. Files may be nested in directories.
+	if len(files) == 0 {
 		return nil, nil, fmt.Errorf("tinytown: empty archive: %s", filename)
-	// Meta is usually first or last; don't allocate for those.
-	case strings.HasSuffix(files[0].Name, ".meta.json.xz"):
-		meta = files[0]
-		dumps = files[1:]
-	case strings.HasSuffix(files[len(files)-1].Name, ".meta.json.xz"):
-		meta = files[len(files)-1]
-		dumps = files[:len(files)-1]
-	default:
-		for i, f := range files {
-			if strings.HasSuffix(f.Name, ".meta.json.xz") {
-				meta = f
-				dumps = make([]*zip.File, 0, len(files)-1)
-				dumps = append(append(dumps, files[:i]...), files[i+1:]...)
-				break meta
+	}
+	dumps = make([]*zip.File, 0, len(files))
+	for _, f := range files {
+		switch {
+		case strings.HasSuffix(f.Name, ".meta.json.xz"):
+			if meta != nil {
+				return nil, nil, fmt.Errorf("tinytown: multiple meta files in archive: %s", filename)
 			}
+			meta = f
+		case strings.HasSuffix(f.Name, ".txt.xz"):
+			dumps = append(dumps, f)
 		}
-		return nil, nil, fmt.Errorf("tinytown: no meta file in archive: %s", filename)
+		// Directories and other files are skipped.
 	}
-
-	for _, f := range dumps {
-		if !strings.HasSuffix(f.Name, ".txt.xz") {
-			return nil, nil, fmt.Errorf("tinytown: not a link dump: %s", filename)
-		}
+	if meta == nil {
+		return nil, nil, fmt.Errorf("tinytown: no meta file in archive: %s", filename)
 	}
-	return
+	return meta, dumps, nil
 }
 
-func readMeta(f *zip.File) (*Meta, error) {
+func readMeta(f *zip.File) (*ProjectMeta, error) {
 	fr, err := f.Open()
 	if err != nil {
 		return nil, err
 	}
 	defer fr.Close()
-	xr, err := archive.NewXZReader(fr)
+	return ReadProjectMeta(fr)
+}
+
+func processLinkDump(ctx context.Context, f *zip.File, filename, rel string, meta *ProjectMeta, j *journal, fn ProcessFunc) error {
+	r, err := f.Open()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer xr.Close()
-	var m Meta
-	if err := jsonutil.Decode(xr, &m); err != nil {
-		return nil, err
+	defer r.Close()
+	shortcodeLen := len(path.Base(f.Name)) - len(".txt.xz")
+	return journalLinkDump(ctx, r, shortcodeLen, filename, rel, f.Name, meta, j, fn)
+}
+
+// ProcessTinybackDump processes a link dump from a first-generation
+// TinyBack release by calling fn on every link. TinyBack releases have
+// a directory of xz-compressed dumps for each shortener and no meta
+// files, so the project name is taken from the directory and the
+// shortcode length from TinybackShortcodeLens.
+func ProcessTinybackDump(filename string, fn ProcessFunc) error {
+	return processTinybackDump(context.Background(), filename, "", nil, fn)
+}
+
+// TinybackShortcodeLens is the fixed shortcode length of each TinyBack
+// project, by the name of its directory, which is needed to join the
+// lines of multi-line targets. Projects not listed have variable-length
+// shortcodes.
+var TinybackShortcodeLens = map[string]int{}
+
+// processTinybackDump is ProcessTinybackDump with a journal, like
+// processProject.
+func processTinybackDump(ctx context.Context, filename, rel string, j *journal, fn ProcessFunc) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	name := filepath.Base(filename)
+	if j != nil {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if j.has(rel, name, fi.Size()) {
+			return nil
+		}
 	}
-	return &m, nil
+	meta := &ProjectMeta{Name: filepath.Base(filepath.Dir(filename))}
+	return journalLinkDump(ctx, f, TinybackShortcodeLens[meta.Name], filename, rel, name, meta, j, fn)
 }
 
-func processLinkDump(f *zip.File, filename string, meta *Meta, fn ProcessFunc) error {
-	r, err := f.Open()
+// journalLinkDump reads a link dump with readLinkDump and, when it
+// completes, adds it to j with its checksum and link count.
+func journalLinkDump(ctx context.Context, r io.Reader, shortcodeLen int, filename, rel, dumpName string, meta *ProjectMeta, j *journal, fn ProcessFunc) error {
+	if j == nil {
+		_, err := readLinkDump(ctx, r, shortcodeLen, filename, dumpName, meta, fn)
+		return err
+	}
+	h := sha256.New()
+	cr := &countingReader{r: io.TeeReader(r, h)}
+	links, err := readLinkDump(ctx, cr, shortcodeLen, filename, dumpName, meta, fn)
 	if err != nil {
 		return err
 	}
-	defer r.Close()
+	// Hash any trailing bytes after the xz stream.
+	if _, err := io.Copy(io.Discard, cr); err != nil {
+		return err
+	}
+	return j.add(journalEntry{
+		File:   rel,
+		Entry:  dumpName,
+		Size:   cr.n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		Links:  links,
+	})
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// readLinkDump reads an xz-compressed URLTeam link dump, calling fn on
+// every link, and returns the number of links. A shortcodeLen <=0 is
+// variable.
+func readLinkDump(ctx context.Context, r io.Reader, shortcodeLen int, filename, dumpName string, meta *ProjectMeta, fn ProcessFunc) (int, error) {
 	xr, err := archive.NewXZReader(r)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer xr.Close()
 
-	shortcodeLen := len(filepath.Base(f.Name)) - len(".txt.xz")
 	br := beacon.NewURLTeamReader(xr, shortcodeLen)
-	fmt.Fprintf(os.Stderr, "%s:%s ", filepath.Base(filename), f.Name)
 	n := 0
 	for {
 		link, err := br.Read()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "[%d links]\n", n)
 			if err == io.EOF {
-				return nil
+				loggerFrom(ctx).Debug("processed link dump", "file", filepath.Base(filename), "dump", dumpName, "links", n)
+				return n, nil
 			}
-			return err
+			return n, err
 		}
 		n++
-		if err := fn(link, meta, shortcodeLen, filename, f.Name); err != nil {
-			return err
+		if err := fn(link, meta, shortcodeLen, filename, dumpName); err != nil {
+			return n, err
 		}
 	}
 }
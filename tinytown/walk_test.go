@@ -0,0 +1,320 @@
+// Copyright (c) 2021 Andrew Archibald
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tinytown
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ulikunitz/xz"
+
+	"github.com/andrewarchi/urlhero/beacon"
+)
+
+func TestProcessReleases(t *testing.T) {
+	root := t.TempDir()
+	writeZip(t, filepath.Join(root, "urlteam_2021-01-01", "foo.zip"), []zipEntry{
+		{"foo/", ""},
+		{"foo/12.txt.xz", "ab|http://example.com/ab\ncd|http://example.com/cd\n"},
+		{"foo/foo.meta.json.xz", `{"name":"foo","alphabet":"abcd"}`},
+		{"foo/123.txt.xz", "abc|http://example.com/abc\n"},
+	})
+	writeZip(t, filepath.Join(root, "nested", "urlteam_2021-02-01", "bar.zip"), []zipEntry{
+		{"bar.meta.json.xz", `{"name":"bar"}`},
+		{"1.txt.xz", "x|http://example.com/x\n"},
+	})
+
+	type visit struct {
+		Project, Release string
+		Link             beacon.Link
+	}
+	var got []visit
+	err := ProcessReleases(root, func(m *ProjectMeta, release string, l *beacon.Link) error {
+		if m.Name == "foo" && m.Alphabet != "abcd" {
+			t.Errorf("got alphabet %q, want %q", m.Alphabet, "abcd")
+		}
+		got = append(got, visit{m.Name, release, *l})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []visit{
+		{"bar", "urlteam_2021-02-01", beacon.Link{Source: "x", Target: "http://example.com/x"}},
+		{"foo", "urlteam_2021-01-01", beacon.Link{Source: "ab", Target: "http://example.com/ab"}},
+		{"foo", "urlteam_2021-01-01", beacon.Link{Source: "cd", Target: "http://example.com/cd"}},
+		{"foo", "urlteam_2021-01-01", beacon.Link{Source: "abc", Target: "http://example.com/abc"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = ProcessReleases(root, func(m *ProjectMeta, release string, l *beacon.Link) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("got error %v after %d links, want %v after 1", err, n, stop)
+	}
+}
+
+func TestProcessReleaseProjects(t *testing.T) {
+	root := t.TempDir()
+	release := filepath.Join(root, "urlteam_2021-01-01")
+	writeZip(t, filepath.Join(release, "foo.2021-01-01.zip"), []zipEntry{
+		{"foo.meta.json.xz", `{"name":"foo"}`},
+		{"1.txt.xz", "a|http://example.com/a\n"},
+	})
+	writeZip(t, filepath.Join(release, "bar.2021-01-01.zip"), []zipEntry{
+		{"bar.meta.json.xz", `{"name":"bar"}`},
+		{"1.txt.xz", "b|http://example.com/b\n"},
+	})
+
+	var got []string
+	err := ProcessReleaseProjects(root, []string{"foo"}, func(m *ProjectMeta, release string, l *beacon.Link) error {
+		got = append(got, m.Name+" "+l.Source)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"foo a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestProcessReleasesDates(t *testing.T) {
+	root := t.TempDir()
+	release := filepath.Join(root, "urlteam_2014-06-01")
+	for _, name := range []string{"bitly.2014-05-07-21-17-02.zip", "bitly.2014-05-08-00-00-00.zip", "isgd.latest.zip"} {
+		project, _ := zipProject(name)
+		writeZip(t, filepath.Join(release, name), []zipEntry{
+			{project + ".meta.json.xz", `{"name":"` + project + `"}`},
+			{"1.txt.xz", "a|http://example.com/" + name + "\n"},
+		})
+	}
+	var got []string
+	opts := &ProcessOptions{
+		From: time.Date(2014, 5, 8, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2014, 5, 9, 0, 0, 0, 0, time.UTC),
+	}
+	err := ProcessReleasesOptions(context.Background(), root, opts, func(m *ProjectMeta, release string, l *beacon.Link) error {
+		got = append(got, l.Target)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	want := []string{"http://example.com/bitly.2014-05-08-00-00-00.zip", "http://example.com/isgd.latest.zip"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestProcessReleasesTinyback(t *testing.T) {
+	root := t.TempDir()
+	writeZip(t, filepath.Join(root, "urlteam_2021-01-01", "isgd.2021-01-01.zip"), []zipEntry{
+		{"isgd.meta.json.xz", `{"name":"isgd"}`},
+		{"1.txt.xz", "a|http://example.com/a\n"},
+	})
+	release := filepath.Join(root, "URLTeamTorrentRelease2013July")
+	writeXZ(t, filepath.Join(release, "isgd", "isgd.txt.xz"), "ab|http://example.com/ab\nabcd|http://example.com/abcd\n")
+	writeXZ(t, filepath.Join(release, "tinyurl", "tinyurl.txt.xz"), "x|http://example.com/x\n")
+	writeXZ(t, filepath.Join(release, "fixed", "fixed.txt.xz"), "abc|http://example.com/1\nline\nxyz|http://example.com/2\n")
+	defer func(lens map[string]int) { TinybackShortcodeLens = lens }(TinybackShortcodeLens)
+	TinybackShortcodeLens = map[string]int{"fixed": 3}
+
+	type visit struct {
+		Project, Release, Source, Target string
+	}
+	var got []visit
+	err := ProcessReleaseProjects(root, []string{"isgd", "fixed"}, func(m *ProjectMeta, release string, l *beacon.Link) error {
+		got = append(got, visit{m.Name, release, l.Source, l.Target})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []visit{
+		{"fixed", "URLTeamTorrentRelease2013July", "abc", "http://example.com/1\nline"},
+		{"fixed", "URLTeamTorrentRelease2013July", "xyz", "http://example.com/2"},
+		{"isgd", "URLTeamTorrentRelease2013July", "ab", "http://example.com/ab"},
+		{"isgd", "URLTeamTorrentRelease2013July", "abcd", "http://example.com/abcd"},
+		{"isgd", "urlteam_2021-01-01", "a", "http://example.com/a"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestProcessReleasesWorkers(t *testing.T) {
+	root := t.TempDir()
+	writeSyntheticReleases(t, root, 3, 4, 100)
+
+	var (
+		mu       sync.Mutex
+		inFlight = make(map[string]bool)
+		counts   = make(map[string]int)
+	)
+	err := ProcessReleasesOptions(context.Background(), root, &ProcessOptions{Workers: 4}, func(m *ProjectMeta, release string, l *beacon.Link) error {
+		key := release + "/" + m.Name
+		mu.Lock()
+		if inFlight[key] {
+			t.Errorf("concurrent calls for %s", key)
+		}
+		inFlight[key] = true
+		counts[key]++
+		mu.Unlock()
+		time.Sleep(time.Microsecond)
+		mu.Lock()
+		inFlight[key] = false
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 12 {
+		t.Errorf("visited %d files, want 12", len(counts))
+	}
+	for key, n := range counts {
+		if n != 100 {
+			t.Errorf("%s: visited %d links, want 100", key, n)
+		}
+	}
+
+	stop := errors.New("stop")
+	var calls atomic.Int64
+	err = ProcessReleasesOptions(context.Background(), root, &ProcessOptions{Workers: 4}, func(m *ProjectMeta, release string, l *beacon.Link) error {
+		calls.Add(1)
+		return stop
+	})
+	if err != stop {
+		t.Errorf("got error %v, want %v", err, stop)
+	}
+	if n := calls.Load(); n > 4 {
+		t.Errorf("got %d calls after error, want at most one per worker", n)
+	}
+}
+
+func BenchmarkProcessReleases(b *testing.B) {
+	root := b.TempDir()
+	writeSyntheticReleases(b, root, 4, 8, 20000)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			opts := &ProcessOptions{Workers: workers}
+			for i := 0; i < b.N; i++ {
+				var links atomic.Int64
+				err := ProcessReleasesOptions(context.Background(), root, opts, func(m *ProjectMeta, release string, l *beacon.Link) error {
+					links.Add(1)
+					return nil
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// writeSyntheticReleases writes releases of project zips, each with a
+// single dump of 4-character shortcodes.
+func writeSyntheticReleases(tb testing.TB, root string, releases, projects, links int) {
+	tb.Helper()
+	for r := 0; r < releases; r++ {
+		release := fmt.Sprintf("urlteam_2021-%02d-01", r+1)
+		for p := 0; p < projects; p++ {
+			project := fmt.Sprintf("project%d", p)
+			var dump strings.Builder
+			for i := 0; i < links; i++ {
+				fmt.Fprintf(&dump, "%04x|http://example.com/%d/%d\n", i, r, i)
+			}
+			writeZip(tb, filepath.Join(root, release, project+"."+release+".zip"), []zipEntry{
+				{project + ".meta.json.xz", `{"name":"` + project + `"}`},
+				{"1234.txt.xz", dump.String()},
+			})
+		}
+	}
+}
+
+// writeXZ writes an xz-compressed file.
+func writeXZ(t *testing.T, filename, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filename), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	xw, err := xz.NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := xw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := xw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type zipEntry struct {
+	Name, Content string
+}
+
+// writeZip writes a zip with each non-directory entry compressed with
+// xz.
+func writeZip(t testing.TB, filename string, entries []zipEntry) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filename), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		w, err := zw.Create(e.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Name[len(e.Name)-1] == '/' {
+			continue
+		}
+		xw, err := xz.NewWriter(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := xw.Write([]byte(e.Content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := xw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}